@@ -18,11 +18,34 @@ The commands are:
 
 	apply                 applies a batch spec to create or update a batch
 	                      change
+	cache                 lists, inspects, and prunes the local execution
+	                      cache
+	changesets            lists the changesets of a batch change
+	close                 closes the selected changesets of a batch change
+	comment               comments on the selected changesets of a batch
+	                      change
+	explain               shows what executing a batch spec would do in
+	                      each workspace
+	export                executes a batch spec and writes the changesets
+	                      to patch files, bundles, or local clones
+	functions             lists the functions available in batch spec
+	                      templates
+	hooks                 runs changeset hooks locally
+	lint                  finds mistakes in the templates and steps of a
+	                      batch spec
+	list                  lists batch changes
+	migrate               rewrites a batch spec to the latest version
 	new                   creates a new batch spec YAML file
 	preview               creates a batch spec to be previewed or applied
+	publish               publishes the selected changesets of a batch change
+	reenqueue             retries the selected changesets of a batch change
 	remote                creates server side batch changes
+	report                converts the log of an execution to a JUnit XML
+	                      or HTML report
 	repos,repositories    queries the exact repositories that a batch spec will
 	                      apply to
+	status                shows the state of a batch change and its
+	                      changesets
 	validate              validates a batch spec
 
 Use "src batch [command] -h" for more information about a command.
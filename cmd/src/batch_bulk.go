@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+	"github.com/sourcegraph/src-cli/internal/batches/service"
+	"github.com/sourcegraph/src-cli/internal/cmderrors"
+)
+
+// batchBulkCommand is a command that starts a bulk operation on the selected
+// changesets of a batch change.
+type batchBulkCommand struct {
+	name  string
+	usage string
+	// addFlags registers the flags specific to the command.
+	addFlags func(flagSet *flag.FlagSet)
+	// validate checks the flags specific to the command.
+	validate func() error
+	// run starts the bulk operation.
+	run func(ctx context.Context, svc *service.Service, batchChangeID string, changesetIDs []string) (*graphql.BulkOperation, error)
+}
+
+func init() {
+	var draft bool
+	registerBatchBulkCommand(batchBulkCommand{
+		name: "publish",
+		usage: `
+'src batch publish' publishes the selected changesets of a batch change to
+their code hosts.
+
+Usage:
+
+    src batch publish [command options] NAME
+
+Examples:
+
+    $ src batch publish -state unpublished my-batch-change
+
+    $ src batch publish -all -draft my-batch-change
+
+`,
+		addFlags: func(flagSet *flag.FlagSet) {
+			flagSet.BoolVar(&draft, "draft", false, "Publish the changesets as drafts, on code hosts that support them.")
+		},
+		run: func(ctx context.Context, svc *service.Service, batchChangeID string, changesetIDs []string) (*graphql.BulkOperation, error) {
+			return svc.PublishChangesets(ctx, batchChangeID, changesetIDs, draft)
+		},
+	})
+
+	registerBatchBulkCommand(batchBulkCommand{
+		name: "close",
+		usage: `
+'src batch close' closes the selected changesets of a batch change on their
+code hosts.
+
+Usage:
+
+    src batch close [command options] NAME
+
+Examples:
+
+    $ src batch close -state open -check-state failed my-batch-change
+
+`,
+		run: func(ctx context.Context, svc *service.Service, batchChangeID string, changesetIDs []string) (*graphql.BulkOperation, error) {
+			return svc.CloseChangesets(ctx, batchChangeID, changesetIDs)
+		},
+	})
+
+	registerBatchBulkCommand(batchBulkCommand{
+		name: "reenqueue",
+		usage: `
+'src batch reenqueue' retries publishing or updating the selected changesets
+of a batch change.
+
+Usage:
+
+    src batch reenqueue [command options] NAME
+
+Examples:
+
+    $ src batch reenqueue -state failed my-batch-change
+
+`,
+		run: func(ctx context.Context, svc *service.Service, batchChangeID string, changesetIDs []string) (*graphql.BulkOperation, error) {
+			return svc.ReenqueueChangesets(ctx, batchChangeID, changesetIDs)
+		},
+	})
+
+	var body string
+	registerBatchBulkCommand(batchBulkCommand{
+		name: "comment",
+		usage: `
+'src batch comment' posts a comment on the selected changesets of a batch
+change.
+
+Usage:
+
+    src batch comment [command options] NAME
+
+Examples:
+
+    $ src batch comment -review-state changes-requested -body "Friendly reminder" my-batch-change
+
+`,
+		addFlags: func(flagSet *flag.FlagSet) {
+			flagSet.StringVar(&body, "body", "", "The body of the comment. Required.")
+		},
+		validate: func() error {
+			if body == "" {
+				return cmderrors.Usage("-body is required")
+			}
+			return nil
+		},
+		run: func(ctx context.Context, svc *service.Service, batchChangeID string, changesetIDs []string) (*graphql.BulkOperation, error) {
+			return svc.CreateChangesetComments(ctx, batchChangeID, changesetIDs, body)
+		},
+	})
+}
+
+// registerBatchBulkCommand registers a bulk operation command. The changesets
+// are selected with the changeset selector flags, or -all.
+func registerBatchBulkCommand(bc batchBulkCommand) {
+	flagSet := flag.NewFlagSet(bc.name, flag.ExitOnError)
+	var (
+		flags     = newBatchChangeFlags(flagSet)
+		selectors = newChangesetSelectorFlags(flagSet)
+		allFlag   = flagSet.Bool("all", false, "Select all changesets of the batch change. Required if no other selector is given.")
+		dryRun    = flagSet.Bool("dry-run", false, "List the selected changesets without starting the bulk operation.")
+	)
+	if bc.addFlags != nil {
+		bc.addFlags(flagSet)
+	}
+
+	handler := func(args []string) error {
+		ctx := context.Background()
+
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if selectors.empty() && !*allFlag {
+			return cmderrors.Usage("select changesets with -state, -review-state, -check-state or -search, or all of them with -all")
+		}
+		filter, err := selectors.filter()
+		if err != nil {
+			return err
+		}
+		if bc.validate != nil {
+			if err := bc.validate(); err != nil {
+				return err
+			}
+		}
+
+		svc := service.New(&service.Opts{
+			Client: cfg.apiClient(flags.api, flagSet.Output()),
+		})
+
+		batchChange, ok, err := flags.batchChange(ctx, flagSet, svc)
+		if err != nil || !ok {
+			return err
+		}
+		changesets, err := svc.ListChangesets(ctx, batchChange.ID, filter)
+		if err != nil {
+			return err
+		}
+
+		// Changesets in repositories the user can't access can't be operated
+		// on.
+		var (
+			selected []*graphql.Changeset
+			ids      []string
+		)
+		for _, c := range changesets {
+			if !c.Hidden() {
+				selected = append(selected, c)
+				ids = append(ids, c.ID)
+			}
+		}
+		if len(ids) == 0 {
+			fmt.Println("No changesets selected.")
+			return nil
+		}
+
+		if *dryRun {
+			fmt.Printf("Selected %d changesets:\n\n", len(ids))
+			return printChangesets(os.Stdout, selected)
+		}
+
+		op, err := bc.run(ctx, svc, batchChange.ID, ids)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Started bulk operation %s on %d changesets.\n", op.ID, len(ids))
+		return nil
+	}
+
+	batchCommands = append(batchCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(bc.usage)
+		},
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/sourcegraph/sourcegraph/lib/batches/execution/cache"
+
+	"github.com/sourcegraph/src-cli/internal/batches/executor"
+)
+
+var batchCacheCommands commander
+
+func init() {
+	usage := `'src batch cache' manages the local cache of step results written by
+'src batch preview' and 'src batch apply'.
+
+Usage:
+
+	src batch cache command [command options]
+
+The commands are:
+
+	ls	lists the cached step results
+	inspect	prints a cached step result
+	prune	removes cached step results
+
+Use "src batch cache [command] -h" for more information about a command.
+`
+
+	flagSet := flag.NewFlagSet("cache", flag.ExitOnError)
+	handler := func(args []string) error {
+		batchCacheCommands.run(flagSet, "src batch cache", usage, args)
+		return nil
+	}
+
+	batchCommands = append(batchCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Println(usage)
+		},
+	})
+}
+
+// filterCacheEntriesByRepo returns the entries of the given repository. All
+// entries are returned if repo is empty.
+func filterCacheEntriesByRepo(entries []executor.CacheEntry, repo string) []executor.CacheEntry {
+	if repo == "" {
+		return entries
+	}
+
+	// Entries are grouped by the slug of their repository and commit, and
+	// commits never contain a dash.
+	prefix := cache.SlugForRepo(repo, "")
+	var filtered []executor.CacheEntry
+	for _, entry := range entries {
+		if commit, ok := strings.CutPrefix(entry.Slug, prefix); ok && !strings.Contains(commit, "-") {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	humanize "github.com/dustin/go-humanize"
+
+	"github.com/sourcegraph/sourcegraph/lib/batches/execution"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/src-cli/internal/batches/executor"
+	"github.com/sourcegraph/src-cli/internal/cmderrors"
+)
+
+func init() {
+	usage := `
+'src batch cache inspect' prints the step result with the given key from the
+local execution cache, including its diff and outputs. The keys are listed by
+'src batch cache ls'.
+
+Usage:
+
+    src batch cache inspect [command options] KEY
+
+Examples:
+
+    $ src batch cache inspect RUJXlI8h3Ny7u0PrcEXvIw-step-1
+
+    $ src batch cache inspect -json RUJXlI8h3Ny7u0PrcEXvIw-step-1
+
+`
+
+	flagSet := flag.NewFlagSet("inspect", flag.ExitOnError)
+	var (
+		cacheDir = flagSet.String("cache", batchDefaultCacheDir(), "Directory for caching results and repository archives.")
+		jsonFlag = flagSet.Bool("json", false, "Print the entry and its result as JSON.")
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if flagSet.NArg() != 1 {
+			return cmderrors.Usage("expected exactly one cache key")
+		}
+
+		entry, result, err := executor.ExecutionDiskCache{Dir: *cacheDir}.Entry(flagSet.Arg(0))
+		if err != nil {
+			return err
+		}
+
+		if *jsonFlag {
+			return json.NewEncoder(os.Stdout).Encode(struct {
+				executor.CacheEntry
+				Result execution.AfterStepResult `json:"result"`
+			}{entry, result})
+		}
+
+		return printCacheEntry(os.Stdout, entry, result)
+	}
+
+	batchCacheCommands = append(batchCacheCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch cache %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
+
+func printCacheEntry(w io.Writer, entry executor.CacheEntry, result execution.AfterStepResult) error {
+	fmt.Fprintf(w, "Key:         %s\n", entry.Key)
+	fmt.Fprintf(w, "Repository:  %s\n", entry.Repository)
+	fmt.Fprintf(w, "Commit:      %s\n", entry.Commit)
+	if entry.Path != "" {
+		fmt.Fprintf(w, "Path:        %s\n", entry.Path)
+	}
+	fmt.Fprintf(w, "Step:        %d\n", entry.StepIndex+1)
+	fmt.Fprintf(w, "Batch spec:  %s\n", valueOrDash(entry.BatchSpec))
+	fmt.Fprintf(w, "Size:        %s\n", humanize.Bytes(uint64(entry.Size)))
+	fmt.Fprintf(w, "Modified:    %s (%s)\n", entry.ModTime.Format("2006-01-02 15:04:05"), humanize.Time(entry.ModTime))
+	if result.Skipped {
+		fmt.Fprintln(w, "Skipped:     true")
+	}
+
+	changes := result.ChangedFiles
+	if len(changes.Modified)+len(changes.Added)+len(changes.Deleted)+len(changes.Renamed) > 0 {
+		fmt.Fprintf(w, "\nChanged files:\n")
+		for _, group := range []struct {
+			prefix string
+			files  []string
+		}{{"M", changes.Modified}, {"A", changes.Added}, {"D", changes.Deleted}, {"R", changes.Renamed}} {
+			for _, f := range group.files {
+				fmt.Fprintf(w, "  %s %s\n", group.prefix, f)
+			}
+		}
+	}
+
+	if len(result.Outputs) > 0 {
+		fmt.Fprintf(w, "\nOutputs:\n")
+		names := make([]string, 0, len(result.Outputs))
+		for name := range result.Outputs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value, err := json.Marshal(result.Outputs[name])
+			if err != nil {
+				return errors.Wrapf(err, "formatting output %q", name)
+			}
+			fmt.Fprintf(w, "  %s: %s\n", name, value)
+		}
+	}
+
+	for _, section := range []struct{ title, content string }{
+		{"Standard out", result.Stdout},
+		{"Standard error", result.Stderr},
+		{"Diff", string(result.Diff)},
+	} {
+		if strings.TrimSpace(section.content) == "" {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s:\n%s", section.title, section.content)
+		if !strings.HasSuffix(section.content, "\n") {
+			fmt.Fprintln(w)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	humanize "github.com/dustin/go-humanize"
+
+	"github.com/sourcegraph/src-cli/internal/batches/executor"
+	"github.com/sourcegraph/src-cli/internal/cmderrors"
+)
+
+func init() {
+	usage := `
+'src batch cache ls' lists the step results in the local execution cache,
+grouped by repository and commit.
+
+Usage:
+
+    src batch cache ls [command options]
+
+Examples:
+
+    $ src batch cache ls
+
+    $ src batch cache ls -repo github.com/sourcegraph/src-cli
+
+    $ src batch cache ls -json
+
+`
+
+	flagSet := flag.NewFlagSet("ls", flag.ExitOnError)
+	var (
+		cacheDir = flagSet.String("cache", batchDefaultCacheDir(), "Directory for caching results and repository archives.")
+		repo     = flagSet.String("repo", "", "Only list the results of the repository with this name.")
+		jsonFlag = flagSet.Bool("json", false, "Print the results as a JSON array.")
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if flagSet.NArg() != 0 {
+			return cmderrors.Usage("additional arguments not allowed")
+		}
+
+		entries, err := executor.ExecutionDiskCache{Dir: *cacheDir}.Entries()
+		if err != nil {
+			return err
+		}
+		entries = filterCacheEntriesByRepo(entries, *repo)
+
+		if *jsonFlag {
+			if entries == nil {
+				entries = []executor.CacheEntry{}
+			}
+			return json.NewEncoder(os.Stdout).Encode(entries)
+		}
+
+		if len(entries) == 0 {
+			fmt.Println("No cached step results.")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		var slug string
+		for _, entry := range entries {
+			if entry.Slug != slug {
+				if slug != "" {
+					fmt.Fprintln(w)
+				}
+				slug = entry.Slug
+				fmt.Fprintf(w, "%s@%s\n", entry.Repository, entry.Commit)
+				fmt.Fprintln(w, "  KEY\tSTEP\tSIZE\tAGE\tBATCH SPEC\tPATH")
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\t%s\n",
+				entry.Key,
+				// Steps are 1-indexed in the UI.
+				strconv.Itoa(entry.StepIndex+1),
+				humanize.Bytes(uint64(entry.Size)),
+				humanize.Time(entry.ModTime),
+				valueOrDash(entry.BatchSpec),
+				valueOrDash(entry.Path),
+			)
+		}
+		return w.Flush()
+	}
+
+	batchCacheCommands = append(batchCacheCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch cache %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
+
+func valueOrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/src-cli/internal/batches/executor"
+	"github.com/sourcegraph/src-cli/internal/cmderrors"
+)
+
+func init() {
+	usage := `
+'src batch cache prune' removes step results from the local execution cache.
+Results are removed if they are older than -older-than, if they belong to the
+batch spec given with -f, or, with -max-size, if they are the oldest results
+exceeding the size limit.
+
+With -step-caches, the caches declared with 'caches:' in batch specs are
+removed, too, unless a running execution uses them.
+
+Usage:
+
+    src batch cache prune [command options]
+
+Examples:
+
+    $ src batch cache prune -older-than 720h
+
+    $ src batch cache prune -max-size 1000000000
+
+    $ src batch cache prune -f batch.spec.yaml -dry-run
+
+    $ src batch cache prune -step-caches
+
+`
+
+	flagSet := flag.NewFlagSet("prune", flag.ExitOnError)
+	var (
+		cacheDir  = flagSet.String("cache", batchDefaultCacheDir(), "Directory for caching results and repository archives.")
+		olderThan = flagSet.Duration("older-than", 0, "Remove results that were written longer ago than this duration.")
+		maxSize   = flagSet.Int64("max-size", 0, "Remove the oldest results until the remaining results take up at most this many bytes.")
+		file      = flagSet.String("f", "", "Remove the results of the batch spec in this file.")
+		repo      = flagSet.String("repo", "", "Only remove results of the repository with this name.")
+		steps     = flagSet.Bool("step-caches", false, "Remove the step caches that aren't in use.")
+		dryRun    = flagSet.Bool("dry-run", false, "Print the results that would be removed without removing them.")
+		jsonFlag  = flagSet.Bool("json", false, "Print the removed results as a JSON array. The removed step caches are printed as a separate JSON array.")
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if flagSet.NArg() != 0 {
+			return cmderrors.Usage("additional arguments not allowed")
+		}
+		pruneResults := *olderThan > 0 || *maxSize > 0 || *file != ""
+		if !pruneResults && !*steps {
+			return cmderrors.Usage("one of -older-than, -max-size, -f, or -step-caches is required")
+		}
+
+		if pruneResults {
+			if err := pruneCachedResults(*cacheDir, *olderThan, *maxSize, *file, *repo, *dryRun, *jsonFlag); err != nil {
+				return err
+			}
+		}
+		if *steps {
+			return pruneStepCaches(*cacheDir, *dryRun, *jsonFlag)
+		}
+		return nil
+	}
+
+	batchCacheCommands = append(batchCacheCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch cache %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
+
+// pruneCachedResults removes the cached step results selected by the flags.
+func pruneCachedResults(cacheDir string, olderThan time.Duration, maxSize int64, file, repo string, dryRun, jsonOut bool) error {
+	opts := executor.CachePruneOpts{
+		OlderThan: olderThan,
+		MaxSize:   maxSize,
+		Now:       time.Now(),
+	}
+	if file != "" {
+		name, err := readBatchSpecName(file)
+		if err != nil {
+			return err
+		}
+		opts.BatchSpec = name
+	}
+
+	c := executor.ExecutionDiskCache{Dir: cacheDir}
+	entries, err := c.Entries()
+	if err != nil {
+		return err
+	}
+	pruned := executor.SelectCacheEntriesToPrune(filterCacheEntriesByRepo(entries, repo), opts)
+
+	if !dryRun {
+		for _, entry := range pruned {
+			if err := c.Remove(entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	if jsonOut {
+		if pruned == nil {
+			pruned = []executor.CacheEntry{}
+		}
+		return json.NewEncoder(os.Stdout).Encode(pruned)
+	}
+
+	var size int64
+	for _, entry := range pruned {
+		size += entry.Size
+		fmt.Printf("%s\t%s@%s step %d\n", entry.Key, entry.Repository, entry.Commit, entry.StepIndex+1)
+	}
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("%s %d cached step results (%s).\n", verb, len(pruned), humanize.Bytes(uint64(size)))
+	return nil
+}
+
+// pruneStepCaches removes the step caches that aren't in use.
+func pruneStepCaches(cacheDir string, dryRun, jsonOut bool) error {
+	c := executor.StepCaches{Dir: filepath.Join(cacheDir, executor.StepCachesDir)}
+	caches, err := c.List()
+	if err != nil {
+		return err
+	}
+
+	removed := []executor.StepCacheInfo{}
+	for _, cache := range caches {
+		if cache.InUse {
+			continue
+		}
+		if !dryRun {
+			ok, err := c.Remove(cache.Name)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				// Started being used in the meantime.
+				continue
+			}
+		}
+		removed = append(removed, cache)
+	}
+
+	if jsonOut {
+		return json.NewEncoder(os.Stdout).Encode(removed)
+	}
+
+	var size int64
+	for _, cache := range removed {
+		size += cache.Size
+		fmt.Printf("%s\t%d slots\t%s\n", cache.Name, cache.Slots, humanize.Bytes(uint64(cache.Size)))
+	}
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("%s %d step caches (%s).\n", verb, len(removed), humanize.Bytes(uint64(size)))
+	return nil
+}
+
+// readBatchSpecName returns the name of the batch spec in the given file.
+func readBatchSpecName(file string) (string, error) {
+	f, err := batchOpenFileFlag(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return "", errors.Wrap(err, "reading batch spec")
+	}
+
+	dir, err := getBatchSpecDirectory(file)
+	if err != nil {
+		return "", err
+	}
+	spec, _, err := batcheslib.ParseBatchSpecWithIncludes(file, dir, data)
+	if err != nil {
+		return "", errors.Wrap(err, "parsing batch spec")
+	}
+	return spec.Name, nil
+}
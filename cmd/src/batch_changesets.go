@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+	"github.com/sourcegraph/src-cli/internal/batches/service"
+	"github.com/sourcegraph/src-cli/internal/cmderrors"
+)
+
+var (
+	batchChangeStates     = []string{"OPEN", "CLOSED", "DRAFT"}
+	changesetStates       = []string{"UNPUBLISHED", "SCHEDULED", "PROCESSING", "OPEN", "DRAFT", "CLOSED", "MERGED", "READONLY", "DELETED", "RETRYING", "FAILED"}
+	changesetReviewStates = []string{"APPROVED", "CHANGES_REQUESTED", "PENDING", "COMMENTED", "DISMISSED"}
+	changesetCheckStates  = []string{"PENDING", "PASSED", "FAILED"}
+)
+
+// batchChangeFlags are the flags of the commands that manage an existing
+// batch change, which is given by its name and namespace.
+type batchChangeFlags struct {
+	api       *api.Flags
+	namespace string
+}
+
+func newBatchChangeFlags(flagSet *flag.FlagSet) *batchChangeFlags {
+	bcf := &batchChangeFlags{
+		api: api.NewFlags(flagSet),
+	}
+	flagSet.StringVar(
+		&bcf.namespace, "namespace", "",
+		"The user or organization namespace of the batch change. Default is the currently authenticated user.",
+	)
+	flagSet.StringVar(&bcf.namespace, "n", "", "Alias for -namespace.")
+	return bcf
+}
+
+// batchChange returns the batch change named by the only argument of the
+// command. ok is false if only the curl command of the request was printed,
+// because of -get-curl, in which case the command has nothing left to do.
+func (bcf *batchChangeFlags) batchChange(ctx context.Context, flagSet *flag.FlagSet, svc *service.Service) (_ *graphql.BatchChange, ok bool, err error) {
+	if flagSet.NArg() != 1 {
+		return nil, false, cmderrors.Usage("expected the name of a batch change")
+	}
+	namespace, err := svc.ResolveNamespace(ctx, bcf.namespace)
+	if err != nil || bcf.api.GetCurl() {
+		// The other requests depend on the namespace, so only its curl
+		// command is printed.
+		return nil, false, err
+	}
+	batchChange, err := svc.GetBatchChange(ctx, namespace.ID, flagSet.Arg(0))
+	if err != nil {
+		return nil, false, err
+	}
+	return batchChange, true, nil
+}
+
+// changesetSelectorFlags select changesets of a batch change by their state.
+type changesetSelectorFlags struct {
+	state       string
+	reviewState string
+	checkState  string
+	search      string
+}
+
+func newChangesetSelectorFlags(flagSet *flag.FlagSet) *changesetSelectorFlags {
+	csf := &changesetSelectorFlags{}
+	flagSet.StringVar(&csf.state, "state", "", "Only select changesets in this state: "+enumUsage(changesetStates)+".")
+	flagSet.StringVar(&csf.reviewState, "review-state", "", "Only select changesets in this review state: "+enumUsage(changesetReviewStates)+".")
+	flagSet.StringVar(&csf.checkState, "check-state", "", "Only select changesets in this CI state: "+enumUsage(changesetCheckStates)+".")
+	flagSet.StringVar(&csf.search, "search", "", "Only select changesets whose title or repository name matches this search.")
+	return csf
+}
+
+func (csf *changesetSelectorFlags) empty() bool {
+	return csf.state == "" && csf.reviewState == "" && csf.checkState == "" && csf.search == ""
+}
+
+func (csf *changesetSelectorFlags) filter() (service.ChangesetFilter, error) {
+	var (
+		filter = service.ChangesetFilter{Search: csf.search}
+		err    error
+	)
+	if filter.State, err = parseEnumFlag("state", csf.state, changesetStates); err != nil {
+		return filter, err
+	}
+	if filter.ReviewState, err = parseEnumFlag("review-state", csf.reviewState, changesetReviewStates); err != nil {
+		return filter, err
+	}
+	if filter.CheckState, err = parseEnumFlag("check-state", csf.checkState, changesetCheckStates); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// parseEnumFlag returns the GraphQL enum value of a flag, which can be given
+// in lower case and with dashes, e.g. "changes-requested".
+func parseEnumFlag(name, value string, valid []string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	enum := strings.ToUpper(strings.ReplaceAll(value, "-", "_"))
+	if !slices.Contains(valid, enum) {
+		return "", cmderrors.Usagef("invalid -%s %q, expected one of: %s", name, value, enumUsage(valid))
+	}
+	return enum, nil
+}
+
+func enumUsage(valid []string) string {
+	values := make([]string, len(valid))
+	for i, v := range valid {
+		values[i] = strings.ToLower(strings.ReplaceAll(v, "_", "-"))
+	}
+	return strings.Join(values, ", ")
+}
+
+func printChangesets(w io.Writer, changesets []*graphql.Changeset) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATE\tCI\tREVIEW\tREPOSITORY\tTITLE\tURL")
+	for _, c := range changesets {
+		if c.Hidden() {
+			fmt.Fprintf(tw, "%s\t-\t-\t(hidden)\t-\t-\n", c.State)
+			continue
+		}
+		var repo, url string
+		if c.Repository != nil {
+			repo = c.Repository.Name
+		}
+		if c.ExternalURL != nil {
+			url = c.ExternalURL.URL
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			c.State,
+			valueOrDash(c.CheckState),
+			valueOrDash(c.ReviewState),
+			valueOrDash(repo),
+			valueOrDash(c.Title),
+			valueOrDash(url),
+		)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	usage := `
+'src batch changesets' lists the changesets of a batch change.
+
+Usage:
+
+    src batch changesets [command options] NAME
+
+Examples:
+
+    $ src batch changesets my-batch-change
+
+    $ src batch changesets -state open -check-state failed my-batch-change
+
+    $ src batch changesets -namespace my-org -json my-batch-change
+
+`
+
+	flagSet := flag.NewFlagSet("changesets", flag.ExitOnError)
+	var (
+		flags     = newBatchChangeFlags(flagSet)
+		selectors = newChangesetSelectorFlags(flagSet)
+		jsonFlag  = flagSet.Bool("json", false, "Print the changesets as a JSON array.")
+	)
+
+	handler := func(args []string) error {
+		ctx := context.Background()
+
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		filter, err := selectors.filter()
+		if err != nil {
+			return err
+		}
+
+		svc := service.New(&service.Opts{
+			Client: cfg.apiClient(flags.api, flagSet.Output()),
+		})
+
+		batchChange, ok, err := flags.batchChange(ctx, flagSet, svc)
+		if err != nil || !ok {
+			return err
+		}
+		changesets, err := svc.ListChangesets(ctx, batchChange.ID, filter)
+		if err != nil {
+			return err
+		}
+
+		if *jsonFlag {
+			if changesets == nil {
+				changesets = []*graphql.Changeset{}
+			}
+			return json.NewEncoder(os.Stdout).Encode(changesets)
+		}
+
+		if len(changesets) == 0 {
+			fmt.Println("No changesets.")
+			return nil
+		}
+		return printChangesets(os.Stdout, changesets)
+	}
+
+	batchCommands = append(batchCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
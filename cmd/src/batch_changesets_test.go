@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/batches/service"
+)
+
+func TestBatchChangeFlags_GetCurl(t *testing.T) {
+	flagSet := flag.NewFlagSet("status", flag.ContinueOnError)
+	flags := newBatchChangeFlags(flagSet)
+	if err := flagSet.Parse([]string{"-get-curl", "-n", "sourcegraph", "my-batch-change"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	client := api.NewClient(api.ClientOpts{
+		EndpointURL:       &url.URL{Scheme: "https", Host: "sourcegraph.test"},
+		AdditionalHeaders: map[string]string{},
+		Flags:             flags.api,
+		Out:               &out,
+	})
+	svc := service.New(&service.Opts{Client: client})
+
+	batchChange, ok, err := flags.batchChange(context.Background(), flagSet, svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok || batchChange != nil {
+		t.Fatalf("expected no batch change with -get-curl, got ok=%t, batchChange=%v", ok, batchChange)
+	}
+	// Only the curl command of the namespace request is printed.
+	if have := strings.Count(out.String(), "curl "); have != 1 {
+		t.Fatalf("wrong number of curl commands. want=1, have=%d:\n%s", have, out.String())
+	}
+}
@@ -12,11 +12,13 @@ import (
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/mattn/go-isatty"
+	yamlv3 "gopkg.in/yaml.v3"
 
 	"github.com/sourcegraph/sourcegraph/lib/errors"
 	"github.com/sourcegraph/sourcegraph/lib/output"
@@ -28,8 +30,10 @@ import (
 	"github.com/sourcegraph/src-cli/internal/batches"
 	"github.com/sourcegraph/src-cli/internal/batches/docker"
 	"github.com/sourcegraph/src-cli/internal/batches/executor"
+	"github.com/sourcegraph/src-cli/internal/batches/export"
 	"github.com/sourcegraph/src-cli/internal/batches/graphql"
 	"github.com/sourcegraph/src-cli/internal/batches/log"
+	"github.com/sourcegraph/src-cli/internal/batches/report"
 	"github.com/sourcegraph/src-cli/internal/batches/repozip"
 	"github.com/sourcegraph/src-cli/internal/batches/service"
 	"github.com/sourcegraph/src-cli/internal/batches/ui"
@@ -50,11 +54,13 @@ type batchExecutionFlags struct {
 	clearCache       bool
 	namespace        string
 	skipErrors       bool
+	vars             *batchVariablesFlags
 }
 
 func newBatchExecutionFlags(flagSet *flag.FlagSet) *batchExecutionFlags {
 	bef := &batchExecutionFlags{
-		api: api.NewFlags(flagSet),
+		api:  api.NewFlags(flagSet),
+		vars: newBatchVariablesFlags(flagSet),
 	}
 
 	flagSet.BoolVar(
@@ -82,12 +88,85 @@ func newBatchExecutionFlags(flagSet *flag.FlagSet) *batchExecutionFlags {
 	return bef
 }
 
+// batchVariablesFlags set the values of the variables declared by a batch
+// spec.
+type batchVariablesFlags struct {
+	vars    batchVarFlag
+	varFile string
+}
+
+func newBatchVariablesFlags(flagSet *flag.FlagSet) *batchVariablesFlags {
+	bvf := &batchVariablesFlags{vars: batchVarFlag{}}
+	flagSet.Var(
+		bvf.vars, "var",
+		"Set a variable of the batch spec, as name=value. Can be given multiple times.",
+	)
+	flagSet.StringVar(
+		&bvf.varFile, "var-file", "",
+		"A YAML file that maps the names of variables of the batch spec to their values. Values given with -var take precedence.",
+	)
+	return bvf
+}
+
+// values returns the values of the variables given with -var-file and -var.
+func (bvf *batchVariablesFlags) values() (map[string]string, error) {
+	values := map[string]string{}
+	if bvf.varFile != "" {
+		data, err := os.ReadFile(bvf.varFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading variables file")
+		}
+		var file map[string]yamlv3.Node
+		if err := yamlv3.Unmarshal(data, &file); err != nil {
+			return nil, errors.Wrapf(err, "parsing variables file %s", bvf.varFile)
+		}
+		for name, n := range file {
+			// The text of the value is used, so that the value is converted
+			// to the type of the variable, and not guessed by YAML.
+			if n.Kind != yamlv3.ScalarNode {
+				return nil, errors.Newf("%s:%d: the value of variable %q must be a string, number or boolean", bvf.varFile, n.Line, name)
+			}
+			values[name] = n.Value
+		}
+	}
+	for name, value := range bvf.vars {
+		values[name] = value
+	}
+	return values, nil
+}
+
+// batchVarFlag collects the name=value pairs given with -var.
+type batchVarFlag map[string]string
+
+func (f batchVarFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for name, value := range f {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
+
+func (f batchVarFlag) Set(v string) error {
+	name, value, ok := strings.Cut(v, "=")
+	if !ok || name == "" {
+		return errors.Newf("invalid variable %q, must be name=value", v)
+	}
+	f[name] = value
+	return nil
+}
+
 // batchExecuteFlags are used when executing batch changes locally.
 type batchExecuteFlags struct {
 	*batchExecutionFlags
 
 	apply         bool
 	cacheDir      string
+	cacheURL      string
+	cacheMaxSize  int64
+	clearShared   bool
+	artifactsDir  string
+	report        string
 	tempDir       string
 	file          string
 	keepLogs      bool
@@ -97,6 +176,21 @@ type batchExecuteFlags struct {
 	cleanArchives bool
 	skipErrors    bool
 	runAsRoot     bool
+	runtime       string
+	hostImages    string
+	resume        bool
+	retryFailed   string
+	// retryFailedAllowChangedSpec allows -retry-failed to retry an
+	// execution of a different version of the batch spec.
+	retryFailedAllowChangedSpec bool
+
+	// workspaceMirrors is the directory containing local git mirrors of the
+	// repositories used by -workspace worktree.
+	workspaceMirrors string
+
+	// codingAgentCommand is the binary run by codingAgent steps of type
+	// "command".
+	codingAgentCommand string
 
 	// If true, fail fast on first error instead of continuing execution
 	failFast bool
@@ -130,6 +224,46 @@ func newBatchExecuteFlags(flagSet *flag.FlagSet, cacheDir, tempDir string) *batc
 		"Directory for caching results and repository archives.",
 	)
 
+	flagSet.StringVar(
+		&caf.cacheURL, "cache-url", "",
+		"URL of a shared cache for step results, in addition to the local cache. Results are read from and written to it with HTTP GET and PUT requests. Credentials can be given in the URL. file:// URLs use a shared directory instead.",
+	)
+
+	flagSet.Int64Var(
+		&caf.cacheMaxSize, "cache-max-size", 100<<20,
+		"Maximum size in bytes of a single step result in the shared cache given with -cache-url. Larger results are only cached locally. 0 means no limit.",
+	)
+
+	flagSet.BoolVar(
+		&caf.clearShared, "clear-shared-cache", false,
+		"If true, -clear-cache also removes the results from the shared cache given with -cache-url, for everyone using it. Otherwise, -clear-cache only clears the local cache.",
+	)
+
+	flagSet.StringVar(
+		&caf.artifactsDir, "artifacts-dir", "",
+		"Directory the artifacts collected by steps are written to, in <repository>/<workspace>/step-<n> subdirectories. If not set, artifacts are only listed in the step results and stored in the -cache directory.",
+	)
+
+	flagSet.StringVar(
+		&caf.report, "report", "",
+		"Write a report of the execution with a test case for every workspace to this file: JUnit XML if it ends in .xml, or HTML if it ends in .html. Workspaces with changeset specs link to the preview of the batch spec, which lists all changeset specs, not to their own changeset specs. 'src batch report' converts the output of -text-only instead.",
+	)
+
+	flagSet.BoolVar(
+		&caf.resume, "resume", false,
+		"If true, resumes the last interrupted execution of the same batch spec, reusing its resolved workspaces, finished tasks and uploaded changeset specs. Interrupted executions are kept in the -cache directory for 24 hours.",
+	)
+
+	flagSet.StringVar(
+		&caf.retryFailed, "retry-failed", "",
+		"Retry only the failed workspaces of a previous execution, given by its run ID or a JUnit XML report written with -report. Its resolved workspaces and the changeset specs of its successful workspaces are reused. Executions with failed workspaces are kept in the -cache directory for 24 hours.",
+	)
+
+	flagSet.BoolVar(
+		&caf.retryFailedAllowChangedSpec, "retry-failed-allow-changed-spec", false,
+		"If true, -retry-failed retries executions of a different version of the batch spec, too. The changeset specs of their successful workspaces, built by the previous version, are reused, and their workspaces are resolved again if 'on' or 'workspaces' changed.",
+	)
+
 	flagSet.StringVar(
 		&caf.tempDir, "tmp", tempDir,
 		"Directory for storing temporary data, such as log files. Default is /tmp. Can also be set with environment variable SRC_BATCH_TMP_DIR; if both are set, this flag will be used and not the environment variable.",
@@ -147,7 +281,7 @@ func newBatchExecuteFlags(flagSet *flag.FlagSet, cacheDir, tempDir string) *batc
 
 	flagSet.DurationVar(
 		&caf.timeout, "timeout", 60*time.Minute,
-		"The maximum duration a single batch spec step can take.",
+		"The maximum duration a single batch spec step can take. Steps with a timeout in the batch spec are limited by it instead.",
 	)
 
 	flagSet.BoolVar(
@@ -157,7 +291,17 @@ func newBatchExecuteFlags(flagSet *flag.FlagSet, cacheDir, tempDir string) *batc
 
 	flagSet.StringVar(
 		&caf.workspace, "workspace", "auto",
-		`Workspace mode to use ("auto", "bind", or "volume")`,
+		`Workspace mode to use ("auto", "bind", "volume", "host", or "worktree"). "host" runs the steps directly on the host instead of in containers. "worktree" creates the workspaces as git worktrees of local mirrors, see -workspace-mirrors.`,
+	)
+
+	flagSet.StringVar(
+		&caf.workspaceMirrors, "workspace-mirrors", "",
+		`Directory containing local git mirrors of the repositories, at <dir>/<repository name>, used by -workspace worktree. Repositories without a mirror containing the revision are downloaded and shared by all of their workspaces.`,
+	)
+
+	flagSet.StringVar(
+		&caf.hostImages, "host-images", "",
+		`Comma-separated list of the images whose steps may run on the host with -workspace host. Steps with other images fail. If empty, the images of all steps are ignored.`,
 	)
 
 	flagSet.BoolVar(verbose, "v", false, "print verbose output")
@@ -167,6 +311,16 @@ func newBatchExecuteFlags(flagSet *flag.FlagSet, cacheDir, tempDir string) *batc
 		"If true, forces all step containers to run as root.",
 	)
 
+	flagSet.StringVar(
+		&caf.runtime, "runtime", docker.RuntimeAuto,
+		`Container runtime to run steps with ("auto", "docker", or "podman"). "auto" uses Docker if it is available and Podman otherwise.`,
+	)
+
+	flagSet.StringVar(
+		&caf.codingAgentCommand, "coding-agent-command", "",
+		`Path to the binary that is run inside the step container by codingAgent steps of type "command". The binary is invoked with the rendered prompt as its only argument.`,
+	)
+
 	flagSet.BoolVar(
 		&caf.failFast, "fail-fast", false,
 		"Halts execution immediately upon first error instead of continuing with other tasks.",
@@ -261,12 +415,20 @@ type executeBatchSpecOpts struct {
 	applyBatchSpec bool
 	file           string
 
+	// export, if set, exports the changesets to disk instead of uploading
+	// them to Sourcegraph.
+	export *export.Opts
+	// localRepos, if set, is the directory containing the git repositories
+	// the batch spec is executed against, instead of the repositories on the
+	// Sourcegraph instance. Requires export.
+	localRepos string
+
 	client api.Client
 }
 
-func createDockerWatchdog(ctx context.Context, execUI ui.ExecUI) *watchdog.WatchDog {
+func createDockerWatchdog(ctx context.Context, rt docker.ContainerRuntime, execUI ui.ExecUI) *watchdog.WatchDog {
 	return watchdog.New(dockerWatchDuration, func() {
-		_, err := docker.NCPU(ctx)
+		_, err := rt.NCPU(ctx)
 		if err != nil {
 			execUI.DockerWatchDogWarning(errors.Wrap(err, "docker watchdog"))
 		}
@@ -285,7 +447,20 @@ func executeBatchSpec(ctx context.Context, opts executeBatchSpecOpts) (err error
 		execUI = &ui.TUI{Out: out}
 	}
 
-	w := createDockerWatchdog(ctx, execUI)
+	// Flags that don't fit together are reported before anything is
+	// executed.
+	if err := checkBatchExecuteFlags(opts.flags); err != nil {
+		execUI.ExecutionError(err)
+		return err
+	}
+
+	rt, err := newBatchRuntime(ctx, opts.flags.runtime, opts.flags.workspace, opts.flags.hostImages)
+	if err != nil {
+		execUI.ExecutionError(err)
+		return err
+	}
+
+	w := createDockerWatchdog(ctx, rt, execUI)
 	go w.Start()
 
 	defer func() {
@@ -299,9 +474,20 @@ func executeBatchSpec(ctx context.Context, opts executeBatchSpecOpts) (err error
 		Client: opts.client,
 	})
 
-	lr, ffs, err := svc.DetermineLicenseAndFeatureFlags(ctx, opts.flags.skipErrors)
-	if err != nil {
-		return err
+	var (
+		lr  *batches.LicenseRestrictions
+		ffs *batches.FeatureFlags
+	)
+	if opts.localRepos != "" {
+		// Without a Sourcegraph instance, there are no restrictions and the
+		// features of the latest version can be used.
+		lr = &batches.LicenseRestrictions{}
+		ffs = &batches.FeatureFlags{Sourcegraph40: true, BinaryDiffs: true, Sourcegraph70: true}
+	} else {
+		lr, ffs, err = svc.DetermineLicenseAndFeatureFlags(ctx, opts.flags.skipErrors)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Once we know about feature flags, reconfigure the UI if needed.
@@ -309,7 +495,29 @@ func executeBatchSpec(ctx context.Context, opts executeBatchSpecOpts) (err error
 		execUI = &ui.JSONLines{BinaryDiffs: true}
 	}
 
-	imageCache := docker.NewImageCache()
+	// The report is built from the same events as the JSON lines UI. It
+	// records the ID of the run, once known, so that it can be given to
+	// -retry-failed.
+	var runID string
+	if opts.flags.report != "" {
+		rec := report.NewRecorder()
+		execUI = &ui.Tee{
+			Primary:   execUI,
+			Secondary: &ui.JSONLines{BinaryDiffs: ffs.BinaryDiffs, Log: rec.Record},
+		}
+		defer func() {
+			r := rec.Report()
+			r.RunID = runID
+			if err != nil && r.Error == "" {
+				r.Error = err.Error()
+			}
+			if reportErr := report.Write(opts.flags.report, r); reportErr != nil {
+				err = errors.Append(err, reportErr)
+			}
+		}()
+	}
+
+	imageCache := docker.NewImageCache(rt)
 
 	if err := validateSourcegraphVersionConstraint(ffs); err != nil {
 		if !opts.flags.skipErrors {
@@ -325,12 +533,12 @@ func executeBatchSpec(ctx context.Context, opts executeBatchSpecOpts) (err error
 
 	// In the past, we relied on `getBatchParallelism` to ascertain if docker is running,
 	// however, we don't always check for the number of CPUs (especially when the -j parallelis)
-	// flag is passed. This is a more explicit check to confirm docker is working.
-	if err := docker.CheckVersion(ctx); err != nil {
+	// flag is passed. This is a more explicit check to confirm the runtime is working.
+	if err := rt.CheckVersion(ctx); err != nil {
 		return err
 	}
 
-	parallelism, err := getBatchParallelism(ctx, opts.flags.parallelism)
+	parallelism, err := getBatchParallelism(ctx, rt, opts.flags.parallelism)
 	if err != nil {
 		return err
 	}
@@ -344,7 +552,7 @@ func executeBatchSpec(ctx context.Context, opts executeBatchSpecOpts) (err error
 	// desktop-linux, we'll just assume the user has the default /home mount
 	// available and go from there.
 	if runtime.GOOS == "linux" && opts.flags.tempDir == batchDefaultTempDirPrefix() {
-		context, err := docker.CurrentContext(ctx)
+		context, err := rt.CurrentContext(ctx)
 		if err != nil {
 			return err
 		}
@@ -359,7 +567,7 @@ func executeBatchSpec(ctx context.Context, opts executeBatchSpecOpts) (err error
 
 	// Parse flags and build up our service and executor options.
 	execUI.ParsingBatchSpec()
-	batchSpec, batchSpecDir, rawSpec, err := parseBatchSpec(ctx, opts.file, svc)
+	batchSpec, batchSpecDir, rawSpec, err := parseBatchSpec(ctx, opts.file, opts.flags.vars, svc)
 	if err != nil {
 		var multiErr errors.MultiError
 		if errors.As(err, &multiErr) {
@@ -373,16 +581,39 @@ func executeBatchSpec(ctx context.Context, opts executeBatchSpecOpts) (err error
 	}
 	execUI.ParsingBatchSpecSuccess()
 
-	if batchSpec.Version == 3 {
-		return errors.New("batch spec version 3 is not supported for local execution, please run server-side")
+	var (
+		namespace  service.Namespace
+		localRepos service.LocalRepos
+		endpoint   = cfg.endpointURL.String()
+	)
+	if opts.localRepos != "" {
+		if len(batchSpec.ImportChangesets) > 0 {
+			return errors.New("importChangesets can't be used with local repositories")
+		}
+		localRepos, err = service.FindLocalRepos(opts.localRepos)
+		if err != nil {
+			return err
+		}
+		if endpoint, err = filepath.Abs(opts.localRepos); err != nil {
+			return errors.Wrap(err, "local repositories path")
+		}
+	} else {
+		execUI.ResolvingNamespace()
+		namespace, err = svc.ResolveNamespace(ctx, opts.flags.namespace)
+		if err != nil {
+			return err
+		}
+		execUI.ResolvingNamespaceSuccess(namespace.ID)
 	}
 
-	execUI.ResolvingNamespace()
-	namespace, err := svc.ResolveNamespace(ctx, opts.flags.namespace)
+	// The run state is keyed on the ID of the resolved namespace rather than
+	// on -namespace, which can name the same namespace in different ways and
+	// defaults to the user the access token belongs to.
+	runState, err := openBatchRunState(opts.flags, endpoint, namespace.ID, batchSpecDir, rawSpec, batchSpec)
 	if err != nil {
 		return err
 	}
-	execUI.ResolvingNamespaceSuccess(namespace.ID)
+	runID = runState.ID()
 
 	var workspaceCreator workspace.Creator
 
@@ -402,7 +633,13 @@ func executeBatchSpec(ctx context.Context, opts executeBatchSpecOpts) (err error
 
 		execUI.DeterminingWorkspaceCreatorType()
 		var typ workspace.CreatorType
-		workspaceCreator, typ = workspace.NewCreator(ctx, opts.flags.workspace, opts.flags.cacheDir, opts.flags.tempDir, images)
+		workspaceCreator, typ = workspace.NewCreator(ctx, rt, opts.flags.workspace, opts.flags.cacheDir, opts.flags.tempDir, images)
+		if typ == workspace.CreatorTypeWorktree {
+			workspaceCreator = workspace.NewWorktreeCreator(opts.flags.cacheDir, workspaceMirrors(opts.flags.workspaceMirrors, localRepos))
+		}
+		if closer, ok := workspaceCreator.(io.Closer); ok {
+			defer closer.Close()
+		}
 		if typ == workspace.CreatorTypeVolume {
 			// This creator type requires an additional image, so let's ensure it exists.
 			_, err = imageCache.Ensure(ctx, workspace.DockerVolumeWorkspaceImage)
@@ -414,20 +651,51 @@ func executeBatchSpec(ctx context.Context, opts executeBatchSpecOpts) (err error
 	}
 
 	execUI.DeterminingWorkspaces()
-	workspaces, repos, err := svc.ResolveWorkspacesForBatchSpec(ctx, batchSpec, opts.flags.allowUnsupported, opts.flags.allowIgnored)
-	if err != nil {
-		if repoSet, ok := err.(batches.UnsupportedRepoSet); ok {
-			execUI.DeterminingWorkspacesSuccess(len(workspaces), len(repos), repoSet, nil)
-		} else if repoSet, ok := err.(batches.IgnoredRepoSet); ok {
-			execUI.DeterminingWorkspacesSuccess(len(workspaces), len(repos), nil, repoSet)
+	// A resumed execution reuses the workspaces it resolved, so that it builds
+	// the same tasks even if the matched repositories changed in the
+	// meantime.
+	workspaces, repos, resumed := runState.Workspaces()
+	if resumed {
+		execUI.DeterminingWorkspacesSuccess(len(workspaces), len(repos), nil, nil)
+	} else {
+		if localRepos != nil {
+			workspaces, repos, err = svc.ResolveLocalWorkspacesForBatchSpec(ctx, batchSpec, localRepos)
 		} else {
-			return errors.Wrap(err, "resolving repositories")
+			workspaces, repos, err = svc.ResolveWorkspacesForBatchSpec(ctx, batchSpec, opts.flags.allowUnsupported, opts.flags.allowIgnored)
+		}
+		if err != nil {
+			if repoSet, ok := err.(batches.UnsupportedRepoSet); ok {
+				execUI.DeterminingWorkspacesSuccess(len(workspaces), len(repos), repoSet, nil)
+			} else if repoSet, ok := err.(batches.IgnoredRepoSet); ok {
+				execUI.DeterminingWorkspacesSuccess(len(workspaces), len(repos), nil, repoSet)
+			} else {
+				return errors.Wrap(err, "resolving repositories")
+			}
+		} else {
+			execUI.DeterminingWorkspacesSuccess(len(workspaces), len(repos), nil, nil)
+		}
+		if err := runState.SetWorkspaces(workspaces, repos); err != nil {
+			return err
+		}
+	}
+
+	executionCache := executor.NewDiskCache(opts.flags.cacheDir)
+	if opts.flags.cacheURL != "" {
+		executionCache, err = executor.NewRemoteCache(executionCache, executor.RemoteCacheOpts{
+			URL:         opts.flags.cacheURL,
+			MaxSize:     opts.flags.cacheMaxSize,
+			ClearShared: opts.flags.clearShared,
+			Warn:        func(err error) { cliLog.Printf("WARNING: %s", err) },
+		})
+		if err != nil {
+			return err
 		}
-	} else {
-		execUI.DeterminingWorkspacesSuccess(len(workspaces), len(repos), nil, nil)
 	}
 
 	archiveRegistry := repozip.NewArchiveRegistry(opts.client, opts.flags.cacheDir, opts.flags.cleanArchives)
+	if localRepos != nil {
+		archiveRegistry = repozip.NewLocalArchiveRegistry(localRepos, opts.flags.tempDir)
+	}
 	logManager := log.NewDiskManager(opts.flags.tempDir, opts.flags.keepLogs)
 	coord := executor.NewCoordinator(
 		executor.NewCoordinatorOpts{
@@ -435,7 +703,9 @@ func executeBatchSpec(ctx context.Context, opts executeBatchSpecOpts) (err error
 				Logger:              logManager,
 				RepoArchiveRegistry: archiveRegistry,
 				Creator:             workspaceCreator,
+				Runtime:             rt,
 				EnsureImage:         imageCache.Ensure,
+				BuildImage:          imageCache.Build,
 				Parallelism:         parallelism,
 				WorkingDirectory:    batchSpecDir,
 				Timeout:             opts.flags.timeout,
@@ -443,10 +713,18 @@ func executeBatchSpec(ctx context.Context, opts executeBatchSpecOpts) (err error
 				GlobalEnv:           os.Environ(),
 				ForceRoot:           opts.flags.runAsRoot,
 				FailFast:            opts.flags.failFast,
+				Host:                opts.flags.workspace == "host",
 				BinaryDiffs:         ffs.BinaryDiffs,
+				AgentRunners: map[string]executor.AgentRunner{
+					executor.AgentTypeCommand: &executor.CommandAgentRunner{Binary: opts.flags.codingAgentCommand},
+				},
+				StepCaches:    &executor.StepCaches{Dir: filepath.Join(opts.flags.cacheDir, executor.StepCachesDir)},
+				ArtifactsDir:  opts.flags.artifactsDir,
+				ArtifactStore: &executor.ArtifactStore{Dir: filepath.Join(opts.flags.cacheDir, executor.ArtifactStoreDir)},
 			},
 			Logger:      logManager,
-			Cache:       executor.NewDiskCache(opts.flags.cacheDir),
+			Cache:       executionCache,
+			Journal:     runState,
 			BinaryDiffs: ffs.BinaryDiffs,
 			GlobalEnv:   os.Environ(),
 		},
@@ -461,8 +739,11 @@ func executeBatchSpec(ctx context.Context, opts executeBatchSpecOpts) (err error
 		batchSpec.Steps,
 		workspaces,
 	)
+	// Tasks that finished in an interrupted execution, or successfully in the
+	// execution whose failed tasks are retried, aren't run again.
+	tasks, specs := runState.SkipFinishedTasks(tasks)
 	var (
-		specs         []*batcheslib.ChangesetSpec
+		cachedSpecs   []*batcheslib.ChangesetSpec
 		uncachedTasks []*executor.Task
 	)
 	if opts.flags.clearCache {
@@ -472,17 +753,24 @@ func executeBatchSpec(ctx context.Context, opts executeBatchSpecOpts) (err error
 		uncachedTasks = tasks
 	} else {
 		// Check the cache for completely cached executions.
-		uncachedTasks, specs, err = coord.CheckCache(ctx, batchSpec, tasks)
+		uncachedTasks, cachedSpecs, err = coord.CheckCache(ctx, batchSpec, tasks)
 		if err != nil {
 			return err
 		}
 	}
+	specs = append(specs, cachedSpecs...)
 	execUI.CheckingCacheSuccess(len(specs), len(uncachedTasks))
 
 	taskExecUI := execUI.ExecutingTasks(*verbose, parallelism)
 	freshSpecs, logFiles, execErr := coord.ExecuteAndBuildSpecs(ctx, batchSpec, uncachedTasks, taskExecUI)
 	// Add external changeset specs.
-	importedSpecs, importErr := svc.CreateImportChangesetSpecs(ctx, batchSpec)
+	var (
+		importedSpecs []*batcheslib.ChangesetSpec
+		importErr     error
+	)
+	if localRepos == nil {
+		importedSpecs, importErr = svc.CreateImportChangesetSpecs(ctx, batchSpec)
+	}
 	if execErr != nil {
 		err = errors.Append(err, execErr)
 	}
@@ -490,6 +778,7 @@ func executeBatchSpec(ctx context.Context, opts executeBatchSpecOpts) (err error
 		err = errors.Append(err, importErr)
 	}
 	if err != nil && !opts.flags.skipErrors {
+		printRetryFailedHint(runState)
 		return err
 	}
 	if err == nil || opts.flags.skipErrors {
@@ -517,16 +806,32 @@ func executeBatchSpec(ctx context.Context, opts executeBatchSpecOpts) (err error
 		return err
 	}
 
+	if opts.export != nil {
+		if err := exportChangesets(ctx, execUI, *opts.export, repos, specs); err != nil {
+			return err
+		}
+		return finishBatchRunState(runState)
+	}
+
 	ids := make([]graphql.ChangesetSpecID, len(specs))
 
 	if len(specs) > 0 {
 		execUI.UploadingChangesetSpecs(len(specs))
 
 		for i, spec := range specs {
-			id, err := svc.CreateChangesetSpec(ctx, spec)
+			id, uploaded, err := runState.ChangesetSpecID(spec)
 			if err != nil {
 				return err
 			}
+			if !uploaded {
+				id, err = svc.CreateChangesetSpec(ctx, spec)
+				if err != nil {
+					return err
+				}
+				if err := runState.ChangesetSpecUploaded(spec, id); err != nil {
+					return err
+				}
+			}
 			ids[i] = id
 			execUI.UploadingChangesetSpecsProgress(i+1, len(specs))
 		}
@@ -537,9 +842,15 @@ func executeBatchSpec(ctx context.Context, opts executeBatchSpecOpts) (err error
 	}
 
 	execUI.CreatingBatchSpec()
-	id, url, err := svc.CreateBatchSpec(ctx, namespace.ID, rawSpec, ids)
-	if err != nil {
-		return execUI.CreatingBatchSpecError(lr.MaxUnlicensedChangesets, err)
+	id, url, created := runState.BatchSpec()
+	if !created {
+		id, url, err = svc.CreateBatchSpec(ctx, namespace.ID, rawSpec, ids)
+		if err != nil {
+			return execUI.CreatingBatchSpecError(lr.MaxUnlicensedChangesets, err)
+		}
+		if err := runState.BatchSpecCreated(id, url); err != nil {
+			return err
+		}
 	}
 	previewURL := cfg.endpointURL.JoinPath(url).String()
 	execUI.CreatingBatchSpecSuccess(previewURL)
@@ -551,19 +862,22 @@ func executeBatchSpec(ctx context.Context, opts executeBatchSpecOpts) (err error
 			break
 		}
 	}
-	if hasWorkspaceFiles {
+	if hasWorkspaceFiles && !runState.WorkspaceFilesUploaded() {
 		execUI.UploadingWorkspaceFiles()
 		if err := svc.UploadBatchSpecWorkspaceFiles(ctx, batchSpecDir, string(id), batchSpec.Steps); err != nil {
 			// Since failing to upload workspace files should not stop processing, just warn
 			execUI.UploadingWorkspaceFilesWarning(errors.Wrap(err, "uploading workspace files"))
 		} else {
 			execUI.UploadingWorkspaceFilesSuccess()
+			if err := runState.SetWorkspaceFilesUploaded(); err != nil {
+				return err
+			}
 		}
 	}
 
 	if !opts.applyBatchSpec {
 		execUI.PreviewBatchSpec(previewURL)
-		return
+		return finishBatchRunState(runState)
 	}
 
 	execUI.ApplyingBatchSpec()
@@ -573,9 +887,148 @@ func executeBatchSpec(ctx context.Context, opts executeBatchSpecOpts) (err error
 	}
 	execUI.ApplyingBatchSpecSuccess(cfg.endpointURL.JoinPath(batch.URL).String())
 
+	return finishBatchRunState(runState)
+}
+
+// checkBatchExecuteFlags returns a usage error if the flags don't fit
+// together.
+func checkBatchExecuteFlags(flags *batchExecuteFlags) error {
+	if flags.clearShared && !flags.clearCache {
+		return cmderrors.Usage("-clear-shared-cache can only be used with -clear-cache")
+	}
+	if flags.report != "" {
+		if err := report.CheckFormat(flags.report); err != nil {
+			return cmderrors.Usage(err.Error())
+		}
+	}
 	return nil
 }
 
+// exportChangesets exports the changesets built from the given specs, except
+// for imported changesets, which have nothing to export.
+func exportChangesets(ctx context.Context, execUI ui.ExecUI, opts export.Opts, repos []*graphql.Repository, specs []*batcheslib.ChangesetSpec) error {
+	names := make(map[string]string, len(repos))
+	for _, repo := range repos {
+		names[repo.ID] = repo.Name
+	}
+
+	var changesets []export.Changeset
+	for _, spec := range specs {
+		if spec.ExternalID != "" {
+			continue
+		}
+		changesets = append(changesets, export.Changeset{Repository: names[spec.BaseRepository], Spec: spec})
+	}
+	if len(changesets) == 0 {
+		execUI.NoChangesetSpecs()
+		return nil
+	}
+
+	execUI.ExportingChangesets(len(changesets))
+	result, err := export.Export(ctx, changesets, opts, execUI.ExportingChangesetsProgress)
+	if err != nil {
+		return err
+	}
+	execUI.ExportingChangesetsSuccess(result)
+	return nil
+}
+
+// openBatchRunState returns the run state of the execution of the given batch
+// spec. With -resume, the run state of an interrupted execution is loaded if
+// there is one. With -retry-failed, the run state is built from the one of the
+// given execution, so that only its failed tasks are run.
+func openBatchRunState(flags *batchExecuteFlags, endpoint, namespaceID, batchSpecDir, rawSpec string, batchSpec *batcheslib.BatchSpec) (*service.RunState, error) {
+	runSpec, err := service.NewRunSpec(endpoint, namespaceID, batchSpecDir, rawSpec, batchSpec)
+	if err != nil {
+		return nil, err
+	}
+	id := runSpec.ID()
+	if flags.retryFailedAllowChangedSpec && flags.retryFailed == "" {
+		return nil, cmderrors.Usage("-retry-failed-allow-changed-spec can only be used with -retry-failed")
+	}
+	if flags.retryFailed != "" {
+		if flags.resume {
+			return nil, cmderrors.Usage("-resume and -retry-failed can't be used together")
+		}
+		retryID, err := retryFailedRunID(flags.retryFailed)
+		if err != nil {
+			return nil, err
+		}
+		state, found, err := service.LoadRunState(flags.cacheDir, retryID)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, errors.Newf("no execution with run ID %s to retry in %s, executions are kept for 24 hours", retryID, flags.cacheDir)
+		}
+		if state.FailedTasks() == 0 {
+			return nil, errors.Newf("the execution with run ID %s has no failed workspaces to retry", retryID)
+		}
+		retry, err := state.RetryFailed(flags.cacheDir, runSpec, flags.retryFailedAllowChangedSpec)
+		if errors.Is(err, service.ErrRunSpecChanged) {
+			return nil, errors.Newf("the batch spec changed since the execution with run ID %s. Use -retry-failed-allow-changed-spec to retry its failed workspaces anyway, reusing the changeset specs its successful workspaces were built with", retryID)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "retrying the execution with run ID %s", retryID)
+		}
+		return retry, nil
+	}
+	if flags.resume {
+		state, found, err := service.LoadRunState(flags.cacheDir, id)
+		if err != nil {
+			return nil, err
+		}
+		if found && !state.Completed() {
+			return state, nil
+		}
+		if found {
+			cliLog.Printf("WARNING: the last execution of this batch spec completed, starting from scratch. Use -retry-failed %s to retry its failed workspaces.", id)
+		} else {
+			cliLog.Println("WARNING: no interrupted execution of this batch spec to resume, starting from scratch")
+		}
+	}
+	return service.NewRunState(flags.cacheDir, runSpec), nil
+}
+
+// retryFailedRunID returns the run ID given to -retry-failed, which is either
+// the ID itself or the path of a JUnit XML report of the execution.
+func retryFailedRunID(arg string) (string, error) {
+	f, err := os.Open(arg)
+	if os.IsNotExist(err) {
+		return arg, nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "opening report")
+	}
+	defer f.Close()
+	return report.ReadRunID(f)
+}
+
+// finishBatchRunState removes the run state of a completed execution, unless
+// tasks failed: then it's kept so that they can be retried with -retry-failed.
+func finishBatchRunState(runState *service.RunState) error {
+	if runState.FailedTasks() == 0 {
+		return runState.Remove()
+	}
+	if err := runState.SetCompleted(); err != nil {
+		return err
+	}
+	printRetryFailedHint(runState)
+	return nil
+}
+
+// printRetryFailedHint tells how to retry the failed tasks of the execution, if
+// there are any.
+func printRetryFailedHint(runState *service.RunState) {
+	switch n := runState.FailedTasks(); n {
+	case 0:
+	case 1:
+		cliLog.Printf("1 workspace failed. Run the same command with -retry-failed %s to retry it.", runState.ID())
+	default:
+		cliLog.Printf("%d workspaces failed. Run the same command with -retry-failed %s to retry them.", n, runState.ID())
+	}
+}
+
 func setReadDeadlineOnCancel(ctx context.Context, f *os.File) {
 	go func() {
 		// When user cancels, we set the read deadline to now() so the runtime
@@ -585,9 +1038,14 @@ func setReadDeadlineOnCancel(ctx context.Context, f *os.File) {
 	}()
 }
 
-// parseBatchSpec parses and validates the given batch spec. If the spec has
-// validation errors, they are returned.
-func parseBatchSpec(ctx context.Context, file string, svc *service.Service) (*batcheslib.BatchSpec, string, string, error) {
+// parseBatchSpec parses and validates the given batch spec, with the
+// variables set by vars. If the spec has validation errors, they are returned.
+func parseBatchSpec(ctx context.Context, file string, vars *batchVariablesFlags, svc *service.Service) (*batcheslib.BatchSpec, string, string, error) {
+	values, err := vars.values()
+	if err != nil {
+		return nil, "", "", err
+	}
+
 	f, err := batchOpenFileFlag(file)
 	if err != nil {
 		return nil, "", "", err
@@ -610,8 +1068,14 @@ func parseBatchSpec(ctx context.Context, file string, svc *service.Service) (*ba
 		return nil, "", "", errors.Wrap(err, "batch spec path")
 	}
 
-	spec, err := svc.ParseBatchSpec(dir, data)
-	return spec, dir, string(data), err
+	name := file
+	if name == "" || name == "-" {
+		name = "<stdin>"
+	}
+	// Step libraries and variables are expanded when parsing the batch spec,
+	// and the expanded batch spec is what gets cached and uploaded.
+	spec, expanded, err := svc.ParseBatchSpec(name, dir, data, values)
+	return spec, dir, string(expanded), err
 }
 
 func getBatchSpecDirectory(file string) (string, error) {
@@ -665,12 +1129,31 @@ func contextCancelOnInterrupt(parent context.Context) (context.Context, func())
 	}
 }
 
-func getBatchParallelism(ctx context.Context, flag int) (int, error) {
+// newBatchRuntime returns the container runtime selected with the -runtime
+// flag, or the host runtime if steps are run on the host with -workspace host.
+func newBatchRuntime(ctx context.Context, runtimeFlag, workspaceFlag, hostImagesFlag string) (docker.ContainerRuntime, error) {
+	if workspaceFlag != "host" {
+		return docker.NewRuntime(ctx, runtimeFlag)
+	}
+
+	var allowed []string
+	for image := range strings.SplitSeq(hostImagesFlag, ",") {
+		if image = strings.TrimSpace(image); image != "" {
+			allowed = append(allowed, image)
+		}
+	}
+	if len(allowed) == 0 {
+		cliLog.Printf("WARNING: steps are run on the host, ignoring their container images. Use -host-images to only allow steps with specific images.")
+	}
+	return docker.NewHostRuntime(allowed), nil
+}
+
+func getBatchParallelism(ctx context.Context, rt docker.ContainerRuntime, flag int) (int, error) {
 	if flag > 0 {
 		return flag, nil
 	}
 
-	return docker.NCPU(ctx)
+	return rt.NCPU(ctx)
 }
 
 func validateSourcegraphVersionConstraint(ffs *batches.FeatureFlags) error {
@@ -679,3 +1162,21 @@ func validateSourcegraphVersionConstraint(ffs *batches.FeatureFlags) error {
 	}
 	return errors.Newf("\n\n * Warning:\n This version of src-cli requires Sourcegraph version 4.0 or newer. If you're not on Sourcegraph 4.0 or newer, please use the 3.x release of src-cli that corresponds to your Sourcegraph version.\n\n")
 }
+
+// workspaceMirrors returns the local git mirrors used by worktree workspaces:
+// the local repositories, if set, and the repositories in dir.
+func workspaceMirrors(dir string, localRepos service.LocalRepos) workspace.Mirrors {
+	var inDir workspace.Mirrors
+	if dir != "" {
+		inDir = workspace.MirrorsInDir(dir)
+	}
+	return func(repoName string) (string, bool) {
+		if mirror, ok := localRepos[repoName]; ok {
+			return mirror, true
+		}
+		if inDir != nil {
+			return inDir(repoName)
+		}
+		return "", false
+	}
+}
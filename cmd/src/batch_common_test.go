@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+	"github.com/sourcegraph/src-cli/internal/batches/service"
+)
+
+func TestOpenBatchRunState_Namespace(t *testing.T) {
+	const rawSpec = "name: test"
+	batchSpec := &batcheslib.BatchSpec{Name: "test"}
+	flags := &batchExecuteFlags{cacheDir: t.TempDir()}
+
+	state, err := openBatchRunState(flags, "https://sourcegraph.test", "VXNlcjox", "/specs", rawSpec, batchSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &graphql.Repository{ID: "repo-1", Name: "github.com/sourcegraph/src-cli"}
+	if err := state.SetWorkspaces([]service.RepoWorkspace{{Repo: repo}}, []*graphql.Repository{repo}); err != nil {
+		t.Fatal(err)
+	}
+
+	flags.resume = true
+	resumed, err := openBatchRunState(flags, "https://sourcegraph.test", "VXNlcjox", "/specs", rawSpec, batchSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := resumed.Workspaces(); !ok || resumed.ID() != state.ID() {
+		t.Fatalf("execution in the same namespace wasn't resumed")
+	}
+
+	other, err := openBatchRunState(flags, "https://sourcegraph.test", "VXNlcjoy", "/specs", rawSpec, batchSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := other.Workspaces(); ok || other.ID() == state.ID() {
+		t.Fatalf("execution in another namespace was resumed")
+	}
+}
@@ -42,7 +42,7 @@ type executorModeFlags struct {
 
 func newExecutorModeFlags(flagSet *flag.FlagSet) (f *executorModeFlags) {
 	f = &executorModeFlags{}
-	flagSet.DurationVar(&f.timeout, "timeout", 60*time.Minute, "The maximum duration a single batch spec step can take.")
+	flagSet.DurationVar(&f.timeout, "timeout", 60*time.Minute, "The maximum duration a single batch spec step can take. Steps with a timeout in the batch spec are limited by it instead.")
 	flagSet.StringVar(&f.file, "f", "", "The workspace execution input file to read.")
 	flagSet.BoolVar(&f.runAsImageUser, "run-as-image-user", false, "True to run step containers as the default image user; if false or omitted, containers are always run as root.")
 	flagSet.StringVar(&f.tempDir, "tmp", "", "Directory for storing temporary data.")
@@ -174,7 +174,9 @@ func executeBatchSpecInWorkspaces(ctx context.Context, flags *executorModeFlags)
 		return errors.New("invalid execution, no steps to process")
 	}
 
-	imageCache := docker.NewImageCache()
+	// Executors always run steps with Docker.
+	rt := docker.NewDockerRuntime()
+	imageCache := docker.NewImageCache(rt)
 
 	ui.PreparingContainerImages()
 	_, err = service.New(&service.Opts{}).EnsureDockerImages(
@@ -203,7 +205,9 @@ func executeBatchSpecInWorkspaces(ctx context.Context, flags *executorModeFlags)
 	opts := &executor.RunStepsOpts{
 		Logger:      &log.NoopTaskLogger{},
 		WC:          workspace.NewExecutorWorkspaceCreator(tempDir, repoDir),
+		Runtime:     rt,
 		EnsureImage: imageCache.Ensure,
+		BuildImage:  imageCache.Build,
 		Task:        task,
 		// TODO: Should be slightly less than the executor timeout. Can we somehow read that?
 		Timeout:          flags.timeout,
@@ -214,12 +218,15 @@ func executeBatchSpecInWorkspaces(ctx context.Context, flags *executorModeFlags)
 		UI:               taskExecUI.StepsExecutionUI(task),
 		ForceRoot:        !flags.runAsImageUser,
 		BinaryDiffs:      flags.binaryDiffs,
+		// Executors don't keep any state between executions, so step caches
+		// only live as long as the temp dir.
+		StepCaches: &executor.StepCaches{Dir: filepath.Join(tempDir, executor.StepCachesDir)},
 	}
 	results, err := executor.RunSteps(ctx, opts)
 
 	// Write all step cache results for all results.
 	for _, stepRes := range results {
-		cacheKey := task.CacheKey(globalEnv, workspaceFilesDir, stepRes.StepIndex)
+		cacheKey := task.CacheKey(globalEnv, workspaceFilesDir, "", stepRes.StepIndex)
 		k, err := cacheKey.Key()
 		if err != nil {
 			return errors.Wrap(err, "calculating step cache key")
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	cliLog "log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/sourcegraph/sourcegraph/lib/batches/template"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+	"github.com/sourcegraph/sourcegraph/lib/output"
+
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/batches"
+	"github.com/sourcegraph/src-cli/internal/batches/docker"
+	"github.com/sourcegraph/src-cli/internal/batches/executor"
+	"github.com/sourcegraph/src-cli/internal/batches/explain"
+	"github.com/sourcegraph/src-cli/internal/batches/service"
+	"github.com/sourcegraph/src-cli/internal/batches/ui"
+)
+
+func init() {
+	usage := `
+'src batch explain' shows what executing a batch spec would do in each of its
+workspaces, without executing it: which steps run or are skipped by their if
+conditions, their scripts, environment variables and files with the templates
+evaluated as far as possible, the digests of their images, and which step
+results are cached.
+
+Templates that depend on the results of earlier steps, such as their outputs,
+are shown as they are. Steps whose if condition depends on them are shown as
+conditional.
+
+Usage:
+
+    src batch explain [-f] FILE [command options]
+
+Examples:
+
+    $ src batch explain batch.spec.yaml
+
+    $ src batch explain -repo github.com/sourcegraph/src-cli batch.spec.yaml
+
+    $ src batch explain -json -digests=false batch.spec.yaml
+
+`
+
+	flagSet := flag.NewFlagSet("explain", flag.ExitOnError)
+
+	var (
+		fileFlag    = flagSet.String("f", "", "The batch spec file to read, or - to read from standard input.")
+		repoFlag    = flagSet.String("repo", "", "Only explain the workspaces in the repository with this name.")
+		jsonFlag    = flagSet.Bool("json", false, "Print the execution plans as JSON.")
+		digestsFlag = flagSet.Bool("digests", true, "Show the digests of the images of the steps, pulling the images if necessary.")
+		cacheFlag   = flagSet.String("cache", batchDefaultCacheDir(), "Directory for caching results.")
+		apiFlags    = api.NewFlags(flagSet)
+		varsFlags   = newBatchVariablesFlags(flagSet)
+
+		workspaceFlag = flagSet.String(
+			"workspace", "auto",
+			`Workspace mode the batch spec would be executed with. Step results cached with -workspace host are only used by executions on the host.`,
+		)
+		runtimeFlag = flagSet.String(
+			"runtime", docker.RuntimeAuto,
+			`Container runtime to pull images with ("auto", "docker", or "podman").`,
+		)
+		hostImagesFlag = flagSet.String(
+			"host-images", "",
+			`Comma-separated list of the images whose steps may run on the host with -workspace host.`,
+		)
+	)
+
+	var (
+		allowUnsupported bool
+		allowIgnored     bool
+		skipErrors       bool
+	)
+	flagSet.BoolVar(
+		&allowUnsupported, "allow-unsupported", false,
+		"Allow unsupported code hosts.",
+	)
+	flagSet.BoolVar(
+		&allowIgnored, "force-override-ignore", false,
+		"Do not ignore repositories that have a .batchignore file.",
+	)
+	flagSet.BoolVar(
+		&skipErrors, "skip-errors", false,
+		"If true, errors encountered won't stop the program, but only log them.",
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+
+		file, err := getBatchSpecFile(flagSet, fileFlag)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := contextCancelOnInterrupt(context.Background())
+		defer cancel()
+
+		client := cfg.apiClient(apiFlags, flagSet.Output())
+		svc := service.New(&service.Opts{
+			Client: client,
+		})
+
+		_, ffs, err := svc.DetermineLicenseAndFeatureFlags(ctx, skipErrors)
+		if err != nil {
+			return err
+		}
+		if err := validateSourcegraphVersionConstraint(ffs); err != nil {
+			if !skipErrors {
+				return err
+			} else {
+				cliLog.Printf("WARNING: %s", err)
+			}
+		}
+
+		out := output.NewOutput(flagSet.Output(), output.OutputOpts{Verbose: *verbose})
+		spec, batchSpecDir, _, err := parseBatchSpec(ctx, file, varsFlags, svc)
+		if err != nil {
+			ui := &ui.TUI{Out: out}
+			ui.ParsingBatchSpecFailure(err)
+			return err
+		}
+
+		workspaces, _, err := svc.ResolveWorkspacesForBatchSpec(ctx, spec, allowUnsupported, allowIgnored)
+		if err != nil {
+			if _, ok := err.(batches.UnsupportedRepoSet); ok {
+				// This is fine, those repositories aren't part of the plans.
+			} else if _, ok := err.(batches.IgnoredRepoSet); ok {
+				// This is fine, those repositories aren't part of the plans.
+			} else {
+				return errors.Wrap(err, "resolving repositories")
+			}
+		}
+		if *repoFlag != "" {
+			var filtered []service.RepoWorkspace
+			for _, ws := range workspaces {
+				if ws.Repo.Name == *repoFlag {
+					filtered = append(filtered, ws)
+				}
+			}
+			if len(filtered) == 0 {
+				return errors.Newf("the batch spec has no workspaces in repository %q", *repoFlag)
+			}
+			workspaces = filtered
+		}
+
+		tasks := svc.BuildTasks(
+			&template.BatchChangeAttributes{
+				Name:        spec.Name,
+				Description: spec.Description,
+			},
+			spec.Steps,
+			workspaces,
+		)
+
+		coord := executor.NewCoordinator(
+			executor.NewCoordinatorOpts{
+				ExecOpts: executor.NewExecutorOpts{
+					WorkingDirectory: batchSpecDir,
+					Host:             *workspaceFlag == "host",
+				},
+				Cache:     executor.NewDiskCache(*cacheFlag),
+				GlobalEnv: os.Environ(),
+			},
+		)
+		opts := explain.Opts{Cache: coord}
+		if *digestsFlag && len(spec.Steps) > 0 {
+			rt, err := newBatchRuntime(ctx, *runtimeFlag, *workspaceFlag, *hostImagesFlag)
+			if err != nil {
+				return err
+			}
+			imageCache := docker.NewImageCache(rt)
+			opts.ImageDigest = func(ctx context.Context, image string) (string, error) {
+				img, err := imageCache.Ensure(ctx, image)
+				if err != nil {
+					return "", err
+				}
+				return img.Digest(ctx)
+			}
+		}
+
+		plans, err := explain.Explain(ctx, spec, tasks, opts)
+		if err != nil {
+			return err
+		}
+
+		if *jsonFlag {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(plans)
+		}
+		printExplainPlans(os.Stdout, plans)
+		return nil
+	}
+
+	batchCommands = append(batchCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
+
+func printExplainPlans(w io.Writer, plans []*explain.Plan) {
+	for i, plan := range plans {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+
+		workspace := plan.Repository
+		if plan.Path != "" {
+			workspace += ", workspace " + plan.Path
+		}
+		fmt.Fprintf(w, "%s (%s @ %s)\n", workspace, plan.Branch, plan.Revision)
+		fmt.Fprintf(w, "  cache: %s\n", plan.Cache)
+
+		for _, step := range plan.Steps {
+			status := string(step.Status)
+			if step.Cached {
+				status += ", cached"
+			}
+			fmt.Fprintf(w, "  step %d: %s\n", step.Number, status)
+			if step.Status == explain.StepStatusSkipped {
+				fmt.Fprintf(w, "    if: %s\n", step.If)
+				continue
+			}
+
+			if step.If != "" {
+				fmt.Fprintf(w, "    if: %s\n", step.If)
+			}
+			if step.Image != "" {
+				fmt.Fprintf(w, "    image: %s\n", step.Image)
+			}
+			if step.ImageDigest != "" {
+				fmt.Fprintf(w, "    digest: %s\n", step.ImageDigest)
+			}
+			if step.Run != "" {
+				fmt.Fprintln(w, "    run:")
+				printExplainIndented(w, step.Run, "      ")
+			}
+			if step.Prompt != "" {
+				fmt.Fprintln(w, "    prompt:")
+				printExplainIndented(w, step.Prompt, "      ")
+			}
+			if len(step.Env) > 0 || len(step.InheritedEnv) > 0 {
+				fmt.Fprintln(w, "    env:")
+				names := make([]string, 0, len(step.Env))
+				for name := range step.Env {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					fmt.Fprintf(w, "      %s=%s\n", name, step.Env[name])
+				}
+				for _, name := range step.InheritedEnv {
+					fmt.Fprintf(w, "      %s (from the environment)\n", name)
+				}
+			}
+			if len(step.Files) > 0 {
+				fmt.Fprintln(w, "    files:")
+				paths := make([]string, 0, len(step.Files))
+				for path := range step.Files {
+					paths = append(paths, path)
+				}
+				sort.Strings(paths)
+				for _, path := range paths {
+					fmt.Fprintf(w, "      %s:\n", path)
+					printExplainIndented(w, step.Files[path], "        ")
+				}
+			}
+		}
+	}
+}
+
+// printExplainIndented prints the lines of s with the given indentation.
+func printExplainIndented(w io.Writer, s, indent string) {
+	for line := range strings.SplitSeq(strings.TrimRight(s, "\n"), "\n") {
+		fmt.Fprintf(w, "%s%s\n", indent, line)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/sourcegraph/src-cli/internal/batches/export"
+	"github.com/sourcegraph/src-cli/internal/cmderrors"
+)
+
+func init() {
+	usage := `
+'src batch export' executes the steps in a batch spec like 'src batch preview',
+but instead of uploading the changesets to a Sourcegraph instance, it writes
+every changeset to a patch file in the format of git format-patch, named
+<dir>/<repository>/<branch>.patch, next to its changeset spec in
+<dir>/<repository>/<branch>.json. The branch is percent-encoded in the file
+names, so batch/fix is written to batch%2Ffix.patch. The diffs in the patches
+have no a/ and b/ prefixes, so apply them with 'git am -p0'.
+
+With -clones, the changesets are also committed on their branches in local
+clones of the repositories, found at <clones>/<repository>. The working tree
+and index of the clones aren't modified, but the base revisions of the
+changesets need to be fetched. With -bundle, a git bundle of these branches is
+written to <dir>/<repository>.bundle for every repository.
+
+With -local-repos, the batch spec is executed against the git repositories in
+the given directory instead of the repositories on a Sourcegraph instance, so
+no instance is needed. The repositories are named after their paths relative to
+the directory, like with 'src serve-git'. Repositories in 'on' can be given as
+glob patterns, and 'repositoriesMatchingQuery' may only contain repo: filters.
+Without a branch, the checked out HEAD of a repository is used.
+
+Usage:
+
+    src batch export [command options] [-f FILE]
+    src batch export [command options] FILE
+
+Examples:
+
+    $ src batch export -f batch.spec.yaml -o patches
+
+    $ src batch export -f batch.spec.yaml -clones ~/src
+
+    $ src batch export -f batch.spec.yaml -clones ~/src -bundle -o bundles
+
+    $ src batch export -f batch.spec.yaml -local-repos ~/src -clones ~/src
+
+`
+
+	flagSet := flag.NewFlagSet("export", flag.ExitOnError)
+	flags := newBatchExecuteFlags(flagSet, batchDefaultCacheDir(), batchDefaultTempDirPrefix())
+
+	var (
+		outDir     = flagSet.String("o", "batch-export", "The directory to write patch files, changeset specs and bundles to.")
+		clones     = flagSet.String("clones", "", "The directory containing local clones of the repositories. If set, the changesets are committed on their branches in the clones.")
+		bundle     = flagSet.Bool("bundle", false, "If true, writes a git bundle of the branches of every repository. Requires -clones.")
+		force      = flagSet.Bool("force", false, "If true, overwrites existing branches in the clones.")
+		localRepos = flagSet.String("local-repos", "", "The directory containing the git repositories to execute the batch spec against, instead of the repositories on the Sourcegraph instance.")
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+
+		if *bundle && *clones == "" {
+			return cmderrors.Usage("-bundle requires -clones")
+		}
+
+		file, err := getBatchSpecFile(flagSet, &flags.file)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := contextCancelOnInterrupt(context.Background())
+		defer cancel()
+
+		if err = executeBatchSpec(ctx, executeBatchSpecOpts{
+			flags:  flags,
+			client: cfg.apiClient(flags.api, flagSet.Output()),
+			file:   file,
+
+			localRepos: *localRepos,
+			export: &export.Opts{
+				Dir:     *outDir,
+				Clones:  *clones,
+				Bundles: *bundle,
+				Force:   *force,
+				Date:    time.Now(),
+			},
+		}); err != nil {
+			return cmderrors.ExitCode(1, nil)
+		}
+
+		return nil
+	}
+
+	batchCommands = append(batchCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
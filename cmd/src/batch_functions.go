@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/sourcegraph/sourcegraph/lib/batches/template"
+
+	"github.com/sourcegraph/src-cli/internal/cmderrors"
+)
+
+func init() {
+	usage := `
+'src batch functions' lists the functions that are available in the templates
+of batch specs: in steps, outputs, and the changeset template.
+
+The set of functions is versioned. A batch spec that uses functions added in a
+later version can require that version with templateFunctions, so that older
+versions of src fail to parse it instead of failing when the functions are
+called:
+
+    templateFunctions: 2
+
+Usage:
+
+    src batch functions [command options]
+
+Examples:
+
+    $ src batch functions
+
+    $ src batch functions -json
+
+`
+
+	flagSet := flag.NewFlagSet("functions", flag.ExitOnError)
+	var (
+		jsonFlag = flagSet.Bool("json", false, "Print the version and the functions as a JSON object.")
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if flagSet.NArg() != 0 {
+			return cmderrors.Usage("additional arguments not allowed")
+		}
+
+		return printTemplateFunctions(os.Stdout, *jsonFlag)
+	}
+
+	batchCommands = append(batchCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
+
+func printTemplateFunctions(out io.Writer, asJSON bool) error {
+	if asJSON {
+		return json.NewEncoder(out).Encode(struct {
+			Version   int                 `json:"version"`
+			Functions []template.Function `json:"functions"`
+		}{template.FunctionsVersion, template.Functions})
+	}
+
+	fmt.Fprintf(out, "Template functions version %d. Require it in a batch spec with templateFunctions: %d.\n\n", template.FunctionsVersion, template.FunctionsVersion)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FUNCTION\tSINCE\tDESCRIPTION")
+	for _, f := range template.Functions {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", f.Usage, f.Since, f.Description)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/sourcegraph/lib/batches/template"
+)
+
+func TestPrintTemplateFunctions(t *testing.T) {
+	t.Run("table", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := printTemplateFunctions(&out, false); err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		// The version, a blank line, the header, and one line per function.
+		if have, want := len(lines), len(template.Functions)+3; have != want {
+			t.Fatalf("wrong number of lines: have %d, want %d:\n%s", have, want, out.String())
+		}
+		if !strings.Contains(lines[0], fmt.Sprintf("templateFunctions: %d", template.FunctionsVersion)) {
+			t.Errorf("version line doesn't mention templateFunctions: %q", lines[0])
+		}
+		for i, f := range template.Functions {
+			if !strings.HasPrefix(lines[i+3], f.Usage+" ") {
+				t.Errorf("line %d doesn't start with %q: %q", i+3, f.Usage, lines[i+3])
+			}
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := printTemplateFunctions(&out, true); err != nil {
+			t.Fatal(err)
+		}
+
+		var have struct {
+			Version   int
+			Functions []struct{ Name string }
+		}
+		if err := json.Unmarshal(out.Bytes(), &have); err != nil {
+			t.Fatal(err)
+		}
+		if have.Version != template.FunctionsVersion {
+			t.Errorf("wrong version: have %d, want %d", have.Version, template.FunctionsVersion)
+		}
+		var names, want []string
+		for _, f := range have.Functions {
+			names = append(names, f.Name)
+		}
+		for _, f := range template.Functions {
+			want = append(want, f.Name)
+		}
+		if diff := cmp.Diff(want, names); diff != "" {
+			t.Errorf("wrong functions (-want +have):\n%s", diff)
+		}
+	})
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+var batchHooksCommands commander
+
+func init() {
+	usage := `'src batch hooks' works with the changeset hooks declared in a batch spec.
+
+Usage:
+
+	src batch hooks command [command options]
+
+The commands are:
+
+	run	runs the steps of a changeset hook locally
+
+Use "src batch hooks [command] -h" for more information about a command.
+`
+
+	flagSet := flag.NewFlagSet("hooks", flag.ExitOnError)
+	handler := func(args []string) error {
+		batchHooksCommands.run(flagSet, "src batch hooks", usage, args)
+		return nil
+	}
+
+	batchCommands = append(batchCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Println(usage)
+		},
+	})
+}
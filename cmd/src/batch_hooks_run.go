@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/lib/batches/template"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+	"github.com/sourcegraph/sourcegraph/lib/output"
+
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/batches/docker"
+	"github.com/sourcegraph/src-cli/internal/batches/executor"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+	"github.com/sourcegraph/src-cli/internal/batches/log"
+	"github.com/sourcegraph/src-cli/internal/batches/repozip"
+	"github.com/sourcegraph/src-cli/internal/batches/service"
+	"github.com/sourcegraph/src-cli/internal/batches/ui"
+	"github.com/sourcegraph/src-cli/internal/batches/workspace"
+	"github.com/sourcegraph/src-cli/internal/cmderrors"
+)
+
+type batchHooksRunFlags struct {
+	file               string
+	event              string
+	payload            string
+	repo               string
+	branch             string
+	checkout           string
+	cacheDir           string
+	tempDir            string
+	timeout            time.Duration
+	workspace          string
+	runtime            string
+	hostImages         string
+	runAsRoot          bool
+	codingAgentCommand string
+	vars               *batchVariablesFlags
+}
+
+func init() {
+	usage := `
+'src batch hooks run' runs the steps of a changeset hook declared in a batch
+spec against a single repository and prints the resulting diff. The hook is
+executed locally, exactly like the steps of 'src batch preview' are.
+
+The event payload, such as a CI log or the conflicting files of a merge, is
+read from the file given with -payload. Steps can access the event with
+${{ event.name }} and ${{ event.payload }}.
+
+The workspace is either fetched from Sourcegraph with -repo and -branch, or
+created from a local git checkout with -checkout. Only committed changes of a
+local checkout are part of the workspace.
+
+Usage:
+
+    src batch hooks run -f FILE -event EVENT (-repo REPO | -checkout DIR) [command options]
+
+Examples:
+
+    $ src batch hooks run -f batch.spec.yaml -event onCIFailure -payload ci.log -repo github.com/sourcegraph/src-cli -branch my-batch-change
+
+    $ src batch hooks run -f batch.spec.yaml -event onMergeConflict -payload conflicts.txt -checkout .
+
+`
+
+	flagSet := flag.NewFlagSet("run", flag.ExitOnError)
+	flags := &batchHooksRunFlags{}
+	flagSet.StringVar(&flags.file, "f", "", "The batch spec file to read, or - to read from standard input.")
+	flagSet.StringVar(&flags.event, "event", "", `The hook event to run the steps of ("onCIFailure" or "onMergeConflict").`)
+	flagSet.StringVar(&flags.payload, "payload", "", "The file containing the event payload.")
+	flagSet.StringVar(&flags.repo, "repo", "", "The name of the repository to run the hook in. Optional with -checkout.")
+	flagSet.StringVar(&flags.branch, "branch", "", "The branch to run the hook on. Default is the default branch of the repository, or HEAD with -checkout.")
+	flagSet.StringVar(&flags.checkout, "checkout", "", "Path of a local git checkout to create the workspace from instead of fetching it from Sourcegraph.")
+	flagSet.StringVar(&flags.cacheDir, "cache", batchDefaultCacheDir(), "Directory for caching repository archives.")
+	flagSet.StringVar(&flags.tempDir, "tmp", batchDefaultTempDirPrefix(), "Directory for storing temporary data.")
+	flagSet.DurationVar(&flags.timeout, "timeout", 60*time.Minute, "The maximum duration the hook steps can take.")
+	flagSet.StringVar(&flags.workspace, "workspace", "auto", `Workspace mode to use ("auto", "bind", "volume", "host", or "worktree"). "host" runs the steps directly on the host instead of in containers. "worktree" creates the workspace as a git worktree of the -checkout.`)
+	flagSet.StringVar(&flags.runtime, "runtime", docker.RuntimeAuto, `Container runtime to run steps with ("auto", "docker", or "podman").`)
+	flagSet.StringVar(&flags.hostImages, "host-images", "", "Comma-separated list of the images whose steps may run on the host with -workspace host.")
+	flagSet.BoolVar(&flags.runAsRoot, "run-as-root", false, "If true, forces all step containers to run as root.")
+	flagSet.StringVar(
+		&flags.codingAgentCommand, "coding-agent-command", "",
+		`Path to the binary that is run inside the step container by codingAgent steps of type "command".`,
+	)
+	flags.vars = newBatchVariablesFlags(flagSet)
+	flagSet.BoolVar(verbose, "v", false, "print verbose output")
+	apiFlags := api.NewFlags(flagSet)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+
+		if flagSet.NArg() != 0 {
+			return errAdditionalArguments
+		}
+		if flags.file == "" {
+			return cmderrors.Usage("-f is required")
+		}
+		if flags.event == "" {
+			return cmderrors.Usage("-event is required")
+		}
+		if flags.repo == "" && flags.checkout == "" {
+			return cmderrors.Usage("either -repo or -checkout is required")
+		}
+
+		ctx, cancel := contextCancelOnInterrupt(context.Background())
+		defer cancel()
+
+		out := output.NewOutput(os.Stderr, output.OutputOpts{Verbose: *verbose})
+		execUI := &ui.TUI{Out: out}
+
+		diff, err := runBatchHook(ctx, flags, cfg.apiClient(apiFlags, flagSet.Output()), execUI)
+		if err != nil {
+			execUI.ExecutionError(err)
+			return cmderrors.ExitCode(1, nil)
+		}
+
+		_, err = os.Stdout.Write(diff)
+		return err
+	}
+
+	batchHooksCommands = append(batchHooksCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch hooks %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
+
+// runBatchHook runs the steps declared for the hook event in flags and returns
+// the diff they produced.
+func runBatchHook(ctx context.Context, flags *batchHooksRunFlags, client api.Client, execUI *ui.TUI) ([]byte, error) {
+	svc := service.New(&service.Opts{Client: client})
+
+	spec, specDir, _, err := parseBatchSpec(ctx, flags.file, flags.vars, svc)
+	if err != nil {
+		return nil, err
+	}
+	if spec.ChangesetHooks == nil {
+		return nil, errors.New("batch spec declares no hooks")
+	}
+	action, ok := spec.ChangesetHooks.Action(flags.event)
+	if !ok {
+		return nil, errors.Newf("unknown hook event %q", flags.event)
+	}
+	if len(action.Steps) == 0 {
+		return nil, errors.Newf("batch spec declares no steps for hook event %q", flags.event)
+	}
+
+	event := template.HookEvent{Name: flags.event}
+	if flags.payload != "" {
+		payload, err := os.ReadFile(flags.payload)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading event payload")
+		}
+		event.Payload = string(payload)
+	}
+
+	if err := checkExecutable("git", "version"); err != nil {
+		return nil, err
+	}
+	rt, err := newBatchRuntime(ctx, flags.runtime, flags.workspace, flags.hostImages)
+	if err != nil {
+		return nil, err
+	}
+	if err := rt.CheckVersion(ctx); err != nil {
+		return nil, err
+	}
+
+	tempDir, err := filepath.Abs(flags.tempDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting absolute path for temp dir")
+	}
+	if err := os.MkdirAll(tempDir, os.ModePerm); err != nil {
+		return nil, errors.Wrap(err, "creating temp directory")
+	}
+
+	var (
+		repo    *graphql.Repository
+		archive repozip.Archive
+	)
+	if flags.checkout != "" {
+		repo, err = resolveLocalCheckout(ctx, flags.checkout, flags.repo, flags.branch)
+		if err != nil {
+			return nil, err
+		}
+		archive = repozip.NewLocalArchive(flags.checkout, repo.Rev(), tempDir)
+	} else {
+		repo, err = svc.ResolveRepositoryBranch(ctx, flags.repo, flags.branch)
+		if err != nil {
+			return nil, errors.Wrap(err, "resolving repository")
+		}
+		archive = repozip.NewArchiveRegistry(client, flags.cacheDir, true).Checkout(
+			repozip.RepoRevision{RepoName: repo.Name, Commit: repo.Rev()},
+			"",
+		)
+	}
+
+	imageCache := docker.NewImageCache(rt)
+	execUI.PreparingContainerImages()
+	images, err := svc.EnsureDockerImages(ctx, imageCache, action.Steps, execPullParallelism, execUI.PreparingContainerImagesProgress)
+	if err != nil {
+		return nil, err
+	}
+	execUI.PreparingContainerImagesSuccess()
+
+	workspaceCreator, typ := workspace.NewCreator(ctx, rt, flags.workspace, flags.cacheDir, tempDir, images)
+	if typ == workspace.CreatorTypeWorktree && flags.checkout != "" {
+		workspaceCreator = workspace.NewWorktreeCreator(flags.cacheDir, func(string) (string, bool) {
+			return flags.checkout, true
+		})
+	}
+	if closer, ok := workspaceCreator.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if typ == workspace.CreatorTypeVolume {
+		if _, err := imageCache.Ensure(ctx, workspace.DockerVolumeWorkspaceImage); err != nil {
+			return nil, err
+		}
+	}
+
+	task := &executor.Task{
+		Repository: repo,
+		Steps:      action.Steps,
+		BatchChangeAttributes: &template.BatchChangeAttributes{
+			Name:        spec.Name,
+			Description: spec.Description,
+		},
+		Event: event,
+	}
+
+	taskExecUI := execUI.ExecutingTasks(*verbose, 1)
+	taskExecUI.Start([]*executor.Task{task})
+	taskExecUI.TaskStarted(task)
+
+	results, err := executor.RunSteps(ctx, &executor.RunStepsOpts{
+		Logger:           &log.NoopTaskLogger{},
+		WC:               workspaceCreator,
+		Runtime:          rt,
+		EnsureImage:      imageCache.Ensure,
+		BuildImage:       imageCache.Build,
+		Task:             task,
+		Timeout:          flags.timeout,
+		TempDir:          tempDir,
+		WorkingDirectory: specDir,
+		GlobalEnv:        os.Environ(),
+		RepoArchive:      archive,
+		UI:               taskExecUI.StepsExecutionUI(task),
+		ForceRoot:        flags.runAsRoot,
+		Host:             typ == workspace.CreatorTypeHost,
+		AgentRunners: map[string]executor.AgentRunner{
+			executor.AgentTypeCommand: &executor.CommandAgentRunner{Binary: flags.codingAgentCommand},
+		},
+		StepCaches: &executor.StepCaches{Dir: filepath.Join(flags.cacheDir, executor.StepCachesDir)},
+	})
+	taskExecUI.TaskFinished(task, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return results[len(results)-1].Diff, nil
+}
+
+// resolveLocalCheckout builds the repository for a local git checkout at dir.
+// If name is empty, the name of the directory is used. If rev is empty, HEAD
+// is used.
+func resolveLocalCheckout(ctx context.Context, dir, name, rev string) (*graphql.Repository, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting absolute path for checkout")
+	}
+	if name == "" {
+		name = filepath.Base(absDir)
+	}
+	if rev == "" {
+		rev = "HEAD"
+	}
+
+	git := func(args ...string) (string, error) {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = absDir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return "", errors.Wrapf(err, "running git %s in %q: %s", strings.Join(args, " "), absDir, out)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	oid, err := git("rev-parse", "--verify", rev+"^{commit}")
+	if err != nil {
+		return nil, err
+	}
+	branch := rev
+	if rev == "HEAD" {
+		if branch, err = git("rev-parse", "--abbrev-ref", "HEAD"); err != nil {
+			return nil, err
+		}
+	}
+
+	target := graphql.Target{OID: oid}
+	return &graphql.Repository{
+		Name:          name,
+		DefaultBranch: &graphql.Branch{Name: branch, Target: target},
+		Branch:        graphql.Branch{Name: branch, Target: target},
+		Commit:        target,
+	}, nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/src-cli/internal/batches/lint"
+	"github.com/sourcegraph/src-cli/internal/batches/service"
+	"github.com/sourcegraph/src-cli/internal/cmderrors"
+)
+
+func init() {
+	usage := `
+'src batch lint' finds mistakes in a batch spec that 'src batch validate'
+doesn't catch: templates that reference undefined variables, fields or
+outputs, or values that are always empty where they are used, steps that are
+never executed, outputs that are never used, and container images that
+aren't pinned to a tag or digest.
+
+Findings are printed with their line in the batch spec, as JSON, or as a
+SARIF log for code scanning tools. Batch specs that include step libraries
+or declare variables are linted after they are expanded, so their findings
+have no lines.
+
+The command exits with status 1 if there are errors, or, with -strict,
+warnings.
+
+Usage:
+
+    src batch lint [-f] FILE [command options]
+
+Examples:
+
+    $ src batch lint batch.spec.yaml
+
+    $ src batch lint -format sarif batch.spec.yaml > batch.sarif
+
+`
+
+	flagSet := flag.NewFlagSet("lint", flag.ExitOnError)
+	var (
+		fileFlag   = flagSet.String("f", "", "The batch spec file to read, or - to read from standard input.")
+		formatFlag = flagSet.String("format", "text", `The output format: "text", "json", or "sarif".`)
+		strictFlag = flagSet.Bool("strict", false, "Exit with status 1 if there are warnings, too.")
+		varsFlags  = newBatchVariablesFlags(flagSet)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		switch *formatFlag {
+		case "text", "json", "sarif":
+		default:
+			return cmderrors.Usagef("invalid -format %q", *formatFlag)
+		}
+
+		file, err := getBatchSpecFile(flagSet, fileFlag)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := contextCancelOnInterrupt(context.Background())
+		defer cancel()
+
+		name := file
+		if name == "" || name == "-" {
+			name = "<stdin>"
+		}
+		vars, err := varsFlags.values()
+		if err != nil {
+			return err
+		}
+		findings, err := lintBatchSpec(ctx, file, name, vars)
+		if err != nil {
+			return err
+		}
+
+		switch *formatFlag {
+		case "json":
+			if findings == nil {
+				findings = []lint.Finding{}
+			}
+			err = json.NewEncoder(os.Stdout).Encode(findings)
+		case "sarif":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(lint.SARIF(name, findings))
+		default:
+			printLintFindings(os.Stdout, name, findings)
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, f := range findings {
+			if f.Severity == lint.SeverityError || *strictFlag {
+				return cmderrors.ExitCode(1, nil)
+			}
+		}
+		return nil
+	}
+
+	batchCommands = append(batchCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
+
+// lintBatchSpec validates and lints the batch spec in the given file, which
+// is called name in errors, with the given values of its variables. Errors that make the batch spec invalid are
+// returned as findings, too.
+func lintBatchSpec(ctx context.Context, file, name string, vars map[string]string) ([]lint.Finding, error) {
+	f, err := batchOpenFileFlag(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	setReadDeadlineOnCancel(ctx, f)
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading batch spec")
+	}
+	dir, err := getBatchSpecDirectory(file)
+	if err != nil {
+		return nil, err
+	}
+
+	svc := service.New(&service.Opts{})
+	_, expanded, err := svc.ParseBatchSpec(name, dir, data, vars)
+	if err != nil {
+		errs := []error{err}
+		var multiErr errors.MultiError
+		if errors.As(err, &multiErr) {
+			errs = multiErr.Errors()
+		}
+		var findings []lint.Finding
+		for _, err := range errs {
+			findings = append(findings, lint.Finding{
+				Rule:     lint.RuleInvalidSpec,
+				Severity: lint.SeverityError,
+				Message:  err.Error(),
+			})
+		}
+		return findings, nil
+	}
+
+	findings, err := lint.Lint(expanded)
+	if err != nil {
+		return nil, err
+	}
+
+	// The lines of the expanded batch spec don't match the file, so the
+	// findings are mapped back to the nodes they come from. Findings in
+	// included steps don't have a position in the file.
+	_, positions, err := batcheslib.ExpandBatchSpec(name, dir, data, vars)
+	if err != nil {
+		return nil, err
+	}
+	for i, f := range findings {
+		if f.Line == 0 {
+			continue
+		}
+		source, _ := positions.Source(batcheslib.Position{Line: f.Line, Column: f.Column})
+		findings[i].Line, findings[i].Column = source.Line, source.Column
+	}
+	return findings, nil
+}
+
+func printLintFindings(w io.Writer, name string, findings []lint.Finding) {
+	var errs, warnings int
+	for _, f := range findings {
+		location := name
+		if f.Line > 0 {
+			location += fmt.Sprintf(":%d", f.Line)
+			if f.Column > 0 {
+				location += fmt.Sprintf(":%d", f.Column)
+			}
+		}
+		message := f.Message
+		if f.Path != "" {
+			message = f.Path + ": " + message
+		}
+		fmt.Fprintf(w, "%s: %s: %s [%s]\n", location, f.Severity, message, f.Rule)
+
+		if f.Severity == lint.SeverityError {
+			errs++
+		} else {
+			warnings++
+		}
+	}
+	if len(findings) == 0 {
+		fmt.Fprintln(w, "No problems found.")
+		return
+	}
+	fmt.Fprintf(w, "%d errors, %d warnings.\n", errs, warnings)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/src-cli/internal/batches/lint"
+)
+
+func TestLintBatchSpec_Positions(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "batch.yaml")
+	spec := `name: test
+variables:
+  org:
+    default: sourcegraph
+on:
+  - repositoriesMatchingQuery: repo:^github.com/${{ vars.org }}/
+steps:
+  - include: ./lib.yaml
+  - run: echo ${{ vars.org }}
+    container: alpine
+changesetTemplate:
+  title: Test
+  body: Test
+  branch: test
+  commit:
+    message: Test
+`
+	lib := `steps:
+  - run: echo included
+    container: ubuntu
+`
+	if err := os.WriteFile(file, []byte(spec), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "lib.yaml"), []byte(lib), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	findings, err := lintBatchSpec(context.Background(), file, "batch.yaml", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type position struct {
+		Path         string
+		Line, Column int
+	}
+	var have []position
+	for _, f := range findings {
+		if f.Rule == lint.RuleUnpinnedContainer {
+			have = append(have, position{f.Path, f.Line, f.Column})
+		}
+	}
+	// The included step has no position in the batch spec, and the other
+	// one is reported where it's declared in the file.
+	want := []position{
+		{"steps[0].container", 0, 0},
+		{"steps[1].container", 10, 16},
+	}
+	if diff := cmp.Diff(want, have); diff != "" {
+		t.Fatalf("wrong positions (-want +have):\n%s", diff)
+	}
+}
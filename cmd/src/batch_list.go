@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+	"github.com/sourcegraph/src-cli/internal/batches/service"
+	"github.com/sourcegraph/src-cli/internal/cmderrors"
+)
+
+func init() {
+	usage := `
+'src batch list' lists the batch changes on the Sourcegraph instance.
+
+Usage:
+
+    src batch list [command options]
+
+Examples:
+
+    $ src batch list
+
+    $ src batch list -namespace my-org -state open
+
+    $ src batch list -json
+
+`
+
+	flagSet := flag.NewFlagSet("list", flag.ExitOnError)
+	var (
+		apiFlags  = api.NewFlags(flagSet)
+		namespace = flagSet.String("namespace", "", "Only list the batch changes in this user or organization namespace. Default is all batch changes you can see.")
+		state     = flagSet.String("state", "", "Only list the batch changes in this state: "+enumUsage(batchChangeStates)+".")
+		jsonFlag  = flagSet.Bool("json", false, "Print the batch changes as a JSON array.")
+	)
+	flagSet.StringVar(namespace, "n", "", "Alias for -namespace.")
+
+	handler := func(args []string) error {
+		ctx := context.Background()
+
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if flagSet.NArg() != 0 {
+			return cmderrors.Usage("additional arguments not allowed")
+		}
+		var states []string
+		if s, err := parseEnumFlag("state", *state, batchChangeStates); err != nil {
+			return err
+		} else if s != "" {
+			states = []string{s}
+		}
+
+		svc := service.New(&service.Opts{
+			Client: cfg.apiClient(apiFlags, flagSet.Output()),
+		})
+
+		var namespaceID string
+		if *namespace != "" {
+			ns, err := svc.ResolveNamespace(ctx, *namespace)
+			if err != nil {
+				return err
+			}
+			namespaceID = ns.ID
+		}
+
+		batchChanges, err := svc.ListBatchChanges(ctx, namespaceID, states)
+		if err != nil {
+			return err
+		}
+
+		if *jsonFlag {
+			if batchChanges == nil {
+				batchChanges = []*graphql.BatchChange{}
+			}
+			return json.NewEncoder(os.Stdout).Encode(batchChanges)
+		}
+
+		if len(batchChanges) == 0 {
+			fmt.Println("No batch changes.")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAMESPACE\tNAME\tSTATE\tCHANGESETS\tOPEN\tMERGED\tUPDATED")
+		for _, bc := range batchChanges {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%s\n",
+				bc.Namespace.NamespaceName,
+				bc.Name,
+				bc.State,
+				bc.ChangesetsStats.Total,
+				bc.ChangesetsStats.Open,
+				bc.ChangesetsStats.Merged,
+				bc.UpdatedAt.Format("2006-01-02"),
+			)
+		}
+		return w.Flush()
+	}
+
+	batchCommands = append(batchCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
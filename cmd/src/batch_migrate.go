@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/src-cli/internal/batches/migrate"
+	"github.com/sourcegraph/src-cli/internal/cmderrors"
+)
+
+func init() {
+	usage := `
+'src batch migrate' rewrites a batch spec of an older version to the latest
+version, and explains every change it makes. Comments, blank lines and the
+order of fields are preserved.
+
+Steps use image instead of container, and changesetTemplate.published is
+removed. Constructs that have no equivalent in the latest version, such as
+published values other than false, have to be migrated by hand: the command
+explains how, and exits with status 1 without rewriting the batch spec.
+
+With -check, the batch spec isn't rewritten, and the command exits with
+status 1 if it isn't at the latest version, so that it can run in CI.
+
+Usage:
+
+    src batch migrate [-f] FILE [command options]
+
+Examples:
+
+    $ src batch migrate batch.spec.yaml
+
+    $ src batch migrate -check batch.spec.yaml
+
+    $ src batch migrate -o batch.v3.yaml batch.spec.yaml
+
+`
+
+	flagSet := flag.NewFlagSet("migrate", flag.ExitOnError)
+	var (
+		fileFlag   = flagSet.String("f", "", "The batch spec file to migrate, or - to read from standard input.")
+		checkFlag  = flagSet.Bool("check", false, "Don't rewrite the batch spec, but exit with status 1 if it isn't at the latest version.")
+		outputFlag = flagSet.String("o", "", "Write the migrated batch spec to this file, or - for standard output, instead of rewriting the batch spec. Default is standard output if the batch spec is read from standard input.")
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+
+		file, err := getBatchSpecFile(flagSet, fileFlag)
+		if err != nil {
+			return err
+		}
+		name, output := file, *outputFlag
+		if file == "" || file == "-" {
+			name = "<stdin>"
+			if output == "" {
+				output = "-"
+			}
+		} else if output == "" {
+			output = file
+		}
+
+		f, err := batchOpenFileFlag(file)
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return errors.Wrap(err, "reading batch spec")
+		}
+
+		result, err := migrate.Migrate(data)
+		if err != nil {
+			return errors.Wrap(err, name)
+		}
+
+		// The explanations go to standard error if the batch spec is written to
+		// standard output.
+		log := os.Stdout
+		if output == "-" && !*checkFlag {
+			log = os.Stderr
+		}
+		printMigrationChanges(log, name, result)
+
+		if len(result.Unsupported) > 0 {
+			fmt.Fprintf(log, "%s can't be migrated to version %d automatically.\n", name, migrate.LatestVersion)
+			return cmderrors.ExitCode(1, nil)
+		}
+		if result.FromVersion == migrate.LatestVersion {
+			fmt.Fprintf(log, "%s is already at version %d.\n", name, migrate.LatestVersion)
+			if output != file && !*checkFlag {
+				return writeMigratedBatchSpec(output, data)
+			}
+			return nil
+		}
+		if *checkFlag {
+			fmt.Fprintf(log, "%s is at version %d, run 'src batch migrate' to migrate it to version %d.\n", name, result.FromVersion, migrate.LatestVersion)
+			return cmderrors.ExitCode(1, nil)
+		}
+
+		dir, err := getBatchSpecDirectory(file)
+		if err != nil {
+			return err
+		}
+		// Variables aren't expanded, since the migrated batch spec is written
+		// with them.
+		if _, _, err := batcheslib.ParseBatchSpecWithIncludes(name, dir, result.Spec); err != nil {
+			return errors.Wrap(err, "the migrated batch spec isn't valid")
+		}
+
+		if err := writeMigratedBatchSpec(output, result.Spec); err != nil {
+			return err
+		}
+		fmt.Fprintf(log, "Migrated %s from version %d to version %d.\n", name, result.FromVersion, migrate.LatestVersion)
+		return nil
+	}
+
+	batchCommands = append(batchCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
+
+func printMigrationChanges(w io.Writer, name string, result *migrate.Result) {
+	printChange := func(kind string, c migrate.Change) {
+		location := name
+		if c.Line > 0 {
+			location += fmt.Sprintf(":%d", c.Line)
+		}
+		fmt.Fprintf(w, "%s: %s: %s: %s\n", location, kind, c.Path, c.Message)
+	}
+	for _, c := range result.Changes {
+		printChange("changed", c)
+	}
+	for _, c := range result.Unsupported {
+		printChange("error", c)
+	}
+}
+
+// writeMigratedBatchSpec writes the batch spec to the given file, keeping its
+// permissions if it exists, or to standard output if file is "-".
+func writeMigratedBatchSpec(file string, data []byte) error {
+	if file == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(file); err == nil {
+		mode = info.Mode().Perm()
+	}
+	return errors.Wrap(os.WriteFile(file, data, mode), "writing migrated batch spec")
+}
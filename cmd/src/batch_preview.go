@@ -24,6 +24,12 @@ Examples:
 
     $ src batch preview batch.spec.yaml
 
+  Retry only the workspaces that failed in a previous execution, given its
+  run ID or its report:
+
+    $ src batch preview -skip-errors -report junit.xml -f batch.spec.yaml
+    $ src batch preview -retry-failed junit.xml -f batch.spec.yaml
+
 `
 
 	flagSet := flag.NewFlagSet("preview", flag.ExitOnError)
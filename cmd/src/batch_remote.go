@@ -5,13 +5,19 @@ import (
 	"flag"
 	"fmt"
 	cliLog "log"
+	"os"
+	"os/signal"
+	"strings"
 	"time"
 
+	"github.com/mattn/go-isatty"
+
 	"github.com/sourcegraph/sourcegraph/lib/errors"
 	"github.com/sourcegraph/sourcegraph/lib/output"
 
 	"github.com/sourcegraph/src-cli/internal/batches/service"
 	"github.com/sourcegraph/src-cli/internal/batches/ui"
+	"github.com/sourcegraph/src-cli/internal/cmderrors"
 )
 
 func init() {
@@ -26,13 +32,20 @@ Examples:
 
     $ src batch remote -f batch.spec.yaml
 
+    $ src batch remote -watch -f batch.spec.yaml
+
+With -watch, the command follows the execution until it's done, prints the
+logs of the workspaces that fail, and exits with status 1 if any workspace
+failed. Pressing Ctrl-C offers to cancel the execution on Sourcegraph.
+
 `
 
 	flagSet := flag.NewFlagSet("remote", flag.ExitOnError)
 	flags := newBatchExecutionFlags(flagSet)
 
 	var (
-		fileFlag = flagSet.String("f", "", "The name of the batch spec file to run.")
+		fileFlag  = flagSet.String("f", "", "The name of the batch spec file to run.")
+		watchFlag = flagSet.Bool("watch", false, "Follow the execution until it's done and exit with status 1 if any workspace failed.")
 	)
 
 	handler := func(args []string) error {
@@ -72,7 +85,7 @@ Examples:
 		// may as well validate it at the same time so we don't even have to go to
 		// the backend if it's invalid.
 		ui.ParsingBatchSpec()
-		spec, batchSpecDir, raw, err := parseBatchSpec(ctx, file, svc)
+		spec, batchSpecDir, raw, err := parseBatchSpec(ctx, file, flags.vars, svc)
 		if err != nil {
 			ui.ParsingBatchSpecFailure(err)
 			return err
@@ -164,6 +177,9 @@ Examples:
 		).String()
 		ui.RemoteSuccess(executionURL)
 
+		if *watchFlag {
+			return watchBatchSpecExecution(ctx, svc, ui, batchSpecID, executionURL)
+		}
 		return nil
 	}
 
@@ -178,3 +194,141 @@ Examples:
 		},
 	})
 }
+
+// remoteLogTailLines is the number of log lines printed for every failed step
+// of a workspace when watching a server-side execution, unless -v is given.
+const remoteLogTailLines = 20
+
+// watchBatchSpecExecution polls the state of the server-side execution of the
+// batch spec until it's done, and prints the logs of failed workspaces as they
+// fail. If any workspace fails, the returned error exits with status 1.
+func watchBatchSpecExecution(ctx context.Context, svc *service.Service, ui *ui.TUI, batchSpecID, executionURL string) error {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	reported := map[string]bool{}
+	watching := false
+	for {
+		execution, err := svc.GetBatchSpecExecution(ctx, batchSpecID)
+		if err != nil {
+			return err
+		}
+
+		var done, failed int
+		for _, ws := range execution.Workspaces {
+			if ws.Done() {
+				done++
+			}
+			if ws.State == "FAILED" {
+				failed++
+			}
+		}
+		if !watching {
+			ui.WatchingExecution(len(execution.Workspaces))
+			watching = true
+		}
+		ui.WatchingExecutionProgress(done, failed, len(execution.Workspaces))
+
+		for _, ws := range execution.Workspaces {
+			if ws.State != "FAILED" || reported[ws.ID] {
+				continue
+			}
+			reported[ws.ID] = true
+
+			var logs []string
+			if !ws.Hidden() {
+				steps, err := svc.GetBatchSpecWorkspaceSteps(ctx, ws.ID)
+				if err != nil {
+					return err
+				}
+				logs = failedStepLogs(steps, *verbose)
+			}
+			ui.WorkspaceFailed(workspaceDisplayName(ws), ws.FailureMessage, logs)
+		}
+
+		if execution.Done() {
+			ui.WatchingExecutionSuccess(execution.State, failed)
+			if failed > 0 || execution.State != "COMPLETED" {
+				return cmderrors.ExitCode(1, nil)
+			}
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-interrupt:
+			ui.WatchingExecutionInterrupted()
+			// Stop catching interrupts, so that a second Ctrl-C while we're
+			// asking exits src instead of being ignored.
+			signal.Stop(interrupt)
+			cancel := false
+			if isatty.IsTerminal(os.Stdin.Fd()) {
+				// An error reading the answer, such as a second Ctrl-C, counts
+				// as no.
+				cancel, _ = verify("Cancel the execution on Sourcegraph?")
+			}
+			if !cancel {
+				return cmderrors.ExitCode(1, errors.Newf("stopped watching the execution, which continues at %s", executionURL))
+			}
+
+			ui.CancelingExecution()
+			if err := svc.CancelBatchSpecExecution(ctx, batchSpecID); err != nil {
+				return err
+			}
+			ui.CancelingExecutionSuccess()
+			return cmderrors.ExitCode(1, nil)
+		}
+	}
+}
+
+// failedStepLogs returns the logs of the steps that exited with a non-zero
+// exit code, or of the last step if none did. Only the last lines of every
+// log are returned, unless all is true.
+func failedStepLogs(steps []service.BatchSpecWorkspaceStep, all bool) []string {
+	var failed []service.BatchSpecWorkspaceStep
+	for _, step := range steps {
+		if step.ExitCode != nil && *step.ExitCode != 0 {
+			failed = append(failed, step)
+		}
+	}
+	if len(failed) == 0 && len(steps) > 0 {
+		failed = steps[len(steps)-1:]
+	}
+
+	var logs []string
+	for _, step := range failed {
+		header := fmt.Sprintf("step %d: %s", step.Number, strings.TrimSpace(step.Run))
+		if step.ExitCode != nil {
+			header += fmt.Sprintf(" (exit code %d)", *step.ExitCode)
+		}
+		logs = append(logs, header)
+
+		lines := step.OutputLines.Nodes
+		if !all && len(lines) > remoteLogTailLines {
+			logs = append(logs, fmt.Sprintf("... %d lines omitted, use -v to see them", len(lines)-remoteLogTailLines))
+			lines = lines[len(lines)-remoteLogTailLines:]
+		}
+		for _, line := range lines {
+			logs = append(logs, "  "+line)
+		}
+	}
+	return logs
+}
+
+func workspaceDisplayName(ws *service.BatchSpecWorkspace) string {
+	if ws.Hidden() {
+		return "Hidden workspace"
+	}
+	name := ws.Repository.Name
+	if ws.Branch.DisplayName != "" {
+		name += "@" + ws.Branch.DisplayName
+	}
+	if ws.Path != "" {
+		name += ":" + ws.Path
+	}
+	return name
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/src-cli/internal/batches/report"
+	"github.com/sourcegraph/src-cli/internal/cmderrors"
+)
+
+func init() {
+	usage := `
+'src batch report' converts the JSON lines log of an execution, written by
+'src batch preview -text-only' or 'src batch apply -text-only', to a report
+with a test case for every workspace: its steps with their timings, failures
+with the tail of the standard error of the failed step, diff statistics, and
+a link to the preview of the changeset specs.
+
+The report is JUnit XML if the output file ends in .xml, or HTML if it ends
+in .html. Use -report on 'src batch preview' and 'src batch apply' to write
+the report while executing.
+
+Usage:
+
+    src batch report -o FILE [LOG]
+
+The log is read from standard input if LOG is omitted or -.
+
+Examples:
+
+    $ src batch preview -text-only -f batch.spec.yaml > execution.jsonl
+    $ src batch report -o junit.xml execution.jsonl
+
+    $ src batch report -o report.html < execution.jsonl
+
+`
+
+	flagSet := flag.NewFlagSet("report", flag.ExitOnError)
+	outputFlag := flagSet.String("o", "", "The report file to write, ending in .xml for JUnit XML or .html for HTML. Required.")
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if *outputFlag == "" {
+			return cmderrors.Usage("-o must be given")
+		}
+		if err := report.CheckFormat(*outputFlag); err != nil {
+			return cmderrors.Usage(err.Error())
+		}
+		if flagSet.NArg() > 1 {
+			return errAdditionalArguments
+		}
+
+		in := os.Stdin
+		if file := flagSet.Arg(0); file != "" && file != "-" {
+			f, err := os.Open(file)
+			if err != nil {
+				return errors.Wrap(err, "opening log")
+			}
+			defer f.Close()
+			in = f
+		}
+
+		r, err := report.ReadLog(in)
+		if err != nil {
+			return err
+		}
+		if len(r.Workspaces) == 0 {
+			return errors.New("the log doesn't contain any executed workspaces")
+		}
+		return report.Write(*outputFlag, r)
+	}
+
+	batchCommands = append(batchCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
@@ -36,8 +36,9 @@ Examples:
 	flagSet := flag.NewFlagSet("repositories", flag.ExitOnError)
 
 	var (
-		fileFlag = flagSet.String("f", "", "The batch spec file to read, or - to read from standard input.")
-		apiFlags = api.NewFlags(flagSet)
+		fileFlag  = flagSet.String("f", "", "The batch spec file to read, or - to read from standard input.")
+		apiFlags  = api.NewFlags(flagSet)
+		varsFlags = newBatchVariablesFlags(flagSet)
 	)
 
 	var (
@@ -89,7 +90,7 @@ Examples:
 		}
 
 		out := output.NewOutput(flagSet.Output(), output.OutputOpts{Verbose: *verbose})
-		spec, _, _, err := parseBatchSpec(ctx, file, svc)
+		spec, _, _, err := parseBatchSpec(ctx, file, varsFlags, svc)
 		if err != nil {
 			ui := &ui.TUI{Out: out}
 			ui.ParsingBatchSpecFailure(err)
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+	"github.com/sourcegraph/src-cli/internal/batches/service"
+)
+
+func init() {
+	usage := `
+'src batch status' shows the state of a batch change and of its changesets,
+including their CI and review states.
+
+Usage:
+
+    src batch status [command options] NAME
+
+Examples:
+
+    $ src batch status my-batch-change
+
+    $ src batch status -review-state changes-requested my-batch-change
+
+`
+
+	flagSet := flag.NewFlagSet("status", flag.ExitOnError)
+	var (
+		flags     = newBatchChangeFlags(flagSet)
+		selectors = newChangesetSelectorFlags(flagSet)
+	)
+
+	handler := func(args []string) error {
+		ctx := context.Background()
+
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		filter, err := selectors.filter()
+		if err != nil {
+			return err
+		}
+
+		svc := service.New(&service.Opts{
+			Client: cfg.apiClient(flags.api, flagSet.Output()),
+		})
+
+		batchChange, ok, err := flags.batchChange(ctx, flagSet, svc)
+		if err != nil || !ok {
+			return err
+		}
+		changesets, err := svc.ListChangesets(ctx, batchChange.ID, filter)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s/%s (%s)\n", batchChange.Namespace.NamespaceName, batchChange.Name, batchChange.State)
+		fmt.Println(cfg.endpointURL.JoinPath(batchChange.URL).String())
+		fmt.Println()
+		fmt.Println("Changesets:", formatChangesetsStats(batchChange.ChangesetsStats))
+		if !selectors.empty() {
+			fmt.Printf("Selected:   %d\n", len(changesets))
+		}
+		fmt.Println("CI:        ", formatStateCounts(changesets, func(c *graphql.Changeset) string { return c.CheckState }))
+		fmt.Println("Reviews:   ", formatStateCounts(changesets, func(c *graphql.Changeset) string { return c.ReviewState }))
+
+		if len(changesets) == 0 {
+			return nil
+		}
+		fmt.Println()
+		return printChangesets(os.Stdout, changesets)
+	}
+
+	batchCommands = append(batchCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
+
+// formatChangesetsStats lists the number of changesets in every state that
+// has any, e.g. "10 total, 4 open, 6 merged".
+func formatChangesetsStats(stats graphql.BatchChangeStatistics) string {
+	parts := []string{fmt.Sprintf("%d total", stats.Total)}
+	for _, s := range []struct {
+		name  string
+		count int
+	}{
+		{"unpublished", stats.Unpublished},
+		{"scheduled", stats.Scheduled},
+		{"processing", stats.Processing},
+		{"retrying", stats.Retrying},
+		{"failed", stats.Failed},
+		{"draft", stats.Draft},
+		{"open", stats.Open},
+		{"merged", stats.Merged},
+		{"closed", stats.Closed},
+		{"deleted", stats.Deleted},
+		{"archived", stats.Archived},
+	} {
+		if s.count > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", s.count, s.name))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatStateCounts counts the changesets by the state that fn returns, in
+// the order the states first appear. Changesets without a state, such as
+// unpublished ones, aren't counted.
+func formatStateCounts(changesets []*graphql.Changeset, fn func(*graphql.Changeset) string) string {
+	var (
+		states []string
+		counts = map[string]int{}
+	)
+	for _, c := range changesets {
+		state := fn(c)
+		if state == "" {
+			continue
+		}
+		if counts[state] == 0 {
+			states = append(states, state)
+		}
+		counts[state]++
+	}
+	if len(states) == 0 {
+		return "-"
+	}
+
+	parts := make([]string, len(states))
+	for i, state := range states {
+		parts[i] = fmt.Sprintf("%d %s", counts[state], strings.ToLower(strings.ReplaceAll(state, "_", " ")))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -28,11 +28,14 @@ Examples:
 
     $ src batch validate -f batch.spec.yaml
 
+    $ src batch validate -var org=sourcegraph -var-file vars.yaml batch.spec.yaml
+
 `
 
 	flagSet := flag.NewFlagSet("validate", flag.ExitOnError)
 	apiFlags := api.NewFlags(flagSet)
 	fileFlag := flagSet.String("f", "", "The batch spec file to read, or - to read from standard input.")
+	varsFlags := newBatchVariablesFlags(flagSet)
 
 	var (
 		allowUnsupported bool
@@ -88,7 +91,7 @@ Examples:
 			return err
 		}
 
-		if _, _, _, err := parseBatchSpec(ctx, file, svc); err != nil {
+		if _, _, _, err := parseBatchSpec(ctx, file, varsFlags, svc); err != nil {
 			ui.ParsingBatchSpecFailure(err)
 			return err
 		}
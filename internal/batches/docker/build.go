@@ -0,0 +1,42 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+)
+
+// builtImageRepository is the repository used for the images created by
+// buildImage steps.
+const builtImageRepository = "src-batch-build-image"
+
+// BuiltImageName returns the name of the image that results from running
+// script in the image with the given content digest. The name only depends on
+// its inputs, so that built images can be reused across workspaces and runs.
+func BuiltImageName(baseDigest, script string) string {
+	h := sha256.New()
+	h.Write([]byte(baseDigest))
+	h.Write([]byte{0})
+	h.Write([]byte(script))
+	return builtImageRepository + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// imageBuild describes how to build an image that doesn't exist locally.
+type imageBuild struct {
+	runtime ContainerRuntime
+	base    Image
+	script  string
+}
+
+// run builds the image by running the script in a container of the base image
+// and committing the result as name.
+func (b *imageBuild) run(ctx context.Context, name string) error {
+	digest, err := b.base.Digest(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting base image digest")
+	}
+
+	return b.runtime.CommitImage(ctx, digest, b.script, name)
+}
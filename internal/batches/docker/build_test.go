@@ -0,0 +1,88 @@
+package docker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourcegraph/src-cli/internal/exec/expect"
+)
+
+func TestBuiltImageName(t *testing.T) {
+	name := BuiltImageName("digest", "apk add git")
+	assert.Equal(t, name, BuiltImageName("digest", "apk add git"))
+	assert.NotEqual(t, name, BuiltImageName("other-digest", "apk add git"))
+	assert.NotEqual(t, name, BuiltImageName("digest", "apk add curl"))
+}
+
+func TestImageCache_Build(t *testing.T) {
+	ctx := context.Background()
+	name := BuiltImageName("base-digest", "apk add git")
+
+	t.Run("already built", func(t *testing.T) {
+		expect.Commands(
+			t,
+			inspectSuccess("alpine:3", "base-digest"),
+			inspectSuccess(name, "built-digest"),
+		)
+
+		cache := NewImageCache(NewDockerRuntime())
+		haveName, img, err := cache.Build(ctx, "alpine:3", "apk add git")
+		require.NoError(t, err)
+		assert.Equal(t, name, haveName)
+		assert.Same(t, cache.Get(name), img)
+
+		digest, err := img.Digest(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "built-digest", digest)
+	})
+
+	t.Run("build required", func(t *testing.T) {
+		expect.Commands(
+			t,
+			inspectSuccess("alpine:3", "base-digest"),
+			inspectFailure(name),
+			expect.NewGlob(
+				expect.Behaviour{Stdout: []byte("container-id\n")},
+				"docker", "create", "--entrypoint", "/bin/sh", "base-digest", "-c", "apk add git",
+			),
+			expect.NewGlob(expect.Success, "docker", "start", "--attach", "container-id"),
+			expect.NewGlob(expect.Success, "docker", "commit", "container-id", name),
+			expect.NewGlob(expect.Success, "docker", "rm", "-f", "--", "container-id"),
+			inspectSuccess(name, "built-digest"),
+		)
+
+		cache := NewImageCache(NewDockerRuntime())
+		haveName, img, err := cache.Build(ctx, "alpine:3", "apk add git")
+		require.NoError(t, err)
+		assert.Equal(t, name, haveName)
+
+		digest, err := img.Digest(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "built-digest", digest)
+	})
+
+	t.Run("build failure", func(t *testing.T) {
+		expect.Commands(
+			t,
+			inspectSuccess("alpine:3", "base-digest"),
+			inspectFailure(name),
+			expect.NewGlob(
+				expect.Behaviour{Stdout: []byte("container-id\n")},
+				"docker", "create", "--entrypoint", "/bin/sh", "base-digest", "-c", "apk add git",
+			),
+			expect.NewGlob(
+				expect.Behaviour{Stderr: []byte("package not found"), ExitCode: 1},
+				"docker", "start", "--attach", "container-id",
+			),
+			expect.NewGlob(expect.Success, "docker", "rm", "-f", "--", "container-id"),
+		)
+
+		cache := NewImageCache(NewDockerRuntime())
+		_, _, err := cache.Build(ctx, "alpine:3", "apk add git")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "package not found")
+	})
+}
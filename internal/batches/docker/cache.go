@@ -10,18 +10,23 @@ import (
 type ImageCache interface {
 	Get(name string) Image
 	Ensure(ctx context.Context, name string) (Image, error)
+	// Build returns the image that results from running script in baseImage,
+	// building it if it doesn't exist locally yet, along with its name.
+	Build(ctx context.Context, baseImage, script string) (string, Image, error)
 }
 
-// imageCache is a cache of metadata about Docker images, indexed by name.
+// imageCache is a cache of metadata about container images, indexed by name.
 type imageCache struct {
+	runtime  ContainerRuntime
 	images   map[string]Image
 	imagesMu sync.Mutex
 }
 
-// NewImageCache creates a new image cache.
-func NewImageCache() ImageCache {
+// NewImageCache creates a new image cache for images of the given runtime.
+func NewImageCache(runtime ContainerRuntime) ImageCache {
 	return &imageCache{
-		images: make(map[string]Image),
+		runtime: runtime,
+		images:  make(map[string]Image),
 	}
 }
 
@@ -36,7 +41,7 @@ func (ic *imageCache) Get(name string) Image {
 		return image
 	}
 
-	image := &image{name: name}
+	image := &image{name: name, runtime: ic.runtime}
 	ic.images[name] = image
 	return image
 }
@@ -52,3 +57,38 @@ func (ic *imageCache) Ensure(ctx context.Context, name string) (Image, error) {
 
 	return img, nil
 }
+
+// Build returns the image cache entry for the image that results from running
+// script in baseImage and makes sure it exists on disk. The image is named by
+// BuiltImageName, so subsequent calls to Get with that name return the same
+// entry.
+func (ic *imageCache) Build(ctx context.Context, baseImage, script string) (string, Image, error) {
+	base, err := ic.Ensure(ctx, baseImage)
+	if err != nil {
+		return "", nil, err
+	}
+	digest, err := base.Digest(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	name := BuiltImageName(digest, script)
+
+	ic.imagesMu.Lock()
+	img, ok := ic.images[name]
+	if !ok {
+		img = &image{
+			name:    name,
+			runtime: ic.runtime,
+			build:   &imageBuild{runtime: ic.runtime, base: base, script: script},
+		}
+		ic.images[name] = img
+	}
+	ic.imagesMu.Unlock()
+
+	if err := img.Ensure(ctx); err != nil {
+		return "", nil, errors.Wrapf(err, "building image from %q", baseImage)
+	}
+
+	return name, img, nil
+}
@@ -0,0 +1,193 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	goexec "os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/src-cli/internal/exec"
+)
+
+// cliRuntime is a ContainerRuntime that shells out to a Docker compatible
+// command line client.
+type cliRuntime struct {
+	binary string
+}
+
+var _ ContainerRuntime = &cliRuntime{}
+
+// NewDockerRuntime returns the ContainerRuntime that uses the docker command.
+func NewDockerRuntime() ContainerRuntime {
+	return &cliRuntime{binary: RuntimeDocker}
+}
+
+func (rt *cliRuntime) Name() string { return rt.binary }
+
+// InspectImage returns the content digest for the image. Note that this is
+// different from the "distribution digest" (which is what you can use to
+// specify an image to `docker run`, as in `my/image@sha256:xxx`). We need to
+// use the content digest because the distribution digest is only computed for
+// images that have been pulled from or pushed to a registry. See
+// https://windsock.io/explaining-docker-image-ids/ under "A Final Twist" for a
+// good explanation.
+func (rt *cliRuntime) InspectImage(ctx context.Context, name string) (string, error) {
+	// Since we are only asking the runtime for local information, we expect
+	// this operation to be quick, and therefore set a relatively low timeout
+	// for it to respond. This is particularly useful because this function is
+	// usually the first non-trivial interaction we have with the runtime in a
+	// src-cli invocation, and this allows us to catch failure modes that
+	// result in the Docker socket still listening and accepting connections,
+	// but where dockerd is no longer able to respond to non-trivial requests.
+	//
+	// Anecdotally, this seems to happen most frequently with Docker Desktop
+	// VMs running out of memory, whereupon the Linux kernel's OOM killer
+	// sometimes chooses to kill components of Docker instead of processes
+	// within containers.
+	dctx, cancel, err := withFastCommandContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer cancel()
+
+	args := []string{"image", "inspect", "--format", "{{ .Id }}", name}
+	out, err := exec.CommandContext(dctx, rt.binary, args...).Output()
+	if errors.IsDeadlineExceeded(err) || errors.IsDeadlineExceeded(dctx.Err()) {
+		return "", newFastCommandTimeoutError(dctx, rt.binary, args...)
+	} else if err != nil {
+		return "", err
+	}
+
+	return string(bytes.TrimSpace(out)), nil
+}
+
+func (rt *cliRuntime) PullImage(ctx context.Context, name string) error {
+	pullCmd := exec.CommandContext(ctx, rt.binary, "image", "pull", name)
+	var stderr bytes.Buffer
+	pullCmd.Stderr = &stderr
+	if err := pullCmd.Run(); err != nil {
+		exitErr := &goexec.ExitError{}
+		if errors.As(err, &exitErr) {
+			return errors.Newf("failed to pull image: %s\n%s pull exited with code %d", stderr.String(), rt.binary, exitErr.ExitCode())
+		}
+		return errors.Wrap(err, "pulling image")
+	}
+	return nil
+}
+
+func (rt *cliRuntime) CommitImage(ctx context.Context, digest, script, name string) error {
+	out, err := exec.CommandContext(ctx, rt.binary, "create", "--entrypoint", "/bin/sh", digest, "-c", script).Output()
+	if err != nil {
+		return errors.Wrap(err, "creating build container")
+	}
+	id := string(bytes.TrimSpace(out))
+	defer func() {
+		// Use a fresh context, so that the container is also removed when the
+		// build was cancelled.
+		_ = rt.RemoveContainer(context.Background(), id)
+	}()
+
+	// start --attach exits with the exit code of the container.
+	if out, err := exec.CommandContext(ctx, rt.binary, "start", "--attach", id).CombinedOutput(); err != nil {
+		exitErr := &goexec.ExitError{}
+		if errors.As(err, &exitErr) {
+			return errors.Newf("build script exited with code %d:\n%s", exitErr.ExitCode(), strings.TrimSpace(string(out)))
+		}
+		return errors.Wrap(err, "running build container")
+	}
+
+	if err := exec.CommandContext(ctx, rt.binary, "commit", id, name).Run(); err != nil {
+		return errors.Wrap(err, "committing build container")
+	}
+
+	return nil
+}
+
+func (rt *cliRuntime) Run(ctx context.Context, args ...string) (*goexec.Cmd, error) {
+	return exec.CommandContext(ctx, rt.binary, append([]string{"run"}, args...)...), nil
+}
+
+func (rt *cliRuntime) RemoveContainer(ctx context.Context, id string) error {
+	return exec.CommandContext(ctx, rt.binary, "rm", "-f", "--", id).Run()
+}
+
+func (rt *cliRuntime) ContainerOOMKilled(ctx context.Context, id string) (bool, error) {
+	out, err := exec.CommandContext(ctx, rt.binary, "container", "inspect", "--format", "{{ .State.OOMKilled }}", "--", id).Output()
+	if err != nil {
+		return false, errors.Wrap(err, "inspecting container")
+	}
+	return strconv.ParseBool(string(bytes.TrimSpace(out)))
+}
+
+func (rt *cliRuntime) CreateVolume(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, rt.binary, "volume", "create").CombinedOutput()
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytes.TrimSpace(out)), nil
+}
+
+func (rt *cliRuntime) RemoveVolume(ctx context.Context, name string) error {
+	return exec.CommandContext(ctx, rt.binary, "volume", "rm", name).Run()
+}
+
+// podmanRuntime is the ContainerRuntime for Podman. Podman's command line
+// client is compatible with Docker's, except for a few differences handled
+// here.
+type podmanRuntime struct {
+	cliRuntime
+}
+
+var _ ContainerRuntime = &podmanRuntime{}
+
+// NewPodmanRuntime returns the ContainerRuntime that uses the podman command.
+func NewPodmanRuntime() ContainerRuntime {
+	return &podmanRuntime{cliRuntime{binary: RuntimePodman}}
+}
+
+// CurrentContext always returns an empty string, since Podman has no
+// contexts.
+func (rt *podmanRuntime) CurrentContext(ctx context.Context) (string, error) {
+	return "", nil
+}
+
+func (rt *podmanRuntime) InspectImage(ctx context.Context, name string) (string, error) {
+	digest, err := rt.cliRuntime.InspectImage(ctx, name)
+	if err == nil || errors.HasType[*fastCommandTimeoutError](err) {
+		return digest, err
+	}
+	if qualified := qualifyImageName(name); qualified != name {
+		// Images that were pulled with their qualified name might not be
+		// found by their short name, depending on the registries
+		// configuration.
+		return rt.cliRuntime.InspectImage(ctx, qualified)
+	}
+	return digest, err
+}
+
+func (rt *podmanRuntime) PullImage(ctx context.Context, name string) error {
+	// Depending on its short name mode, Podman either prompts for a registry
+	// or refuses to pull short names, so we resolve them like Docker does.
+	return rt.cliRuntime.PullImage(ctx, qualifyImageName(name))
+}
+
+// qualifyImageName prefixes names of images on Docker Hub with the registry,
+// e.g. "alpine:3" becomes "docker.io/library/alpine:3". Names that already
+// contain a registry and image IDs are returned as they are.
+func qualifyImageName(name string) string {
+	if strings.HasPrefix(name, "sha256:") {
+		return name
+	}
+	first, _, found := strings.Cut(name, "/")
+	if !found {
+		return "docker.io/library/" + name
+	}
+	if first == "localhost" || strings.ContainsAny(first, ".:") {
+		return name
+	}
+	return "docker.io/" + name
+}
@@ -4,12 +4,13 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"sync"
 	"time"
 
 	"github.com/kballard/go-shellquote"
 	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/src-cli/internal/exec"
 )
 
 // withFastCommandContext wraps the given context with a timeout appropriate for
@@ -18,7 +19,7 @@ import (
 // by the undocumented $SRC_DOCKER_FAST_COMMAND_TIMEOUT environment variable.
 //
 // If the context deadline is exceeded, the code using the context can pass the
-// context and Docker arguments to newFastCommandTimeoutError to get a nicely
+// context, the runtime binary and its arguments to newFastCommandTimeoutError to get a nicely
 // formatted error for the user.
 func withFastCommandContext(ctx context.Context) (context.Context, context.CancelFunc, error) {
 	timeout, err := fastCommandTimeout()
@@ -34,11 +35,12 @@ func withFastCommandContext(ctx context.Context) (context.Context, context.Cance
 }
 
 type fastCommandTimeoutError struct {
+	binary  string
 	args    []string
 	timeout time.Duration
 }
 
-func newFastCommandTimeoutError(ctx context.Context, args ...string) error {
+func newFastCommandTimeoutError(ctx context.Context, binary string, args ...string) error {
 	// Attempt to extract the timeout from the context.
 	timeout, ok := ctx.Value(fastCommandTimeoutEnv).(time.Duration)
 	if !ok {
@@ -46,12 +48,13 @@ func newFastCommandTimeoutError(ctx context.Context, args ...string) error {
 			"additional error found when attempting to create fastCommandTimeoutError: "+
 				"no timeout was set within the context, so the context probably wasn't wrapped "+
 				"with withFastCommandContext (please file a bug report on src-cli!): "+
-				"the original error involved invoking docker with these args: %q",
-			args,
+				"the original error involved invoking %s with these args: %q",
+			binary, args,
 		)
 	}
 
 	return &fastCommandTimeoutError{
+		binary:  binary,
 		args:    args,
 		timeout: timeout,
 	}
@@ -59,9 +62,9 @@ func newFastCommandTimeoutError(ctx context.Context, args ...string) error {
 
 func (e *fastCommandTimeoutError) Error() string {
 	return fmt.Sprintf(
-		"`docker %s` failed to respond within %s; "+
-			"please verify that Docker has been started and is responding normally",
-		shellquote.Join(e.args...), e.timeout,
+		"`%s %s` failed to respond within %s; "+
+			"please verify that %s has been started and is responding normally",
+		e.binary, shellquote.Join(e.args...), e.timeout, e.binary,
 	)
 }
 
@@ -98,18 +101,19 @@ func fastCommandTimeout() (time.Duration, error) {
 	return fastCommandTimeoutData.timeout, fastCommandTimeoutData.err
 }
 
-// executeFastCommand creates a fastCommandContext used to execute docker commands
-// with a timeout for docker commands that are supposed to be fast (e.g docker info).
-func executeFastCommand(ctx context.Context, args ...string) ([]byte, error) {
+// executeFastCommand creates a fastCommandContext used to execute runtime
+// commands with a timeout for commands that are supposed to be fast (e.g
+// docker info).
+func executeFastCommand(ctx context.Context, binary string, args ...string) ([]byte, error) {
 	dctx, cancel, err := withFastCommandContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 	defer cancel()
 
-	out, err := exec.CommandContext(dctx, "docker", args...).CombinedOutput()
+	out, err := exec.CommandContext(dctx, binary, args...).CombinedOutput()
 	if errors.IsDeadlineExceeded(err) || errors.IsDeadlineExceeded(dctx.Err()) {
-		return nil, newFastCommandTimeoutError(dctx, args...)
+		return nil, newFastCommandTimeoutError(dctx, binary, args...)
 	}
 
 	return out, err
@@ -0,0 +1,88 @@
+package docker
+
+import (
+	"context"
+	goexec "os/exec"
+	"runtime"
+	"slices"
+
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+)
+
+// RuntimeHost is the name of the host runtime. It can't be selected with
+// NewRuntime, since it's only used together with host workspaces.
+const RuntimeHost = "host"
+
+// ErrHostContainer is returned by the host runtime when a container would have
+// to be run, e.g. for a coding agent step that runs in its container.
+var ErrHostContainer = errors.New("containers can't be run when running steps on the host")
+
+// hostRuntime is the ContainerRuntime used when steps are run directly on the
+// host instead of in containers. It doesn't run any containers: it only
+// validates the images of steps against an allowlist, so that the executor can
+// still resolve and prepare the images of a batch spec like it always does.
+type hostRuntime struct {
+	allowedImages []string
+}
+
+var _ ContainerRuntime = &hostRuntime{}
+
+// NewHostRuntime returns the ContainerRuntime for steps that are run on the
+// host. If allowedImages is not empty, steps that use any other image fail.
+// Otherwise, the images of steps are ignored.
+func NewHostRuntime(allowedImages []string) ContainerRuntime {
+	return &hostRuntime{allowedImages: allowedImages}
+}
+
+func (rt *hostRuntime) Name() string { return RuntimeHost }
+
+func (rt *hostRuntime) CheckVersion(ctx context.Context) error { return nil }
+
+func (rt *hostRuntime) CurrentContext(ctx context.Context) (string, error) { return "", nil }
+
+func (rt *hostRuntime) NCPU(ctx context.Context) (int, error) { return runtime.NumCPU(), nil }
+
+// InspectImage returns a digest derived from the name of the image, since
+// there's no image to inspect. It returns an error if the image is not
+// allowed.
+func (rt *hostRuntime) InspectImage(ctx context.Context, name string) (string, error) {
+	if err := rt.checkImage(name); err != nil {
+		return "", err
+	}
+	return "host:" + name, nil
+}
+
+// PullImage doesn't pull anything, but fails for images that are not allowed.
+func (rt *hostRuntime) PullImage(ctx context.Context, name string) error {
+	return rt.checkImage(name)
+}
+
+func (rt *hostRuntime) CommitImage(ctx context.Context, digest, script, name string) error {
+	return errors.New("images can't be built when running steps on the host")
+}
+
+// Run always returns ErrHostContainer, since there are no containers to run.
+func (rt *hostRuntime) Run(ctx context.Context, args ...string) (*goexec.Cmd, error) {
+	return nil, ErrHostContainer
+}
+
+func (rt *hostRuntime) RemoveContainer(ctx context.Context, id string) error { return nil }
+
+func (rt *hostRuntime) ContainerOOMKilled(ctx context.Context, id string) (bool, error) {
+	return false, nil
+}
+
+func (rt *hostRuntime) CreateVolume(ctx context.Context) (string, error) {
+	return "", errors.New("volumes are not supported when running steps on the host")
+}
+
+func (rt *hostRuntime) RemoveVolume(ctx context.Context, name string) error {
+	return errors.New("volumes are not supported when running steps on the host")
+}
+
+func (rt *hostRuntime) checkImage(name string) error {
+	if len(rt.allowedImages) > 0 && !slices.Contains(rt.allowedImages, name) {
+		return errors.Newf("image %q is not allowed to run on the host", name)
+	}
+	return nil
+}
@@ -4,13 +4,10 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	goexec "os/exec"
 	"strings"
 	"sync"
 
 	"github.com/sourcegraph/sourcegraph/lib/errors"
-
-	"github.com/sourcegraph/src-cli/internal/exec"
 )
 
 // UIDGID represents a UID:GID pair.
@@ -34,7 +31,12 @@ type Image interface {
 }
 
 type image struct {
-	name string
+	name    string
+	runtime ContainerRuntime
+
+	// build is set for images that are built locally instead of being pulled
+	// from a registry.
+	build *imageBuild
 
 	// There are lots of once fields below: basically, we're going to try fairly
 	// hard to prevent performing the same operations on the same image over and
@@ -50,74 +52,44 @@ type image struct {
 	uidGidOnce sync.Once
 }
 
-// Digest returns the content digest for the image. Note that this is different
-// from the "distribution digest" (which is what you can use to specify an image
-// to `docker run`, as in `my/image@sha256:xxx`). We need to use the content digest
-// because the distribution digest is only computed for images that have been pulled
-// from or pushed to a registry. See https://windsock.io/explaining-docker-image-ids/
-// under "A Final Twist" for a good explanation.
+// Digest returns the content digest for the image, as returned by
+// ContainerRuntime.InspectImage.
 func (image *image) Digest(ctx context.Context) (string, error) {
 	ensureErr := image.Ensure(ctx)
 	return image.digest, ensureErr
 }
 
-// Ensure ensures that the image has been pulled by Docker. Note that it does
-// not attempt to pull a newer version of the image if it exists locally.
+// Ensure ensures that the image has been pulled by the runtime, or built if it is
+// the result of a buildImage step. Note that it does not attempt to pull a
+// newer version of the image if it exists locally.
 func (image *image) Ensure(ctx context.Context) error {
 	image.ensureOnce.Do(func() {
 		image.ensureErr = func() (err error) {
 			inspectDigest := func() (string, error) {
-				// Since we are only asking Docker for local information, we
-				// expect this operation to be quick, and therefore set a
-				// relatively low timeout for Docker to respond. This is
-				// particularly useful because this function is usually the
-				// first non-trivial interaction we have with Docker in a
-				// src-cli invocation, and this allows us to catch failure modes
-				// that result in the Docker socket still listening and
-				// accepting connections, but where dockerd is no longer able to
-				// respond to non-trivial requests.
-				//
-				// Anecdotally, this seems to happen most frequently with Docker
-				// Desktop VMs running out of memory, whereupon the Linux
-				// kernel's OOM killer sometimes chooses to kill components of
-				// Docker instead of processes within containers.
-				dctx, cancel, err := withFastCommandContext(ctx)
-				if err != nil {
-					return "", err
-				}
-				defer cancel()
-
-				args := []string{"image", "inspect", "--format", "{{ .Id }}", image.name}
-				out, err := exec.CommandContext(dctx, "docker", args...).Output()
-				id := string(bytes.TrimSpace(out))
-
-				if errors.IsDeadlineExceeded(err) || errors.IsDeadlineExceeded(dctx.Err()) {
-					return "", newFastCommandTimeoutError(dctx, args...)
-				} else if err != nil {
-					return "", err
-				}
-
-				return id, nil
+				return image.runtime.InspectImage(ctx, image.name)
 			}
 
-			// docker image inspect will return a non-zero exit code if the image and
-			// tag don't exist locally, regardless of the format.
+			// Inspecting the image returns an error if the image and tag
+			// don't exist locally.
 			var digest string
 			if digest, err = inspectDigest(); errors.HasType[*fastCommandTimeoutError](err) {
 				// Ensure we immediately propagate a timeout up, rather than
-				// trying to tell an unresponsive Docker to pull.
+				// trying to tell an unresponsive runtime to pull.
 				return err
+			} else if err != nil && image.build != nil {
+				// Built images are never pulled, so let's build it.
+				if err := image.build.run(ctx, image.name); err != nil {
+					return errors.Wrap(err, "building image")
+				}
+				// And try again to get the image digest.
+				digest, err = inspectDigest()
+				if err != nil {
+					return errors.Wrap(err, "not found after building image")
+				}
 			} else if err != nil {
 				// Let's try pulling the image.
-				pullCmd := exec.CommandContext(ctx, "docker", "image", "pull", image.name)
-				var stderr bytes.Buffer
-				pullCmd.Stderr = &stderr
-				if err := pullCmd.Run(); err != nil {
-					exitErr := &goexec.ExitError{}
-					if errors.As(err, &exitErr) {
-						return errors.Newf("failed to pull image: %s\ndocker pull exited with code %d", stderr.String(), exitErr.ExitCode())
-					}
-					return errors.Wrap(err, "pulling image")
+				if err := image.runtime.PullImage(ctx, image.name); err != nil {
+					return err
 				}
 				// And try again to get the image digest.
 				digest, err = inspectDigest()
@@ -151,14 +123,16 @@ func (image *image) UIDGID(ctx context.Context) (UIDGID, error) {
 				return UIDGID{}, errors.Wrap(err, "getting digest")
 			}
 
-			args := []string{
-				"run",
+			cmd, err := image.runtime.Run(
+				ctx,
 				"--rm",
 				"--entrypoint", "/bin/sh",
 				digest,
 				"-c", "id -u; id -g",
+			)
+			if err != nil {
+				return UIDGID{}, err
 			}
-			cmd := exec.CommandContext(ctx, "docker", args...)
 			cmd.Stdout = stdout
 
 			if err := cmd.Run(); err != nil {
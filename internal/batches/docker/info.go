@@ -12,7 +12,7 @@ import (
 
 // CurrentContext returns the name of the current Docker context (not to be
 // confused with a Go context).
-func CurrentContext(ctx context.Context) (string, error) {
+func (rt *cliRuntime) CurrentContext(ctx context.Context) (string, error) {
 	dctx, cancel, err := withFastCommandContext(ctx)
 	if err != nil {
 		return "", err
@@ -20,9 +20,9 @@ func CurrentContext(ctx context.Context) (string, error) {
 	defer cancel()
 
 	args := []string{"context", "inspect", "--format", "{{ .Name }}"}
-	out, err := exec.CommandContext(dctx, "docker", args...).CombinedOutput()
+	out, err := exec.CommandContext(dctx, rt.binary, args...).CombinedOutput()
 	if errors.IsDeadlineExceeded(err) || errors.IsDeadlineExceeded(dctx.Err()) {
-		return "", newFastCommandTimeoutError(dctx, args...)
+		return "", newFastCommandTimeoutError(dctx, rt.binary, args...)
 	} else if err != nil {
 		return "", err
 	}
@@ -42,8 +42,8 @@ type Info struct {
 	NCPU int `json:"NCPU"` // Docker Engine
 }
 
-// NCPU returns the number of CPU cores available to Docker.
-func NCPU(ctx context.Context) (int, error) {
+// NCPU returns the number of CPU cores available to the runtime.
+func (rt *cliRuntime) NCPU(ctx context.Context) (int, error) {
 	dctx, cancel, err := withFastCommandContext(ctx)
 	if err != nil {
 		return 0, err
@@ -51,9 +51,9 @@ func NCPU(ctx context.Context) (int, error) {
 	defer cancel()
 
 	args := []string{"info", "--format", "{{ json .}}"}
-	out, err := exec.CommandContext(dctx, "docker", args...).CombinedOutput()
+	out, err := exec.CommandContext(dctx, rt.binary, args...).CombinedOutput()
 	if errors.IsDeadlineExceeded(err) || errors.IsDeadlineExceeded(dctx.Err()) {
-		return 0, newFastCommandTimeoutError(dctx, args...)
+		return 0, newFastCommandTimeoutError(dctx, rt.binary, args...)
 	} else if err != nil {
 		return 0, err
 	}
@@ -19,7 +19,7 @@ func Test_CurrentContext(t *testing.T) {
 	t.Run("docker fails", func(t *testing.T) {
 		expect.Commands(t, contextInspectFailure())
 
-		name, err := CurrentContext(ctx)
+		name, err := NewDockerRuntime().CurrentContext(ctx)
 		assert.Empty(t, name)
 		assert.Error(t, err)
 	})
@@ -30,7 +30,7 @@ func Test_CurrentContext(t *testing.T) {
 
 		expect.Commands(t, contextInspectSuccess("desktop-linux"))
 
-		name, err := CurrentContext(tctx)
+		name, err := NewDockerRuntime().CurrentContext(tctx)
 		assert.Zero(t, name)
 		var terr *fastCommandTimeoutError
 		assert.ErrorAs(t, err, &terr)
@@ -41,7 +41,7 @@ func Test_CurrentContext(t *testing.T) {
 	t.Run("docker succeeds, but returns nothing", func(t *testing.T) {
 		expect.Commands(t, contextInspectSuccess(""))
 
-		name, err := CurrentContext(ctx)
+		name, err := NewDockerRuntime().CurrentContext(ctx)
 		assert.Empty(t, name)
 		assert.Error(t, err)
 	})
@@ -49,7 +49,7 @@ func Test_CurrentContext(t *testing.T) {
 	t.Run("docker succeeds", func(t *testing.T) {
 		expect.Commands(t, contextInspectSuccess("desktop-linux"))
 
-		name, err := CurrentContext(ctx)
+		name, err := NewDockerRuntime().CurrentContext(ctx)
 		assert.Equal(t, "desktop-linux", name)
 		assert.NoError(t, err)
 	})
@@ -75,7 +75,7 @@ func Test_NCPU(t *testing.T) {
 	t.Run("docker fails", func(t *testing.T) {
 		expect.Commands(t, infoFailure())
 
-		ncpu, err := NCPU(ctx)
+		ncpu, err := NewDockerRuntime().NCPU(ctx)
 		assert.Zero(t, ncpu)
 		assert.Error(t, err)
 	})
@@ -86,7 +86,7 @@ func Test_NCPU(t *testing.T) {
 
 		expect.Commands(t, infoSuccess("4"))
 
-		ncpu, err := NCPU(tctx)
+		ncpu, err := NewDockerRuntime().NCPU(tctx)
 		assert.Zero(t, ncpu)
 		var terr *fastCommandTimeoutError
 		assert.ErrorAs(t, err, &terr)
@@ -97,7 +97,7 @@ func Test_NCPU(t *testing.T) {
 	t.Run("docker succeeds, but returns nothing", func(t *testing.T) {
 		expect.Commands(t, infoSuccess(""))
 
-		ncpu, err := NCPU(ctx)
+		ncpu, err := NewDockerRuntime().NCPU(ctx)
 		assert.Zero(t, ncpu)
 		assert.Error(t, err)
 	})
@@ -105,7 +105,7 @@ func Test_NCPU(t *testing.T) {
 	t.Run("docker succeeds, but returns something invalid", func(t *testing.T) {
 		expect.Commands(t, infoSuccess("foo"))
 
-		ncpu, err := NCPU(ctx)
+		ncpu, err := NewDockerRuntime().NCPU(ctx)
 		assert.Zero(t, ncpu)
 		assert.Error(t, err)
 	})
@@ -113,7 +113,7 @@ func Test_NCPU(t *testing.T) {
 	t.Run("docker succeeds", func(t *testing.T) {
 		expect.Commands(t, infoSuccess("4"))
 
-		ncpu, err := NCPU(ctx)
+		ncpu, err := NewDockerRuntime().NCPU(ctx)
 		assert.Equal(t, 4, ncpu)
 		assert.NoError(t, err)
 	})
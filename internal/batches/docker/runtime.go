@@ -0,0 +1,91 @@
+package docker
+
+import (
+	"context"
+	goexec "os/exec"
+
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+)
+
+// ContainerRuntime is the container engine batch change steps are executed
+// with. Every runtime needs to understand the arguments of `docker run`, since
+// those are what the executor and the workspaces build up.
+type ContainerRuntime interface {
+	// Name returns the name of the runtime, as accepted by NewRuntime.
+	Name() string
+
+	// CheckVersion returns an error if the runtime is not available or not
+	// responding.
+	CheckVersion(ctx context.Context) error
+	// CurrentContext returns the name of the current context of the runtime.
+	// Runtimes without contexts return an empty string.
+	CurrentContext(ctx context.Context) (string, error)
+	// NCPU returns the number of CPU cores available to containers.
+	NCPU(ctx context.Context) (int, error)
+
+	// InspectImage returns the content digest of the image with the given
+	// name. It returns an error if the image doesn't exist locally.
+	InspectImage(ctx context.Context, name string) (string, error)
+	// PullImage pulls the image with the given name from its registry.
+	PullImage(ctx context.Context, name string) error
+	// CommitImage runs script with /bin/sh in a container of the image with
+	// the given digest and commits the resulting container as name.
+	CommitImage(ctx context.Context, digest, script, name string) error
+
+	// Run returns the command that runs a container with the given `docker
+	// run` arguments. The command is not started. It returns an error if the
+	// runtime can't run containers.
+	Run(ctx context.Context, args ...string) (*goexec.Cmd, error)
+	// RemoveContainer forcefully removes the container with the given ID.
+	RemoveContainer(ctx context.Context, id string) error
+	// ContainerOOMKilled returns whether the container with the given ID was
+	// killed by the OOM killer. The container must not have been removed.
+	ContainerOOMKilled(ctx context.Context, id string) (bool, error)
+
+	// CreateVolume creates a new volume and returns its name.
+	CreateVolume(ctx context.Context) (string, error)
+	// RemoveVolume removes the volume with the given name.
+	RemoveVolume(ctx context.Context, name string) error
+}
+
+// Names of the container runtimes accepted by NewRuntime.
+const (
+	RuntimeAuto   = "auto"
+	RuntimeDocker = "docker"
+	RuntimePodman = "podman"
+)
+
+// lookPath is replaced in tests.
+var lookPath = goexec.LookPath
+
+// NewRuntime returns the container runtime with the given name. If name is
+// RuntimeAuto or empty, the first runtime that is installed and responding is
+// used, preferring Docker over Podman.
+func NewRuntime(ctx context.Context, name string) (ContainerRuntime, error) {
+	switch name {
+	case RuntimeDocker:
+		return NewDockerRuntime(), nil
+	case RuntimePodman:
+		return NewPodmanRuntime(), nil
+	case RuntimeAuto, "":
+		return detectRuntime(ctx), nil
+	}
+	return nil, errors.Newf("unknown container runtime %q, must be one of %q, %q or %q", name, RuntimeAuto, RuntimeDocker, RuntimePodman)
+}
+
+func detectRuntime(ctx context.Context) ContainerRuntime {
+	candidates := []ContainerRuntime{NewDockerRuntime(), NewPodmanRuntime()}
+	for _, rt := range candidates {
+		if _, err := lookPath(rt.Name()); err != nil {
+			continue
+		}
+		if err := rt.CheckVersion(ctx); err != nil {
+			continue
+		}
+		return rt
+	}
+
+	// Nothing is available, so we fall back to Docker. The caller will report
+	// an error that explains what's missing when it checks the version.
+	return candidates[0]
+}
@@ -0,0 +1,158 @@
+package docker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourcegraph/src-cli/internal/exec/expect"
+)
+
+func TestNewRuntime(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("explicit", func(t *testing.T) {
+		rt, err := NewRuntime(ctx, RuntimeDocker)
+		require.NoError(t, err)
+		assert.Equal(t, RuntimeDocker, rt.Name())
+
+		rt, err = NewRuntime(ctx, RuntimePodman)
+		require.NoError(t, err)
+		assert.Equal(t, RuntimePodman, rt.Name())
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		_, err := NewRuntime(ctx, "containerd")
+		assert.Error(t, err)
+	})
+
+	t.Run("auto", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			installed    []string
+			expectations []*expect.Expectation
+			want         string
+		}{
+			"docker available": {
+				installed:    []string{"docker", "podman"},
+				expectations: []*expect.Expectation{expect.NewLiteral(expect.Success, "docker", "version")},
+				want:         RuntimeDocker,
+			},
+			"docker not responding": {
+				installed: []string{"docker", "podman"},
+				expectations: []*expect.Expectation{
+					expect.NewLiteral(expect.Behaviour{ExitCode: 1}, "docker", "version"),
+					expect.NewLiteral(expect.Success, "podman", "version"),
+				},
+				want: RuntimePodman,
+			},
+			"only podman installed": {
+				installed:    []string{"podman"},
+				expectations: []*expect.Expectation{expect.NewLiteral(expect.Success, "podman", "version")},
+				want:         RuntimePodman,
+			},
+			"nothing installed": {
+				want: RuntimeDocker,
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				expect.Commands(t, tc.expectations...)
+
+				oldLookPath := lookPath
+				lookPath = func(file string) (string, error) {
+					for _, installed := range tc.installed {
+						if installed == file {
+							return "/usr/bin/" + file, nil
+						}
+					}
+					return "", errors.New("not found")
+				}
+				t.Cleanup(func() { lookPath = oldLookPath })
+
+				rt, err := NewRuntime(ctx, RuntimeAuto)
+				require.NoError(t, err)
+				assert.Equal(t, tc.want, rt.Name())
+			})
+		}
+	})
+}
+
+func TestPodmanRuntime(t *testing.T) {
+	ctx := context.Background()
+	rt := NewPodmanRuntime()
+
+	t.Run("pull qualifies short names", func(t *testing.T) {
+		expect.Commands(t, expect.NewLiteral(expect.Success, "podman", "image", "pull", "docker.io/library/alpine:3"))
+
+		assert.NoError(t, rt.PullImage(ctx, "alpine:3"))
+	})
+
+	t.Run("inspect falls back to qualified name", func(t *testing.T) {
+		expect.Commands(
+			t,
+			expect.NewLiteral(expect.Behaviour{ExitCode: 1}, "podman", "image", "inspect", "--format", "{{ .Id }}", "alpine:3"),
+			expect.NewLiteral(expect.Behaviour{Stdout: []byte("digest\n")}, "podman", "image", "inspect", "--format", "{{ .Id }}", "docker.io/library/alpine:3"),
+		)
+
+		digest, err := rt.InspectImage(ctx, "alpine:3")
+		require.NoError(t, err)
+		assert.Equal(t, "digest", digest)
+	})
+
+	t.Run("no contexts", func(t *testing.T) {
+		name, err := rt.CurrentContext(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, name)
+	})
+}
+
+func TestHostRuntime(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("all images allowed", func(t *testing.T) {
+		cache := NewImageCache(NewHostRuntime(nil))
+		img, err := cache.Ensure(ctx, "alpine:3")
+		require.NoError(t, err)
+
+		digest, err := img.Digest(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "host:alpine:3", digest)
+	})
+
+	t.Run("allowlist", func(t *testing.T) {
+		cache := NewImageCache(NewHostRuntime([]string{"alpine:3"}))
+		_, err := cache.Ensure(ctx, "alpine:3")
+		assert.NoError(t, err)
+
+		_, err = cache.Ensure(ctx, "ubuntu:latest")
+		assert.ErrorContains(t, err, `image "ubuntu:latest" is not allowed to run on the host`)
+	})
+
+	t.Run("no containers", func(t *testing.T) {
+		rt := NewHostRuntime(nil)
+		cmd, err := rt.Run(ctx, "--rm", "alpine:3", "true")
+		assert.Nil(t, cmd)
+		assert.ErrorIs(t, err, ErrHostContainer)
+
+		img, err := NewImageCache(rt).Ensure(ctx, "alpine:3")
+		require.NoError(t, err)
+		_, err = img.UIDGID(ctx)
+		assert.ErrorIs(t, err, ErrHostContainer)
+	})
+}
+
+func TestQualifyImageName(t *testing.T) {
+	for name, want := range map[string]string{
+		"alpine":                       "docker.io/library/alpine",
+		"alpine:3":                     "docker.io/library/alpine:3",
+		"sourcegraph/src-cli:latest":   "docker.io/sourcegraph/src-cli:latest",
+		"ghcr.io/sourcegraph/src-cli":  "ghcr.io/sourcegraph/src-cli",
+		"localhost/src-batch-image:12": "localhost/src-batch-image:12",
+		"registry:5000/image":          "registry:5000/image",
+		"sha256:abcdef":                "sha256:abcdef",
+	} {
+		assert.Equal(t, want, qualifyImageName(name), name)
+	}
+}
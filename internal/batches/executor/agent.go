@@ -0,0 +1,261 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/batches/template"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/src-cli/internal/batches/workspace"
+)
+
+// AgentTypeCommand is the codingAgent type that is handled by the
+// CommandAgentRunner.
+const AgentTypeCommand = "command"
+
+// AgentRunner implementations execute codingAgent steps. The changes an agent
+// makes to the workspace are captured like the changes of any other step.
+type AgentRunner interface {
+	// RunAgent runs the agent described by req. A non-nil error fails the
+	// step.
+	RunAgent(ctx context.Context, req *AgentRequest) error
+}
+
+// AgentRequest describes a single codingAgent step execution.
+type AgentRequest struct {
+	// Type is the codingAgent type of the step.
+	Type string
+	// Prompt is the rendered prompt of the step.
+	Prompt string
+	// StepContext is the template context the prompt was rendered with.
+	StepContext *template.StepContext
+	// Workspace is the workspace the agent should make its changes in.
+	Workspace workspace.Workspace
+	// Image is the digest of the step image, if the step declares one.
+	Image string
+	// Stdout and Stderr receive the output of the agent. Everything written to
+	// them ends up in the step result, the logs and the UI.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// RunInContainer runs a script in the step image with the workspace
+	// mounted, the same way `run` steps are executed. It returns an error if
+	// the step doesn't declare an image.
+	RunInContainer func(ctx context.Context, run AgentContainerRun) error
+}
+
+// AgentContainerRun describes a script to be run in the step container by an
+// AgentRunner.
+type AgentContainerRun struct {
+	// Script is the shell script to execute.
+	Script string
+	// Files maps paths in the container to the content of the file that
+	// should be mounted there.
+	Files map[string]string
+	// Mounts maps paths on the host to paths in the container. They are
+	// mounted read-only.
+	Mounts map[string]string
+}
+
+const commandAgentDir = "/tmp/src-coding-agent"
+
+// CommandAgentRunner runs a local binary inside the step container. The binary
+// is invoked in the workspace with the rendered prompt as its only argument.
+type CommandAgentRunner struct {
+	// Binary is the path of the agent binary on the host. It needs to be
+	// executable within the step image.
+	Binary string
+}
+
+var _ AgentRunner = &CommandAgentRunner{}
+
+func (r *CommandAgentRunner) RunAgent(ctx context.Context, req *AgentRequest) error {
+	if r.Binary == "" {
+		return errors.Newf("no binary configured for coding agent type %q", req.Type)
+	}
+	if req.Image == "" {
+		return errors.Newf("coding agent type %q requires the step to declare an image", req.Type)
+	}
+
+	binary, err := filepath.Abs(r.Binary)
+	if err != nil {
+		return errors.Wrap(err, "resolving coding agent binary")
+	}
+	if _, err := os.Stat(binary); err != nil {
+		return errors.Wrap(err, "checking coding agent binary")
+	}
+	// The binary is mounted into the container, so it must not break out of
+	// the mount spec.
+	if strings.Contains(binary, ",") {
+		return errors.Newf("coding agent binary path %q contains invalid characters", binary)
+	}
+
+	return req.RunInContainer(ctx, AgentContainerRun{
+		Script: fmt.Sprintf("exec %s/agent \"$(cat %s/prompt)\"\n", commandAgentDir, commandAgentDir),
+		Files:  map[string]string{commandAgentDir + "/prompt": req.Prompt},
+		Mounts: map[string]string{binary: commandAgentDir + "/agent"},
+	})
+}
+
+// FakeAgentRunner is a deterministic AgentRunner to be used in tests. It
+// writes the prompt into the file at Path, relative to the workspace path, and
+// echoes it to stdout.
+type FakeAgentRunner struct {
+	Path string
+}
+
+var _ AgentRunner = &FakeAgentRunner{}
+
+func (r *FakeAgentRunner) RunAgent(ctx context.Context, req *AgentRequest) error {
+	if r.Path == "" {
+		return errors.New("no path configured for fake coding agent")
+	}
+
+	content := req.Prompt
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	lines := strings.SplitAfter(content, "\n")
+	lines = lines[:len(lines)-1]
+
+	target := path.Join(req.StepContext.Steps.Path, r.Path)
+
+	var diff bytes.Buffer
+	fmt.Fprintf(&diff, "diff --git %s %s\n", target, target)
+	fmt.Fprintf(&diff, "new file mode 100644\n")
+	fmt.Fprintf(&diff, "--- /dev/null\n")
+	fmt.Fprintf(&diff, "+++ %s\n", target)
+	fmt.Fprintf(&diff, "@@ -0,0 +1,%d @@\n", len(lines))
+	for _, line := range lines {
+		fmt.Fprintf(&diff, "+%s", line)
+	}
+
+	if err := req.Workspace.ApplyDiff(ctx, diff.Bytes()); err != nil {
+		return errors.Wrap(err, "applying fake agent changes")
+	}
+
+	_, err := io.WriteString(req.Stdout, content)
+	return err
+}
+
+// executeAgentStep executes a codingAgent step with the AgentRunner registered
+// for its type.
+func executeAgentStep(
+	ctx context.Context,
+	opts *RunStepsOpts,
+	workspace workspace.Workspace,
+	stepIdx int,
+	step batcheslib.Step,
+	imageDigest string,
+	stepContext *template.StepContext,
+	filesToMount map[string]*os.File,
+	cacheMounts map[string]string,
+	env map[string]string,
+) (stdout bytes.Buffer, stderr bytes.Buffer, err error) {
+	runner, ok := opts.AgentRunners[step.CodingAgent.Type]
+	if !ok {
+		err = errors.Newf("no runner available for coding agent type %q", step.CodingAgent.Type)
+		opts.UI.StepPreparingFailed(stepIdx+1, err)
+		return bytes.Buffer{}, bytes.Buffer{}, err
+	}
+
+	var prompt bytes.Buffer
+	if err := template.RenderStepTemplate("step-coding-agent-prompt", step.CodingAgent.Prompt, &prompt, stepContext); err != nil {
+		err = errors.Wrap(err, "parsing coding agent prompt")
+		opts.UI.StepPreparingFailed(stepIdx+1, err)
+		return bytes.Buffer{}, bytes.Buffer{}, err
+	}
+
+	opts.UI.StepPreparingSuccess(stepIdx + 1)
+
+	// ----------
+	// EXECUTION
+	// ----------
+	opts.UI.StepStarted(stepIdx+1, prompt.String(), env)
+
+	writerCtx, writerCancel := context.WithCancel(ctx)
+	defer writerCancel()
+	outputWriter := opts.UI.StepOutputWriter(writerCtx, opts.Task, stepIdx+1)
+	defer func() {
+		outputWriter.Close()
+	}()
+
+	stdoutWriter := io.MultiWriter(&stdout, outputWriter.StdoutWriter(), opts.Logger.PrefixWriter("stdout"))
+	stderrWriter := io.MultiWriter(&stderr, outputWriter.StderrWriter(), opts.Logger.PrefixWriter("stderr"))
+
+	opts.Logger.Logf("[Step %d] coding agent: %q, container: %q", stepIdx+1, step.CodingAgent.Type, step.Container)
+
+	req := &AgentRequest{
+		Type:        step.CodingAgent.Type,
+		Prompt:      prompt.String(),
+		StepContext: stepContext,
+		Workspace:   workspace,
+		Image:       imageDigest,
+		Stdout:      stdoutWriter,
+		Stderr:      stderrWriter,
+		RunInContainer: func(ctx context.Context, run AgentContainerRun) error {
+			if imageDigest == "" {
+				return errors.New("coding agent step has no image to run in")
+			}
+
+			shell, containerTemp, err := probeImageForShell(ctx, opts.Runtime, imageDigest)
+			if err != nil {
+				return errors.Wrapf(err, "probing image %q for shell", step.Container)
+			}
+
+			runScriptFile, cleanup, err := writeRunScriptFile(opts.TempDir, run.Script)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			agentFiles, cleanup, err := writeFilesToMount(opts.TempDir, run.Files)
+			defer cleanup()
+			if err != nil {
+				return err
+			}
+			files := make(map[string]*os.File, len(filesToMount)+len(agentFiles))
+			for target, f := range filesToMount {
+				files[target] = f
+			}
+			for target, f := range agentFiles {
+				files[target] = f
+			}
+
+			return runStepContainer(ctx, opts, workspace, stepIdx, step, &containerRun{
+				imageDigest:   imageDigest,
+				shell:         shell,
+				containerTemp: containerTemp,
+				runScriptFile: runScriptFile,
+				runScript:     run.Script,
+				filesToMount:  files,
+				extraMounts:   run.Mounts,
+				cacheMounts:   cacheMounts,
+				env:           env,
+				stdout:        &stdout,
+				stderr:        &stderr,
+				stdoutWriter:  stdoutWriter,
+				stderrWriter:  stderrWriter,
+			})
+		},
+	}
+
+	if err := runner.RunAgent(ctx, req); err != nil {
+		opts.Logger.Logf("[Step %d] error running coding agent: %+v", stepIdx+1, err)
+		if errors.HasType[stepFailedErr](err) {
+			return stdout, stderr, err
+		}
+		return stdout, stderr, errors.Wrapf(err, "running coding agent %q", step.CodingAgent.Type)
+	}
+
+	opts.Logger.Logf("[Step %d] complete", stepIdx+1)
+	return stdout, stderr, nil
+}
@@ -0,0 +1,215 @@
+package executor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/batches/execution"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/src-cli/internal/batches/workspace"
+)
+
+// rootWorkspaceDir is the name of the directory of the artifacts of a task
+// whose workspace is the root of the repository.
+const rootWorkspaceDir = "_root"
+
+// ArtifactStoreDir is the directory in the cache directory that the
+// ArtifactStore is stored in by default.
+const ArtifactStoreDir = "artifacts"
+
+// ArtifactStore stores the contents of artifacts by their SHA-256 hash, so
+// that the step results only need to record their listings, and the artifacts
+// of cached steps can be restored from it.
+type ArtifactStore struct {
+	Dir string
+}
+
+func (s *ArtifactStore) path(sum string) string {
+	return filepath.Join(s.Dir, sum[:2], sum)
+}
+
+// has returns whether the content of the artifact is stored. A nil store has
+// no contents.
+func (s *ArtifactStore) has(a execution.Artifact) bool {
+	if s == nil || len(a.SHA256) < 2 {
+		return false
+	}
+	st, err := os.Stat(s.path(a.SHA256))
+	return err == nil && st.Size() == a.Size
+}
+
+// put stores the content of file, whose hash is sum, unless it's already
+// stored.
+func (s *ArtifactStore) put(file, sum string) error {
+	dest := s.path(sum)
+	if _, err := os.Stat(dest); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	// Other processes may store the same content concurrently, so it's
+	// written to a temporary file and moved into place.
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := copyFileTo(tmp, file); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+// collectArtifacts moves the artifacts of the step out of the workspace,
+// writes them to opts.ArtifactsDir and stores them in opts.ArtifactStore, and
+// returns their listings.
+func collectArtifacts(ctx context.Context, opts *RunStepsOpts, ws workspace.Workspace, stepIdx int, step batcheslib.Step) ([]execution.Artifact, error) {
+	// The patterns are relative to the workspace, which is a directory of
+	// the repository.
+	patterns := make([]string, len(step.Artifacts))
+	for i, p := range step.Artifacts {
+		patterns[i] = path.Join(opts.Task.Path, p)
+	}
+
+	dir, err := os.MkdirTemp(opts.TempDir, "artifacts-*")
+	if err != nil {
+		return nil, errors.Wrap(err, "creating artifacts directory")
+	}
+	defer os.RemoveAll(dir)
+
+	files, err := ws.CollectArtifacts(ctx, patterns, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	artifacts := make([]execution.Artifact, 0, len(files))
+	for _, file := range files {
+		src := filepath.Join(dir, filepath.FromSlash(file))
+		// Workspaces only collect regular files, but the file must never
+		// be a link to a file on the host.
+		st, err := os.Lstat(src)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading artifact %s", file)
+		}
+		if !st.Mode().IsRegular() {
+			return nil, errors.Newf("artifact %s is not a regular file", file)
+		}
+		sum, err := hashFile(src)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading artifact %s", file)
+		}
+
+		if opts.Task.Path != "" {
+			file = strings.TrimPrefix(file, opts.Task.Path+"/")
+		}
+		a := execution.Artifact{StepIndex: stepIdx, Path: file, Size: st.Size(), SHA256: sum}
+
+		if opts.ArtifactStore != nil {
+			if err := opts.ArtifactStore.put(src, sum); err != nil {
+				return nil, errors.Wrapf(err, "storing artifact %s", file)
+			}
+		}
+		if opts.ArtifactsDir != "" {
+			if err := writeArtifact(artifactPath(opts.ArtifactsDir, opts.Task, a), src); err != nil {
+				return nil, errors.Wrapf(err, "writing artifact %s", file)
+			}
+		}
+		artifacts = append(artifacts, a)
+	}
+	return artifacts, nil
+}
+
+// restoreArtifacts writes the artifacts of cached steps of the task from the
+// store to dir. Nothing is written if dir is empty.
+func restoreArtifacts(dir string, store *ArtifactStore, task *Task, artifacts []execution.Artifact) error {
+	if dir == "" {
+		return nil
+	}
+	for _, a := range artifacts {
+		if !store.has(a) {
+			return errors.Newf("artifact %s of step %d is not stored in the cache anymore", a.Path, a.StepIndex+1)
+		}
+		if err := writeArtifact(artifactPath(dir, task, a), store.path(a.SHA256)); err != nil {
+			return errors.Wrapf(err, "writing artifact %s", a.Path)
+		}
+	}
+	return nil
+}
+
+// artifactsRestorable returns whether the artifacts of a cached step can be
+// restored to dir.
+func artifactsRestorable(dir string, store *ArtifactStore, artifacts []execution.Artifact) bool {
+	if dir == "" {
+		return true
+	}
+	for _, a := range artifacts {
+		if !store.has(a) {
+			return false
+		}
+	}
+	return true
+}
+
+// artifactPath returns the path in dir that the artifact of the task is
+// written to: <dir>/<repo-slug>/<workspace>/step-<n>/<path>.
+func artifactPath(dir string, task *Task, a execution.Artifact) string {
+	workspaceDir := rootWorkspaceDir
+	if task.Path != "" {
+		workspaceDir = strings.ReplaceAll(task.Path, "/", "-")
+	}
+	return filepath.Join(
+		dir,
+		strings.ReplaceAll(task.Repository.Name, "/", "-"),
+		workspaceDir,
+		fmt.Sprintf("step-%d", a.StepIndex+1),
+		filepath.FromSlash(a.Path),
+	)
+}
+
+// writeArtifact copies the file src to dest.
+func writeArtifact(dest, src string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := copyFileTo(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func copyFileTo(w io.Writer, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = io.Copy(w, in)
+	return err
+}
+
+func hashFile(file string) (string, error) {
+	h := sha256.New()
+	if err := copyFileTo(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,83 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/batches/template"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+)
+
+// builtImageOutput is the name of the output that buildImage steps set to the
+// name of the image they created.
+const builtImageOutput = batcheslib.BuiltImageOutput
+
+// executeBuildImageStep builds the image described by a buildImage step. The
+// workspace is not touched. It returns the name of the built image.
+func executeBuildImageStep(
+	ctx context.Context,
+	opts *RunStepsOpts,
+	stepIdx int,
+	step batcheslib.Step,
+	stepContext *template.StepContext,
+) (stdout bytes.Buffer, stderr bytes.Buffer, imageName string, err error) {
+	// ----------
+	// PREPARATION
+	// ----------
+	opts.UI.StepPreparingStart(stepIdx + 1)
+
+	if opts.BuildImage == nil {
+		err = errors.New("building images is not supported")
+		opts.UI.StepPreparingFailed(stepIdx+1, err)
+		return bytes.Buffer{}, bytes.Buffer{}, "", err
+	}
+
+	baseImage, err := renderStepContainer(step.BuildImage.BaseImage, stepContext)
+	if err != nil {
+		err = errors.Wrap(err, "resolving base image")
+		opts.UI.StepPreparingFailed(stepIdx+1, err)
+		return bytes.Buffer{}, bytes.Buffer{}, "", err
+	}
+
+	var script bytes.Buffer
+	if err := template.RenderStepTemplate("step-build-image-run", step.BuildImage.Run, &script, stepContext); err != nil {
+		err = errors.Wrap(err, "parsing build image run")
+		opts.UI.StepPreparingFailed(stepIdx+1, err)
+		return bytes.Buffer{}, bytes.Buffer{}, "", err
+	}
+
+	opts.UI.StepPreparingSuccess(stepIdx + 1)
+
+	// ----------
+	// EXECUTION
+	// ----------
+	opts.UI.StepStarted(stepIdx+1, script.String(), nil)
+
+	writerCtx, writerCancel := context.WithCancel(ctx)
+	defer writerCancel()
+	outputWriter := opts.UI.StepOutputWriter(writerCtx, opts.Task, stepIdx+1)
+	defer func() {
+		outputWriter.Close()
+	}()
+
+	stdoutWriter := io.MultiWriter(&stdout, outputWriter.StdoutWriter(), opts.Logger.PrefixWriter("stdout"))
+
+	opts.Logger.Logf("[Step %d] build image: %q, base image: %q", stepIdx+1, script.String(), baseImage)
+
+	t0 := time.Now()
+	imageName, _, err = opts.BuildImage(ctx, baseImage, script.String())
+	elapsed := time.Since(t0).Round(time.Millisecond)
+	if err != nil {
+		opts.Logger.Logf("[Step %d] took %s; error building image: %+v", stepIdx+1, elapsed, err)
+		return stdout, stderr, "", errors.Wrapf(err, "building image from %q", baseImage)
+	}
+
+	fmt.Fprintln(stdoutWriter, imageName)
+
+	opts.Logger.Logf("[Step %d] complete in %s", stepIdx+1, elapsed)
+	return stdout, stderr, imageName, nil
+}
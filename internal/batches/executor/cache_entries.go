@@ -0,0 +1,271 @@
+package executor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/sourcegraph/lib/batches/execution"
+	"github.com/sourcegraph/sourcegraph/lib/batches/execution/cache"
+)
+
+// cacheMetadataExt is the extension of the files that are stored next to the
+// results in an ExecutionDiskCache and contain their cacheEntryMetadata.
+const cacheMetadataExt = ".meta.json"
+
+// cacheEntryKeyPattern matches the keys returned by cache.CacheKey.Key, so that
+// other files in the cache directory are ignored.
+var cacheEntryKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+-step-(\d+)$`)
+
+// cacheEntryMetadata describes the cache key of a result. It can't be
+// recovered from the key itself, since that's a hash.
+type cacheEntryMetadata struct {
+	Repository string `json:"repository"`
+	Commit     string `json:"commit"`
+	Path       string `json:"path,omitempty"`
+	BatchSpec  string `json:"batchSpec,omitempty"`
+	StepIndex  int    `json:"stepIndex"`
+}
+
+// metadataForKey returns the cacheEntryMetadata for the given key, if it's a
+// cache.CacheKey.
+func metadataForKey(key cache.Keyer) (cacheEntryMetadata, bool) {
+	var k cache.CacheKey
+	switch v := key.(type) {
+	case *cache.CacheKey:
+		k = *v
+	case cache.CacheKey:
+		k = v
+	default:
+		return cacheEntryMetadata{}, false
+	}
+
+	metadata := cacheEntryMetadata{
+		Repository: k.Repository.Name,
+		Commit:     k.Repository.BaseRev,
+		Path:       k.Path,
+		StepIndex:  k.StepIndex,
+	}
+	if k.BatchChangeAttributes != nil {
+		metadata.BatchSpec = k.BatchChangeAttributes.Name
+	}
+	return metadata, true
+}
+
+// CacheEntry is a single step result stored in an ExecutionDiskCache.
+type CacheEntry struct {
+	Key string `json:"key"`
+	// Slug is the cache.SlugForRepo of the repository and commit the result
+	// belongs to. All results of the same slug are stored together.
+	Slug       string `json:"slug"`
+	Repository string `json:"repository"`
+	Commit     string `json:"commit"`
+	Path       string `json:"path,omitempty"`
+	StepIndex  int    `json:"stepIndex"`
+	// BatchSpec is the name of the batch spec the result was created for. It
+	// is empty for results cached by versions of src that didn't record it.
+	BatchSpec string    `json:"batchSpec,omitempty"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"modTime"`
+
+	file string
+}
+
+// Entries returns all results stored in the cache, ordered by their slug and
+// step index.
+func (c ExecutionDiskCache) Entries() ([]CacheEntry, error) {
+	slugs, err := os.ReadDir(c.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "reading cache directory")
+	}
+
+	var entries []CacheEntry
+	for _, slug := range slugs {
+		// Repository archives, temporary workspaces, step caches and
+		// artifacts are stored in the cache directory, too.
+		if !slug.IsDir() || strings.HasPrefix(slug.Name(), "workspace-") || slug.Name() == StepCachesDir || slug.Name() == ArtifactStoreDir {
+			continue
+		}
+
+		files, err := os.ReadDir(filepath.Join(c.Dir, slug.Name()))
+		if err != nil {
+			return nil, errors.Wrap(err, "reading cache directory")
+		}
+		for _, f := range files {
+			entry, ok, err := c.readEntry(slug.Name(), f.Name())
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Slug != entries[j].Slug {
+			return entries[i].Slug < entries[j].Slug
+		}
+		if entries[i].StepIndex != entries[j].StepIndex {
+			return entries[i].StepIndex < entries[j].StepIndex
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	return entries, nil
+}
+
+// Entry returns the entry with the given key and its result.
+func (c ExecutionDiskCache) Entry(key string) (CacheEntry, execution.AfterStepResult, error) {
+	var result execution.AfterStepResult
+
+	entries, err := c.Entries()
+	if err != nil {
+		return CacheEntry{}, result, err
+	}
+	for _, entry := range entries {
+		if entry.Key != key {
+			continue
+		}
+
+		data, err := os.ReadFile(entry.file)
+		if err != nil {
+			return entry, result, errors.Wrap(err, "reading cache entry")
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return entry, result, errors.Wrapf(err, "reading cache file %s", entry.file)
+		}
+		return entry, result, nil
+	}
+
+	return CacheEntry{}, result, errors.Newf("no cache entry with key %q", key)
+}
+
+// Remove removes the given entry from the cache.
+func (c ExecutionDiskCache) Remove(entry CacheEntry) error {
+	if err := os.Remove(entry.file); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "removing cache entry %s", entry.Key)
+	}
+	if err := os.Remove(strings.TrimSuffix(entry.file, cacheFileExt) + cacheMetadataExt); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "removing metadata of cache entry %s", entry.Key)
+	}
+
+	// Remove the directory of the slug once it's empty. This fails if it
+	// isn't, which is fine.
+	_ = os.Remove(filepath.Dir(entry.file))
+	return nil
+}
+
+func (c ExecutionDiskCache) readEntry(slug, name string) (CacheEntry, bool, error) {
+	key, ok := strings.CutSuffix(name, cacheFileExt)
+	if !ok || strings.HasSuffix(name, cacheMetadataExt) {
+		return CacheEntry{}, false, nil
+	}
+	m := cacheEntryKeyPattern.FindStringSubmatch(key)
+	if m == nil {
+		return CacheEntry{}, false, nil
+	}
+
+	path := filepath.Join(c.Dir, slug, name)
+	info, err := os.Stat(path)
+	if err != nil {
+		return CacheEntry{}, false, errors.Wrap(err, "reading cache entry")
+	}
+
+	entry := CacheEntry{
+		Key:     key,
+		Slug:    slug,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		file:    path,
+	}
+
+	var metadata cacheEntryMetadata
+	if data, err := os.ReadFile(filepath.Join(c.Dir, slug, key+cacheMetadataExt)); err == nil && json.Unmarshal(data, &metadata) == nil {
+		entry.Repository = metadata.Repository
+		entry.Commit = metadata.Commit
+		entry.Path = metadata.Path
+		entry.BatchSpec = metadata.BatchSpec
+		entry.StepIndex = metadata.StepIndex
+	} else {
+		// Results cached by older versions have no metadata, so we recover
+		// what we can from the slug and the key. The slug replaces the slashes
+		// of the repository name, so that's the best we can do.
+		entry.Repository = slug
+		if i := strings.LastIndex(slug, "-"); i >= 0 {
+			entry.Repository, entry.Commit = slug[:i], slug[i+1:]
+		}
+		entry.StepIndex, _ = strconv.Atoi(m[1])
+	}
+
+	return entry, true, nil
+}
+
+// CachePruneOpts select the entries that are removed by PruneCacheEntries.
+// Entries matching any of the options are pruned.
+type CachePruneOpts struct {
+	// OlderThan prunes entries that were last written longer ago than this.
+	OlderThan time.Duration
+	// MaxSize prunes the oldest entries until the remaining entries take up
+	// at most MaxSize bytes.
+	MaxSize int64
+	// BatchSpec prunes the entries of the batch spec with this name.
+	BatchSpec string
+
+	// Now is the time OlderThan is relative to.
+	Now time.Time
+}
+
+// SelectCacheEntriesToPrune returns the entries that are to be removed
+// according to opts.
+func SelectCacheEntriesToPrune(entries []CacheEntry, opts CachePruneOpts) []CacheEntry {
+	prune := make(map[string]bool)
+	for _, entry := range entries {
+		if opts.OlderThan > 0 && opts.Now.Sub(entry.ModTime) > opts.OlderThan {
+			prune[entry.file] = true
+		}
+		if opts.BatchSpec != "" && entry.BatchSpec == opts.BatchSpec {
+			prune[entry.file] = true
+		}
+	}
+
+	if opts.MaxSize > 0 {
+		// Prune the oldest entries first.
+		byAge := make([]CacheEntry, len(entries))
+		copy(byAge, entries)
+		sort.SliceStable(byAge, func(i, j int) bool { return byAge[i].ModTime.Before(byAge[j].ModTime) })
+
+		var total int64
+		for _, entry := range byAge {
+			if !prune[entry.file] {
+				total += entry.Size
+			}
+		}
+		for _, entry := range byAge {
+			if total <= opts.MaxSize {
+				break
+			}
+			if !prune[entry.file] {
+				prune[entry.file] = true
+				total -= entry.Size
+			}
+		}
+	}
+
+	var selected []CacheEntry
+	for _, entry := range entries {
+		if prune[entry.file] {
+			selected = append(selected, entry)
+		}
+	}
+	return selected
+}
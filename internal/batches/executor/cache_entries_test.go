@@ -0,0 +1,139 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/batches/execution"
+	"github.com/sourcegraph/sourcegraph/lib/batches/execution/cache"
+	"github.com/sourcegraph/sourcegraph/lib/batches/template"
+)
+
+func TestExecutionDiskCache_Entries(t *testing.T) {
+	ctx := context.Background()
+	c := ExecutionDiskCache{Dir: t.TempDir()}
+
+	steps := []batcheslib.Step{
+		{Run: "echo 'Hello World'", Container: "alpine:3"},
+		{Run: "echo 'Goodbye World'", Container: "alpine:3"},
+	}
+	key1 := &cache.CacheKey{
+		Repository:            cacheRepo1,
+		Steps:                 steps,
+		BatchChangeAttributes: &template.BatchChangeAttributes{Name: "hello-world"},
+		StepIndex:             1,
+	}
+	key2 := &cache.CacheKey{
+		Repository:            cacheRepo2,
+		Steps:                 steps,
+		BatchChangeAttributes: &template.BatchChangeAttributes{Name: "other"},
+	}
+	result := execution.AfterStepResult{Version: 2, Diff: testDiff, StepIndex: 1, Outputs: map[string]any{"greeting": "hi"}}
+	require.NoError(t, c.Set(ctx, key1, result))
+	require.NoError(t, c.Set(ctx, key2, execution.AfterStepResult{Version: 2, Outputs: map[string]any{}}))
+
+	// Results written by older versions have no metadata.
+	legacyDir := filepath.Join(c.Dir, "github.com-sourcegraph-legacy-c0ff33")
+	require.NoError(t, os.MkdirAll(legacyDir, 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(legacyDir, "abcdefghijklmnopqrstuv-step-2.json"), []byte(`{"stepIndex":2}`), 0600))
+
+	// Other files in the cache directory are ignored.
+	require.NoError(t, os.WriteFile(filepath.Join(c.Dir, "github.com-sourcegraph-src-cli-d34db33f.zip"), nil, 0600))
+	require.NoError(t, os.MkdirAll(filepath.Join(c.Dir, "workspace-123"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(c.Dir, "workspace-123", "package-step-1.json"), nil, 0600))
+
+	entries, err := c.Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	key1String, err := key1.Key()
+	require.NoError(t, err)
+
+	assert.Equal(t, "github.com-sourcegraph-legacy", entries[0].Repository)
+	assert.Equal(t, "c0ff33", entries[0].Commit)
+	assert.Equal(t, 2, entries[0].StepIndex)
+	assert.Empty(t, entries[0].BatchSpec)
+
+	assert.Equal(t, cacheRepo2.Name, entries[1].Repository)
+	assert.Equal(t, "other", entries[1].BatchSpec)
+
+	assert.Equal(t, key1String, entries[2].Key)
+	assert.Equal(t, key1.Slug(), entries[2].Slug)
+	assert.Equal(t, cacheRepo1.Name, entries[2].Repository)
+	assert.Equal(t, cacheRepo1.BaseRev, entries[2].Commit)
+	assert.Equal(t, 1, entries[2].StepIndex)
+	assert.Equal(t, "hello-world", entries[2].BatchSpec)
+	assert.NotZero(t, entries[2].Size)
+
+	entry, have, err := c.Entry(key1String)
+	require.NoError(t, err)
+	assert.Equal(t, entries[2], entry)
+	assert.Equal(t, testDiff, have.Diff)
+	assert.Equal(t, "hi", have.Outputs["greeting"])
+
+	_, _, err = c.Entry("missing-step-0")
+	assert.ErrorContains(t, err, `no cache entry with key "missing-step-0"`)
+
+	require.NoError(t, c.Remove(entry))
+	assertCacheMiss(t, c, key1)
+	assert.NoDirExists(t, filepath.Dir(entry.file))
+
+	entries, err = c.Entries()
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestSelectCacheEntriesToPrune(t *testing.T) {
+	now := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	entries := []CacheEntry{
+		{Key: "a", BatchSpec: "spec-1", Size: 100, ModTime: now.Add(-5 * 24 * time.Hour), file: "a"},
+		{Key: "b", BatchSpec: "spec-2", Size: 200, ModTime: now.Add(-1 * time.Hour), file: "b"},
+		{Key: "c", BatchSpec: "spec-1", Size: 300, ModTime: now.Add(-2 * 24 * time.Hour), file: "c"},
+		{Key: "d", Size: 400, ModTime: now.Add(-10 * time.Minute), file: "d"},
+	}
+
+	keys := func(entries []CacheEntry) []string {
+		var keys []string
+		for _, e := range entries {
+			keys = append(keys, e.Key)
+		}
+		return keys
+	}
+
+	for name, tc := range map[string]struct {
+		opts CachePruneOpts
+		want []string
+	}{
+		"nothing": {
+			opts: CachePruneOpts{Now: now},
+			want: nil,
+		},
+		"older than": {
+			opts: CachePruneOpts{Now: now, OlderThan: 24 * time.Hour},
+			want: []string{"a", "c"},
+		},
+		"batch spec": {
+			opts: CachePruneOpts{Now: now, BatchSpec: "spec-2"},
+			want: []string{"b"},
+		},
+		"max size prunes oldest first": {
+			opts: CachePruneOpts{Now: now, MaxSize: 650},
+			want: []string{"a", "c"},
+		},
+		"max size after other options": {
+			opts: CachePruneOpts{Now: now, MaxSize: 700, BatchSpec: "spec-2"},
+			want: []string{"a", "b"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, keys(SelectCacheEntriesToPrune(entries, tc.opts)))
+		})
+	}
+}
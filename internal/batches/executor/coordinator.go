@@ -2,6 +2,7 @@ package executor
 
 import (
 	"context"
+	"sync"
 
 	"github.com/sourcegraph/sourcegraph/lib/errors"
 
@@ -13,10 +14,14 @@ import (
 )
 
 type taskExecutor interface {
-	Start(context.Context, []*Task, TaskExecutionUI)
+	Start(context.Context, []*Task, TaskExecutionUI, taskFinishedFunc)
 	Wait() ([]taskResult, error)
 }
 
+// taskFinishedFunc is called by a taskExecutor with the result of every task
+// as soon as the task finished.
+type taskFinishedFunc func(*taskResult)
+
 // Coordinator coordinates the execution of Tasks. It makes use of an executor,
 // checks the ExecutionCache whether execution is necessary, and builds
 // batcheslib.ChangesetSpecs out of the executionResults.
@@ -35,6 +40,17 @@ type NewCoordinatorOpts struct {
 	BinaryDiffs bool
 
 	IsRemote bool
+
+	// Journal, if set, records the outcome of every executed task.
+	Journal TaskJournal
+}
+
+// TaskJournal records the outcome of executed tasks, so that an interrupted
+// execution can be resumed without executing them again.
+type TaskJournal interface {
+	// TaskFinished is called with the changeset specs built for a task that
+	// finished successfully, or with the error of a failed task.
+	TaskFinished(task *Task, specs []*batcheslib.ChangesetSpec, err error) error
 }
 
 func NewCoordinator(opts NewCoordinatorOpts) *Coordinator {
@@ -68,7 +84,7 @@ func (c *Coordinator) CheckCache(ctx context.Context, batchSpec *batcheslib.Batc
 func (c *Coordinator) ClearCache(ctx context.Context, tasks []*Task) error {
 	for _, task := range tasks {
 		for i := len(task.Steps) - 1; i > -1; i-- {
-			key := task.CacheKey(c.opts.GlobalEnv, c.opts.ExecOpts.WorkingDirectory, i)
+			key := task.CacheKey(c.opts.GlobalEnv, c.opts.ExecOpts.WorkingDirectory, c.opts.ExecOpts.Runner(), i)
 			if err := c.opts.Cache.Clear(ctx, key); err != nil {
 				return errors.Wrapf(err, "clearing cache for step %d in %q", i, task.Repository.Name)
 			}
@@ -86,6 +102,12 @@ func (c *Coordinator) checkCacheForTask(ctx context.Context, batchSpec *batchesl
 	// we build changeset specs and return.
 	// TODO: This doesn't consider skipped steps.
 	if task.CachedStepResultFound && task.CachedStepResult.StepIndex == len(task.Steps)-1 {
+		// The steps aren't executed again, so their artifacts are restored
+		// from the cache.
+		if err := restoreArtifacts(c.opts.ExecOpts.ArtifactsDir, c.opts.ExecOpts.ArtifactStore, task, task.CachedStepResult.Artifacts); err != nil {
+			return specs, false, err
+		}
+
 		// If the cached result resulted in an empty diff, we don't need to
 		// add it to the list of specs that are displayed to the user and
 		// send to the server. Instead, we can just report that the task is
@@ -134,13 +156,28 @@ func (c *Coordinator) loadCachedStepResults(ctx context.Context, task *Task, glo
 	// We start at the back so that we can find the _last_ cached step,
 	// then restart execution on the following step.
 	for i := len(task.Steps) - 1; i > -1; i-- {
-		key := task.CacheKey(globalEnv, c.opts.ExecOpts.WorkingDirectory, i)
+		key := task.CacheKey(globalEnv, c.opts.ExecOpts.WorkingDirectory, c.opts.ExecOpts.Runner(), i)
 
 		result, found, err := c.opts.Cache.Get(ctx, key)
 		if err != nil {
 			return errors.Wrapf(err, "checking for cached diff for step %d", i)
 		}
 
+		// Results whose artifacts can't be restored anymore, e.g. because
+		// they were cached on another machine, are treated as missing, so
+		// that the steps are executed again.
+		if found && !artifactsRestorable(c.opts.ExecOpts.ArtifactsDir, c.opts.ExecOpts.ArtifactStore, result.Artifacts) {
+			continue
+		}
+
+		// Images built by buildImage steps only exist locally, and may have
+		// been removed since. If later steps need to be executed, the
+		// results are treated as missing up to the step that built it, so
+		// that it's built again.
+		if found && i < len(task.Steps)-1 && !c.builtImageExists(ctx, result) {
+			continue
+		}
+
 		// Found a cached result, we're done.
 		if found {
 			task.CachedStepResultFound = true
@@ -152,6 +189,17 @@ func (c *Coordinator) loadCachedStepResults(ctx context.Context, task *Task, glo
 	return nil
 }
 
+// builtImageExists returns whether the image built by a buildImage step
+// before the cached step still exists. It returns true if no image was built.
+func (c *Coordinator) builtImageExists(ctx context.Context, result execution.AfterStepResult) bool {
+	name, ok := result.Outputs[builtImageOutput].(string)
+	if !ok || name == "" {
+		return true
+	}
+	_, err := c.opts.ExecOpts.Runtime.InspectImage(ctx, name)
+	return err == nil
+}
+
 func (c *Coordinator) buildSpecs(ctx context.Context, batchSpec *batcheslib.BatchSpec, taskResult taskResult, ui TaskExecutionUI) ([]*batcheslib.ChangesetSpec, error) {
 	if len(taskResult.stepResults) == 0 {
 		return nil, nil
@@ -180,36 +228,64 @@ func (c *Coordinator) buildSpecs(ctx context.Context, batchSpec *batcheslib.Batc
 func (c *Coordinator) ExecuteAndBuildSpecs(ctx context.Context, batchSpec *batcheslib.BatchSpec, tasks []*Task, ui TaskExecutionUI) ([]*batcheslib.ChangesetSpec, []string, error) {
 	ui.Start(tasks)
 
+	var (
+		mu         sync.Mutex
+		finishErrs error
+	)
+	// Cache the results of every task, build its changeset specs and record
+	// it in the journal as soon as it finished, so that nothing is lost if
+	// the execution is interrupted.
+	finished := func(res *taskResult) {
+		if err := c.finishTask(ctx, batchSpec, res, ui); err != nil {
+			mu.Lock()
+			finishErrs = errors.Append(finishErrs, err)
+			mu.Unlock()
+		}
+	}
+
 	// Run executor.
-	c.exec.Start(ctx, tasks, ui)
+	c.exec.Start(ctx, tasks, ui, finished)
 	results, errs := c.exec.Wait()
-
-	// Write all step cache results to the cache.
-	for _, res := range results {
-		for _, stepRes := range res.stepResults {
-			cacheKey := res.task.CacheKey(c.opts.GlobalEnv, c.opts.ExecOpts.WorkingDirectory, stepRes.StepIndex)
-			if err := c.opts.Cache.Set(ctx, cacheKey, stepRes); err != nil {
-				return nil, nil, errors.Wrapf(err, "caching result for step %d", stepRes.StepIndex)
-			}
-		}
+	if finishErrs != nil {
+		return nil, nil, finishErrs
 	}
 
 	var specs []*batcheslib.ChangesetSpec
-
-	// Build ChangesetSpecs if possible and add to list.
 	for _, taskResult := range results {
-		// Don't build changeset specs for failed workspaces.
-		if taskResult.err != nil {
-			continue
-		}
+		specs = append(specs, taskResult.specs...)
+	}
 
-		taskSpecs, err := c.buildSpecs(ctx, batchSpec, taskResult, ui)
-		if err != nil {
-			return nil, nil, err
+	return specs, c.opts.Logger.LogFiles(), errs
+}
+
+// finishTask writes the step results of the finished task to the cache,
+// builds its changeset specs if it succeeded, and records it in the journal.
+// The built specs are stored in res.
+func (c *Coordinator) finishTask(ctx context.Context, batchSpec *batcheslib.BatchSpec, res *taskResult, ui TaskExecutionUI) error {
+	var errs error
+	for _, stepRes := range res.stepResults {
+		cacheKey := res.task.CacheKey(c.opts.GlobalEnv, c.opts.ExecOpts.WorkingDirectory, c.opts.ExecOpts.Runner(), stepRes.StepIndex)
+		if err := c.opts.Cache.Set(ctx, cacheKey, stepRes); err != nil {
+			errs = errors.Append(errs, errors.Wrapf(err, "caching result for step %d", stepRes.StepIndex))
 		}
+	}
 
-		specs = append(specs, taskSpecs...)
+	// Don't build changeset specs for failed workspaces.
+	if res.err != nil {
+		return errors.Append(errs, c.journalTask(res.task, nil, res.err))
 	}
 
-	return specs, c.opts.Logger.LogFiles(), errs
+	specs, err := c.buildSpecs(ctx, batchSpec, *res, ui)
+	if err != nil {
+		return errors.Append(errs, err)
+	}
+	res.specs = specs
+	return errors.Append(errs, c.journalTask(res.task, specs, nil))
+}
+
+func (c *Coordinator) journalTask(task *Task, specs []*batcheslib.ChangesetSpec, taskErr error) error {
+	if c.opts.Journal == nil {
+		return nil
+	}
+	return errors.Wrap(c.opts.Journal.TaskFinished(task, specs, taskErr), "recording task in run state")
 }
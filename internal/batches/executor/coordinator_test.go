@@ -435,6 +435,110 @@ func TestCoordinator_Execute_StepCaching(t *testing.T) {
 	assertCacheSize(t, cache, 6)
 }
 
+func TestCoordinator_CheckCache_MissingArtifacts(t *testing.T) {
+	ctx := context.Background()
+	execCache := newInMemoryExecutionCache()
+	store := &ArtifactStore{Dir: t.TempDir()}
+
+	task := &Task{
+		Steps: []batcheslib.Step{
+			{Run: `echo "one"`},
+			{Run: `echo "two" > report.txt`, Artifacts: []string{"report.txt"}},
+		},
+		Repository:            testRepo1,
+		BatchChangeAttributes: &template.BatchChangeAttributes{},
+	}
+
+	coord := &Coordinator{opts: NewCoordinatorOpts{
+		Cache:    execCache,
+		Logger:   mock.LogNoOpManager{},
+		ExecOpts: NewExecutorOpts{ArtifactsDir: t.TempDir(), ArtifactStore: store},
+	}}
+	for i, result := range []execution.AfterStepResult{
+		{Version: 2, StepIndex: 0, Diff: []byte("step-0-diff")},
+		{
+			Version:   2,
+			StepIndex: 1,
+			Diff:      []byte("step-1-diff"),
+			Artifacts: []execution.Artifact{{StepIndex: 1, Path: "report.txt", Size: 4, SHA256: "27dd8ed44a83ff94d557f9fd0412ed5a8cbca69ea04922d88c01184a07300a5a"}},
+		},
+	} {
+		key := task.CacheKey(coord.opts.GlobalEnv, coord.opts.ExecOpts.WorkingDirectory, coord.opts.ExecOpts.Runner(), i)
+		if err := execCache.Set(ctx, key, result); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The content of the artifact of the last step isn't stored, so that
+	// step is executed again.
+	uncached, specs, err := coord.CheckCache(ctx, &batcheslib.BatchSpec{ChangesetTemplate: testChangesetTemplate}, []*Task{task})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) != 0 || len(uncached) != 1 {
+		t.Fatalf("wrong cache check result. specs=%d, uncached=%d", len(specs), len(uncached))
+	}
+	if !task.CachedStepResultFound || task.CachedStepResult.StepIndex != 0 {
+		t.Fatalf("wrong cached step result. found=%t, step=%d", task.CachedStepResultFound, task.CachedStepResult.StepIndex)
+	}
+}
+
+func TestCoordinator_CheckCache_MissingBuiltImage(t *testing.T) {
+	ctx := context.Background()
+
+	task := &Task{
+		Steps: []batcheslib.Step{
+			{BuildImage: &batcheslib.BuildImageStep{BaseImage: "alpine:3", Run: "apk add git"}},
+			{Run: `echo "one"`, Container: "${{ outputs.imageName }}"},
+			{Run: `echo "two"`, Container: "${{ outputs.imageName }}"},
+		},
+		Repository:            testRepo1,
+		BatchChangeAttributes: &template.BatchChangeAttributes{},
+	}
+
+	for name, tc := range map[string]struct {
+		committed []string
+		wantFound bool
+	}{
+		"image exists":  {committed: []string{"built-image"}, wantFound: true},
+		"image missing": {wantFound: false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			execCache := newInMemoryExecutionCache()
+			coord := &Coordinator{opts: NewCoordinatorOpts{
+				Cache:    execCache,
+				Logger:   mock.LogNoOpManager{},
+				ExecOpts: NewExecutorOpts{Runtime: &mock.ContainerRuntime{Committed: tc.committed}},
+			}}
+			for i := 0; i < 2; i++ {
+				key := task.CacheKey(coord.opts.GlobalEnv, coord.opts.ExecOpts.WorkingDirectory, coord.opts.ExecOpts.Runner(), i)
+				result := execution.AfterStepResult{Version: 2, StepIndex: i, Outputs: map[string]any{builtImageOutput: "built-image"}}
+				if err := execCache.Set(ctx, key, result); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			task.CachedStepResultFound = false
+			task.CachedStepResult = execution.AfterStepResult{}
+			uncached, _, err := coord.CheckCache(ctx, &batcheslib.BatchSpec{ChangesetTemplate: testChangesetTemplate}, []*Task{task})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(uncached) != 1 {
+				t.Fatalf("wrong number of uncached tasks. want=1, have=%d", len(uncached))
+			}
+			// If the image is missing, the steps are executed again from the
+			// buildImage step.
+			if task.CachedStepResultFound != tc.wantFound {
+				t.Fatalf("wrong cached step result. want found=%t, have found=%t", tc.wantFound, task.CachedStepResultFound)
+			}
+			if tc.wantFound && task.CachedStepResult.StepIndex != 1 {
+				t.Fatalf("wrong cached step. want=1, have=%d", task.CachedStepResult.StepIndex)
+			}
+		})
+	}
+}
+
 // execAndEnsure executes the given Task with the given cache and dummyExecutor
 // in a new Coordinator, setting cb as the startCallback on the executor.
 func execAndEnsure(t *testing.T, coord *Coordinator, exec *dummyExecutor, batchSpec *batcheslib.BatchSpec, task *Task, cb startCallback) {
@@ -550,19 +654,27 @@ type dummyExecutor struct {
 	startCb       startCallback
 	startCbCalled bool
 
-	results []taskResult
-	waitErr error
+	results  []taskResult
+	waitErr  error
+	finished taskFinishedFunc
 }
 
-func (d *dummyExecutor) Start(ctx context.Context, ts []*Task, ui TaskExecutionUI) {
+func (d *dummyExecutor) Start(ctx context.Context, ts []*Task, ui TaskExecutionUI, finished taskFinishedFunc) {
 	if d.startCb != nil {
 		d.startCb(ctx, ts, ui)
 		d.startCbCalled = true
 	}
+	d.finished = finished
 	// "noop noop noop", the crowd screams
 }
 
 func (d *dummyExecutor) Wait() ([]taskResult, error) {
+	// The tasks finish as soon as we wait for them.
+	for i := range d.results {
+		if d.finished != nil && d.results[i].task != nil {
+			d.finished(&d.results[i])
+		}
+	}
 	return d.results, d.waitErr
 }
 
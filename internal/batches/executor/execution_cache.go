@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/sourcegraph/sourcegraph/lib/errors"
 
@@ -79,6 +80,9 @@ func (c ExecutionDiskCache) Clear(ctx context.Context, key cache.Keyer) error {
 		return nil
 	}
 
+	if err := os.Remove(strings.TrimSuffix(path, cacheFileExt) + cacheMetadataExt); err != nil && !os.IsNotExist(err) {
+		return err
+	}
 	return os.Remove(path)
 }
 
@@ -103,7 +107,16 @@ func (c ExecutionDiskCache) Set(ctx context.Context, key cache.Keyer, result exe
 		return err
 	}
 
-	return c.writeCacheFile(path, &result)
+	if err := c.writeCacheFile(path, &result); err != nil {
+		return err
+	}
+
+	// Store what we know about the key next to the result, so that the cache
+	// can be listed and pruned.
+	if metadata, ok := metadataForKey(key); ok {
+		return c.writeCacheFile(strings.TrimSuffix(path, cacheFileExt)+cacheMetadataExt, &metadata)
+	}
+	return nil
 }
 
 // ExecutionNoOpCache is an implementation of ExecutionCache that does not store or
@@ -15,6 +15,7 @@ import (
 	"github.com/sourcegraph/src-cli/internal/batches/util"
 	"github.com/sourcegraph/src-cli/internal/batches/workspace"
 
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
 	"github.com/sourcegraph/sourcegraph/lib/batches/execution"
 )
 
@@ -49,15 +50,23 @@ type taskResult struct {
 	task        *Task
 	stepResults []execution.AfterStepResult
 	err         error
+
+	// specs are the changeset specs built for the result once the task
+	// finished.
+	specs []*batcheslib.ChangesetSpec
 }
 
 type imageEnsurer func(ctx context.Context, name string) (docker.Image, error)
 
+type imageBuilder func(ctx context.Context, baseImage, script string) (string, docker.Image, error)
+
 type NewExecutorOpts struct {
 	// Dependencies
 	Creator             workspace.Creator
+	Runtime             docker.ContainerRuntime
 	RepoArchiveRegistry repozip.ArchiveRegistry
 	EnsureImage         imageEnsurer
+	BuildImage          imageBuilder
 	Logger              log.LogManager
 
 	// Config
@@ -69,8 +78,33 @@ type NewExecutorOpts struct {
 	GlobalEnv        []string
 	ForceRoot        bool
 	FailFast         bool
+	// Host runs the step scripts directly on the host instead of in
+	// containers. The workspaces need to be on the host filesystem.
+	Host bool
 
 	BinaryDiffs bool
+
+	// AgentRunners maps codingAgent step types to the runner that executes
+	// them.
+	AgentRunners map[string]AgentRunner
+	// StepCaches stores the caches declared by steps. Steps with caches fail
+	// if it's nil.
+	StepCaches *StepCaches
+	// ArtifactsDir is the directory the artifacts collected by steps are
+	// written to.
+	ArtifactsDir string
+	// ArtifactStore stores the contents of the artifacts collected by steps.
+	ArtifactStore *ArtifactStore
+}
+
+// Runner returns the runner that is part of the cache keys of the tasks
+// executed with these options, so that results of steps run on the host are
+// never mixed up with results of steps run in containers.
+func (opts NewExecutorOpts) Runner() string {
+	if opts.Host {
+		return hostRunner
+	}
+	return ""
 }
 
 type executor struct {
@@ -88,8 +122,10 @@ func NewExecutor(opts NewExecutorOpts) *executor {
 }
 
 // Start starts the execution of the given Tasks in goroutines, calling the
-// given taskStatusHandler to update the progress of the tasks.
-func (x *executor) Start(ctx context.Context, tasks []*Task, ui TaskExecutionUI) {
+// given taskStatusHandler to update the progress of the tasks. finished, if not
+// nil, is called with the result of every task that was started, once it
+// finished.
+func (x *executor) Start(ctx context.Context, tasks []*Task, ui TaskExecutionUI, finished taskFinishedFunc) {
 	defer func() { close(x.doneEnqueuing) }()
 
 	x.workPool = pool.NewWithResults[*taskResult]().WithMaxGoroutines(x.opts.Parallelism).WithContext(ctx)
@@ -105,7 +141,11 @@ func (x *executor) Start(ctx context.Context, tasks []*Task, ui TaskExecutionUI)
 		}
 
 		x.workPool.Go(func(c context.Context) (*taskResult, error) {
-			return x.do(c, task, ui)
+			result, err := x.do(c, task, ui)
+			if result != nil && finished != nil {
+				finished(result)
+			}
+			return result, err
 		})
 	}
 }
@@ -160,14 +200,21 @@ func (x *executor) do(ctx context.Context, task *Task, ui TaskExecutionUI) (resu
 		Task:             task,
 		Logger:           l,
 		WC:               x.opts.Creator,
+		Runtime:          x.opts.Runtime,
 		EnsureImage:      x.opts.EnsureImage,
+		BuildImage:       x.opts.BuildImage,
 		TempDir:          x.opts.TempDir,
 		GlobalEnv:        x.opts.GlobalEnv,
 		Timeout:          x.opts.Timeout,
 		RepoArchive:      repoArchive,
 		WorkingDirectory: x.opts.WorkingDirectory,
 		ForceRoot:        x.opts.ForceRoot,
+		Host:             x.opts.Host,
 		BinaryDiffs:      x.opts.BinaryDiffs,
+		AgentRunners:     x.opts.AgentRunners,
+		StepCaches:       x.opts.StepCaches,
+		ArtifactsDir:     x.opts.ArtifactsDir,
+		ArtifactStore:    x.opts.ArtifactStore,
 
 		UI: ui.StepsExecutionUI(task),
 	}
@@ -16,6 +16,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/sourcegraph/go-diff/diff"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/sourcegraph/sourcegraph/lib/errors"
@@ -378,6 +379,87 @@ func TestExecutor_Integration(t *testing.T) {
 			wantCacheCount:   1,
 			workingDirectory: tempDir,
 		},
+		{
+			name: "coding agent step",
+			archives: []mock.RepoArchive{
+				{RepoName: testRepo1.Name, Commit: testRepo1.Rev(), Files: map[string]string{
+					"README.md": "# Welcome to the README\n",
+				}},
+			},
+			steps: []batcheslib.Step{
+				{Run: `echo -e "foobar\n" >> README.md`},
+				{CodingAgent: &batcheslib.CodingAgentStep{Type: "fake", Prompt: "Update ${{ repository.name }}"}},
+			},
+			tasks: []*Task{
+				{Repository: testRepo1},
+			},
+			wantFilesChanged: filesByRepository{
+				testRepo1.ID: filesByPath{
+					rootPath: []string{"README.md", "AGENT.md"},
+				},
+			},
+			wantFinished:   1,
+			wantCacheCount: 2,
+		},
+		{
+			name: "hook event",
+			archives: []mock.RepoArchive{
+				{RepoName: testRepo1.Name, Commit: testRepo1.Rev(), Files: map[string]string{
+					"README.md": "# Welcome to the README\n",
+				}},
+			},
+			steps: []batcheslib.Step{
+				{Run: `test "${{ event.name }}" = "onCIFailure" && echo "${{ event.payload }}" > ci.log`},
+			},
+			tasks: []*Task{
+				{Repository: testRepo1, Event: template.HookEvent{Name: "onCIFailure", Payload: "tests failed"}},
+			},
+			wantFilesChanged: filesByRepository{
+				testRepo1.ID: filesByPath{
+					rootPath: []string{"ci.log"},
+				},
+			},
+			wantFinished:   1,
+			wantCacheCount: 1,
+		},
+		{
+			name: "build image step",
+			archives: []mock.RepoArchive{
+				{RepoName: testRepo1.Name, Commit: testRepo1.Rev(), Files: map[string]string{
+					"README.md": "# Welcome to the README\n",
+				}},
+			},
+			steps: []batcheslib.Step{
+				{BuildImage: &batcheslib.BuildImageStep{BaseImage: "alpine:3", Run: "apk add git"}},
+				{Container: "${{ outputs.imageName }}", Run: `echo "built with ${{ outputs.imageName }}" >> README.md`},
+			},
+			tasks: []*Task{
+				{Repository: testRepo1},
+			},
+			wantFilesChanged: filesByRepository{
+				testRepo1.ID: filesByPath{
+					rootPath: []string{"README.md"},
+				},
+			},
+			wantFinished:   1,
+			wantCacheCount: 2,
+		},
+		{
+			name: "unknown coding agent type",
+			archives: []mock.RepoArchive{
+				{RepoName: testRepo1.Name, Commit: testRepo1.Rev(), Files: map[string]string{
+					"README.md": "# Welcome to the README\n",
+				}},
+			},
+			steps: []batcheslib.Step{
+				{CodingAgent: &batcheslib.CodingAgentStep{Type: "unknown", Prompt: "Do something"}},
+			},
+			tasks: []*Task{
+				{Repository: testRepo1},
+			},
+			wantErrInclude:      `no runner available for coding agent type "unknown"`,
+			wantFinishedWithErr: 1,
+		},
 	}
 
 	for _, tc := range tests {
@@ -386,6 +468,10 @@ func TestExecutor_Integration(t *testing.T) {
 			images := make(map[string]docker.Image)
 			for _, step := range tc.steps {
 				images[step.Container] = &mock.Image{RawDigest: step.Container}
+				if b := step.BuildImage; b != nil {
+					name := docker.BuiltImageName(b.BaseImage, b.Run)
+					images[name] = &mock.Image{RawDigest: name}
+				}
 			}
 			for _, task := range tc.tasks {
 				task.BatchChangeAttributes = defaultBatchChangeAttributes
@@ -416,7 +502,7 @@ func TestExecutor_Integration(t *testing.T) {
 			testTempDir := t.TempDir()
 
 			ctx := context.Background()
-			cr, _ := workspace.NewCreator(ctx, "bind", testTempDir, testTempDir, images)
+			cr, _ := workspace.NewCreator(ctx, docker.NewDockerRuntime(), "bind", testTempDir, testTempDir, images)
 			// Setup executor
 			parallelism := 0
 			if tc.failFast {
@@ -424,15 +510,20 @@ func TestExecutor_Integration(t *testing.T) {
 			}
 			opts := NewExecutorOpts{
 				Creator:             cr,
+				Runtime:             docker.NewDockerRuntime(),
 				RepoArchiveRegistry: repozip.NewArchiveRegistry(client, testTempDir, false),
 				Logger:              mock.LogNoOpManager{},
 				EnsureImage:         imageMapEnsurer(images),
+				BuildImage:          imageMapBuilder(images),
 
 				TempDir:          testTempDir,
 				Parallelism:      runtime.GOMAXPROCS(parallelism),
 				Timeout:          tc.executorTimeout,
 				FailFast:         tc.failFast,
 				WorkingDirectory: tc.workingDirectory,
+				AgentRunners: map[string]AgentRunner{
+					"fake": &FakeAgentRunner{Path: "AGENT.md"},
+				},
 			}
 
 			if opts.Timeout == 0 {
@@ -443,7 +534,7 @@ func TestExecutor_Integration(t *testing.T) {
 			executor := NewExecutor(opts)
 
 			// Run executor
-			executor.Start(ctx, tc.tasks, dummyUI)
+			executor.Start(ctx, tc.tasks, dummyUI, nil)
 
 			results, err := executor.Wait()
 			if tc.wantErrInclude == "" {
@@ -816,6 +907,70 @@ index 3040106..5f2f924 100644
 	})
 }
 
+func TestExecutor_StepRetries(t *testing.T) {
+	// Don't wait between attempts.
+	oldBackoff := stepRetryBackoff
+	stepRetryBackoff = func(int) time.Duration { return 0 }
+	t.Cleanup(func() { stepRetryBackoff = oldBackoff })
+
+	archive := mock.RepoArchive{
+		RepoName: testRepo1.Name, Commit: testRepo1.Rev(), Files: map[string]string{
+			"README.md": "# Welcome to the README\n",
+		},
+	}
+
+	// failingRun changes the workspace and fails until it has been attempted
+	// the given number of times.
+	failingRun := func(t *testing.T, failures int) string {
+		counter := filepath.Join(t.TempDir(), "attempts")
+		return fmt.Sprintf(`echo "attempt" >> README.md
+echo "attempt" >> "%[1]s"
+if [[ $(wc -l < "%[1]s") -le %[2]d ]]; then exit 1; fi`, counter, failures)
+	}
+
+	t.Run("succeeds after retry", func(t *testing.T) {
+		task := &Task{
+			BatchChangeAttributes: &template.BatchChangeAttributes{},
+			Steps: []batcheslib.Step{
+				{Run: `echo "first step" >> README.md`},
+				{Run: failingRun(t, 2), MaxAttempts: 3},
+			},
+			Repository: testRepo1,
+		}
+
+		results, err := testExecuteTasks(t, []*Task{task}, archive)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Len(t, results[0].stepResults, 2)
+
+		// Only the changes of the successful attempt end up in the diff.
+		diff := string(results[0].stepResults[1].Diff)
+		assert.Equal(t, 1, strings.Count(diff, "+attempt"))
+		assert.Equal(t, 1, strings.Count(diff, "+first step"))
+	})
+
+	t.Run("fails after max attempts", func(t *testing.T) {
+		task := &Task{
+			BatchChangeAttributes: &template.BatchChangeAttributes{},
+			Steps: []batcheslib.Step{
+				{Run: failingRun(t, 2), MaxAttempts: 2},
+			},
+			Repository: testRepo1,
+		}
+
+		_, err := testExecuteTasks(t, []*Task{task}, archive)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "exit code 1")
+	})
+}
+
+func TestStepRetryBackoff(t *testing.T) {
+	assert.Equal(t, 1*time.Second, stepRetryBackoff(1))
+	assert.Equal(t, 2*time.Second, stepRetryBackoff(2))
+	assert.Equal(t, 4*time.Second, stepRetryBackoff(3))
+	assert.Equal(t, stepRetryMaxBackoff, stepRetryBackoff(100))
+}
+
 func testExecuteTasks(t *testing.T, tasks []*Task, archives ...mock.RepoArchive) ([]taskResult, error) {
 	if runtime.GOOS == "windows" {
 		t.Skip("Test doesn't work on Windows because dummydocker is written in bash")
@@ -845,10 +1000,11 @@ func testExecuteTasks(t *testing.T, tasks []*Task, archives ...mock.RepoArchive)
 	}
 
 	ctx := context.Background()
-	cr, _ := workspace.NewCreator(ctx, "bind", testTempDir, testTempDir, images)
+	cr, _ := workspace.NewCreator(ctx, docker.NewDockerRuntime(), "bind", testTempDir, testTempDir, images)
 	// Setup executor
 	executor := NewExecutor(NewExecutorOpts{
 		Creator:             cr,
+		Runtime:             docker.NewDockerRuntime(),
 		RepoArchiveRegistry: repozip.NewArchiveRegistry(client, testTempDir, false),
 		Logger:              mock.LogNoOpManager{},
 		EnsureImage:         imageMapEnsurer(images),
@@ -858,10 +1014,22 @@ func testExecuteTasks(t *testing.T, tasks []*Task, archives ...mock.RepoArchive)
 		Timeout:     30 * time.Second,
 	})
 
-	executor.Start(ctx, tasks, newDummyTaskExecutionUI())
+	executor.Start(ctx, tasks, newDummyTaskExecutionUI(), nil)
 	return executor.Wait()
 }
 
+// imageMapBuilder returns the images in m as if they were built, using the
+// base image name in place of its digest.
+func imageMapBuilder(m map[string]docker.Image) imageBuilder {
+	return func(_ context.Context, baseImage, script string) (string, docker.Image, error) {
+		name := docker.BuiltImageName(baseImage, script)
+		if i, ok := m[name]; ok {
+			return name, i, nil
+		}
+		return "", nil, errors.New(fmt.Sprintf("built image for %s not found", baseImage))
+	}
+}
+
 func imageMapEnsurer(m map[string]docker.Image) imageEnsurer {
 	return func(_ context.Context, container string) (docker.Image, error) {
 		if i, ok := m[container]; ok {
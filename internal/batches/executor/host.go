@@ -0,0 +1,116 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/src-cli/internal/batches/workspace"
+)
+
+// hostRunner is the runner that is part of the cache keys of steps that are
+// run on the host.
+const hostRunner = "host"
+
+// hostStepRootEnv is the environment variable that points to the directory
+// the files and mounts of a step are made available in when it's run on the
+// host. A file that would be mounted to /tmp/foo in a container can be found
+// at $SRC_STEP_ROOT/tmp/foo.
+const hostStepRootEnv = "SRC_STEP_ROOT"
+
+// hostShell returns the shell that step scripts are run with on the host,
+// preferring bash over sh like probeImageForShell does.
+func hostShell() (string, error) {
+	var err error
+	for _, shell := range []string{"bash", "sh"} {
+		path, lookErr := exec.LookPath(shell)
+		if lookErr == nil {
+			return path, nil
+		}
+		err = errors.Append(err, lookErr)
+	}
+	return "", errors.Wrap(err, "finding a shell on the host")
+}
+
+// runStepOnHost is the counterpart of runStepContainer for steps that are run
+// on the host. The script is run in the directory of the workspace, with the
+// global environment and the environment of the step. Everything that would
+// be mounted into the container is linked into a temporary step root instead,
+// which is passed to the script in hostStepRootEnv.
+func runStepOnHost(ctx context.Context, opts *RunStepsOpts, workspace workspace.Workspace, stepIdx int, step batcheslib.Step, run *containerRun) error {
+	dir := workspace.WorkDir()
+	if dir == nil {
+		return errors.New("running steps on the host requires a workspace on the host filesystem")
+	}
+
+	// Resource limits can't be applied on the host, but running a step that
+	// must not reach the network with network access isn't acceptable.
+	if step.Network == batcheslib.StepNetworkNone {
+		return errors.Newf("step %d has network %q, which can't be enforced when running steps on the host", stepIdx+1, step.Network)
+	}
+
+	root, err := os.MkdirTemp(opts.TempDir, "step-root-")
+	if err != nil {
+		return errors.Wrap(err, "creating step root")
+	}
+	defer os.RemoveAll(root)
+
+	for target, source := range run.filesToMount {
+		if err := linkIntoStepRoot(root, source.Name(), target); err != nil {
+			return err
+		}
+	}
+	for _, mount := range step.Mount {
+		source, err := getAbsoluteMountPath(opts.WorkingDirectory, mount.Path)
+		if err != nil {
+			return err
+		}
+		if err := linkIntoStepRoot(root, source, mount.Mountpoint); err != nil {
+			return err
+		}
+	}
+	for source, target := range run.extraMounts {
+		if err := linkIntoStepRoot(root, source, target); err != nil {
+			return err
+		}
+	}
+	for source, target := range run.cacheMounts {
+		if err := linkIntoStepRoot(root, source, target); err != nil {
+			return err
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, run.shell, run.runScriptFile)
+	cmd.Dir = filepath.Join(*dir, filepath.FromSlash(opts.Task.Path))
+	cmd.Env = append(slices.Clone(opts.GlobalEnv), hostStepRootEnv+"="+root)
+	for k, v := range run.env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	return runStepCommand(ctx, opts, stepIdx, step, cmd, run)
+}
+
+// linkIntoStepRoot makes source available at target relative to the step
+// root by symlinking it.
+func linkIntoStepRoot(root, source, target string) error {
+	rel := filepath.Clean(filepath.FromSlash(strings.TrimPrefix(target, "/")))
+	if rel == "." || !filepath.IsLocal(rel) {
+		return errors.Newf("invalid target path %q", target)
+	}
+
+	dst := filepath.Join(root, rel)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return errors.Wrapf(err, "creating directory for %q", target)
+	}
+	// Directory mounts end with a separator, which the link must not.
+	if err := os.Symlink(strings.TrimSuffix(source, string(filepath.Separator)), dst); err != nil {
+		return errors.Wrapf(err, "linking %q", target)
+	}
+	return nil
+}
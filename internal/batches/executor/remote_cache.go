@@ -0,0 +1,286 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/sourcegraph/lib/batches/execution"
+	"github.com/sourcegraph/sourcegraph/lib/batches/execution/cache"
+)
+
+// RemoteCacheOpts are the options of NewRemoteCache.
+type RemoteCacheOpts struct {
+	// URL is the URL of the shared cache. The backend is selected by its
+	// scheme: http and https use an ExecutionHTTPCache, file uses an
+	// ExecutionDiskCache in the given directory.
+	URL string
+	// MaxSize is the maximum size in bytes of a single result in the shared
+	// cache. Larger results are only cached locally. If MaxSize is 0,
+	// there's no limit.
+	MaxSize int64
+	// ClearShared makes Clear remove results from the shared cache, too.
+	// Otherwise, only the local cache is cleared, since the shared cache is
+	// used by others.
+	ClearShared bool
+	// Warn is called with the first error of the shared cache. Errors of the
+	// shared cache don't fail cache operations, since the local cache is
+	// still used: failed reads are misses and failed writes are skipped.
+	Warn func(error)
+}
+
+// NewRemoteCache returns a cache that reads through and writes through local
+// to the shared cache given in the options, so that step results are shared
+// between everyone using the same URL.
+func NewRemoteCache(local cache.Cache, opts RemoteCacheOpts) (cache.Cache, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing cache URL")
+	}
+
+	var remote cache.Cache
+	switch u.Scheme {
+	case "http", "https":
+		remote = &ExecutionHTTPCache{URL: u, Client: http.DefaultClient, MaxSize: opts.MaxSize}
+	case "file":
+		remote = &ExecutionDiskCache{Dir: u.Path}
+	default:
+		return nil, errors.Newf("unsupported cache URL scheme %q, must be one of http, https, or file", u.Scheme)
+	}
+
+	return &layeredCache{local: local, remote: remote, clearRemote: opts.ClearShared, warn: opts.Warn}, nil
+}
+
+// layeredCache is a cache.Cache that reads through and writes through a local
+// cache to a remote one. Errors of the remote cache are only reported to warn.
+type layeredCache struct {
+	local       cache.Cache
+	remote      cache.Cache
+	clearRemote bool
+
+	warn     func(error)
+	warnOnce sync.Once
+}
+
+// remoteFailed reports the first error of the remote cache.
+func (c *layeredCache) remoteFailed(err error) {
+	if c.warn == nil {
+		return
+	}
+	c.warnOnce.Do(func() {
+		c.warn(errors.Wrap(err, "shared cache failed, using only the local cache for the failed requests; further errors of the shared cache are not reported"))
+	})
+}
+
+func (c *layeredCache) Get(ctx context.Context, key cache.Keyer) (execution.AfterStepResult, bool, error) {
+	result, found, err := c.local.Get(ctx, key)
+	if err != nil || found {
+		return result, found, err
+	}
+
+	result, found, err = c.remote.Get(ctx, key)
+	if err != nil {
+		c.remoteFailed(err)
+		return execution.AfterStepResult{}, false, nil
+	}
+	if !found {
+		return result, false, nil
+	}
+
+	// Keep a local copy, so that we don't need to fetch it again.
+	if err := c.local.Set(ctx, key, result); err != nil {
+		return result, false, errors.Wrap(err, "storing remote cache result locally")
+	}
+	return result, true, nil
+}
+
+func (c *layeredCache) Set(ctx context.Context, key cache.Keyer, result execution.AfterStepResult) error {
+	if err := c.local.Set(ctx, key, result); err != nil {
+		return err
+	}
+	if err := c.remote.Set(ctx, key, result); err != nil {
+		c.remoteFailed(err)
+	}
+	return nil
+}
+
+func (c *layeredCache) Clear(ctx context.Context, key cache.Keyer) error {
+	if err := c.local.Clear(ctx, key); err != nil {
+		return err
+	}
+	if !c.clearRemote {
+		return nil
+	}
+	return c.remote.Clear(ctx, key)
+}
+
+// ExecutionHTTPCache is a cache.Cache that stores results in a content
+// addressed HTTP store. Results are read with GET, written with PUT and
+// removed with DELETE requests to URL/<slug>/<key>.json.
+//
+// Every result is stored in an envelope that contains its cache key and
+// checksum. Entries whose envelope doesn't match are treated as missing, so
+// that they are replaced by the next Set.
+type ExecutionHTTPCache struct {
+	URL    *url.URL
+	Client *http.Client
+	// MaxSize is the maximum size in bytes of a single entry. Larger results
+	// are not stored and larger entries are treated as missing. If MaxSize is
+	// 0, there's no limit.
+	MaxSize int64
+}
+
+// httpCacheEntryVersion is the version of the httpCacheEntry envelope. Entries
+// with a different version are treated as missing.
+const httpCacheEntryVersion = 1
+
+type httpCacheEntry struct {
+	Version int             `json:"version"`
+	Key     string          `json:"key"`
+	SHA256  string          `json:"sha256"`
+	Result  json.RawMessage `json:"result"`
+}
+
+func (c *ExecutionHTTPCache) entryURL(key cache.Keyer) (string, string, error) {
+	keyString, err := key.Key()
+	if err != nil {
+		return "", "", errors.Wrap(err, "calculating execution cache key")
+	}
+
+	return c.URL.JoinPath(key.Slug(), keyString+cacheFileExt).String(), keyString, nil
+}
+
+func (c *ExecutionHTTPCache) Get(ctx context.Context, key cache.Keyer) (execution.AfterStepResult, bool, error) {
+	var result execution.AfterStepResult
+	u, keyString, err := c.entryURL(key)
+	if err != nil {
+		return result, false, err
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return result, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return result, false, nil
+	}
+	if err := checkCacheResponse(resp); err != nil {
+		return result, false, err
+	}
+
+	body := io.Reader(resp.Body)
+	if c.MaxSize > 0 {
+		body = io.LimitReader(resp.Body, c.MaxSize+1)
+	}
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return result, false, errors.Wrap(err, "reading remote cache entry")
+	}
+	if c.MaxSize > 0 && int64(len(raw)) > c.MaxSize {
+		return result, false, nil
+	}
+
+	var entry httpCacheEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return result, false, nil
+	}
+	if entry.Version != httpCacheEntryVersion || entry.Key != keyString || entry.SHA256 != checksum(entry.Result) {
+		return result, false, nil
+	}
+	if err := json.Unmarshal(entry.Result, &result); err != nil {
+		return result, false, nil
+	}
+
+	return result, true, nil
+}
+
+func (c *ExecutionHTTPCache) Set(ctx context.Context, key cache.Keyer, result execution.AfterStepResult) error {
+	u, keyString, err := c.entryURL(key)
+	if err != nil {
+		return err
+	}
+
+	rawResult, err := json.Marshal(&result)
+	if err != nil {
+		return errors.Wrap(err, "serializing cache content to JSON")
+	}
+	raw, err := json.Marshal(&httpCacheEntry{
+		Version: httpCacheEntryVersion,
+		Key:     keyString,
+		SHA256:  checksum(rawResult),
+		Result:  rawResult,
+	})
+	if err != nil {
+		return errors.Wrap(err, "serializing cache entry to JSON")
+	}
+	if c.MaxSize > 0 && int64(len(raw)) > c.MaxSize {
+		return nil
+	}
+
+	resp, err := c.do(ctx, http.MethodPut, u, raw)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkCacheResponse(resp)
+}
+
+func (c *ExecutionHTTPCache) Clear(ctx context.Context, key cache.Keyer) error {
+	u, _, err := c.entryURL(key)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(ctx, http.MethodDelete, u, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return checkCacheResponse(resp)
+}
+
+func (c *ExecutionHTTPCache) do(ctx context.Context, method, u string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "creating remote cache request")
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "sending remote cache request")
+	}
+	return resp, nil
+}
+
+func checkCacheResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return errors.Newf("remote cache request %s %s failed with status %d: %s", resp.Request.Method, resp.Request.URL.Redacted(), resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
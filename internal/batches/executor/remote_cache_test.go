@@ -0,0 +1,141 @@
+package executor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/batches/execution"
+	"github.com/sourcegraph/sourcegraph/lib/batches/execution/cache"
+	"github.com/sourcegraph/sourcegraph/lib/batches/git"
+
+	"github.com/sourcegraph/src-cli/internal/batches/mock"
+)
+
+func TestRemoteCache(t *testing.T) {
+	ctx := context.Background()
+
+	key := &cache.CacheKey{
+		Repository: cacheRepo1,
+		Steps: []batcheslib.Step{
+			{Run: "echo 'Hello World'", Container: "alpine:3"},
+		},
+	}
+	keyString, err := key.Key()
+	require.NoError(t, err)
+	entryPath := "/" + key.Slug() + "/" + keyString + cacheFileExt
+
+	value := execution.AfterStepResult{
+		Version: 2,
+		Diff:    testDiff,
+		ChangedFiles: git.Changes{
+			Added: []string{"README.md"},
+		},
+		Outputs: map[string]any{},
+	}
+
+	newCacheWithOpts := func(t *testing.T, server http.Handler, opts RemoteCacheOpts) cache.Cache {
+		ts := httptest.NewServer(server)
+		t.Cleanup(ts.Close)
+
+		opts.URL = ts.URL + "/cache"
+		c, err := NewRemoteCache(ExecutionDiskCache{Dir: t.TempDir()}, opts)
+		require.NoError(t, err)
+		return c
+	}
+	newCache := func(t *testing.T, server *mock.CacheServer, maxSize int64) cache.Cache {
+		return newCacheWithOpts(t, server, RemoteCacheOpts{MaxSize: maxSize})
+	}
+
+	t.Run("write-through and read-through", func(t *testing.T) {
+		server := &mock.CacheServer{}
+		writer := newCache(t, server, 0)
+
+		assertCacheMiss(t, writer, key)
+		require.NoError(t, writer.Set(ctx, key, value))
+		_, ok := server.Entry("/cache" + entryPath)
+		assert.True(t, ok, "result not written to the remote cache")
+
+		// A second cache with an empty local cache reads the result from the
+		// remote cache and then keeps it locally.
+		reader := newCache(t, server, 0)
+		assertCacheHit(t, reader, key, value)
+		gets := server.Gets
+		assertCacheHit(t, reader, key, value)
+		assert.Equal(t, gets, server.Gets, "result not cached locally")
+
+		// Clearing only removes the local result, unless the shared cache
+		// is cleared explicitly.
+		require.NoError(t, writer.Clear(ctx, key))
+		_, ok = server.Entry("/cache" + entryPath)
+		assert.True(t, ok, "result removed from the remote cache")
+
+		require.NoError(t, newCacheWithOpts(t, server, RemoteCacheOpts{ClearShared: true}).Clear(ctx, key))
+		_, ok = server.Entry("/cache" + entryPath)
+		assert.False(t, ok, "result not removed from the remote cache")
+	})
+
+	t.Run("failing remote cache", func(t *testing.T) {
+		failing := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		})
+		var warnings []error
+		c := newCacheWithOpts(t, failing, RemoteCacheOpts{Warn: func(err error) { warnings = append(warnings, err) }})
+
+		// Failed reads are misses and failed writes are skipped, but the
+		// local cache is still used.
+		assertCacheMiss(t, c, key)
+		require.NoError(t, c.Set(ctx, key, value))
+		assertCacheHit(t, c, key, value)
+
+		// Only the first error is reported.
+		require.Len(t, warnings, 1)
+		assert.ErrorContains(t, warnings[0], "failed with status 503")
+	})
+
+	t.Run("integrity", func(t *testing.T) {
+		for name, corrupt := range map[string]func(entry []byte) []byte{
+			"invalid JSON": func(entry []byte) []byte { return entry[:len(entry)/2] },
+			"modified result": func(entry []byte) []byte {
+				return []byte(strings.Replace(string(entry), "README.md", "MALICIOUS.md", 1))
+			},
+			"other key": func(entry []byte) []byte {
+				return []byte(strings.Replace(string(entry), keyString, "other-key", 1))
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				server := &mock.CacheServer{}
+				require.NoError(t, newCache(t, server, 0).Set(ctx, key, value))
+
+				entry, _ := server.Entry("/cache" + entryPath)
+				server.SetEntry("/cache"+entryPath, corrupt(entry))
+
+				assertCacheMiss(t, newCache(t, server, 0), key)
+			})
+		}
+	})
+
+	t.Run("size cap", func(t *testing.T) {
+		server := &mock.CacheServer{}
+		c := newCache(t, server, 64)
+
+		require.NoError(t, c.Set(ctx, key, value))
+		assert.Equal(t, 0, server.Puts, "result larger than the size cap was uploaded")
+		// It's still cached locally.
+		assertCacheHit(t, c, key, value)
+
+		require.NoError(t, newCache(t, server, 0).Set(ctx, key, value))
+		assertCacheMiss(t, newCache(t, server, 64), key)
+	})
+
+	t.Run("unsupported scheme", func(t *testing.T) {
+		_, err := NewRemoteCache(ExecutionDiskCache{Dir: t.TempDir()}, RemoteCacheOpts{URL: "s3://bucket"})
+		assert.ErrorContains(t, err, `unsupported cache URL scheme "s3"`)
+	})
+}
@@ -0,0 +1,103 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/batches/template"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/src-cli/internal/batches/workspace"
+)
+
+const (
+	stepRetryBaseBackoff = 1 * time.Second
+	stepRetryMaxBackoff  = 1 * time.Minute
+)
+
+// stepRetryBackoff returns how long to wait after the given failed attempt
+// before a step is retried. The backoff doubles with every attempt. It is a
+// variable so tests can avoid waiting.
+var stepRetryBackoff = func(attempt int) time.Duration {
+	backoff := stepRetryBaseBackoff
+	for i := 1; i < attempt && backoff < stepRetryMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, stepRetryMaxBackoff)
+}
+
+// executeStepWithRetries executes the step up to step.MaxAttempts times until
+// it succeeds. Before every retry, the workspace is restored to the state it
+// had before the step. Only the output of the last attempt is returned.
+func executeStepWithRetries(
+	ctx context.Context,
+	opts *RunStepsOpts,
+	ws workspace.Workspace,
+	stepIdx int,
+	step batcheslib.Step,
+	imageDigest string,
+	stepContext *template.StepContext,
+) (stdout bytes.Buffer, stderr bytes.Buffer, err error) {
+	maxAttempts := max(step.MaxAttempts, 1)
+
+	// Remember the state of the workspace before the step, so we can restore
+	// it before retrying.
+	var preStepDiff []byte
+	if maxAttempts > 1 {
+		if preStepDiff, err = ws.Diff(ctx); err != nil {
+			return bytes.Buffer{}, bytes.Buffer{}, errors.Wrap(err, "getting diff before step")
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		stdout, stderr, err = executeSingleStep(ctx, opts, ws, stepIdx, step, imageDigest, stepContext)
+		if err == nil {
+			if attempt > 1 {
+				opts.Logger.Logf("[Step %d] attempt %d of %d succeeded", stepIdx+1, attempt, maxAttempts)
+			}
+			return stdout, stderr, nil
+		}
+		if attempt >= maxAttempts || ctx.Err() != nil {
+			return stdout, stderr, err
+		}
+
+		retryIn := stepRetryBackoff(attempt)
+		opts.Logger.Logf("[Step %d] attempt %d of %d failed, retrying in %s: %+v", stepIdx+1, attempt, maxAttempts, retryIn, err)
+		opts.UI.StepAttemptFailed(stepIdx+1, attempt, maxAttempts, err, stepExitCode(err), retryIn)
+
+		if err := resetWorkspace(ctx, ws, preStepDiff); err != nil {
+			return stdout, stderr, errors.Wrap(err, "restoring workspace for next attempt")
+		}
+
+		timer := time.NewTimer(retryIn)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return stdout, stderr, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// resetWorkspace restores the workspace to the state described by diff.
+func resetWorkspace(ctx context.Context, ws workspace.Workspace, diff []byte) error {
+	if err := ws.Reset(ctx); err != nil {
+		return err
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+	return ws.ApplyDiff(ctx, diff)
+}
+
+// stepExitCode returns the exit code of the step container that caused err,
+// or -1 if err wasn't caused by a container.
+func stepExitCode(err error) int {
+	sfe := &stepFailedErr{}
+	if errors.As(err, sfe) {
+		return sfe.ExitCode
+	}
+	return -1
+}
@@ -10,6 +10,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +21,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/lib/batches/template"
 	"github.com/sourcegraph/sourcegraph/lib/errors"
 
+	"github.com/sourcegraph/src-cli/internal/batches/docker"
 	"github.com/sourcegraph/src-cli/internal/batches/log"
 	"github.com/sourcegraph/src-cli/internal/batches/repozip"
 	"github.com/sourcegraph/src-cli/internal/batches/util"
@@ -33,9 +36,14 @@ type RunStepsOpts struct {
 	// WC is the workspace creator to use. It will be called at the beginning of
 	// runSteps to prepare the workspace for execution.
 	WC workspace.Creator
+	// Runtime is the container runtime the step containers are run with.
+	Runtime docker.ContainerRuntime
 	// EnsureImage is called in runSteps to make sure the used image has been
 	// pulled from the registry.
 	EnsureImage imageEnsurer
+	// BuildImage is called in runSteps to build the images of buildImage
+	// steps.
+	BuildImage imageBuilder
 	// Task is the definition of the workspace execution.
 	Task *Task
 	// TempDir points to where temporary files of the execution should live at.
@@ -55,12 +63,31 @@ type RunStepsOpts struct {
 	// ForceRoot forces Docker containers to be run as root:root, rather than
 	// whatever the image's default user and group are.
 	ForceRoot bool
+	// Host runs the step scripts directly on the host instead of in
+	// containers. See runStepOnHost.
+	Host bool
 
 	BinaryDiffs bool
+
+	// AgentRunners maps codingAgent step types to the runner that executes
+	// them.
+	AgentRunners map[string]AgentRunner
+	// StepCaches stores the caches declared by steps. Steps with caches fail
+	// if it's nil.
+	StepCaches *StepCaches
+	// ArtifactsDir is the directory the artifacts collected by steps are
+	// written to. If it's empty, artifacts are only recorded in the step
+	// results.
+	ArtifactsDir string
+	// ArtifactStore stores the contents of the artifacts collected by steps,
+	// so that they can be restored when the steps are cached. If it's nil,
+	// they aren't stored.
+	ArtifactStore *ArtifactStore
 }
 
 func RunSteps(ctx context.Context, opts *RunStepsOpts) (stepResults []execution.AfterStepResult, err error) {
-	// Set up our timeout.
+	// Set up our timeout. Steps with their own timeout are limited by it in
+	// addition, in executeSingleStep.
 	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
 	defer cancel()
 
@@ -73,13 +100,16 @@ func RunSteps(ctx context.Context, opts *RunStepsOpts) (stepResults []execution.
 		}
 	}()
 
-	opts.UI.ArchiveDownloadStarted()
-	err = opts.RepoArchive.Ensure(ctx)
-	opts.UI.ArchiveDownloadFinished(err)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching repo")
+	// Workspaces created from local mirrors don't need the archive.
+	if mc, ok := opts.WC.(workspace.MirrorCreator); !ok || !mc.HasMirror(ctx, opts.Task.Repository) {
+		opts.UI.ArchiveDownloadStarted()
+		err = opts.RepoArchive.Ensure(ctx)
+		opts.UI.ArchiveDownloadFinished(err)
+		if err != nil {
+			return nil, errors.Wrap(err, "fetching repo")
+		}
+		defer opts.RepoArchive.Close()
 	}
-	defer opts.RepoArchive.Close()
 
 	opts.UI.WorkspaceInitializationStarted()
 	ws, err := opts.WC.Create(ctx, opts.Task.Repository, opts.Task.Steps, opts.RepoArchive)
@@ -121,6 +151,12 @@ func RunSteps(ctx context.Context, opts *RunStepsOpts) (stepResults []execution.
 			return stepResults, nil
 		}
 
+		// Restore the artifacts of the cached steps, since they aren't
+		// executed again.
+		if err := restoreArtifacts(opts.ArtifactsDir, opts.ArtifactStore, opts.Task, opts.Task.CachedStepResult.Artifacts); err != nil {
+			return nil, err
+		}
+
 		// If the previous steps made any modifications to the workspace yet,
 		// apply them.
 		if len(opts.Task.CachedStepResult.Diff) > 0 {
@@ -153,6 +189,7 @@ func RunSteps(ctx context.Context, opts *RunStepsOpts) (stepResults []execution.
 				Changes: previousStepResult.ChangedFiles,
 			},
 			PreviousStep: previousStepResult,
+			Event:        opts.Task.Event,
 		}
 
 		// Check if the step needs to be skipped.
@@ -171,31 +208,51 @@ func RunSteps(ctx context.Context, opts *RunStepsOpts) (stepResults []execution.
 		}
 		step.Container = resolvedContainer
 
-		// We need to grab the digest for the exact image we're using.
-		img, err := opts.EnsureImage(ctx, step.Container)
-		if err != nil {
-			return nil, errors.Wrapf(err, "failed to pull image for step %d: %s", i+1, step.Container)
-		}
-		digest, err := img.Digest(ctx)
-		if err != nil {
-			return nil, err
-		}
+		var (
+			stdoutBuffer, stderrBuffer bytes.Buffer
+			// builtImage is the name of the image created by a buildImage
+			// step.
+			builtImage string
+		)
+		if step.BuildImage != nil {
+			stdoutBuffer, stderrBuffer, builtImage, err = executeBuildImageStep(ctx, opts, i, step, &stepContext)
+		} else {
+			// We need to grab the digest for the exact image we're using. Coding
+			// agent steps may run without an image, depending on their runner.
+			var digest string
+			if step.CodingAgent == nil || step.Container != "" {
+				img, err := opts.EnsureImage(ctx, step.Container)
+				if err != nil {
+					return nil, errors.Wrapf(err, "failed to pull image for step %d: %s", i+1, step.Container)
+				}
+				digest, err = img.Digest(ctx)
+				if err != nil {
+					return nil, err
+				}
+			}
 
-		stdoutBuffer, stderrBuffer, err := executeSingleStep(ctx, opts, ws, i, step, digest, &stepContext)
+			stdoutBuffer, stderrBuffer, err = executeStepWithRetries(ctx, opts, ws, i, step, digest, &stepContext)
+		}
 		defer func() {
 			if err != nil {
-				exitCode := -1
-				sfe := &stepFailedErr{}
-				if errors.As(err, sfe) {
-					exitCode = sfe.ExitCode
-				}
-				opts.UI.StepFailed(i+1, err, exitCode)
+				opts.UI.StepFailed(i+1, err, stepExitCode(err))
 			}
 		}()
 		if err != nil {
 			return stepResults, err
 		}
 
+		// Artifacts are collected before the diff is computed, so that they
+		// aren't part of it.
+		artifacts := previousStepResult.Artifacts
+		if len(step.Artifacts) > 0 {
+			collected, err := collectArtifacts(ctx, opts, ws, i, step)
+			if err != nil {
+				return stepResults, errors.Wrap(err, "collecting artifacts")
+			}
+			artifacts = append(slices.Clip(artifacts), collected...)
+		}
+
 		// Get the current diff and store that away as the per-step result.
 		stepDiff, err := ws.Diff(ctx)
 		if err != nil {
@@ -219,10 +276,16 @@ func RunSteps(ctx context.Context, opts *RunStepsOpts) (stepResults []execution.
 			Stderr:       stderrBuffer.String(),
 			StepIndex:    i,
 			Diff:         stepDiff,
+			Artifacts:    artifacts,
 			// Those will be set below.
 			Outputs: make(map[string]any),
 		}
 
+		// Later steps can reference the built image via outputs.
+		if builtImage != "" {
+			lastOutputs[builtImageOutput] = builtImage
+		}
+
 		// Set stepContext.Step to current step's results before rendering outputs.
 		stepContext.Step = stepResult
 		// Render and evaluate outputs.
@@ -284,35 +347,35 @@ func executeSingleStep(
 	// ----------
 	opts.UI.StepPreparingStart(stepIdx + 1)
 
-	cidFile, cleanup, err := createCidFile(ctx, opts.TempDir, util.SlugForRepo(opts.Task.Repository.Name, opts.Task.Repository.Rev()))
+	// Limit the step to its timeout, if it has one. The deadline of the whole
+	// execution still applies.
+	timeout, err := step.TimeoutDuration()
 	if err != nil {
+		err = errors.Wrap(err, "parsing step timeout")
 		opts.UI.StepPreparingFailed(stepIdx+1, err)
 		return bytes.Buffer{}, bytes.Buffer{}, err
 	}
-	defer cleanup()
-
-	// For now, we only support shell scripts provided via the Run field.
-	shell, containerTemp, err := probeImageForShell(ctx, imageDigest)
-	if err != nil {
-		err = errors.Wrapf(err, "probing image %q for shell", step.Container)
-		opts.UI.StepPreparingFailed(stepIdx+1, err)
-		return bytes.Buffer{}, bytes.Buffer{}, err
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, &stepTimeoutReached{timeout: timeout})
+		defer cancel()
 	}
 
-	runScriptFile, runScript, cleanup, err := createRunScriptFile(ctx, opts.TempDir, step.Run, stepContext)
+	// Parse and render the step.Files.
+	filesToMount, cleanup, err := createFilesToMount(opts.TempDir, step, stepContext)
 	if err != nil {
 		opts.UI.StepPreparingFailed(stepIdx+1, err)
 		return bytes.Buffer{}, bytes.Buffer{}, err
 	}
 	defer cleanup()
 
-	// Parse and render the step.Files.
-	filesToMount, cleanup, err := createFilesToMount(opts.TempDir, step, stepContext)
+	// Lock the caches of the step for the duration of the step.
+	cacheMounts, releaseCaches, err := opts.StepCaches.acquire(step)
 	if err != nil {
 		opts.UI.StepPreparingFailed(stepIdx+1, err)
 		return bytes.Buffer{}, bytes.Buffer{}, err
 	}
-	defer cleanup()
+	defer releaseCaches()
 
 	// Resolve step.Env given the current environment.
 	stepEnv, err := step.Env.Resolve(opts.GlobalEnv)
@@ -330,6 +393,35 @@ func executeSingleStep(
 		return bytes.Buffer{}, bytes.Buffer{}, err
 	}
 
+	if step.CodingAgent != nil {
+		return executeAgentStep(ctx, opts, workspace, stepIdx, step, imageDigest, stepContext, filesToMount, cacheMounts, env)
+	}
+
+	// For now, we only support shell scripts provided via the Run field.
+	var shell, containerTemp string
+	if opts.Host {
+		shell, err = hostShell()
+	} else {
+		shell, containerTemp, err = probeImageForShell(ctx, opts.Runtime, imageDigest)
+		err = errors.Wrapf(err, "probing image %q for shell", step.Container)
+	}
+	if err != nil {
+		opts.UI.StepPreparingFailed(stepIdx+1, err)
+		return bytes.Buffer{}, bytes.Buffer{}, err
+	}
+
+	runScriptFile, runScript, cleanup, err := createRunScriptFile(ctx, opts.TempDir, step.Run, stepContext)
+	if err != nil {
+		opts.UI.StepPreparingFailed(stepIdx+1, err)
+		return bytes.Buffer{}, bytes.Buffer{}, err
+	}
+	defer cleanup()
+	if opts.Host {
+		// There's no container to mount the script into, so it's run from
+		// where it is.
+		containerTemp = runScriptFile
+	}
+
 	opts.UI.StepPreparingSuccess(stepIdx + 1)
 
 	// ----------
@@ -337,9 +429,83 @@ func executeSingleStep(
 	// ----------
 	opts.UI.StepStarted(stepIdx+1, runScript, env)
 
+	writerCtx, writerCancel := context.WithCancel(ctx)
+	defer writerCancel()
+	outputWriter := opts.UI.StepOutputWriter(writerCtx, opts.Task, stepIdx+1)
+	defer func() {
+		outputWriter.Close()
+	}()
+
+	opts.Logger.Logf("[Step %d] run: %q, container: %q", stepIdx+1, step.Run, step.Container)
+
+	run := runStepContainer
+	if opts.Host {
+		run = runStepOnHost
+	}
+	err = run(ctx, opts, workspace, stepIdx, step, &containerRun{
+		imageDigest:   imageDigest,
+		shell:         shell,
+		containerTemp: containerTemp,
+		runScriptFile: runScriptFile,
+		runScript:     runScript,
+		filesToMount:  filesToMount,
+		cacheMounts:   cacheMounts,
+		env:           env,
+		stdout:        &stdout,
+		stderr:        &stderr,
+		stdoutWriter:  io.MultiWriter(&stdout, outputWriter.StdoutWriter(), opts.Logger.PrefixWriter("stdout")),
+		stderrWriter:  io.MultiWriter(&stderr, outputWriter.StderrWriter(), opts.Logger.PrefixWriter("stderr")),
+	})
+	return stdout, stderr, err
+}
+
+// containerRun describes a single `docker run` invocation that executes a
+// script in the container of a step.
+type containerRun struct {
+	imageDigest string
+
+	// shell and containerTemp are the results of probeImageForShell.
+	shell         string
+	containerTemp string
+
+	// runScriptFile is the host file containing runScript. It is mounted to
+	// containerTemp and executed by shell.
+	runScriptFile string
+	runScript     string
+
+	// cidFile is the file the container runtime writes the ID of the
+	// container to. It's empty for steps run on the host.
+	cidFile string
+
+	filesToMount map[string]*os.File
+	// extraMounts maps host paths to read-only mount targets in the
+	// container, in addition to the mounts declared in the step.
+	extraMounts map[string]string
+	// cacheMounts maps the directories of the step caches to their writable
+	// mount targets in the container.
+	cacheMounts map[string]string
+	env         map[string]string
+
+	// stdout and stderr are used to build the stepFailedErr. They need to be
+	// written to by stdoutWriter and stderrWriter.
+	stdout       *bytes.Buffer
+	stderr       *bytes.Buffer
+	stdoutWriter io.Writer
+	stderrWriter io.Writer
+}
+
+// runStepContainer runs the given containerRun with the workspace mounted to
+// workDir. If the container fails, a stepFailedErr is returned.
+func runStepContainer(ctx context.Context, opts *RunStepsOpts, workspace workspace.Workspace, stepIdx int, step batcheslib.Step, run *containerRun) error {
+	cidFile, cleanup, err := createCidFile(ctx, opts.Runtime, opts.TempDir, util.SlugForRepo(opts.Task.Repository.Name, opts.Task.Repository.Rev()))
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
 	workspaceOpts, err := workspace.DockerRunOpts(ctx, workDir)
 	if err != nil {
-		return bytes.Buffer{}, bytes.Buffer{}, errors.Wrap(err, "getting Docker options for workspace")
+		return errors.Wrap(err, "getting Docker options for workspace")
 	}
 
 	// Where should we execute the steps.run script?
@@ -348,20 +514,28 @@ func executeSingleStep(
 		scriptWorkDir = workDir + "/" + opts.Task.Path
 	}
 
-	args := append([]string{
-		"run",
-		"--rm",
+	run.cidFile = cidFile
+	args := []string{
 		"--init",
 		"--cidfile", cidFile,
 		"--workdir", scriptWorkDir,
-		"--mount", fmt.Sprintf("type=bind,source=%s,target=%s,ro", runScriptFile, containerTemp),
-	}, workspaceOpts...)
+		"--mount", fmt.Sprintf("type=bind,source=%s,target=%s,ro", run.runScriptFile, run.containerTemp),
+	}
+	// Containers of steps with a memory limit are kept after they exit, so
+	// that we can find out whether they were killed by the OOM killer. They're
+	// removed by the cleanup of the cidfile.
+	if step.Memory == "" {
+		args = append([]string{"--rm"}, args...)
+	}
+	args = append(args, workspaceOpts...)
 
 	if opts.ForceRoot {
 		args = append(args, "--user", "0:0")
 	}
 
-	for target, source := range filesToMount {
+	args = append(args, stepLimitArgs(step)...)
+
+	for target, source := range run.filesToMount {
 		args = append(args, "--mount", fmt.Sprintf("type=bind,source=%s,target=%s,ro", source.Name(), target))
 	}
 
@@ -369,37 +543,46 @@ func executeSingleStep(
 	for _, mount := range step.Mount {
 		workspaceFilePath, err := getAbsoluteMountPath(opts.WorkingDirectory, mount.Path)
 		if err != nil {
-			return bytes.Buffer{}, bytes.Buffer{}, err
+			return err
 		}
 		args = append(args, "--mount", fmt.Sprintf("type=bind,source=%s,target=%s,ro", workspaceFilePath, mount.Mountpoint))
 	}
 
-	for k, v := range env {
+	for source, target := range run.extraMounts {
+		args = append(args, "--mount", fmt.Sprintf("type=bind,source=%s,target=%s,ro", source, target))
+	}
+
+	for source, target := range run.cacheMounts {
+		args = append(args, "--mount", fmt.Sprintf("type=bind,source=%s,target=%s", source, target))
+	}
+
+	for k, v := range run.env {
 		args = append(args, "-e", k+"="+v)
 	}
 
-	args = append(args, "--entrypoint", shell)
+	args = append(args, "--entrypoint", run.shell)
+
+	args = append(args, "--", run.imageDigest, run.containerTemp)
 
-	cmd := exec.CommandContext(ctx, "docker", args...)
-	cmd.Args = append(cmd.Args, "--", imageDigest, containerTemp)
+	cmd, err := opts.Runtime.Run(ctx, args...)
+	if err != nil {
+		return err
+	}
 	if dir := workspace.WorkDir(); dir != nil {
 		cmd.Dir = *dir
 	}
 
-	writerCtx, writerCancel := context.WithCancel(ctx)
-	defer writerCancel()
-	outputWriter := opts.UI.StepOutputWriter(writerCtx, opts.Task, stepIdx+1)
-	defer func() {
-		outputWriter.Close()
-	}()
-
-	stdoutWriter := io.MultiWriter(&stdout, outputWriter.StdoutWriter(), opts.Logger.PrefixWriter("stdout"))
-	stderrWriter := io.MultiWriter(&stderr, outputWriter.StderrWriter(), opts.Logger.PrefixWriter("stderr"))
+	return runStepCommand(ctx, opts, stepIdx, step, cmd, run)
+}
 
+// runStepCommand starts cmd, which executes the script of the given
+// containerRun, and waits for it to finish. If the command fails, a
+// stepFailedErr is returned.
+func runStepCommand(ctx context.Context, opts *RunStepsOpts, stepIdx int, step batcheslib.Step, cmd *exec.Cmd, run *containerRun) error {
 	// Setup readers that pipe the output into the given buffers
-	wg, err := process.PipeOutput(ctx, cmd, stdoutWriter, stderrWriter)
+	wg, err := process.PipeOutput(ctx, cmd, run.stdoutWriter, run.stderrWriter)
 	if err != nil {
-		return stdout, stderr, errors.Wrap(err, "piping process output")
+		return errors.Wrap(err, "piping process output")
 	}
 
 	newStepFailedErr := func(wrappedErr error) stepFailedErr {
@@ -408,26 +591,33 @@ func executeSingleStep(
 		if errors.As(wrappedErr, &exitErr) {
 			exitCode = exitErr.ExitCode()
 		}
-		return stepFailedErr{
+		sfe := stepFailedErr{
 			Err:         wrappedErr,
 			ExitCode:    exitCode,
 			Args:        cmd.Args,
-			Run:         runScript,
+			Run:         run.runScript,
 			Container:   step.Container,
-			TmpFilename: containerTemp,
-			Stdout:      strings.TrimSpace(stdout.String()),
-			Stderr:      strings.TrimSpace(stderr.String()),
+			TmpFilename: run.containerTemp,
+			Stdout:      strings.TrimSpace(run.stdout.String()),
+			Stderr:      strings.TrimSpace(run.stderr.String()),
+		}
+
+		var timeoutErr *stepTimeoutReached
+		if errors.As(context.Cause(ctx), &timeoutErr) {
+			sfe.Timeout = timeoutErr.timeout
+		} else if step.Memory != "" && exitCode == oomKilledExitCode && containerOOMKilled(ctx, opts.Runtime, run.cidFile) {
+			sfe.MemoryLimit = step.Memory
 		}
+		return sfe
 	}
 
-	opts.Logger.Logf("[Step %d] run: %q, container: %q", stepIdx+1, step.Run, step.Container)
 	opts.Logger.Logf("[Step %d] full command: %q", stepIdx+1, strings.Join(cmd.Args, " "))
 
 	// Start the command.
 	t0 := time.Now()
 	if err := cmd.Start(); err != nil {
-		opts.Logger.Logf("[Step %d] error starting Docker container: %+v", stepIdx+1, err)
-		return stdout, stderr, newStepFailedErr(err)
+		opts.Logger.Logf("[Step %d] error starting step command: %+v", stepIdx+1, err)
+		return newStepFailedErr(err)
 	}
 
 	// Wait for the readers, because the pipes used by PipeOutput under the
@@ -438,12 +628,12 @@ func executeSingleStep(
 	err = cmd.Wait()
 	elapsed := time.Since(t0).Round(time.Millisecond)
 	if err != nil {
-		opts.Logger.Logf("[Step %d] took %s; error running Docker container: %+v", stepIdx+1, elapsed, err)
-		return stdout, stderr, newStepFailedErr(err)
+		opts.Logger.Logf("[Step %d] took %s; error running step command: %+v", stepIdx+1, elapsed, err)
+		return newStepFailedErr(err)
 	}
 
 	opts.Logger.Logf("[Step %d] complete in %s", stepIdx+1, elapsed)
-	return stdout, stderr, nil
+	return nil
 }
 
 func setOutputs(stepOutputs batcheslib.Outputs, global map[string]any, stepCtx *template.StepContext) error {
@@ -479,7 +669,7 @@ func setOutputs(stepOutputs batcheslib.Outputs, global map[string]any, stepCtx *
 	return nil
 }
 
-func probeImageForShell(ctx context.Context, image string) (shell, tempfile string, err error) {
+func probeImageForShell(ctx context.Context, rt docker.ContainerRuntime, image string) (shell, tempfile string, err error) {
 	// We need to know two things to be able to run a shell script:
 	//
 	// 1. Which shell is available. We're going to look for /bin/bash and then
@@ -499,9 +689,12 @@ func probeImageForShell(ctx context.Context, image string) (shell, tempfile stri
 		stdout := new(bytes.Buffer)
 		stderr := new(bytes.Buffer)
 
-		args := []string{"run", "--rm", "--entrypoint", shell, image, "-c", "mktemp"}
-
-		cmd := exec.CommandContext(ctx, "docker", args...)
+		cmd, runErr := rt.Run(ctx, "--rm", "--entrypoint", shell, image, "-c", "mktemp")
+		if runErr != nil {
+			// The runtime can't run containers at all, so there's no point in
+			// trying the other shells.
+			return "", "", runErr
+		}
 		cmd.Stdout = stdout
 		cmd.Stderr = stderr
 
@@ -529,6 +722,12 @@ func createFilesToMount(tempDir string, step batcheslib.Step, stepContext *templ
 		return nil, nil, errors.Wrap(err, "parsing step files")
 	}
 
+	return writeFilesToMount(tempDir, files)
+}
+
+// writeFilesToMount writes the given files, keyed by their target path in the
+// container, into temporary files on the host so they can be mounted.
+func writeFilesToMount(tempDir string, files map[string]string) (map[string]*os.File, func(), error) {
 	var toCleanup []string
 	cleanup := func() {
 		for _, fname := range toCleanup {
@@ -574,24 +773,41 @@ func createFilesToMount(tempDir string, step batcheslib.Step, stepContext *templ
 //
 // It returns the location of the file, its content, a function to cleanup the file and possible errors.
 func createRunScriptFile(ctx context.Context, tempDir string, stepRun string, stepCtx *template.StepContext) (string, string, func(), error) {
+	// Parse step.Run as a template and render it into a buffer.
+	var runScript bytes.Buffer
+	if err := template.RenderStepTemplate("step-run", stepRun, &runScript, stepCtx); err != nil {
+		return "", "", nil, errors.Wrap(err, "parsing step run")
+	}
+
+	runScriptFile, cleanup, err := writeRunScriptFile(tempDir, runScript.String())
+	if err != nil {
+		return "", "", nil, err
+	}
+	return runScriptFile, runScript.String(), cleanup, nil
+}
+
+// writeRunScriptFile writes runScript into a temporary file that is readable
+// from within the container.
+//
+// It returns the location of the file and a function to cleanup the file.
+func writeRunScriptFile(tempDir string, runScript string) (string, func(), error) {
 	// Set up a temporary file on the host filesystem to contain the
 	// script.
 	runScriptFile, err := os.CreateTemp(tempDir, "")
 	if err != nil {
-		return "", "", nil, errors.Wrap(err, "creating temporary file")
+		return "", nil, errors.Wrap(err, "creating temporary file")
 	}
 	cleanup := func() { os.Remove(runScriptFile.Name()) }
 
-	// Parse step.Run as a template and render it into a buffer and the
-	// temp file we just created.
-	var runScript bytes.Buffer
-	out := io.MultiWriter(&runScript, runScriptFile)
-	if err := template.RenderStepTemplate("step-run", stepRun, out, stepCtx); err != nil {
-		return "", "", nil, errors.Wrap(err, "parsing step run")
+	if _, err := runScriptFile.WriteString(runScript); err != nil {
+		runScriptFile.Close()
+		cleanup()
+		return "", nil, errors.Wrap(err, "writing temporary file")
 	}
 
 	if err := runScriptFile.Close(); err != nil {
-		return "", "", nil, errors.Wrap(err, "closing temporary file")
+		cleanup()
+		return "", nil, errors.Wrap(err, "closing temporary file")
 	}
 
 	// This file needs to be readable within the container regardless of the
@@ -604,17 +820,18 @@ func createRunScriptFile(ctx context.Context, tempDir string, stepRun string, st
 	// conditionally compiled files here, instead we'll just wait until the
 	// file is closed to twiddle the permission bits. Which is now!
 	if err := os.Chmod(runScriptFile.Name(), 0644); err != nil {
-		return "", "", nil, errors.Wrap(err, "setting permissions on the temporary file")
+		cleanup()
+		return "", nil, errors.Wrap(err, "setting permissions on the temporary file")
 	}
 
-	return runScriptFile.Name(), runScript.String(), cleanup, nil
+	return runScriptFile.Name(), cleanup, nil
 }
 
 // createCidFile creates a temporary file that will contain the container ID
 // when executing steps.
 // It returns the location of the file and a function that cleans up the
 // file.
-func createCidFile(ctx context.Context, tempDir string, repoSlug string) (string, func(), error) {
+func createCidFile(ctx context.Context, rt docker.ContainerRuntime, tempDir string, repoSlug string) (string, func(), error) {
 	// Find a location that we can use for a cidfile, which will contain the
 	// container ID that is used below. We can then use this to remove the
 	// container on a successful run, rather than leaving it dangling.
@@ -637,9 +854,11 @@ func createCidFile(ctx context.Context, tempDir string, repoSlug string) (string
 		cid, err := os.ReadFile(cidFile.Name())
 		_ = os.Remove(cidFile.Name())
 		if err == nil {
-			ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+			// The context may already be done if the step timed out, but the
+			// container still needs to be removed.
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
 			defer cancel()
-			_ = exec.CommandContext(ctx, "docker", "rm", "-f", "--", string(cid)).Run()
+			_ = rt.RemoveContainer(ctx, string(cid))
 		}
 	}
 
@@ -694,6 +913,13 @@ type stepFailedErr struct {
 	// ExitCode of the command, or -1 if a non-command error occured.
 	ExitCode int
 	Err      error
+
+	// Timeout is set to the timeout of the step if the step was stopped
+	// because it exceeded it.
+	Timeout time.Duration
+	// MemoryLimit is set to the memory limit of the step if the container was
+	// killed because it exceeded it.
+	MemoryLimit string
 }
 
 func (e stepFailedErr) Cause() error { return e.Err }
@@ -730,9 +956,14 @@ func (e stepFailedErr) Error() string {
 		printOutput(e.Stderr)
 	}
 
-	if e.ExitCode != -1 {
+	switch {
+	case e.Timeout > 0:
+		fmt.Fprintf(&out, "\nStep timed out after %s.", e.Timeout)
+	case e.MemoryLimit != "":
+		fmt.Fprintf(&out, "\nStep was killed because it exceeded its memory limit of %s (exit code %d).", e.MemoryLimit, e.ExitCode)
+	case e.ExitCode != -1:
 		fmt.Fprintf(&out, "\nCommand failed with exit code %d.", e.ExitCode)
-	} else {
+	default:
 		fmt.Fprintf(&out, "\nCommand failed: %s", e.Err)
 	}
 
@@ -740,6 +971,13 @@ func (e stepFailedErr) Error() string {
 }
 
 func (e stepFailedErr) SingleLineError() string {
+	switch {
+	case e.Timeout > 0:
+		return fmt.Sprintf("step timed out after %s", e.Timeout)
+	case e.MemoryLimit != "":
+		return fmt.Sprintf("step exceeded its memory limit of %s", e.MemoryLimit)
+	}
+
 	out := e.Err.Error()
 	if len(e.Stderr) > 0 {
 		out = e.Stderr
@@ -748,6 +986,51 @@ func (e stepFailedErr) SingleLineError() string {
 	return strings.Split(out, "\n")[0]
 }
 
+// oomKilledExitCode is the exit code of containers that were killed with
+// SIGKILL, which is what the OOM killer sends.
+const oomKilledExitCode = 128 + 9
+
+// containerOOMKilled returns whether the container whose ID was written to
+// cidFile was killed by the OOM killer. Containers that were killed for
+// another reason exit with the same exit code.
+func containerOOMKilled(ctx context.Context, rt docker.ContainerRuntime, cidFile string) bool {
+	if cidFile == "" {
+		return false
+	}
+	cid, err := os.ReadFile(cidFile)
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+	defer cancel()
+	killed, err := rt.ContainerOOMKilled(ctx, strings.TrimSpace(string(cid)))
+	return err == nil && killed
+}
+
+// stepTimeoutReached is the cause of the cancellation of the context of a step
+// that exceeded its timeout.
+type stepTimeoutReached struct{ timeout time.Duration }
+
+func (e *stepTimeoutReached) Error() string {
+	return fmt.Sprintf("step timed out after %s", e.timeout)
+}
+
+// stepLimitArgs returns the `docker run` arguments that apply the resource
+// limits and network policy of the step.
+func stepLimitArgs(step batcheslib.Step) []string {
+	var args []string
+	if step.CPUs > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(step.CPUs, 'f', -1, 64))
+	}
+	if step.Memory != "" {
+		args = append(args, "--memory", step.Memory)
+	}
+	if step.Network == batcheslib.StepNetworkNone {
+		args = append(args, "--network", "none")
+	}
+	return args
+}
+
 type errTimeoutReached struct{ timeout time.Duration }
 
 func (e *errTimeoutReached) Error() string {
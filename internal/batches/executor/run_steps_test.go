@@ -1,12 +1,31 @@
 package executor
 
 import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/batches/env"
+	"github.com/sourcegraph/sourcegraph/lib/batches/execution"
 	"github.com/sourcegraph/sourcegraph/lib/batches/template"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/src-cli/internal/batches/docker"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+	"github.com/sourcegraph/src-cli/internal/batches/log"
+	"github.com/sourcegraph/src-cli/internal/batches/mock"
+	"github.com/sourcegraph/src-cli/internal/batches/repozip"
+	"github.com/sourcegraph/src-cli/internal/batches/workspace"
 )
 
 func TestCreateFilesToMount_RejectsCommaInTargetPath(t *testing.T) {
@@ -44,3 +63,411 @@ func TestRenderStepContainer(t *testing.T) {
 		require.Error(t, err)
 	})
 }
+
+func TestRunSteps_FakeRuntime(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test doesn't work on Windows because the fake runtime runs bash")
+	}
+
+	ctx := context.Background()
+	repoDir := createTestRepo(t)
+
+	tempDir := t.TempDir()
+	rt := &mock.ContainerRuntime{}
+	images := map[string]docker.Image{"alpine:3": &mock.Image{RawDigest: "sha256:alpine"}}
+	wc, _ := workspace.NewCreator(ctx, rt, "bind", tempDir, tempDir, images)
+
+	task := &Task{
+		Repository: &graphql.Repository{
+			Name:   "github.com/sourcegraph/src-cli",
+			Branch: graphql.Branch{Name: "main", Target: graphql.Target{OID: "HEAD"}},
+		},
+		Steps: []batcheslib.Step{
+			{Container: "alpine:3", Run: `echo "hello ${{ repository.name }}" >> README.md`},
+		},
+		BatchChangeAttributes: &template.BatchChangeAttributes{},
+	}
+
+	results, err := RunSteps(ctx, &RunStepsOpts{
+		WC:          wc,
+		Runtime:     rt,
+		EnsureImage: imageMapEnsurer(images),
+		Task:        task,
+		TempDir:     tempDir,
+		Timeout:     time.Minute,
+		RepoArchive: repozip.NewLocalArchive(repoDir, "HEAD", tempDir),
+		Logger:      &log.NoopTaskLogger{},
+		UI:          NoopStepsExecUI{},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Contains(t, string(results[0].Diff), "+hello github.com/sourcegraph/src-cli")
+}
+
+func TestRunSteps_Host(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test doesn't work on Windows because the steps are run with bash")
+	}
+
+	ctx := context.Background()
+	repoDir := createTestRepo(t)
+
+	specDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(specDir, "sample.sh"), []byte("echo mounted >> README.md\n"), 0600))
+
+	var stepEnv env.Environment
+	require.NoError(t, json.Unmarshal([]byte(`{"STEP_VAR": "from the step"}`), &stepEnv))
+
+	newTask := func(container string) *Task {
+		return &Task{
+			Repository: &graphql.Repository{
+				Name:   "github.com/sourcegraph/src-cli",
+				Branch: graphql.Branch{Name: "main", Target: graphql.Target{OID: "HEAD"}},
+			},
+			Steps: []batcheslib.Step{
+				{
+					Container: container,
+					Run: `cat "$SRC_STEP_ROOT/tmp/greeting.txt" >> README.md
+bash "$SRC_STEP_ROOT/scripts/sample.sh"
+echo "$NAME" >> README.md
+echo "$STEP_VAR" >> README.md`,
+					Files: map[string]string{"/tmp/greeting.txt": "hello ${{ repository.name }}\n"},
+					Mount: []batcheslib.Mount{{Path: "./sample.sh", Mountpoint: "/scripts/sample.sh"}},
+					Env:   stepEnv,
+				},
+			},
+			BatchChangeAttributes: &template.BatchChangeAttributes{},
+		}
+	}
+
+	run := func(t *testing.T, rt docker.ContainerRuntime, task *Task) ([]execution.AfterStepResult, error) {
+		tempDir := t.TempDir()
+		wc, typ := workspace.NewCreator(ctx, rt, "host", tempDir, tempDir, nil)
+		require.Equal(t, workspace.CreatorTypeHost, typ)
+
+		return RunSteps(ctx, &RunStepsOpts{
+			WC:               wc,
+			Runtime:          rt,
+			EnsureImage:      docker.NewImageCache(rt).Ensure,
+			Task:             task,
+			TempDir:          tempDir,
+			WorkingDirectory: specDir,
+			GlobalEnv:        append(os.Environ(), "NAME=from the environment"),
+			Timeout:          time.Minute,
+			RepoArchive:      repozip.NewLocalArchive(repoDir, "HEAD", tempDir),
+			Logger:           &log.NoopTaskLogger{},
+			UI:               NoopStepsExecUI{},
+			Host:             true,
+		})
+	}
+
+	t.Run("files, mounts and environment", func(t *testing.T) {
+		results, err := run(t, docker.NewHostRuntime(nil), newTask("alpine:3"))
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		diff := string(results[0].Diff)
+		assert.Contains(t, diff, "+hello github.com/sourcegraph/src-cli")
+		assert.Contains(t, diff, "+mounted")
+		assert.Contains(t, diff, "+from the environment")
+		assert.Contains(t, diff, "+from the step")
+	})
+
+	t.Run("disallowed image", func(t *testing.T) {
+		_, err := run(t, docker.NewHostRuntime([]string{"alpine:3"}), newTask("ubuntu:latest"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `image "ubuntu:latest" is not allowed to run on the host`)
+	})
+
+	t.Run("network none", func(t *testing.T) {
+		task := newTask("alpine:3")
+		task.Steps[0].Network = batcheslib.StepNetworkNone
+		_, err := run(t, docker.NewHostRuntime(nil), task)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `can't be enforced when running steps on the host`)
+	})
+}
+
+func TestRunSteps_Artifacts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test doesn't work on Windows because the steps are run with bash")
+	}
+
+	ctx := context.Background()
+	repoDir := createTestRepo(t)
+
+	newTask := func() *Task {
+		return &Task{
+			Repository: &graphql.Repository{
+				Name:   "github.com/sourcegraph/src-cli",
+				Branch: graphql.Branch{Name: "main", Target: graphql.Target{OID: "HEAD"}},
+			},
+			Steps: []batcheslib.Step{
+				{
+					Container: "alpine:3",
+					Run:       "mkdir -p reports && echo '{}' > reports/lint.json && echo changed >> README.md",
+					Artifacts: []string{"reports/*.json"},
+				},
+				{
+					Container: "alpine:3",
+					Run:       "echo again >> README.md",
+				},
+			},
+			BatchChangeAttributes: &template.BatchChangeAttributes{},
+		}
+	}
+
+	run := func(t *testing.T, task *Task, artifactsDir string, store *ArtifactStore) ([]execution.AfterStepResult, error) {
+		tempDir := t.TempDir()
+		rt := docker.NewHostRuntime(nil)
+		wc, _ := workspace.NewCreator(ctx, rt, "host", tempDir, tempDir, nil)
+
+		return RunSteps(ctx, &RunStepsOpts{
+			WC:            wc,
+			Runtime:       rt,
+			EnsureImage:   docker.NewImageCache(rt).Ensure,
+			Task:          task,
+			TempDir:       tempDir,
+			GlobalEnv:     os.Environ(),
+			Timeout:       time.Minute,
+			RepoArchive:   repozip.NewLocalArchive(repoDir, "HEAD", tempDir),
+			Logger:        &log.NoopTaskLogger{},
+			UI:            NoopStepsExecUI{},
+			Host:          true,
+			ArtifactsDir:  artifactsDir,
+			ArtifactStore: store,
+		})
+	}
+
+	// The SHA-256 hash of "{}\n".
+	const sum = "ca3d163bab055381827226140568f3bef7eaac187cebd76878e0b63e9e442356"
+	wantArtifacts := []execution.Artifact{{StepIndex: 0, Path: "reports/lint.json", Size: 3, SHA256: sum}}
+	artifactPath := func(dir string) string {
+		return filepath.Join(dir, "github.com-sourcegraph-src-cli", "_root", "step-1", "reports", "lint.json")
+	}
+
+	t.Run("collected", func(t *testing.T) {
+		artifactsDir := t.TempDir()
+		store := &ArtifactStore{Dir: t.TempDir()}
+		results, err := run(t, newTask(), artifactsDir, store)
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+
+		// The listings of the artifacts are recorded in the results of all
+		// later steps, and their contents in the store.
+		assert.Equal(t, wantArtifacts, results[0].Artifacts)
+		assert.Equal(t, wantArtifacts, results[1].Artifacts)
+		assert.NotContains(t, string(results[1].Diff), "reports/lint.json")
+		assert.Contains(t, string(results[1].Diff), "+changed")
+
+		content, err := os.ReadFile(artifactPath(artifactsDir))
+		require.NoError(t, err)
+		assert.Equal(t, "{}\n", string(content))
+		content, err = os.ReadFile(filepath.Join(store.Dir, sum[:2], sum))
+		require.NoError(t, err)
+		assert.Equal(t, "{}\n", string(content))
+	})
+
+	t.Run("restored from cache", func(t *testing.T) {
+		task := newTask()
+		task.CachedStepResultFound = true
+		task.CachedStepResult = execution.AfterStepResult{StepIndex: 0, Artifacts: wantArtifacts}
+
+		store := &ArtifactStore{Dir: t.TempDir()}
+		require.NoError(t, os.MkdirAll(filepath.Join(store.Dir, sum[:2]), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(store.Dir, sum[:2], sum), []byte("{}\n"), 0o644))
+
+		artifactsDir := t.TempDir()
+		results, err := run(t, task, artifactsDir, store)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, wantArtifacts, results[0].Artifacts)
+
+		content, err := os.ReadFile(artifactPath(artifactsDir))
+		require.NoError(t, err)
+		assert.Equal(t, "{}\n", string(content))
+	})
+}
+
+func TestRunSteps_StepLimits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test doesn't work on Windows because the fake runtime runs bash")
+	}
+
+	ctx := context.Background()
+	repoDir := createTestRepo(t)
+
+	runWith := func(t *testing.T, rt *mock.ContainerRuntime, timeout time.Duration, step batcheslib.Step) (*mock.ContainerRuntime, error) {
+		tempDir := t.TempDir()
+		images := map[string]docker.Image{"alpine:3": &mock.Image{RawDigest: "sha256:alpine"}}
+		wc, _ := workspace.NewCreator(ctx, rt, "bind", tempDir, tempDir, images)
+
+		step.Container = "alpine:3"
+		_, err := RunSteps(ctx, &RunStepsOpts{
+			WC:          wc,
+			Runtime:     rt,
+			EnsureImage: imageMapEnsurer(images),
+			Task: &Task{
+				Repository: &graphql.Repository{
+					Name:   "github.com/sourcegraph/src-cli",
+					Branch: graphql.Branch{Name: "main", Target: graphql.Target{OID: "HEAD"}},
+				},
+				Steps:                 []batcheslib.Step{step},
+				BatchChangeAttributes: &template.BatchChangeAttributes{},
+			},
+			TempDir:     tempDir,
+			Timeout:     timeout,
+			RepoArchive: repozip.NewLocalArchive(repoDir, "HEAD", tempDir),
+			Logger:      &log.NoopTaskLogger{},
+			UI:          NoopStepsExecUI{},
+		})
+		return rt, err
+	}
+	run := func(t *testing.T, step batcheslib.Step) (*mock.ContainerRuntime, error) {
+		return runWith(t, &mock.ContainerRuntime{}, time.Minute, step)
+	}
+
+	t.Run("docker arguments", func(t *testing.T) {
+		rt, err := run(t, batcheslib.Step{Run: "true", CPUs: 1.5, Memory: "512m", Network: batcheslib.StepNetworkNone})
+		require.NoError(t, err)
+
+		// The last container is the step, after the shell probe.
+		require.NotEmpty(t, rt.Ran)
+		args := strings.Join(rt.Ran[len(rt.Ran)-1], " ")
+		assert.Contains(t, args, "--cpus 1.5 --memory 512m --network none")
+	})
+
+	t.Run("default network", func(t *testing.T) {
+		rt, err := run(t, batcheslib.Step{Run: "true", Network: batcheslib.StepNetworkDefault})
+		require.NoError(t, err)
+		for _, args := range rt.Ran {
+			assert.NotContains(t, args, "--network")
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		_, err := run(t, batcheslib.Step{Run: "exec sleep 10", Timeout: "100ms"})
+		require.Error(t, err)
+
+		var sfe stepFailedErr
+		require.True(t, errors.As(err, &sfe), "unexpected error type %T", err)
+		assert.Equal(t, 100*time.Millisecond, sfe.Timeout)
+		assert.Empty(t, sfe.MemoryLimit)
+		assert.Contains(t, err.Error(), "Step timed out after 100ms.")
+		assert.Equal(t, "step timed out after 100ms", sfe.SingleLineError())
+	})
+
+	t.Run("step timeout doesn't extend the execution timeout", func(t *testing.T) {
+		_, err := runWith(t, &mock.ContainerRuntime{}, 100*time.Millisecond, batcheslib.Step{Run: "exec sleep 10", Timeout: "1m"})
+		require.Error(t, err)
+
+		var timeoutErr *errTimeoutReached
+		require.True(t, errors.As(err, &timeoutErr), "unexpected error type %T", err)
+		assert.Equal(t, 100*time.Millisecond, timeoutErr.timeout)
+	})
+
+	t.Run("out of memory", func(t *testing.T) {
+		rt, err := runWith(t, &mock.ContainerRuntime{OOMKilled: true}, time.Minute, batcheslib.Step{Run: "exit 137", Memory: "64m"})
+		require.Error(t, err)
+
+		var sfe stepFailedErr
+		require.True(t, errors.As(err, &sfe), "unexpected error type %T", err)
+		assert.Equal(t, "64m", sfe.MemoryLimit)
+		assert.Zero(t, sfe.Timeout)
+		assert.Contains(t, err.Error(), "exceeded its memory limit of 64m")
+
+		// The container is kept to be inspected.
+		assert.NotContains(t, rt.Ran[len(rt.Ran)-1], "--rm")
+	})
+
+	t.Run("killed with memory limit", func(t *testing.T) {
+		_, err := run(t, batcheslib.Step{Run: "exit 137", Memory: "64m"})
+		require.Error(t, err)
+
+		var sfe stepFailedErr
+		require.True(t, errors.As(err, &sfe), "unexpected error type %T", err)
+		assert.Empty(t, sfe.MemoryLimit)
+		assert.Contains(t, err.Error(), "Command failed with exit code 137.")
+	})
+
+	t.Run("killed without memory limit", func(t *testing.T) {
+		_, err := run(t, batcheslib.Step{Run: "exit 137"})
+		require.Error(t, err)
+
+		var sfe stepFailedErr
+		require.True(t, errors.As(err, &sfe), "unexpected error type %T", err)
+		assert.Empty(t, sfe.MemoryLimit)
+		assert.Contains(t, err.Error(), "Command failed with exit code 137.")
+	})
+}
+
+func TestRunSteps_StepCaches(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test doesn't work on Windows because the fake runtime runs bash")
+	}
+
+	ctx := context.Background()
+	repoDir := createTestRepo(t)
+	tempDir := t.TempDir()
+	rt := &mock.ContainerRuntime{}
+	images := map[string]docker.Image{"alpine:3": &mock.Image{RawDigest: "sha256:alpine"}}
+	wc, _ := workspace.NewCreator(ctx, rt, "bind", tempDir, tempDir, images)
+	caches := &StepCaches{Dir: filepath.Join(t.TempDir(), StepCachesDir)}
+
+	results, err := RunSteps(ctx, &RunStepsOpts{
+		WC:          wc,
+		Runtime:     rt,
+		EnsureImage: imageMapEnsurer(images),
+		Task: &Task{
+			Repository: &graphql.Repository{
+				Name:   "github.com/sourcegraph/src-cli",
+				Branch: graphql.Branch{Name: "main", Target: graphql.Target{OID: "HEAD"}},
+			},
+			Steps: []batcheslib.Step{{
+				Run:       "echo hello > hello.txt",
+				Container: "alpine:3",
+				Caches:    []batcheslib.StepCache{{Name: "go-build", Mountpoint: "/root/.cache/go-build"}},
+			}},
+			BatchChangeAttributes: &template.BatchChangeAttributes{},
+		},
+		TempDir:     tempDir,
+		Timeout:     time.Minute,
+		RepoArchive: repozip.NewLocalArchive(repoDir, "HEAD", tempDir),
+		Logger:      &log.NoopTaskLogger{},
+		UI:          NoopStepsExecUI{},
+		StepCaches:  caches,
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Contains(t, string(results[0].Diff), "hello.txt")
+
+	require.NotEmpty(t, rt.Ran)
+	args := strings.Join(rt.Ran[len(rt.Ran)-1], " ")
+	assert.Contains(t, args, "--mount type=bind,source="+filepath.Join(caches.Dir, "go-build", "0")+",target=/root/.cache/go-build ")
+
+	// The slot is released once the step is done.
+	list, err := caches.List()
+	require.NoError(t, err)
+	assert.Equal(t, []StepCacheInfo{{Name: "go-build", Slots: 1}}, list)
+}
+
+// createTestRepo creates a git repository with a single commit that adds a
+// README.md, to create workspaces from with a local archive.
+func createTestRepo(t *testing.T) string {
+	t.Helper()
+
+	repoDir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"add", "README.md"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "initial"},
+	} {
+		if args[0] == "add" {
+			require.NoError(t, os.WriteFile(filepath.Join(repoDir, "README.md"), []byte("# README\n"), 0600))
+		}
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repoDir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	return repoDir
+}
@@ -0,0 +1,323 @@
+package executor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/src-cli/internal/batches/util"
+)
+
+// StepCachesDir is the directory in the cache directory that StepCaches are
+// stored in by default.
+const StepCachesDir = "step-caches"
+
+// StepCaches stores the caches declared by steps on the host. Every cache is
+// a directory that is mounted into the containers of the steps using it.
+//
+// Steps running concurrently never share a cache directory. Instead, a cache
+// consists of slots, and every step gets the first slot that isn't in use,
+// which is locked until the step is done. New slots are created as needed,
+// so concurrent steps don't have to wait for each other.
+type StepCaches struct {
+	Dir string
+}
+
+// stepCacheLockExt is the extension of the lock file next to a slot of a
+// cache, which contains the util.LockOwner of the process using the slot.
+const stepCacheLockExt = ".lock"
+
+// stepCacheTakeoverExt is appended to the name of a lock file for the file
+// that guards taking over the stale lock, so that only one process can take
+// it over.
+const stepCacheTakeoverExt = ".takeover"
+
+// acquire locks a slot of every cache of the step. It returns the mounts of
+// the slots, mapping their directories to the mountpoints in the container,
+// and a function that unlocks them.
+func (c *StepCaches) acquire(step batcheslib.Step) (mounts map[string]string, release func(), err error) {
+	var unlocks []func()
+	release = func() {
+		for _, unlock := range unlocks {
+			unlock()
+		}
+	}
+
+	mounts = make(map[string]string, len(step.Caches))
+	for _, cache := range step.Caches {
+		if c == nil {
+			release()
+			return nil, nil, errors.Newf("cache %q can't be used: step caches are not supported here", cache.Name)
+		}
+		dir, unlock, err := c.acquireSlot(cache.Name)
+		if err != nil {
+			release()
+			return nil, nil, errors.Wrapf(err, "acquiring cache %q", cache.Name)
+		}
+		unlocks = append(unlocks, unlock)
+		mounts[dir] = cache.Mountpoint
+	}
+	return mounts, release, nil
+}
+
+func (c *StepCaches) acquireSlot(name string) (string, func(), error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", nil, errors.Newf("invalid cache name %q", name)
+	}
+
+	cacheDir := filepath.Join(c.Dir, name)
+	if err := os.MkdirAll(cacheDir, 0777); err != nil {
+		return "", nil, err
+	}
+
+	for slot := 0; ; slot++ {
+		dir := filepath.Join(cacheDir, strconv.Itoa(slot))
+		lock := dir + stepCacheLockExt
+
+		ok, err := tryLockStepCacheSlot(lock)
+		if err != nil {
+			return "", nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			os.Remove(lock)
+			return "", nil, err
+		}
+		// Since the container might not run as the same user, the cache needs
+		// to be writable for everyone.
+		if err := os.Chmod(dir, 0777); err != nil {
+			os.Remove(lock)
+			return "", nil, err
+		}
+		return dir, func() { os.Remove(lock) }, nil
+	}
+}
+
+// tryLockStepCacheSlot creates the lock file of a slot. It returns false if
+// the slot is locked by a running process. Locks of processes that aren't
+// running anymore are taken over.
+func tryLockStepCacheSlot(lock string) (bool, error) {
+	for {
+		err := createStepCacheLock(lock)
+		if err == nil {
+			return true, nil
+		}
+		if !os.IsExist(err) {
+			return false, errors.Wrap(err, "creating cache lock")
+		}
+
+		owner, err := os.ReadFile(lock)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Unlocked in the meantime.
+				continue
+			}
+			return false, errors.Wrap(err, "reading cache lock")
+		}
+		if !util.StaleLock(string(owner)) {
+			return false, nil
+		}
+
+		// Other processes may find the same stale lock at the same time.
+		// Removing it could remove the lock one of them just created
+		// instead, so it's replaced by whoever gets to take it over.
+		taken, changed, err := takeOverStaleLock(lock, owner)
+		if err != nil {
+			return false, errors.Wrap(err, "taking over stale cache lock")
+		}
+		if !changed {
+			return taken, nil
+		}
+	}
+}
+
+// createStepCacheLock creates the lock file, which must not exist yet.
+func createStepCacheLock(lock string) error {
+	f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(util.LockOwner())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(lock)
+		return errors.Wrap(err, "writing cache lock")
+	}
+	return nil
+}
+
+// takeOverStaleLock replaces the lock file, which contained the given stale
+// owner, with a lock of this process. Only the process that creates the
+// takeover file replaces it, and only if it still contains the stale owner.
+// changed is true if the lock was changed in the meantime and needs to be
+// checked again. taken is false if another process is taking it over.
+func takeOverStaleLock(lock string, staleOwner []byte) (taken, changed bool, err error) {
+	guard := lock + stepCacheTakeoverExt
+	if err := createStepCacheLock(guard); err != nil {
+		if os.IsExist(err) {
+			// A process that crashed while taking over the lock leaves the
+			// takeover file behind. The slot isn't used anymore then, since
+			// it can't be told apart from one that's being taken over.
+			return false, false, nil
+		}
+		return false, false, err
+	}
+	defer os.Remove(guard)
+
+	owner, err := os.ReadFile(lock)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, true, nil
+		}
+		return false, false, err
+	}
+	if !bytes.Equal(owner, staleOwner) {
+		return false, true, nil
+	}
+
+	// The owner of the stale lock isn't running anymore, so no other process
+	// changes the lock file while we hold the takeover file, and it's
+	// replaced in one step.
+	tmp, err := os.CreateTemp(filepath.Dir(lock), filepath.Base(lock)+".tmp-*")
+	if err != nil {
+		return false, false, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(util.LockOwner())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, false, err
+	}
+	if err := os.Chmod(tmp.Name(), 0666); err != nil {
+		return false, false, err
+	}
+	if err := os.Rename(tmp.Name(), lock); err != nil {
+		return false, false, err
+	}
+	return true, false, nil
+}
+
+// StepCacheInfo describes a cache in StepCaches.
+type StepCacheInfo struct {
+	Name  string `json:"name"`
+	Slots int    `json:"slots"`
+	Size  int64  `json:"size"`
+	// InUse is true if a slot of the cache is locked by a running process.
+	InUse bool `json:"inUse"`
+}
+
+// List returns the caches.
+func (c *StepCaches) List() ([]StepCacheInfo, error) {
+	names, err := os.ReadDir(c.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "reading step caches directory")
+	}
+
+	var caches []StepCacheInfo
+	for _, name := range names {
+		if !name.IsDir() {
+			continue
+		}
+		info := StepCacheInfo{Name: name.Name()}
+		cacheDir := filepath.Join(c.Dir, name.Name())
+
+		slots, err := os.ReadDir(cacheDir)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading step cache directory")
+		}
+		for _, slot := range slots {
+			if strings.HasSuffix(slot.Name(), stepCacheLockExt) {
+				if owner, err := os.ReadFile(filepath.Join(cacheDir, slot.Name())); err == nil && !util.StaleLock(string(owner)) {
+					info.InUse = true
+				}
+				continue
+			}
+			if !slot.IsDir() {
+				continue
+			}
+			info.Slots++
+			size, err := dirSize(filepath.Join(cacheDir, slot.Name()))
+			if err != nil {
+				return nil, err
+			}
+			info.Size += size
+		}
+		caches = append(caches, info)
+	}
+	return caches, nil
+}
+
+// Remove removes the slots of the cache with the given name that aren't in
+// use. It returns false if slots were kept because they are in use.
+func (c *StepCaches) Remove(name string) (bool, error) {
+	cacheDir := filepath.Join(c.Dir, name)
+	slots, err := os.ReadDir(cacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, errors.Wrap(err, "reading step cache directory")
+	}
+
+	removedAll := true
+	for _, slot := range slots {
+		if !slot.IsDir() {
+			continue
+		}
+		dir := filepath.Join(cacheDir, slot.Name())
+		lock := dir + stepCacheLockExt
+		ok, err := tryLockStepCacheSlot(lock)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			removedAll = false
+			continue
+		}
+		err = os.RemoveAll(dir)
+		os.Remove(lock)
+		if err != nil {
+			return false, errors.Wrap(err, "removing step cache")
+		}
+	}
+
+	if removedAll {
+		// Another process may have started to use the cache in the meantime,
+		// in which case the directory isn't empty.
+		_ = os.Remove(cacheDir)
+	}
+	return removedAll, nil
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, errors.Wrap(err, "determining step cache size")
+}
@@ -0,0 +1,191 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+
+	"github.com/sourcegraph/src-cli/internal/batches/util"
+)
+
+func TestStepCaches_Acquire(t *testing.T) {
+	c := &StepCaches{Dir: t.TempDir()}
+	step := batcheslib.Step{Caches: []batcheslib.StepCache{
+		{Name: "go-build", Mountpoint: "/root/.cache/go-build"},
+		{Name: "npm", Mountpoint: "/root/.npm"},
+	}}
+
+	mounts1, release1, err := c.acquire(step)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		filepath.Join(c.Dir, "go-build", "0"): "/root/.cache/go-build",
+		filepath.Join(c.Dir, "npm", "0"):      "/root/.npm",
+	}, mounts1)
+
+	// Concurrent steps get their own slots.
+	mounts2, release2, err := c.acquire(step)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		filepath.Join(c.Dir, "go-build", "1"): "/root/.cache/go-build",
+		filepath.Join(c.Dir, "npm", "1"):      "/root/.npm",
+	}, mounts2)
+
+	// Released slots are reused.
+	release1()
+	mounts3, release3, err := c.acquire(step)
+	require.NoError(t, err)
+	assert.Equal(t, mounts1, mounts3)
+	release2()
+	release3()
+
+	for dir := range mounts1 {
+		info, err := os.Stat(dir)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0777), info.Mode().Perm())
+	}
+}
+
+func TestStepCaches_AcquireStaleLock(t *testing.T) {
+	c := &StepCaches{Dir: t.TempDir()}
+	step := batcheslib.Step{Caches: []batcheslib.StepCache{{Name: "go-build", Mountpoint: "/cache"}}}
+
+	require.NoError(t, os.MkdirAll(filepath.Join(c.Dir, "go-build", "0"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(c.Dir, "go-build", "0.lock"), []byte(exitedProcessOwner(t)), 0666))
+
+	mounts, release, err := c.acquire(step)
+	require.NoError(t, err)
+	defer release()
+	assert.Equal(t, map[string]string{filepath.Join(c.Dir, "go-build", "0"): "/cache"}, mounts)
+
+	owner, err := os.ReadFile(filepath.Join(c.Dir, "go-build", "0.lock"))
+	require.NoError(t, err)
+	assert.Equal(t, util.LockOwner(), string(owner))
+}
+
+func TestTryLockStepCacheSlot_ConcurrentTakeover(t *testing.T) {
+	dir := t.TempDir()
+	lock := filepath.Join(dir, "0.lock")
+	require.NoError(t, os.WriteFile(lock, []byte(exitedProcessOwner(t)), 0666))
+
+	// All goroutines find the same stale lock, but only one of them gets it.
+	const n = 20
+	var (
+		wg    sync.WaitGroup
+		taken atomic.Int32
+		errs  = make(chan error, n)
+	)
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := tryLockStepCacheSlot(lock)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if ok {
+				taken.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), taken.Load())
+
+	owner, err := os.ReadFile(lock)
+	require.NoError(t, err)
+	assert.Equal(t, util.LockOwner(), string(owner))
+	assert.NoFileExists(t, lock+stepCacheTakeoverExt)
+}
+
+func TestTryLockStepCacheSlot_TakeoverInProgress(t *testing.T) {
+	dir := t.TempDir()
+	lock := filepath.Join(dir, "0.lock")
+	require.NoError(t, os.WriteFile(lock, []byte(exitedProcessOwner(t)), 0666))
+	require.NoError(t, os.WriteFile(lock+stepCacheTakeoverExt, []byte("src-cli other 1"), 0666))
+
+	ok, err := tryLockStepCacheSlot(lock)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+// exitedProcessOwner returns the lock owner of a process that has exited.
+func exitedProcessOwner(t *testing.T) string {
+	t.Helper()
+
+	cmd := exec.Command("git", "--version")
+	require.NoError(t, cmd.Run())
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	return fmt.Sprintf("src-cli %s %d", hostname, cmd.Process.Pid)
+}
+
+func TestStepCaches_Nil(t *testing.T) {
+	var c *StepCaches
+
+	_, release, err := c.acquire(batcheslib.Step{})
+	require.NoError(t, err)
+	release()
+
+	_, _, err = c.acquire(batcheslib.Step{Caches: []batcheslib.StepCache{{Name: "go-build", Mountpoint: "/cache"}}})
+	assert.ErrorContains(t, err, "step caches are not supported here")
+}
+
+func TestStepCaches_ListRemove(t *testing.T) {
+	c := &StepCaches{Dir: t.TempDir()}
+
+	caches, err := c.List()
+	require.NoError(t, err)
+	assert.Empty(t, caches)
+
+	goBuild := batcheslib.Step{Caches: []batcheslib.StepCache{{Name: "go-build", Mountpoint: "/cache"}}}
+	npm := batcheslib.Step{Caches: []batcheslib.StepCache{{Name: "npm", Mountpoint: "/cache"}}}
+
+	mounts, release, err := c.acquire(goBuild)
+	require.NoError(t, err)
+	for dir := range mounts {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "a"), []byte("hello"), 0644))
+	}
+	_, releaseSecond, err := c.acquire(goBuild)
+	require.NoError(t, err)
+	releaseSecond()
+	release()
+
+	_, releaseNPM, err := c.acquire(npm)
+	require.NoError(t, err)
+	defer releaseNPM()
+
+	caches, err = c.List()
+	require.NoError(t, err)
+	assert.Equal(t, []StepCacheInfo{
+		{Name: "go-build", Slots: 2, Size: 5},
+		{Name: "npm", Slots: 1, InUse: true},
+	}, caches)
+
+	removed, err := c.Remove("go-build")
+	require.NoError(t, err)
+	assert.True(t, removed)
+	assert.NoDirExists(t, filepath.Join(c.Dir, "go-build"))
+
+	// Caches in use are kept.
+	removed, err = c.Remove("npm")
+	require.NoError(t, err)
+	assert.False(t, removed)
+	assert.DirExists(t, filepath.Join(c.Dir, "npm", "0"))
+
+	removed, err = c.Remove("missing")
+	require.NoError(t, err)
+	assert.True(t, removed)
+}
@@ -29,6 +29,9 @@ type Task struct {
 	// When this field is true, CachedStepResult is also populated.
 	CachedStepResultFound bool
 	CachedStepResult      execution.AfterStepResult
+	// Event is the changeset hook event the steps are executed for. It's
+	// only set when running hook steps.
+	Event template.HookEvent
 }
 
 func (t *Task) ArchivePathToFetch() string {
@@ -38,7 +41,7 @@ func (t *Task) ArchivePathToFetch() string {
 	return ""
 }
 
-func (t *Task) CacheKey(globalEnv []string, workingDir string, stepIndex int) cache.Keyer {
+func (t *Task) CacheKey(globalEnv []string, workingDir, runner string, stepIndex int) cache.Keyer {
 	return &cache.CacheKey{
 		Repository: batcheslib.Repository{
 			ID:          t.Repository.ID,
@@ -54,6 +57,7 @@ func (t *Task) CacheKey(globalEnv []string, workingDir string, stepIndex int) ca
 		MetadataRetriever:     fileMetadataRetriever{workingDirectory: workingDir},
 
 		GlobalEnv: globalEnv,
+		Runner:    runner,
 
 		StepIndex: stepIndex,
 	}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/sourcegraph/sourcegraph/lib/batches"
 	"github.com/sourcegraph/sourcegraph/lib/batches/execution/cache"
+	"github.com/sourcegraph/sourcegraph/lib/batches/template"
 	"github.com/sourcegraph/sourcegraph/lib/errors"
 )
 
@@ -151,3 +152,36 @@ func TestFileMetadataRetriever_Get(t *testing.T) {
 		})
 	}
 }
+
+func TestTask_CacheKey_Runner(t *testing.T) {
+	task := &Task{
+		Repository:            testRepo1,
+		Steps:                 []batches.Step{{Run: "echo 1", Container: "alpine:3"}},
+		BatchChangeAttributes: &template.BatchChangeAttributes{Name: "test"},
+	}
+
+	keyFor := func(runner string) string {
+		key, err := task.CacheKey(nil, "", runner, 0).Key()
+		require.NoError(t, err)
+		return key
+	}
+
+	// Keys of steps run in containers must not change, so that existing cache
+	// entries remain valid.
+	legacy, err := cache.CacheKey{
+		Repository: batches.Repository{
+			ID:          testRepo1.ID,
+			Name:        testRepo1.Name,
+			BaseRef:     testRepo1.BaseRef(),
+			BaseRev:     testRepo1.Rev(),
+			FileMatches: testRepo1.SortedFileMatches(),
+		},
+		Steps:                 task.Steps,
+		BatchChangeAttributes: task.BatchChangeAttributes,
+		MetadataRetriever:     fileMetadataRetriever{},
+	}.Key()
+	require.NoError(t, err)
+	assert.Equal(t, legacy, keyFor(""))
+
+	assert.NotEqual(t, keyFor(""), keyFor(hostRunner))
+}
@@ -3,6 +3,7 @@ package executor
 import (
 	"context"
 	"io"
+	"time"
 
 	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
 	"github.com/sourcegraph/sourcegraph/lib/batches/git"
@@ -45,10 +46,27 @@ type StepsExecutionUI interface {
 
 	StepOutputWriter(context.Context, *Task, int) StepOutputWriter
 
+	// StepAttemptFailed is called when an attempt of a step with maxAttempts
+	// failed and the step is retried after retryIn.
+	StepAttemptFailed(idx int, attempt, maxAttempts int, err error, exitCode int, retryIn time.Duration)
+
 	StepFinished(idx int, diff []byte, changes git.Changes, outputs map[string]any)
 	StepFailed(idx int, err error, exitCode int)
 }
 
+// NoopTaskExecUI is an implementation of TaskExecutionUI that does nothing.
+type NoopTaskExecUI struct{}
+
+func (noop NoopTaskExecUI) Start([]*Task)                                              {}
+func (noop NoopTaskExecUI) Success()                                                   {}
+func (noop NoopTaskExecUI) Failed(err error)                                           {}
+func (noop NoopTaskExecUI) TaskStarted(*Task)                                          {}
+func (noop NoopTaskExecUI) TaskFinished(*Task, error)                                  {}
+func (noop NoopTaskExecUI) TaskChangesetSpecsBuilt(*Task, []*batcheslib.ChangesetSpec) {}
+func (noop NoopTaskExecUI) StepsExecutionUI(*Task) StepsExecutionUI {
+	return NoopStepsExecUI{}
+}
+
 // NoopStepsExecUI is an implementation of StepsExecutionUI that does nothing.
 type NoopStepsExecUI struct{}
 
@@ -65,6 +83,8 @@ func (noop NoopStepsExecUI) StepStarted(step int, runScript string, env map[stri
 func (noop NoopStepsExecUI) StepOutputWriter(ctx context.Context, task *Task, step int) StepOutputWriter {
 	return NoopStepOutputWriter{}
 }
+func (noop NoopStepsExecUI) StepAttemptFailed(idx int, attempt, maxAttempts int, err error, exitCode int, retryIn time.Duration) {
+}
 func (noop NoopStepsExecUI) StepFinished(idx int, diff []byte, changes git.Changes, outputs map[string]any) {
 }
 func (noop NoopStepsExecUI) StepFailed(idx int, err error, exitCode int) {
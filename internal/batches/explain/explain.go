@@ -0,0 +1,245 @@
+// Package explain works out what executing the steps of a batch spec would do
+// in each workspace, without executing them.
+//
+// The step templates are evaluated as far as possible with the information
+// that's known before the steps are executed, such as the name of the
+// repository. Everything that depends on the results of earlier steps, such
+// as their outputs, is left as it is.
+package explain
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/batches/template"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/src-cli/internal/batches/executor"
+	"github.com/sourcegraph/src-cli/internal/batches/util"
+)
+
+// CacheStatus is the state of the cached step results of a workspace.
+type CacheStatus string
+
+const (
+	// CacheStatusCached means that the results of all steps are cached, so
+	// that no step is executed.
+	CacheStatusCached CacheStatus = "cached"
+	// CacheStatusPartial means that the results of some steps are cached, so
+	// that the execution resumes after them.
+	CacheStatusPartial CacheStatus = "partial"
+	// CacheStatusNone means that no step results are cached.
+	CacheStatusNone CacheStatus = "none"
+)
+
+// StepStatus is whether a step is executed in a workspace.
+type StepStatus string
+
+const (
+	StepStatusRun     StepStatus = "run"
+	StepStatusSkipped StepStatus = "skipped"
+	// StepStatusConditional means that the if condition of the step depends
+	// on the results of earlier steps, so that it's only known once they are
+	// executed.
+	StepStatusConditional StepStatus = "conditional"
+)
+
+// Plan is the execution plan of the steps of a batch spec in a workspace.
+type Plan struct {
+	Repository string `json:"repository"`
+	Branch     string `json:"branch"`
+	Revision   string `json:"revision"`
+	// Path is the workspace in the repository. "" is the root.
+	Path  string      `json:"path"`
+	Cache CacheStatus `json:"cache"`
+	Steps []*Step     `json:"steps"`
+}
+
+// Step is the execution plan of a single step.
+type Step struct {
+	// Number is the number of the step, starting at 1.
+	Number int        `json:"number"`
+	Status StepStatus `json:"status"`
+	// Cached is true if the result of the step is cached, so that it isn't
+	// executed.
+	Cached bool   `json:"cached"`
+	If     string `json:"if,omitempty"`
+	Image  string `json:"image,omitempty"`
+	// ImageDigest is only set if the image doesn't depend on the results of
+	// earlier steps.
+	ImageDigest string `json:"imageDigest,omitempty"`
+	Run         string `json:"run,omitempty"`
+	Prompt      string `json:"prompt,omitempty"`
+	// Env are the environment variables set in the batch spec. The values of
+	// the variables inherited from the environment of src aren't included,
+	// since they often contain credentials; their names are in InheritedEnv.
+	Env          map[string]string `json:"env,omitempty"`
+	InheritedEnv []string          `json:"inheritedEnv,omitempty"`
+	Files        map[string]string `json:"files,omitempty"`
+}
+
+// CacheChecker checks the cache for the results of the steps of the tasks, as
+// executor.Coordinator does. The cached results are recorded in the tasks.
+type CacheChecker interface {
+	CheckCache(ctx context.Context, batchSpec *batcheslib.BatchSpec, tasks []*executor.Task) ([]*executor.Task, []*batcheslib.ChangesetSpec, error)
+}
+
+// Opts are the options of Explain.
+type Opts struct {
+	Cache CacheChecker
+	// ImageDigest returns the digest of the given image, pulling it if
+	// necessary. If it's nil, no digests are included in the plans.
+	ImageDigest func(ctx context.Context, image string) (string, error)
+}
+
+// Explain returns the execution plans of the tasks built for the batch spec.
+func Explain(ctx context.Context, spec *batcheslib.BatchSpec, tasks []*executor.Task, opts Opts) ([]*Plan, error) {
+	uncached, _, err := opts.Cache.CheckCache(ctx, spec, tasks)
+	if err != nil {
+		return nil, errors.Wrap(err, "checking cache")
+	}
+	isUncached := make(map[*executor.Task]bool, len(uncached))
+	for _, t := range uncached {
+		isUncached[t] = true
+	}
+
+	digests := map[string]string{}
+	plans := make([]*Plan, 0, len(tasks))
+	for _, task := range tasks {
+		plan, err := explainTask(ctx, spec, task, !isUncached[task], digests, opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s", workspaceName(task))
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+func explainTask(ctx context.Context, spec *batcheslib.BatchSpec, task *executor.Task, cached bool, digests map[string]string, opts Opts) (*Plan, error) {
+	plan := &Plan{
+		Repository: task.Repository.Name,
+		Branch:     strings.TrimPrefix(task.Repository.BaseRef(), "refs/heads/"),
+		Revision:   task.Repository.Rev(),
+		Path:       task.Path,
+		Cache:      CacheStatusNone,
+	}
+	lastCachedStep := -1
+	if cached {
+		plan.Cache = CacheStatusCached
+		lastCachedStep = len(task.Steps) - 1
+	} else if task.CachedStepResultFound {
+		plan.Cache = CacheStatusPartial
+		lastCachedStep = task.CachedStepResult.StepIndex
+	}
+
+	skipped, err := batcheslib.SkippedStepsForRepo(spec, task.Repository.Name, task.Repository.SortedFileMatches())
+	if err != nil {
+		return nil, err
+	}
+
+	stepCtx := &template.StepContext{
+		BatchChange: *task.BatchChangeAttributes,
+		Repository: util.NewTemplatingRepo(
+			task.Repository.Name,
+			task.Repository.Branch.Name,
+			task.Repository.FileMatches,
+		),
+		Steps: template.StepsContext{Path: task.Path},
+	}
+	for i, s := range task.Steps {
+		step := &Step{
+			Number: i + 1,
+			Status: StepStatusRun,
+			Cached: i <= lastCachedStep,
+		}
+		if _, ok := skipped[i]; ok {
+			step.Status = StepStatusSkipped
+		} else if s.IfCondition() != "" {
+			// SkippedStepsForRepo only reports the steps whose condition is
+			// false, so the condition is evaluated again to tell the steps
+			// that always run from the ones that depend on earlier steps.
+			static, _, err := template.IsStaticBool(s.IfCondition(), stepCtx)
+			if err != nil {
+				return nil, errors.Wrapf(err, "step %d: evaluating if", i+1)
+			}
+			if !static {
+				step.Status = StepStatusConditional
+			}
+		}
+		if step.If, err = template.PartialEval(s.IfCondition(), stepCtx); err != nil {
+			return nil, errors.Wrapf(err, "step %d: evaluating if", i+1)
+		}
+
+		run, image := s.Run, s.Container
+		if s.BuildImage != nil {
+			run, image = s.BuildImage.Run, s.BuildImage.BaseImage
+		}
+		if step.Run, err = template.PartialEval(run, stepCtx); err != nil {
+			return nil, errors.Wrapf(err, "step %d: evaluating run", i+1)
+		}
+		if step.Image, err = template.PartialEval(image, stepCtx); err != nil {
+			return nil, errors.Wrapf(err, "step %d: evaluating image", i+1)
+		}
+		if s.CodingAgent != nil {
+			if step.Prompt, err = template.PartialEval(s.CodingAgent.Prompt, stepCtx); err != nil {
+				return nil, errors.Wrapf(err, "step %d: evaluating prompt", i+1)
+			}
+		}
+
+		if opts.ImageDigest != nil && step.Status != StepStatusSkipped && step.Image != "" && !template.ContainsTemplateAction(step.Image) {
+			digest, ok := digests[step.Image]
+			if !ok {
+				if digest, err = opts.ImageDigest(ctx, step.Image); err != nil {
+					return nil, errors.Wrapf(err, "step %d", i+1)
+				}
+				digests[step.Image] = digest
+			}
+			step.ImageDigest = digest
+		}
+
+		// The outer variables are resolved to empty values, which are
+		// replaced by their names below.
+		env, err := s.Env.Resolve(nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "step %d: resolving env", i+1)
+		}
+		for _, name := range s.Env.OuterVars() {
+			step.InheritedEnv = append(step.InheritedEnv, name)
+			delete(env, name)
+		}
+		sort.Strings(step.InheritedEnv)
+		if step.Env, err = partialEvalMap(env, stepCtx); err != nil {
+			return nil, errors.Wrapf(err, "step %d: evaluating env", i+1)
+		}
+		if step.Files, err = partialEvalMap(s.Files, stepCtx); err != nil {
+			return nil, errors.Wrapf(err, "step %d: evaluating files", i+1)
+		}
+
+		plan.Steps = append(plan.Steps, step)
+	}
+	return plan, nil
+}
+
+func partialEvalMap(m map[string]string, stepCtx *template.StepContext) (map[string]string, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	evaluated := make(map[string]string, len(m))
+	for k, v := range m {
+		e, err := template.PartialEval(v, stepCtx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s", k)
+		}
+		evaluated[k] = e
+	}
+	return evaluated, nil
+}
+
+func workspaceName(task *executor.Task) string {
+	if task.Path == "" {
+		return task.Repository.Name
+	}
+	return task.Repository.Name + "/" + task.Path
+}
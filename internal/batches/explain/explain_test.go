@@ -0,0 +1,157 @@
+package explain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/batches/template"
+
+	"github.com/sourcegraph/src-cli/internal/batches/executor"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+)
+
+const testSpec = `
+name: test
+steps:
+  - run: echo ${{ repository.name }} >> README.md
+    container: alpine:3
+    env:
+      - REPO: ${{ repository.name }}
+      - GITHUB_TOKEN
+  - if: ${{ eq repository.name "github.com/sourcegraph/other" }}
+    run: echo other
+    container: alpine:3
+  - if: ${{ eq outputs.count "0" }}
+    run: cat ${{ steps.path }}/hello.txt
+    container: ${{ outputs.image }}
+    files:
+      hello.txt: hello from ${{ batch_change.name }}
+changesetTemplate:
+  title: test
+  body: test
+  branch: test
+  commit:
+    message: test
+`
+
+type fakeCache struct {
+	// lastCachedStep maps repository names to the index of the last cached
+	// step of their task.
+	lastCachedStep map[string]int
+}
+
+func (c *fakeCache) CheckCache(_ context.Context, _ *batcheslib.BatchSpec, tasks []*executor.Task) (uncached []*executor.Task, _ []*batcheslib.ChangesetSpec, _ error) {
+	for _, t := range tasks {
+		idx, ok := c.lastCachedStep[t.Repository.Name]
+		if ok {
+			t.CachedStepResultFound = true
+			t.CachedStepResult.StepIndex = idx
+		}
+		if !ok || idx < len(t.Steps)-1 {
+			uncached = append(uncached, t)
+		}
+	}
+	return uncached, nil, nil
+}
+
+func TestExplain(t *testing.T) {
+	spec, err := batcheslib.ParseBatchSpec([]byte(testSpec))
+	require.NoError(t, err)
+
+	repo := func(name string) *graphql.Repository {
+		return &graphql.Repository{
+			Name:          name,
+			DefaultBranch: &graphql.Branch{Name: "main", Target: graphql.Target{OID: "d34db33f"}},
+		}
+	}
+	attrs := &template.BatchChangeAttributes{Name: spec.Name}
+	tasks := []*executor.Task{
+		{Repository: repo("github.com/sourcegraph/src-cli"), Path: "cmd", Steps: spec.Steps, BatchChangeAttributes: attrs},
+		{Repository: repo("github.com/sourcegraph/other"), Steps: spec.Steps, BatchChangeAttributes: attrs},
+	}
+
+	var pulled []string
+	plans, err := Explain(context.Background(), spec, tasks, Opts{
+		Cache: &fakeCache{lastCachedStep: map[string]int{"github.com/sourcegraph/other": 0}},
+		ImageDigest: func(_ context.Context, image string) (string, error) {
+			pulled = append(pulled, image)
+			return "sha256:" + image, nil
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"alpine:3"}, pulled)
+	assert.Equal(t, []*Plan{
+		{
+			Repository: "github.com/sourcegraph/src-cli",
+			Branch:     "main",
+			Revision:   "d34db33f",
+			Path:       "cmd",
+			Cache:      CacheStatusNone,
+			Steps: []*Step{
+				{
+					Number:       1,
+					Status:       StepStatusRun,
+					Image:        "alpine:3",
+					ImageDigest:  "sha256:alpine:3",
+					Run:          "echo github.com/sourcegraph/src-cli >> README.md",
+					Env:          map[string]string{"REPO": "github.com/sourcegraph/src-cli"},
+					InheritedEnv: []string{"GITHUB_TOKEN"},
+				},
+				{
+					Number: 2,
+					Status: StepStatusSkipped,
+					If:     "false",
+					Image:  "alpine:3",
+					Run:    "echo other",
+				},
+				{
+					Number: 3,
+					Status: StepStatusConditional,
+					If:     `${{ eq outputs.count "0" }}`,
+					Image:  "${{ outputs.image }}",
+					Run:    "cat ${{ steps.path }}/hello.txt",
+					Files:  map[string]string{"hello.txt": "hello from test"},
+				},
+			},
+		},
+		{
+			Repository: "github.com/sourcegraph/other",
+			Branch:     "main",
+			Revision:   "d34db33f",
+			Cache:      CacheStatusPartial,
+			Steps: []*Step{
+				{
+					Number:       1,
+					Status:       StepStatusRun,
+					Cached:       true,
+					Image:        "alpine:3",
+					ImageDigest:  "sha256:alpine:3",
+					Run:          "echo github.com/sourcegraph/other >> README.md",
+					Env:          map[string]string{"REPO": "github.com/sourcegraph/other"},
+					InheritedEnv: []string{"GITHUB_TOKEN"},
+				},
+				{
+					Number:      2,
+					Status:      StepStatusRun,
+					If:          "true",
+					Image:       "alpine:3",
+					ImageDigest: "sha256:alpine:3",
+					Run:         "echo other",
+				},
+				{
+					Number: 3,
+					Status: StepStatusConditional,
+					If:     `${{ eq outputs.count "0" }}`,
+					Image:  "${{ outputs.image }}",
+					Run:    "cat ${{ steps.path }}/hello.txt",
+					Files:  map[string]string{"hello.txt": "hello from test"},
+				},
+			},
+		},
+	}, plans)
+}
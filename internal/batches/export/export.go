@@ -0,0 +1,165 @@
+// Package export writes the changesets produced by a local execution of a
+// batch spec to disk instead of uploading them to Sourcegraph: as patch files
+// in the format of git format-patch, as commits on branches in local clones,
+// and as git bundles of those branches.
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+)
+
+// Changeset is a changeset spec together with the name of its repository,
+// which the spec only references by its GraphQL ID.
+type Changeset struct {
+	Repository string
+	Spec       *batcheslib.ChangesetSpec
+}
+
+// Branch returns the name of the branch of the changeset.
+func (c Changeset) Branch() string {
+	return strings.TrimPrefix(c.Spec.HeadRef, "refs/heads/")
+}
+
+// Opts configures Export.
+type Opts struct {
+	// Dir is the directory patch files, changeset specs and bundles are
+	// written to.
+	Dir string
+	// Clones is the directory containing local clones of the repositories,
+	// at <Clones>/<repository name>. If set, the changesets are committed on
+	// their branches in the clones.
+	Clones string
+	// Bundles, if true, writes a git bundle of the branches of every
+	// repository to Dir. Requires Clones.
+	Bundles bool
+	// Force overwrites existing branches in the clones.
+	Force bool
+	// Date is the author and committer date of the exported commits.
+	Date time.Time
+}
+
+// Branch is a branch created in a local clone.
+type Branch struct {
+	Clone  string `json:"clone"`
+	Name   string `json:"name"`
+	Commit string `json:"commit"`
+}
+
+// Result lists everything written by Export.
+type Result struct {
+	Files    []string `json:"files"`
+	Branches []Branch `json:"branches"`
+}
+
+// Export exports the given changesets, which must not be imported changesets.
+// progress is called after every exported changeset.
+func Export(ctx context.Context, changesets []Changeset, opts Opts, progress func(done, total int)) (Result, error) {
+	var res Result
+	if opts.Bundles && opts.Clones == "" {
+		return res, errors.New("bundles can only be written from local clones")
+	}
+
+	byRepo := map[string][]Changeset{}
+	exported := map[string]Changeset{}
+	for i, c := range changesets {
+		path, err := patchPath(opts.Dir, c)
+		if err != nil {
+			return res, err
+		}
+		if prev, ok := exported[path]; ok {
+			return res, errors.Newf("changesets on branches %q in %s and %q in %s would both be exported to %s", prev.Branch(), prev.Repository, c.Branch(), c.Repository, path)
+		}
+		exported[path] = c
+		if err := writePatchFile(path, c, opts.Date); err != nil {
+			return res, err
+		}
+		specPath := strings.TrimSuffix(path, ".patch") + ".json"
+		if err := writeSpecFile(specPath, c); err != nil {
+			return res, err
+		}
+		res.Files = append(res.Files, path, specPath)
+
+		if opts.Clones != "" {
+			clone := filepath.Join(opts.Clones, filepath.FromSlash(c.Repository))
+			commit, err := CommitToBranch(ctx, clone, c.Spec, opts.Date, opts.Force)
+			if err != nil {
+				return res, errors.Wrapf(err, "exporting %s to %s", c.Branch(), c.Repository)
+			}
+			res.Branches = append(res.Branches, Branch{Clone: clone, Name: c.Branch(), Commit: commit})
+			byRepo[c.Repository] = append(byRepo[c.Repository], c)
+		}
+
+		if progress != nil {
+			progress(i+1, len(changesets))
+		}
+	}
+
+	if opts.Bundles {
+		repos := make([]string, 0, len(byRepo))
+		for repo := range byRepo {
+			repos = append(repos, repo)
+		}
+		sort.Strings(repos)
+
+		for _, repo := range repos {
+			path := filepath.Join(opts.Dir, filepath.FromSlash(repo)+".bundle")
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return res, errors.Wrap(err, "creating export directory")
+			}
+			clone := filepath.Join(opts.Clones, filepath.FromSlash(repo))
+			if err := WriteBundle(ctx, clone, path, byRepo[repo]); err != nil {
+				return res, errors.Wrapf(err, "writing bundle of %s", repo)
+			}
+			res.Files = append(res.Files, path)
+		}
+	}
+
+	return res, nil
+}
+
+// patchPath returns the path of the patch file of the changeset, which is
+// named after its branch. The branch is percent-encoded like a URL path
+// segment, so that branches like feature/x and feature-x get different files
+// and the branch can be recovered from the file name.
+func patchPath(dir string, c Changeset) (string, error) {
+	name := url.PathEscape(c.Branch())
+	if name == "" || name == "." || name == ".." {
+		return "", errors.Newf("changeset in %s has an invalid branch %q", c.Repository, c.Spec.HeadRef)
+	}
+	return filepath.Join(dir, filepath.FromSlash(c.Repository), name+".patch"), nil
+}
+
+func writePatchFile(path string, c Changeset, date time.Time) (err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrap(err, "creating export directory")
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "creating patch file")
+	}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil {
+			err = errors.Append(err, closeErr)
+		}
+	}()
+
+	return WritePatch(f, c.Spec, date)
+}
+
+func writeSpecFile(path string, c Changeset) error {
+	raw, err := json.MarshalIndent(c.Spec, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshalling changeset spec JSON")
+	}
+	return errors.Wrap(os.WriteFile(path, append(raw, '\n'), 0644), "writing changeset spec")
+}
@@ -0,0 +1,192 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+)
+
+var testDate = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func TestWritePatch(t *testing.T) {
+	spec := &batcheslib.ChangesetSpec{
+		HeadRef: "refs/heads/hello-world",
+		Commits: []batcheslib.GitCommitDescription{{
+			Message:     "Say hello\nto the world\n\nThis adds a greeting.\n",
+			AuthorName:  "Mary McButtons",
+			AuthorEmail: "mary@example.com",
+			Diff: []byte(`diff --git README.md README.md
+index 1234..5678 100644
+--- README.md
++++ README.md
+@@ -1 +1,2 @@
+ # README
++Hello World
+`),
+		}},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WritePatch(&buf, spec, testDate))
+
+	want := `From 0000000000000000000000000000000000000000 Mon Sep 17 00:00:00 2001
+From: Mary McButtons <mary@example.com>
+Date: Fri, 01 Mar 2024 12:00:00 +0000
+Subject: [PATCH] Say hello to the world
+
+This adds a greeting.
+
+---
+ M README.md
+ 1 file changed
+
+diff --git README.md README.md
+index 1234..5678 100644
+--- README.md
++++ README.md
+@@ -1 +1,2 @@
+ # README
++Hello World
+
+`
+	assert.Equal(t, want, buf.String())
+}
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	clones := t.TempDir()
+	out := t.TempDir()
+
+	clone := filepath.Join(clones, "github.com", "sourcegraph", "src-cli")
+	base := createTestRepo(t, clone)
+
+	// Build the diff like the executor does.
+	require.NoError(t, os.WriteFile(filepath.Join(clone, "README.md"), []byte("# README\nHello World\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(clone, "new.txt"), []byte("new\n"), 0644))
+	runTestGit(t, clone, "add", "--all")
+	diff := runTestGit(t, clone, "diff", "--cached", "--no-prefix", "--binary")
+	runTestGit(t, clone, "reset", "--hard")
+	runTestGit(t, clone, "clean", "-fd")
+
+	spec := &batcheslib.ChangesetSpec{
+		BaseRev: base,
+		HeadRef: "refs/heads/batch/hello-world",
+		Commits: []batcheslib.GitCommitDescription{{
+			Message:     "Hello World",
+			AuthorName:  "Mary McButtons",
+			AuthorEmail: "mary@example.com",
+			Diff:        []byte(diff + "\n"),
+		}},
+	}
+	changesets := []Changeset{{Repository: "github.com/sourcegraph/src-cli", Spec: spec}}
+
+	var progress []int
+	res, err := Export(ctx, changesets, Opts{Dir: out, Clones: clones, Bundles: true, Date: testDate}, func(done, total int) {
+		progress = append(progress, done, total)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 1}, progress)
+
+	patch := filepath.Join(out, "github.com", "sourcegraph", "src-cli", "batch%2Fhello-world.patch")
+	bundle := filepath.Join(out, "github.com", "sourcegraph", "src-cli.bundle")
+	specFile := strings.TrimSuffix(patch, ".patch") + ".json"
+	assert.Equal(t, []string{patch, specFile, bundle}, res.Files)
+	assert.FileExists(t, specFile)
+	require.Len(t, res.Branches, 1)
+	assert.Equal(t, "batch/hello-world", res.Branches[0].Name)
+
+	// The branch has the commit, but the checkout is untouched.
+	assert.Equal(t, res.Branches[0].Commit, runTestGit(t, clone, "rev-parse", "batch/hello-world"))
+	assert.Equal(t, "Mary McButtons <mary@example.com>", runTestGit(t, clone, "log", "-1", "--format=%an <%ae>", "batch/hello-world"))
+	assert.Equal(t, "# README\nHello World", runTestGit(t, clone, "show", "batch/hello-world:README.md"))
+	assert.Equal(t, "", runTestGit(t, clone, "status", "--porcelain"))
+	assert.Equal(t, base, runTestGit(t, clone, "rev-parse", "HEAD"))
+
+	// The patch applies with git am and results in the same tree.
+	runTestGit(t, clone, "checkout", "-q", "-b", "am", base)
+	runTestGit(t, clone, "am", "-q", "-p0", patch)
+	assert.Equal(t, runTestGit(t, clone, "rev-parse", "batch/hello-world^{tree}"), runTestGit(t, clone, "rev-parse", "HEAD^{tree}"))
+	runTestGit(t, clone, "checkout", "-q", "main")
+
+	// The bundle can be fetched from.
+	runTestGit(t, clone, "bundle", "verify", bundle)
+
+	// Existing branches are only overwritten with force.
+	_, err = Export(ctx, changesets, Opts{Dir: out, Clones: clones, Date: testDate.Add(time.Hour)}, nil)
+	assert.ErrorContains(t, err, "use -force to overwrite")
+	res, err = Export(ctx, changesets, Opts{Dir: out, Clones: clones, Force: true, Date: testDate.Add(time.Hour)}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, res.Branches[0].Commit, runTestGit(t, clone, "rev-parse", "batch/hello-world"))
+
+	// A missing base revision is reported.
+	spec.BaseRev = strings.Repeat("1", 40)
+	_, err = Export(ctx, changesets, Opts{Dir: out, Clones: clones, Force: true, Date: testDate}, nil)
+	assert.ErrorContains(t, err, "fetch it first")
+}
+
+func TestExport_BundlesRequireClones(t *testing.T) {
+	_, err := Export(context.Background(), nil, Opts{Dir: t.TempDir(), Bundles: true}, nil)
+	assert.Error(t, err)
+}
+
+func TestExport_PatchFileNames(t *testing.T) {
+	ctx := context.Background()
+	newChangeset := func(branch string) Changeset {
+		return Changeset{Repository: "github.com/sourcegraph/src-cli", Spec: &batcheslib.ChangesetSpec{
+			HeadRef: "refs/heads/" + branch,
+			Commits: []batcheslib.GitCommitDescription{{Message: branch, Diff: []byte("diff --git a a\n")}},
+		}}
+	}
+
+	t.Run("similar branches", func(t *testing.T) {
+		out := t.TempDir()
+		res, err := Export(ctx, []Changeset{newChangeset("feature/x"), newChangeset("feature-x")}, Opts{Dir: out, Date: testDate}, nil)
+		require.NoError(t, err)
+
+		dir := filepath.Join(out, "github.com", "sourcegraph", "src-cli")
+		assert.Equal(t, []string{
+			filepath.Join(dir, "feature%2Fx.patch"), filepath.Join(dir, "feature%2Fx.json"),
+			filepath.Join(dir, "feature-x.patch"), filepath.Join(dir, "feature-x.json"),
+		}, res.Files)
+	})
+
+	t.Run("same branch", func(t *testing.T) {
+		_, err := Export(ctx, []Changeset{newChangeset("feature/x"), newChangeset("feature/x")}, Opts{Dir: t.TempDir(), Date: testDate}, nil)
+		assert.ErrorContains(t, err, "would both be exported to")
+	})
+}
+
+func createTestRepo(t *testing.T, dir string) string {
+	t.Helper()
+
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	runTestGit(t, dir, "init", "-q", "-b", "main")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("# README\n"), 0644))
+	runTestGit(t, dir, "add", "--all")
+	runTestGit(t, dir, "commit", "-q", "-m", "Initial commit")
+	return runTestGit(t, dir, "rev-parse", "HEAD")
+}
+
+func runTestGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,122 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+)
+
+// CommitToBranch creates the commits of the changeset spec on top of its base
+// revision in the git repository at dir, and points the branch of the spec at
+// the last one. The working tree and index of the repository are left
+// untouched. Unless force is true, existing branches aren't overwritten. It
+// returns the hash of the last commit.
+func CommitToBranch(ctx context.Context, dir string, spec *batcheslib.ChangesetSpec, date time.Time, force bool) (string, error) {
+	parent, err := runGit(ctx, dir, nil, nil, "rev-parse", "--verify", "--quiet", spec.BaseRev+"^{commit}")
+	if err != nil {
+		return "", errors.Newf("base revision %s not found in %s, fetch it first", spec.BaseRev, dir)
+	}
+
+	ref := "refs/heads/" + strings.TrimPrefix(spec.HeadRef, "refs/heads/")
+	if head, err := runGit(ctx, dir, nil, nil, "symbolic-ref", "--quiet", "HEAD"); err == nil && head == ref {
+		return "", errors.Newf("branch %s is checked out in %s", ref, dir)
+	}
+
+	tmp, err := os.MkdirTemp("", "src-batch-export-*")
+	if err != nil {
+		return "", errors.Wrap(err, "creating temporary directory")
+	}
+	defer os.RemoveAll(tmp)
+
+	// The commits are built in a separate index, so that the repository's own
+	// index isn't modified.
+	dateEnv := date.Format(time.RFC3339)
+	for _, commit := range spec.Commits {
+		env := []string{
+			"GIT_INDEX_FILE=" + filepath.Join(tmp, "index"),
+			"GIT_AUTHOR_NAME=" + commit.AuthorName,
+			"GIT_AUTHOR_EMAIL=" + commit.AuthorEmail,
+			"GIT_AUTHOR_DATE=" + dateEnv,
+			"GIT_COMMITTER_NAME=" + commit.AuthorName,
+			"GIT_COMMITTER_EMAIL=" + commit.AuthorEmail,
+			"GIT_COMMITTER_DATE=" + dateEnv,
+		}
+		if _, err := runGit(ctx, dir, env, nil, "read-tree", parent); err != nil {
+			return "", err
+		}
+		if len(commit.Diff) > 0 {
+			// Changeset spec diffs have no a/ and b/ prefixes.
+			if _, err := runGit(ctx, dir, env, commit.Diff, "apply", "--cached", "--binary", "-p0", "-"); err != nil {
+				return "", errors.Wrap(err, "applying diff")
+			}
+		}
+		tree, err := runGit(ctx, dir, env, nil, "write-tree")
+		if err != nil {
+			return "", err
+		}
+		parent, err = runGit(ctx, dir, env, []byte(commit.Message), "commit-tree", tree, "-p", parent, "-F", "-")
+		if err != nil {
+			return "", err
+		}
+	}
+
+	args := []string{"update-ref", "-m", "src batch export", ref, parent}
+	if !force {
+		// An empty old value makes update-ref fail if the branch exists.
+		args = append(args, "")
+	}
+	if _, err := runGit(ctx, dir, nil, nil, args...); err != nil {
+		if !force {
+			return "", errors.Wrapf(err, "creating branch %s, use -force to overwrite existing branches", ref)
+		}
+		return "", err
+	}
+
+	return parent, nil
+}
+
+// WriteBundle writes a git bundle of the branches of the given changesets in
+// the git repository at dir to path. The base revisions of the changesets are
+// prerequisites of the bundle, so it can only be fetched into clones that
+// have them.
+func WriteBundle(ctx context.Context, dir, path string, changesets []Changeset) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return errors.Wrap(err, "bundle path")
+	}
+
+	args := []string{"bundle", "create", abs}
+	for _, c := range changesets {
+		args = append(args, "refs/heads/"+c.Branch())
+	}
+	args = append(args, "--not")
+	for _, c := range changesets {
+		args = append(args, c.Spec.BaseRev)
+	}
+	_, err = runGit(ctx, dir, nil, nil, args...)
+	return err
+}
+
+func runGit(ctx context.Context, dir string, env []string, stdin []byte, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.Wrapf(err, "'git %s' failed: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,95 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"time"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/batches/git"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+)
+
+// WritePatch writes the commits of the changeset spec to w as a series of
+// mails in the format of git format-patch. The diffs of changeset specs have
+// no a/ and b/ prefixes, so the patch has to be applied with git am -p0.
+func WritePatch(w io.Writer, spec *batcheslib.ChangesetSpec, date time.Time) error {
+	for i, commit := range spec.Commits {
+		subject, body := splitCommitMessage(commit.Message)
+		if len(spec.Commits) > 1 {
+			subject = fmt.Sprintf("[PATCH %d/%d] %s", i+1, len(spec.Commits), subject)
+		} else {
+			subject = "[PATCH] " + subject
+		}
+
+		changes, err := git.ChangesInDiff(commit.Diff)
+		if err != nil {
+			return errors.Wrap(err, "parsing diff")
+		}
+
+		var b strings.Builder
+		// The hash is unknown, since the commit doesn't exist yet. git
+		// format-patch uses the same magic date.
+		fmt.Fprintf(&b, "From %s Mon Sep 17 00:00:00 2001\n", strings.Repeat("0", 40))
+		fmt.Fprintf(&b, "From: %s <%s>\n", mime.QEncoding.Encode("utf-8", commit.AuthorName), commit.AuthorEmail)
+		fmt.Fprintf(&b, "Date: %s\n", date.Format(time.RFC1123Z))
+		fmt.Fprintf(&b, "Subject: %s\n", mime.QEncoding.Encode("utf-8", subject))
+		b.WriteString("\n")
+		if body != "" {
+			b.WriteString(body)
+			b.WriteString("\n\n")
+		}
+		b.WriteString("---\n")
+		writeSummary(&b, changes)
+		b.WriteString("\n")
+
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+		if _, err := w.Write(commit.Diff); err != nil {
+			return err
+		}
+		if len(commit.Diff) > 0 && commit.Diff[len(commit.Diff)-1] != '\n' {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitCommitMessage splits a commit message into its subject, which joins
+// the lines of the first paragraph like git does, and its body.
+func splitCommitMessage(message string) (subject, body string) {
+	message = strings.TrimSpace(message)
+	paragraph, body, _ := strings.Cut(message, "\n\n")
+	return strings.Join(strings.Fields(paragraph), " "), strings.TrimSpace(body)
+}
+
+func writeSummary(b *strings.Builder, changes git.Changes) {
+	total := 0
+	for _, group := range []struct {
+		status string
+		files  []string
+	}{
+		{"M", changes.Modified},
+		{"A", changes.Added},
+		{"D", changes.Deleted},
+		{"R", changes.Renamed},
+	} {
+		for _, f := range group.files {
+			fmt.Fprintf(b, " %s %s\n", group.status, f)
+		}
+		total += len(group.files)
+	}
+	if total == 1 {
+		b.WriteString(" 1 file changed\n")
+	} else {
+		fmt.Fprintf(b, " %d files changed\n", total)
+	}
+}
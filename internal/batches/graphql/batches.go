@@ -1,5 +1,7 @@
 package graphql
 
+import "time"
+
 type BatchSpecID string
 type ChangesetSpecID string
 
@@ -8,6 +10,125 @@ type CreateBatchSpecResponse struct {
 	ApplyURL string
 }
 
+const BatchChangeFieldsFragment = `
+fragment batchChangeFields on BatchChange {
+    id
+    name
+    description
+    state
+    url
+    namespace {
+        namespaceName
+    }
+    createdAt
+    updatedAt
+    closedAt
+    changesetsStats {
+        total
+        unpublished
+        draft
+        open
+        merged
+        closed
+        deleted
+        archived
+        failed
+        processing
+        retrying
+        scheduled
+    }
+}
+`
+
 type BatchChange struct {
-	URL string
+	ID              string                `json:"id"`
+	Name            string                `json:"name"`
+	Description     string                `json:"description"`
+	State           string                `json:"state"`
+	URL             string                `json:"url"`
+	Namespace       BatchChangeNamespace  `json:"namespace"`
+	CreatedAt       time.Time             `json:"createdAt"`
+	UpdatedAt       time.Time             `json:"updatedAt"`
+	ClosedAt        *time.Time            `json:"closedAt"`
+	ChangesetsStats BatchChangeStatistics `json:"changesetsStats"`
+}
+
+type BatchChangeNamespace struct {
+	NamespaceName string `json:"namespaceName"`
+}
+
+// BatchChangeStatistics are the number of changesets of a batch change in
+// each state.
+type BatchChangeStatistics struct {
+	Total       int `json:"total"`
+	Unpublished int `json:"unpublished"`
+	Draft       int `json:"draft"`
+	Open        int `json:"open"`
+	Merged      int `json:"merged"`
+	Closed      int `json:"closed"`
+	Deleted     int `json:"deleted"`
+	Archived    int `json:"archived"`
+	Failed      int `json:"failed"`
+	Processing  int `json:"processing"`
+	Retrying    int `json:"retrying"`
+	Scheduled   int `json:"scheduled"`
+}
+
+const ChangesetFieldsFragment = `
+fragment changesetFields on Changeset {
+    __typename
+    id
+    state
+    createdAt
+    updatedAt
+    ... on ExternalChangeset {
+        title
+        externalID
+        externalURL {
+            url
+        }
+        reviewState
+        checkState
+        error
+        repository {
+            name
+        }
+    }
+}
+`
+
+// Changeset is a changeset of a batch change. Changesets in repositories the
+// user can't access are hidden, and only have an ID and a state.
+type Changeset struct {
+	Typename    string               `json:"__typename"`
+	ID          string               `json:"id"`
+	State       string               `json:"state"`
+	CreatedAt   time.Time            `json:"createdAt"`
+	UpdatedAt   time.Time            `json:"updatedAt"`
+	Title       string               `json:"title,omitempty"`
+	ExternalID  string               `json:"externalID,omitempty"`
+	ExternalURL *ExternalURL         `json:"externalURL,omitempty"`
+	ReviewState string               `json:"reviewState,omitempty"`
+	CheckState  string               `json:"checkState,omitempty"`
+	Error       string               `json:"error,omitempty"`
+	Repository  *ChangesetRepository `json:"repository,omitempty"`
+}
+
+// Hidden returns true if the changeset is in a repository the user can't
+// access.
+func (c *Changeset) Hidden() bool {
+	return c.Typename == "HiddenExternalChangeset"
+}
+
+type ExternalURL struct {
+	URL string `json:"url"`
+}
+
+type ChangesetRepository struct {
+	Name string `json:"name"`
+}
+
+type BulkOperation struct {
+	ID    string `json:"id"`
+	State string `json:"state"`
 }
@@ -0,0 +1,475 @@
+// Package lint statically analyzes batch specs for mistakes that the schema
+// validation can't catch, such as references to outputs that no step sets or
+// misspelled template variables.
+package lint
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+
+	"github.com/sourcegraph/sourcegraph/lib/batches/template"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+)
+
+// Severity is the severity of a Finding.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// The rules findings are reported for.
+const (
+	RuleInvalidSpec       = "invalid-spec"
+	RuleTemplateSyntax    = "template-syntax"
+	RuleUndefinedField    = "undefined-field"
+	RuleUndefinedOutput   = "undefined-output"
+	RuleAlwaysEmpty       = "always-empty"
+	RuleUnreachableStep   = "unreachable-step"
+	RuleUnusedOutput      = "unused-output"
+	RuleUnpinnedContainer = "unpinned-container"
+)
+
+// Rules describes the rules, in the order they are listed in.
+var Rules = []struct {
+	ID          string
+	Description string
+}{
+	{RuleInvalidSpec, "The batch spec doesn't pass validation."},
+	{RuleTemplateSyntax, "A template can't be parsed."},
+	{RuleUndefinedField, "A template references a variable or field that doesn't exist where the template is used."},
+	{RuleUndefinedOutput, "A template references an output that no previous step sets."},
+	{RuleAlwaysEmpty, "A template references a value that is always empty where the template is used."},
+	{RuleUnreachableStep, "A step is never executed, since its if condition is always false."},
+	{RuleUnusedOutput, "An output is set by a step but never used."},
+	{RuleUnpinnedContainer, "A container image isn't pinned to a tag or digest."},
+}
+
+// Finding is a problem found in a batch spec.
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	// Path is the location of the finding in the batch spec, e.g.
+	// "steps[0].run".
+	Path string `json:"path,omitempty"`
+	// Line and Column are the position of the finding in the batch spec, or 0
+	// if unknown.
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+// Lint analyzes the given batch spec. The batch spec is expected to be valid
+// and have its step libraries expanded, since only the findings that
+// validation doesn't catch are reported.
+func Lint(data []byte) ([]Finding, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrap(err, "parsing batch spec")
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return nil, errors.New("batch spec must be a mapping")
+	}
+	root := doc.Content[0]
+
+	l := &linter{
+		batchChange: template.BatchChangeAttributes{
+			Name:        scalar(mappingValue(root, "name")),
+			Description: scalar(mappingValue(root, "description")),
+		},
+		stepFields:      template.StepContextFields(),
+		changesetFields: template.ChangesetTemplateContextFields(),
+	}
+
+	outputs := l.lintSteps("steps", mappingValue(root, "steps"), false)
+	if ct := mappingValue(root, "changesetTemplate"); ct != nil {
+		for _, field := range []string{"title", "body", "branch", "commit.message", "commit.author.name", "commit.author.email"} {
+			if n := lookup(ct, field); n != nil {
+				l.checkTemplate(templateScope{step: -1, outputs: outputs}, "changesetTemplate."+field, n)
+			}
+		}
+	}
+	l.reportUnusedOutputs(outputs)
+
+	if hooks := mappingValue(root, "changesetHooks"); hooks != nil && hooks.Kind == yamlv3.MappingNode {
+		for i := 0; i+1 < len(hooks.Content); i += 2 {
+			path := "changesetHooks." + hooks.Content[i].Value + ".steps"
+			l.reportUnusedOutputs(l.lintSteps(path, mappingValue(hooks.Content[i+1], "steps"), true))
+		}
+	}
+
+	sort.SliceStable(l.findings, func(i, j int) bool {
+		a, b := l.findings[i], l.findings[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return l.findings, nil
+}
+
+type linter struct {
+	batchChange     template.BatchChangeAttributes
+	stepFields      map[string][]string
+	changesetFields map[string][]string
+	findings        []Finding
+}
+
+// output is an output set by a step.
+type output struct {
+	step int
+	key  *yamlv3.Node
+	path string
+	used bool
+}
+
+// outputSet contains the outputs set by a list of steps, in the order they
+// are set.
+type outputSet struct {
+	outputs []*output
+}
+
+// before returns the outputs set by the steps before the given step.
+func (s *outputSet) before(step int) []*output {
+	var outputs []*output
+	for _, o := range s.outputs {
+		if o.step < step {
+			outputs = append(outputs, o)
+		}
+	}
+	return outputs
+}
+
+// templateScope describes where a template is used.
+type templateScope struct {
+	// step is the index of the step the template belongs to, or -1 for the
+	// changeset template.
+	step int
+	// inSteps is true for templates of steps, as opposed to the changeset
+	// template.
+	inSteps bool
+	// inOutputs is true for the templates of outputs, which are rendered
+	// after the step ran.
+	inOutputs bool
+	// inHook is true for the steps of changeset hooks.
+	inHook bool
+	// outputs are the outputs the template can reference.
+	outputs *outputSet
+}
+
+// lintSteps lints the given list of steps and returns the outputs they set.
+func (l *linter) lintSteps(path string, steps *yamlv3.Node, inHook bool) *outputSet {
+	outputs := &outputSet{}
+	if steps == nil || steps.Kind != yamlv3.SequenceNode {
+		return outputs
+	}
+
+	for i, step := range steps.Content {
+		if outs := mappingValue(step, "outputs"); outs != nil && outs.Kind == yamlv3.MappingNode {
+			for j := 0; j+1 < len(outs.Content); j += 2 {
+				outputs.outputs = append(outputs.outputs, &output{
+					step: i,
+					key:  outs.Content[j],
+					path: fmt.Sprintf("%s[%d].outputs.%s", path, i, outs.Content[j].Value),
+				})
+			}
+		}
+	}
+
+	for i, step := range steps.Content {
+		stepPath := fmt.Sprintf("%s[%d]", path, i)
+		scope := templateScope{step: i, inSteps: true, inHook: inHook, outputs: outputs}
+
+		for _, field := range []string{"run", "container", "image", "codingAgent.prompt", "buildImage.run"} {
+			if n := lookup(step, field); n != nil {
+				l.checkTemplate(scope, stepPath+"."+field, n)
+			}
+		}
+		if env := mappingValue(step, "env"); env != nil {
+			forEachScalar(env, func(n *yamlv3.Node) {
+				l.checkTemplate(scope, stepPath+".env", n)
+			})
+		}
+		if files := mappingValue(step, "files"); files != nil && files.Kind == yamlv3.MappingNode {
+			for j := 0; j+1 < len(files.Content); j += 2 {
+				l.checkTemplate(scope, stepPath+".files."+files.Content[j].Value, files.Content[j+1])
+			}
+		}
+		if outs := mappingValue(step, "outputs"); outs != nil && outs.Kind == yamlv3.MappingNode {
+			outputScope := scope
+			outputScope.inOutputs = true
+			for j := 0; j+1 < len(outs.Content); j += 2 {
+				if value := mappingValue(outs.Content[j+1], "value"); value != nil {
+					l.checkTemplate(outputScope, stepPath+".outputs."+outs.Content[j].Value+".value", value)
+				}
+			}
+		}
+		if cond := mappingValue(step, "if"); cond != nil {
+			l.checkTemplate(scope, stepPath+".if", cond)
+			l.checkReachable(stepPath, cond)
+		}
+
+		for _, field := range []string{"container", "image"} {
+			if n := mappingValue(step, field); n != nil {
+				l.checkPinned(stepPath+"."+field, n)
+			}
+		}
+	}
+	return outputs
+}
+
+// checkTemplate reports the problems of the template in the given node.
+func (l *linter) checkTemplate(scope templateScope, path string, n *yamlv3.Node) {
+	if n.Kind != yamlv3.ScalarNode || !template.ContainsTemplateAction(n.Value) {
+		return
+	}
+
+	refs, err := template.References(n.Value)
+	if err != nil {
+		l.report(RuleTemplateSyntax, SeverityError, path, n, 0, "invalid template: %s", err)
+		return
+	}
+
+	fields, otherFields, where := l.stepFields, l.changesetFields, "the changeset template"
+	if !scope.inSteps {
+		fields, otherFields, where = l.changesetFields, l.stepFields, "steps"
+	}
+
+	for _, ref := range refs {
+		known, ok := fields[ref.Name]
+		switch {
+		case !ok:
+			if _, ok := otherFields[ref.Name]; ok {
+				l.report(RuleUndefinedField, SeverityError, path, n, ref.Offset, "%s is only available in %s", ref.Name, where)
+			} else {
+				l.report(RuleUndefinedField, SeverityError, path, n, ref.Offset, "unknown template variable %q", ref.Name)
+			}
+			continue
+
+		case ref.Name == "outputs":
+			l.checkOutput(scope, path, n, ref)
+			continue
+
+		case ref.Field != "" && known != nil && !slices.Contains(known, ref.Field):
+			l.report(RuleUndefinedField, SeverityError, path, n, ref.Offset, "%s has no field %q, only %s", ref.Name, ref.Field, strings.Join(known, ", "))
+			continue
+		}
+
+		if !scope.inSteps {
+			continue
+		}
+		name := ref.Name
+		if ref.Field != "" {
+			name += "." + ref.Field
+		}
+		switch {
+		case ref.Name == "step" && !scope.inOutputs:
+			l.report(RuleAlwaysEmpty, SeverityWarning, path, n, ref.Offset, "%s is always empty, since the result of a step is only available in its outputs", name)
+		case ref.Name == "previous_step" && scope.step == 0:
+			l.report(RuleAlwaysEmpty, SeverityWarning, path, n, ref.Offset, "%s is always empty in the first step", name)
+		case ref.Name == "steps" && ref.Field != "path" && scope.step == 0 && !scope.inOutputs:
+			l.report(RuleAlwaysEmpty, SeverityWarning, path, n, ref.Offset, "%s is always empty in the first step, since no step has changed files yet", name)
+		case ref.Name == "event" && !scope.inHook:
+			l.report(RuleAlwaysEmpty, SeverityWarning, path, n, ref.Offset, "%s is always empty outside of changeset hooks", name)
+		}
+	}
+}
+
+// checkOutput reports references to outputs that aren't set before the
+// template is rendered, and marks the outputs that are referenced as used.
+func (l *linter) checkOutput(scope templateScope, path string, n *yamlv3.Node, ref template.Reference) {
+	available := scope.outputs.outputs
+	if scope.inSteps {
+		step := scope.step
+		if scope.inOutputs {
+			// The outputs of a step can reference each other.
+			step++
+		}
+		available = scope.outputs.before(step)
+	}
+
+	if ref.Field == "" {
+		// All outputs are used as a whole.
+		for _, o := range available {
+			o.used = true
+		}
+		return
+	}
+
+	var found bool
+	for _, o := range available {
+		if o.key.Value == ref.Field {
+			o.used = true
+			found = true
+		}
+	}
+	if found {
+		return
+	}
+
+	for _, o := range scope.outputs.outputs {
+		if o.key.Value == ref.Field {
+			l.report(RuleUndefinedOutput, SeverityError, path, n, ref.Offset, "outputs.%s is only set by a later step", ref.Field)
+			return
+		}
+	}
+	if scope.inSteps {
+		l.report(RuleUndefinedOutput, SeverityError, path, n, ref.Offset, "outputs.%s isn't set by any previous step", ref.Field)
+	} else {
+		l.report(RuleUndefinedOutput, SeverityError, path, n, ref.Offset, "outputs.%s isn't set by any step", ref.Field)
+	}
+}
+
+// checkReachable reports steps whose if condition is always false.
+func (l *linter) checkReachable(stepPath string, cond *yamlv3.Node) {
+	if cond.Kind != yamlv3.ScalarNode {
+		return
+	}
+	if cond.Tag == "!!bool" {
+		if cond.Value == "false" {
+			l.report(RuleUnreachableStep, SeverityWarning, stepPath+".if", cond, 0, "the step is never executed, since its if condition is false")
+		}
+		return
+	}
+
+	// Only conditions that solely depend on the batch change can be
+	// evaluated ahead of time. Everything else, like the repository, depends
+	// on the workspace.
+	refs, err := template.References(cond.Value)
+	if err != nil {
+		return
+	}
+	for _, ref := range refs {
+		if ref.Name != "batch_change" {
+			return
+		}
+	}
+	static, value, err := template.IsStaticBool(cond.Value, &template.StepContext{BatchChange: l.batchChange})
+	if err == nil && static && !value {
+		l.report(RuleUnreachableStep, SeverityWarning, stepPath+".if", cond, 0, "the step is never executed, since its if condition is always false")
+	}
+}
+
+// checkPinned reports container images without a tag or digest, or with the
+// latest tag.
+func (l *linter) checkPinned(path string, n *yamlv3.Node) {
+	if n.Kind != yamlv3.ScalarNode || n.Value == "" || template.ContainsTemplateAction(n.Value) {
+		return
+	}
+	image := n.Value
+	if strings.Contains(image, "@") {
+		return
+	}
+	// A colon in the last path component separates the tag, other colons
+	// separate the port of the registry.
+	name := image[strings.LastIndex(image, "/")+1:]
+	_, tag, ok := strings.Cut(name, ":")
+	switch {
+	case !ok:
+		l.report(RuleUnpinnedContainer, SeverityWarning, path, n, 0, "container image %q isn't pinned to a tag or digest", image)
+	case tag == "latest":
+		l.report(RuleUnpinnedContainer, SeverityWarning, path, n, 0, "container image %q uses the latest tag, which can change between executions", image)
+	}
+}
+
+// reportUnusedOutputs reports the outputs that no template references.
+func (l *linter) reportUnusedOutputs(outputs *outputSet) {
+	for _, o := range outputs.outputs {
+		if !o.used {
+			l.report(RuleUnusedOutput, SeverityWarning, o.path, o.key, 0, "output %q is never used", o.key.Value)
+		}
+	}
+}
+
+func (l *linter) report(rule string, severity Severity, path string, n *yamlv3.Node, offset int, format string, args ...any) {
+	line, column := position(n, offset)
+	l.findings = append(l.findings, Finding{
+		Rule:     rule,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+		Path:     path,
+		Line:     line,
+		Column:   column,
+	})
+}
+
+// position returns the line and column of the given offset in the value of
+// the node. The column is 0 if it can't be determined, since the indentation
+// of block scalars isn't known and quoted scalars can contain escapes.
+func position(n *yamlv3.Node, offset int) (line, column int) {
+	if offset > len(n.Value) {
+		offset = len(n.Value)
+	}
+	before := n.Value[:offset]
+	newlines := strings.Count(before, "\n")
+
+	switch n.Style {
+	case yamlv3.LiteralStyle:
+		// The value starts on the line after the block indicator.
+		return n.Line + 1 + newlines, 0
+	case yamlv3.FoldedStyle:
+		return n.Line + 1, 0
+	case yamlv3.DoubleQuotedStyle, yamlv3.SingleQuotedStyle:
+		if newlines == 0 && !strings.ContainsAny(before, `"'\`) {
+			return n.Line, n.Column + 1 + offset
+		}
+		return n.Line, n.Column
+	default:
+		if newlines == 0 {
+			return n.Line, n.Column + offset
+		}
+		return n.Line, n.Column
+	}
+}
+
+// lookup returns the value at the dot-separated path in the given mapping
+// node, or nil.
+func lookup(n *yamlv3.Node, path string) *yamlv3.Node {
+	for _, key := range strings.Split(path, ".") {
+		if n = mappingValue(n, key); n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// mappingValue returns the value of the key in the given mapping node, or nil.
+func mappingValue(n *yamlv3.Node, key string) *yamlv3.Node {
+	if n == nil || n.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// forEachScalar calls fn for every scalar value in the given node.
+func forEachScalar(n *yamlv3.Node, fn func(*yamlv3.Node)) {
+	switch n.Kind {
+	case yamlv3.ScalarNode:
+		fn(n)
+	case yamlv3.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			forEachScalar(n.Content[i], fn)
+		}
+	default:
+		for _, c := range n.Content {
+			forEachScalar(c, fn)
+		}
+	}
+}
+
+func scalar(n *yamlv3.Node) string {
+	if n == nil || n.Kind != yamlv3.ScalarNode {
+		return ""
+	}
+	return n.Value
+}
@@ -0,0 +1,216 @@
+package lint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(t *testing.T) {
+	for name, tc := range map[string]struct {
+		spec string
+		want []Finding
+	}{
+		"no findings": {
+			spec: `name: test
+steps:
+  - run: echo ${{ repository.name }} > README.md
+    container: alpine:3
+    outputs:
+      greeting:
+        value: ${{ step.stdout }}
+  - run: echo ${{ outputs.greeting }} ${{ previous_step.stdout }} ${{ join steps.modified_files " " }}
+    container: alpine@sha256:1234
+changesetTemplate:
+  title: ${{ batch_change_link }}
+  body: ${{ index outputs "greeting" }}
+  branch: test
+  commit:
+    message: test
+`,
+		},
+		"undefined fields": {
+			spec: `name: test
+steps:
+  - run: echo ${{ repository.nmae }} ${{ repositry.name }}
+    container: alpine:3
+changesetTemplate:
+  title: ${{ previous_step.stdout }}
+  body: test
+  branch: ${{ batch_change.name }}
+  commit:
+    message: test
+`,
+			want: []Finding{
+				{Rule: RuleUndefinedField, Severity: SeverityError, Path: "steps[0].run", Line: 3, Column: 19, Message: `repository has no field "nmae", only branch, name, search_result_paths`},
+				{Rule: RuleUndefinedField, Severity: SeverityError, Path: "steps[0].run", Line: 3, Column: 42, Message: `unknown template variable "repositry"`},
+				{Rule: RuleUndefinedField, Severity: SeverityError, Path: "changesetTemplate.title", Line: 6, Column: 14, Message: "previous_step is only available in steps"},
+			},
+		},
+		"outputs": {
+			spec: `name: test
+steps:
+  - run: |
+      echo ${{ outputs.later }}
+      echo ${{ outputs.missing }}
+    container: alpine:3
+    outputs:
+      unused:
+        value: test
+  - run: echo
+    container: alpine:3
+    outputs:
+      later:
+        value: test
+changesetTemplate:
+  title: ${{ outputs.later }}
+  body: ${{ outputs.nope }}
+  branch: test
+  commit:
+    message: test
+`,
+			want: []Finding{
+				{Rule: RuleUndefinedOutput, Severity: SeverityError, Path: "steps[0].run", Line: 4, Message: "outputs.later is only set by a later step"},
+				{Rule: RuleUndefinedOutput, Severity: SeverityError, Path: "steps[0].run", Line: 5, Message: "outputs.missing isn't set by any previous step"},
+				{Rule: RuleUnusedOutput, Severity: SeverityWarning, Path: "steps[0].outputs.unused", Line: 8, Column: 7, Message: `output "unused" is never used`},
+				{Rule: RuleUndefinedOutput, Severity: SeverityError, Path: "changesetTemplate.body", Line: 17, Column: 13, Message: "outputs.nope isn't set by any step"},
+			},
+		},
+		"always empty": {
+			spec: `name: test
+steps:
+  - run: echo ${{ steps.modified_files }} ${{ steps.path }}
+    container: alpine:3
+    if: ${{ previous_step.stdout }}
+  - run: echo ${{ step.stdout }} ${{ event.name }}
+    container: alpine:3
+changesetTemplate:
+  title: test
+  body: test
+  branch: test
+  commit:
+    message: test
+`,
+			want: []Finding{
+				{Rule: RuleAlwaysEmpty, Severity: SeverityWarning, Path: "steps[0].run", Line: 3, Column: 19, Message: "steps.modified_files is always empty in the first step, since no step has changed files yet"},
+				{Rule: RuleAlwaysEmpty, Severity: SeverityWarning, Path: "steps[0].if", Line: 5, Column: 13, Message: "previous_step.stdout is always empty in the first step"},
+				{Rule: RuleAlwaysEmpty, Severity: SeverityWarning, Path: "steps[1].run", Line: 6, Column: 19, Message: "step.stdout is always empty, since the result of a step is only available in its outputs"},
+				{Rule: RuleAlwaysEmpty, Severity: SeverityWarning, Path: "steps[1].run", Line: 6, Column: 38, Message: "event.name is always empty outside of changeset hooks"},
+			},
+		},
+		"unreachable steps": {
+			spec: `name: test
+steps:
+  - run: echo
+    container: alpine:3
+    if: false
+  - run: echo
+    container: alpine:3
+    if: ${{ eq batch_change.name "other" }}
+  - run: echo
+    container: alpine:3
+    if: ${{ eq repository.name "other" }}
+changesetTemplate:
+  title: test
+  body: test
+  branch: test
+  commit:
+    message: test
+`,
+			want: []Finding{
+				{Rule: RuleUnreachableStep, Severity: SeverityWarning, Path: "steps[0].if", Line: 5, Column: 9, Message: "the step is never executed, since its if condition is false"},
+				{Rule: RuleUnreachableStep, Severity: SeverityWarning, Path: "steps[1].if", Line: 8, Column: 9, Message: "the step is never executed, since its if condition is always false"},
+			},
+		},
+		"unpinned containers": {
+			spec: `name: test
+steps:
+  - run: echo
+    container: alpine
+  - run: echo
+    container: registry.example.com:5000/alpine:latest
+  - run: echo
+    container: registry.example.com:5000/alpine
+  - run: echo
+    container: ${{ repository.name }}
+changesetTemplate:
+  title: test
+  body: test
+  branch: test
+  commit:
+    message: test
+`,
+			want: []Finding{
+				{Rule: RuleUnpinnedContainer, Severity: SeverityWarning, Path: "steps[0].container", Line: 4, Column: 16, Message: `container image "alpine" isn't pinned to a tag or digest`},
+				{Rule: RuleUnpinnedContainer, Severity: SeverityWarning, Path: "steps[1].container", Line: 6, Column: 16, Message: `container image "registry.example.com:5000/alpine:latest" uses the latest tag, which can change between executions`},
+				{Rule: RuleUnpinnedContainer, Severity: SeverityWarning, Path: "steps[2].container", Line: 8, Column: 16, Message: `container image "registry.example.com:5000/alpine" isn't pinned to a tag or digest`},
+			},
+		},
+		"hooks": {
+			spec: `name: test
+version: 3
+steps: []
+changesetHooks:
+  onCIFailure:
+    steps:
+      - run: echo ${{ event.payload }} ${{ outputs.main }}
+        image: alpine:3
+`,
+			want: []Finding{
+				{Rule: RuleUndefinedOutput, Severity: SeverityError, Path: "changesetHooks.onCIFailure.steps[0].run", Line: 7, Column: 44, Message: "outputs.main isn't set by any previous step"},
+			},
+		},
+		"syntax error": {
+			spec: `name: test
+steps:
+  - run: echo ${{ repository.name }
+    container: alpine:3
+changesetTemplate:
+  title: test
+  body: test
+  branch: test
+  commit:
+    message: test
+`,
+			want: []Finding{
+				{Rule: RuleTemplateSyntax, Severity: SeverityError, Path: "steps[0].run", Line: 3, Column: 10, Message: `invalid template: template: references:1: unexpected "}" in operand`},
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			findings, err := Lint([]byte(tc.spec))
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, findings)
+		})
+	}
+}
+
+func TestSARIF(t *testing.T) {
+	log := SARIF("batch.yaml", []Finding{
+		{Rule: RuleUnusedOutput, Severity: SeverityWarning, Path: "steps[0].outputs.foo", Line: 3, Column: 7, Message: `output "foo" is never used`},
+		{Rule: RuleInvalidSpec, Severity: SeverityError, Message: "invalid"},
+	})
+
+	require.Len(t, log.Runs, 1)
+	assert.Len(t, log.Runs[0].Tool.Driver.Rules, len(Rules))
+	assert.Equal(t, []sarifResult{
+		{
+			RuleID:  RuleUnusedOutput,
+			Level:   "warning",
+			Message: sarifMessage{Text: `steps[0].outputs.foo: output "foo" is never used`},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: "batch.yaml"},
+				Region:           &sarifRegion{StartLine: 3, StartColumn: 7},
+			}}},
+		},
+		{
+			RuleID:  RuleInvalidSpec,
+			Level:   "error",
+			Message: sarifMessage{Text: "invalid"},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: "batch.yaml"},
+			}}},
+		},
+	}, log.Runs[0].Results)
+}
@@ -0,0 +1,95 @@
+package lint
+
+// SARIFLog is a log in the Static Analysis Results Interchange Format 2.1.0,
+// which code scanning tools can import. Only the parts used for findings are
+// modelled.
+type SARIFLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// SARIF returns the findings in the batch spec file with the given URI as a
+// SARIF log.
+func SARIF(uri string, findings []Finding) *SARIFLog {
+	driver := sarifDriver{
+		Name:           "src batch lint",
+		InformationURI: "https://github.com/sourcegraph/src-cli",
+	}
+	for _, rule := range Rules {
+		driver.Rules = append(driver.Rules, sarifRule{ID: rule.ID, ShortDescription: sarifMessage{Text: rule.Description}})
+	}
+
+	results := []sarifResult{}
+	for _, f := range findings {
+		message := f.Message
+		if f.Path != "" {
+			message = f.Path + ": " + message
+		}
+		location := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: uri}}
+		if f.Line > 0 {
+			location.Region = &sarifRegion{StartLine: f.Line, StartColumn: f.Column}
+		}
+		results = append(results, sarifResult{
+			RuleID:    f.Rule,
+			Level:     string(f.Severity),
+			Message:   sarifMessage{Text: message},
+			Locations: []sarifLocation{{PhysicalLocation: location}},
+		})
+	}
+
+	return &SARIFLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	}
+}
@@ -0,0 +1,274 @@
+// Package migrate rewrites batch specs of older versions to the latest
+// version.
+//
+// The rewrite works on the YAML nodes of the batch spec, but edits the source
+// text at the positions of the nodes instead of encoding the nodes again, so
+// that comments, blank lines, quoting, and the order of fields are preserved.
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+
+	yamlv3 "gopkg.in/yaml.v3"
+
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+)
+
+// LatestVersion is the batch spec version specs are migrated to.
+const LatestVersion = 3
+
+// Change is a change made to a batch spec, or a construct that can't be
+// migrated.
+type Change struct {
+	// Path is the location of the change in the batch spec, e.g.
+	// "steps[0].container".
+	Path string `json:"path"`
+	// Line is the line of the change in the original batch spec, or 0 if
+	// unknown.
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// Result is the result of migrating a batch spec.
+type Result struct {
+	// FromVersion is the version of the original batch spec.
+	FromVersion int `json:"fromVersion"`
+	// Spec is the migrated batch spec. It's nil if there are Unsupported
+	// constructs.
+	Spec []byte `json:"-"`
+	// Changes explains the changes made to the batch spec.
+	Changes []Change `json:"changes"`
+	// Unsupported are the constructs of the batch spec that have no
+	// equivalent in the latest version, and have to be migrated by hand.
+	Unsupported []Change `json:"unsupported"`
+}
+
+// Migrate rewrites the given batch spec to the LatestVersion. A batch spec
+// that's already at the latest version is returned as it is.
+func Migrate(data []byte) (*Result, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrap(err, "parsing batch spec")
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return nil, errors.New("batch spec must be a mapping")
+	}
+	root := doc.Content[0]
+	if root.Style&yamlv3.FlowStyle != 0 {
+		return nil, errors.New("batch specs in flow style, such as JSON, can't be migrated")
+	}
+
+	m := &migrator{src: newSource(data), result: &Result{FromVersion: 1}}
+
+	versionKey, version := mappingValue(root, "version")
+	if version != nil {
+		v, err := strconv.Atoi(version.Value)
+		if err != nil || v < 1 || v > LatestVersion {
+			return nil, errors.Newf("line %d: unknown batch spec version %q", version.Line, version.Value)
+		}
+		m.result.FromVersion = v
+	}
+	if m.result.FromVersion == LatestVersion {
+		m.result.Spec = data
+		return m.result, nil
+	}
+
+	if version != nil {
+		m.src.replaceScalar(version, strconv.Itoa(LatestVersion))
+		m.change("version", versionKey, "set version to %d", LatestVersion)
+	} else {
+		m.src.insertLine(root.Content[0].Line, fmt.Sprintf("version: %d", LatestVersion))
+		m.change("version", nil, "added version: %d, since batch specs without a version are version 1", LatestVersion)
+	}
+
+	if _, steps := mappingValue(root, "steps"); steps != nil && steps.Kind == yamlv3.SequenceNode {
+		m.migrateSteps("steps", steps)
+	}
+	if _, tmpl := mappingValue(root, "changesetTemplate"); tmpl != nil && tmpl.Kind == yamlv3.MappingNode {
+		m.migrateChangesetTemplate(tmpl)
+	}
+
+	if len(m.result.Unsupported) > 0 {
+		return m.result, nil
+	}
+	m.result.Spec = m.src.apply()
+	return m.result, nil
+}
+
+type migrator struct {
+	src    *source
+	result *Result
+}
+
+func (m *migrator) change(path string, n *yamlv3.Node, format string, args ...any) {
+	m.result.Changes = append(m.result.Changes, Change{Path: path, Line: line(n), Message: fmt.Sprintf(format, args...)})
+}
+
+func (m *migrator) unsupported(path string, n *yamlv3.Node, format string, args ...any) {
+	m.result.Unsupported = append(m.result.Unsupported, Change{Path: path, Line: line(n), Message: fmt.Sprintf(format, args...)})
+}
+
+// migrateSteps renames the container field of steps to image.
+func (m *migrator) migrateSteps(path string, steps *yamlv3.Node) {
+	if steps.Style&yamlv3.FlowStyle != 0 {
+		m.unsupported(path, steps, "steps in flow style can't be migrated, rewrite them in block style first")
+		return
+	}
+	for i, step := range steps.Content {
+		stepPath := fmt.Sprintf("%s[%d]", path, i)
+		if step.Kind != yamlv3.MappingNode {
+			continue
+		}
+		if step.Style&yamlv3.FlowStyle != 0 {
+			m.unsupported(stepPath, step, "steps in flow style can't be migrated, rewrite them in block style first")
+			continue
+		}
+
+		if includeKey, include := mappingValue(step, "include"); include != nil {
+			m.change(stepPath+".include", includeKey, "the included step library %s has to use image instead of container, too", include.Value)
+			continue
+		}
+
+		containerKey, container := mappingValue(step, "container")
+		if container == nil {
+			continue
+		}
+		if imageKey, image := mappingValue(step, "image"); image != nil {
+			if image.Value != container.Value {
+				m.unsupported(stepPath+".container", containerKey, "the step has both container %q and image %q, remove one of them", container.Value, image.Value)
+				continue
+			}
+			if step.Content[0] != containerKey {
+				m.src.deleteLine(containerKey.Line)
+				m.change(stepPath+".container", containerKey, "removed container, since image is the same")
+				continue
+			}
+			// The first field shares its line with the dash of the sequence
+			// item, so the line of image is removed instead.
+			m.src.deleteLine(imageKey.Line)
+		}
+		m.src.replaceScalar(containerKey, "image")
+		m.change(stepPath+".container", containerKey, "renamed container to image")
+	}
+}
+
+// migrateChangesetTemplate removes changesetTemplate.published, which
+// version 3 doesn't support.
+func (m *migrator) migrateChangesetTemplate(tmpl *yamlv3.Node) {
+	publishedKey, published := mappingValue(tmpl, "published")
+	if published == nil {
+		return
+	}
+	// Changesets are unpublished until they are published explicitly in
+	// version 3, so unpublished changesets need no equivalent.
+	if tmpl.Style&yamlv3.FlowStyle == 0 && published.Kind == yamlv3.ScalarNode && (published.Tag == "!!null" || (published.Tag == "!!bool" && published.Value == "false")) {
+		m.src.deleteLine(publishedKey.Line)
+		m.change("changesetTemplate.published", publishedKey, "removed published: %s, since changesets are unpublished until they are published in version 3", published.Value)
+		return
+	}
+	m.unsupported("changesetTemplate.published", publishedKey,
+		"published has no equivalent in version 3: remove it, and publish the changesets after applying the batch spec with 'src batch publish' or the publish_changesets tool")
+}
+
+// mappingValue returns the key and value nodes of the given key in the
+// mapping, or nils if the mapping doesn't contain the key.
+func mappingValue(mapping *yamlv3.Node, key string) (*yamlv3.Node, *yamlv3.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i], mapping.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+func line(n *yamlv3.Node) int {
+	if n == nil {
+		return 0
+	}
+	return n.Line
+}
+
+// source is the text of a batch spec, with the edits to apply to it.
+type source struct {
+	data []byte
+	// lines are the offsets at which the lines start.
+	lines []int
+	edits []edit
+}
+
+// edit replaces the text between start and end with text.
+type edit struct {
+	start, end int
+	text       string
+}
+
+func newSource(data []byte) *source {
+	s := &source{data: data, lines: []int{0}}
+	for i, b := range data {
+		if b == '\n' {
+			s.lines = append(s.lines, i+1)
+		}
+	}
+	return s
+}
+
+// offset returns the offset of the given 1-based line and column, which
+// yaml.v3 counts in runes.
+func (s *source) offset(line, column int) int {
+	start := s.lines[line-1]
+	return start + len(string([]rune(string(s.lineText(line)))[:column-1]))
+}
+
+func (s *source) lineText(line int) []byte {
+	start := s.lines[line-1]
+	end := len(s.data)
+	if line < len(s.lines) {
+		end = s.lines[line] - 1
+	}
+	return bytes.TrimSuffix(s.data[start:end], []byte("\r"))
+}
+
+// replaceScalar replaces the text of a single-line scalar node, keeping its
+// quotes.
+func (s *source) replaceScalar(n *yamlv3.Node, value string) {
+	start := s.offset(n.Line, n.Column)
+	length := len(n.Value)
+	if n.Style&(yamlv3.DoubleQuotedStyle|yamlv3.SingleQuotedStyle) != 0 {
+		start++
+	}
+	s.edits = append(s.edits, edit{start: start, end: start + length, text: value})
+}
+
+// insertLine inserts a line before the given line.
+func (s *source) insertLine(line int, text string) {
+	start := s.lines[line-1]
+	s.edits = append(s.edits, edit{start: start, end: start, text: text + "\n"})
+}
+
+// deleteLine deletes the given line, including its line break.
+func (s *source) deleteLine(line int) {
+	start := s.lines[line-1]
+	end := len(s.data)
+	if line < len(s.lines) {
+		end = s.lines[line]
+	}
+	s.edits = append(s.edits, edit{start: start, end: end})
+}
+
+// apply returns the text with all edits applied. Edits must not overlap.
+func (s *source) apply() []byte {
+	sort.SliceStable(s.edits, func(i, j int) bool { return s.edits[i].start < s.edits[j].start })
+
+	var out bytes.Buffer
+	prev := 0
+	for _, e := range s.edits {
+		out.Write(s.data[prev:e.start])
+		out.WriteString(e.text)
+		prev = e.end
+	}
+	out.Write(s.data[prev:])
+	return out.Bytes()
+}
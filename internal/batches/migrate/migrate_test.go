@@ -0,0 +1,162 @@
+package migrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	for name, tc := range map[string]struct {
+		spec            string
+		wantSpec        string
+		wantVersion     int
+		wantChanges     []Change
+		wantUnsupported []Change
+	}{
+		"version 1": {
+			spec: `# Adds Hello World to READMEs.
+name: hello-world
+description: Add Hello World to READMEs
+
+on:
+  - repositoriesMatchingQuery: file:README.md
+
+steps:
+  # Append to the README.
+  - run: echo Hello World | tee -a $(find -name README.md)
+    container: alpine:3 # pinned
+  - container: "alpine:3"
+    run: echo
+
+changesetTemplate:
+  title: Hello World
+  body: My first batch change!
+  branch: hello-world
+  commit:
+    message: Append Hello World to all README.md files
+  published: false
+`,
+			wantSpec: `# Adds Hello World to READMEs.
+version: 3
+name: hello-world
+description: Add Hello World to READMEs
+
+on:
+  - repositoriesMatchingQuery: file:README.md
+
+steps:
+  # Append to the README.
+  - run: echo Hello World | tee -a $(find -name README.md)
+    image: alpine:3 # pinned
+  - image: "alpine:3"
+    run: echo
+
+changesetTemplate:
+  title: Hello World
+  body: My first batch change!
+  branch: hello-world
+  commit:
+    message: Append Hello World to all README.md files
+`,
+			wantVersion: 1,
+			wantChanges: []Change{
+				{Path: "version", Message: "added version: 3, since batch specs without a version are version 1"},
+				{Path: "steps[0].container", Line: 11, Message: "renamed container to image"},
+				{Path: "steps[1].container", Line: 12, Message: "renamed container to image"},
+				{Path: "changesetTemplate.published", Line: 21, Message: "removed published: false, since changesets are unpublished until they are published in version 3"},
+			},
+		},
+		"version 2": {
+			spec: `version: 2
+name: test
+steps:
+- run: echo
+  container: alpine:3
+  image: alpine:3
+- container: alpine:3
+  image: alpine:3
+  run: echo
+- include: ./lib.yaml
+`,
+			wantSpec: `version: 3
+name: test
+steps:
+- run: echo
+  image: alpine:3
+- image: alpine:3
+  run: echo
+- include: ./lib.yaml
+`,
+			wantVersion: 2,
+			wantChanges: []Change{
+				{Path: "version", Line: 1, Message: "set version to 3"},
+				{Path: "steps[0].container", Line: 5, Message: "removed container, since image is the same"},
+				{Path: "steps[1].container", Line: 7, Message: "renamed container to image"},
+				{Path: "steps[2].include", Line: 10, Message: "the included step library ./lib.yaml has to use image instead of container, too"},
+			},
+		},
+		"version 3": {
+			spec: `version: 3
+name: test
+`,
+			wantSpec: `version: 3
+name: test
+`,
+			wantVersion: 3,
+		},
+		"unsupported": {
+			spec: `version: 2
+name: test
+steps:
+  - run: echo
+    container: alpine:3
+    image: ubuntu:22.04
+changesetTemplate:
+  title: test
+  body: test
+  branch: test
+  commit:
+    message: test
+  published:
+    - github.com/sourcegraph/*: draft
+`,
+			wantVersion: 2,
+			wantChanges: []Change{
+				{Path: "version", Line: 1, Message: "set version to 3"},
+			},
+			wantUnsupported: []Change{
+				{Path: "steps[0].container", Line: 5, Message: `the step has both container "alpine:3" and image "ubuntu:22.04", remove one of them`},
+				{Path: "changesetTemplate.published", Line: 13, Message: "published has no equivalent in version 3: remove it, and publish the changesets after applying the batch spec with 'src batch publish' or the publish_changesets tool"},
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			result, err := Migrate([]byte(tc.spec))
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.wantVersion, result.FromVersion)
+			assert.Equal(t, tc.wantChanges, result.Changes)
+			assert.Equal(t, tc.wantUnsupported, result.Unsupported)
+			if tc.wantSpec == "" {
+				assert.Nil(t, result.Spec)
+			} else {
+				assert.Equal(t, tc.wantSpec, string(result.Spec))
+			}
+		})
+	}
+}
+
+func TestMigrate_Errors(t *testing.T) {
+	for name, spec := range map[string]string{
+		"not a mapping":   `- name: test`,
+		"flow style":      `{"name": "test", "version": 2}`,
+		"unknown version": `version: 4`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Migrate([]byte(spec))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -17,3 +17,16 @@ func (c *ImageCache) Ensure(ctx context.Context, name string) (docker.Image, err
 	img := c.Images[name]
 	return img, img.Ensure(ctx)
 }
+func (c *ImageCache) Build(ctx context.Context, baseImage, script string) (string, docker.Image, error) {
+	base, err := c.Ensure(ctx, baseImage)
+	if err != nil {
+		return "", nil, err
+	}
+	digest, err := base.Digest(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	name := docker.BuiltImageName(digest, script)
+	img, err := c.Ensure(ctx, name)
+	return name, img, err
+}
@@ -0,0 +1,79 @@
+package mock
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// CacheServer is an in-memory stand-in for a content addressed HTTP store, as
+// used by the remote execution cache. It stores the bodies of PUT requests by
+// their path, returns them for GET requests and removes them for DELETE
+// requests.
+type CacheServer struct {
+	mu      sync.Mutex
+	Entries map[string][]byte
+	// Gets and Puts count the requests served.
+	Gets int
+	Puts int
+}
+
+var _ http.Handler = &CacheServer{}
+
+func (s *CacheServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Entries == nil {
+		s.Entries = make(map[string][]byte)
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.Gets++
+		entry, ok := s.Entries[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(entry)
+	case http.MethodPut:
+		s.Puts++
+		entry, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.Entries[r.URL.Path] = entry
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		if _, ok := s.Entries[r.URL.Path]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		delete(s.Entries, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Entry returns the entry stored at the given path.
+func (s *CacheServer) Entry(path string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.Entries[path]
+	return entry, ok
+}
+
+// SetEntry replaces the entry stored at the given path.
+func (s *CacheServer) SetEntry(path string, entry []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Entries == nil {
+		s.Entries = make(map[string][]byte)
+	}
+	s.Entries[path] = entry
+}
@@ -0,0 +1,175 @@
+package mock
+
+import (
+	"context"
+	"os"
+	goexec "os/exec"
+	"strings"
+	"sync"
+
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/src-cli/internal/batches/docker"
+)
+
+// ContainerRuntime is a fake docker.ContainerRuntime that doesn't need a
+// container daemon. It runs the scripts of step containers directly on the
+// host, in the directory of the bind workspace, so it can only be used with
+// bind workspaces and step scripts that work on the host.
+type ContainerRuntime struct {
+	// Images maps image names to their digests. Pulling an image that is not
+	// in Images fails.
+	Images map[string]string
+
+	mu sync.Mutex
+	// Pulled and Committed record the images that were pulled and committed.
+	Pulled    []string
+	Committed []string
+	// Ran records the arguments of all containers that were run.
+	Ran [][]string
+
+	// OOMKilled is returned by ContainerOOMKilled for all containers.
+	OOMKilled bool
+}
+
+// fakeContainerID is the ID written to the cidfile of containers.
+const fakeContainerID = "fake-container"
+
+var _ docker.ContainerRuntime = &ContainerRuntime{}
+
+// fakeContainerTemp is the path the fake runtime claims mktemp returned in the
+// container. The step script is mounted there.
+const fakeContainerTemp = "/tmp/fake-runtime-script"
+
+// fakeWorkDir is the path the workspace is mounted to in the container.
+const fakeWorkDir = "/work"
+
+func (rt *ContainerRuntime) Name() string { return "fake" }
+
+func (rt *ContainerRuntime) CheckVersion(ctx context.Context) error { return nil }
+
+func (rt *ContainerRuntime) CurrentContext(ctx context.Context) (string, error) { return "", nil }
+
+func (rt *ContainerRuntime) NCPU(ctx context.Context) (int, error) { return 1, nil }
+
+func (rt *ContainerRuntime) InspectImage(ctx context.Context, name string) (string, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	for _, pulled := range append(rt.Pulled, rt.Committed...) {
+		if pulled == name {
+			return rt.digest(name), nil
+		}
+	}
+	return "", errors.Newf("image %q not found", name)
+}
+
+func (rt *ContainerRuntime) PullImage(ctx context.Context, name string) error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if _, ok := rt.Images[name]; !ok {
+		return errors.Newf("image %q not found in registry", name)
+	}
+	rt.Pulled = append(rt.Pulled, name)
+	return nil
+}
+
+func (rt *ContainerRuntime) CommitImage(ctx context.Context, digest, script, name string) error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	rt.Committed = append(rt.Committed, name)
+	return nil
+}
+
+// Run returns a command that behaves like the given container would. Shell
+// probes print a fake temporary file and step scripts are executed with bash
+// in the working directory set on the command by the caller.
+func (rt *ContainerRuntime) Run(ctx context.Context, args ...string) (*goexec.Cmd, error) {
+	if len(args) == 0 {
+		return nil, errors.New("fake runtime: no arguments given to run")
+	}
+
+	rt.mu.Lock()
+	rt.Ran = append(rt.Ran, args)
+	rt.mu.Unlock()
+
+	var (
+		workdir string
+		env     []string
+		mounts  = make(map[string]string)
+	)
+	for i := 0; i < len(args)-1; i++ {
+		switch args[i] {
+		case "--workdir":
+			workdir = args[i+1]
+		case "-e":
+			env = append(env, args[i+1])
+		case "--cidfile":
+			if err := os.WriteFile(args[i+1], []byte(fakeContainerID), 0o600); err != nil {
+				return nil, errors.Wrap(err, "fake runtime: writing cidfile")
+			}
+		case "--mount":
+			// We only care about bind mounts of the form
+			// type=bind,source=SOURCE,target=TARGET,ro.
+			var source, target string
+			for _, field := range strings.Split(args[i+1], ",") {
+				if k, v, ok := strings.Cut(field, "="); ok {
+					switch k {
+					case "source":
+						source = v
+					case "target":
+						target = v
+					}
+				}
+			}
+			mounts[target] = source
+		}
+	}
+
+	switch last := args[len(args)-1]; last {
+	case "mktemp":
+		return goexec.CommandContext(ctx, "echo", fakeContainerTemp), nil
+	case fakeContainerTemp:
+		script, ok := mounts[fakeContainerTemp]
+		if !ok {
+			return nil, errors.New("fake runtime: script not mounted")
+		}
+		dir := strings.TrimPrefix(strings.TrimPrefix(workdir, fakeWorkDir), "/")
+		if dir == "" {
+			dir = "."
+		}
+		// The command is run in the workspace directory, so we only need to
+		// change into the step's subdirectory.
+		cmd := goexec.CommandContext(ctx, "bash", "-c", `cd "$1" && exec bash "$2"`, "bash", dir, script)
+		cmd.Env = append(os.Environ(), env...)
+		return cmd, nil
+	default:
+		return nil, errors.Newf("fake runtime: unknown container command %q", last)
+	}
+}
+
+func (rt *ContainerRuntime) RemoveContainer(ctx context.Context, id string) error { return nil }
+
+func (rt *ContainerRuntime) ContainerOOMKilled(ctx context.Context, id string) (bool, error) {
+	if id != fakeContainerID {
+		return false, errors.Newf("container %q not found", id)
+	}
+	return rt.OOMKilled, nil
+}
+
+func (rt *ContainerRuntime) CreateVolume(ctx context.Context) (string, error) {
+	return "", errors.New("volumes are not supported by the fake runtime")
+}
+
+func (rt *ContainerRuntime) RemoveVolume(ctx context.Context, name string) error {
+	return errors.New("volumes are not supported by the fake runtime")
+}
+
+func (rt *ContainerRuntime) digest(name string) string {
+	if digest, ok := rt.Images[name]; ok {
+		return digest
+	}
+	return "sha256:" + name
+}
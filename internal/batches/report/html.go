@@ -0,0 +1,84 @@
+package report
+
+import (
+	"html/template"
+	"io"
+	"time"
+)
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"duration": func(d time.Duration) string { return d.Round(time.Millisecond).String() },
+	"step":     stepSummary,
+	"time":     func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+	"statusClass": func(s Status) string {
+		if s == StatusNotRun {
+			return "not-run"
+		}
+		return string(s)
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Batch spec execution report</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #24292f; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #d0d7de; padding: 0.4em 0.6em; text-align: left; vertical-align: top; }
+pre { background: #f6f8fa; padding: 0.6em; overflow-x: auto; margin: 0.4em 0; }
+ul { margin: 0; padding-left: 1.2em; }
+.passed { color: #1a7f37; }
+.failed { color: #cf222e; }
+.not-run { color: #6e7781; }
+</style>
+</head>
+<body>
+<h1>Batch spec execution report</h1>
+<p>
+{{- if not .Started.IsZero }}Started {{ time .Started }}, took {{ duration .Duration }}. {{ end -}}
+{{ len .Workspaces }} workspaces executed, {{ .Failures }} failed
+{{- if .NotRun }}, {{ .NotRun }} not run{{ end -}}
+{{- if .CachedChangesetSpecs }}; {{ .CachedChangesetSpecs }} changeset specs were cached{{ end }}.
+{{- if .PreviewURL }} <a href="{{ .PreviewURL }}">Preview the changeset specs</a>.{{ end }}
+{{- if .RunID }} Run ID: <code>{{ .RunID }}</code>.{{ end }}
+</p>
+{{- if .Error }}
+<pre class="failed">{{ .Error }}</pre>
+{{- end }}
+<table>
+<thead>
+<tr><th>Workspace</th><th>Status</th><th>Duration</th><th>Steps</th><th>Diff</th><th>Changeset specs</th></tr>
+</thead>
+<tbody>
+{{- range .Workspaces }}
+<tr>
+<td>{{ .Name }}</td>
+<td class="{{ statusClass .Status }}">{{ .Status }}</td>
+<td>{{ duration .Duration }}</td>
+<td><ul>
+{{- range .Steps }}
+<li>Step {{ .Number }}: {{ step . }}
+{{- if .Error }}<pre>{{ .Error }}
+{{- range .StderrTail }}
+{{ . }}
+{{- end }}</pre>{{ end -}}
+</li>
+{{- end }}
+</ul>
+{{- if and .Error (eq (len .Steps) 0) }}<pre>{{ .Error }}</pre>{{ end -}}
+</td>
+<td>{{ if .Diff.Files }}{{ .Diff }}{{ end }}</td>
+<td>{{ if and .ChangesetSpecs $.PreviewURL }}built, <a href="{{ $.PreviewURL }}">listed in the preview</a>{{ else if .ChangesetSpecs }}built{{ end }}</td>
+</tr>
+{{- end }}
+</tbody>
+</table>
+</body>
+</html>
+`))
+
+// WriteHTML writes the report as a self-contained HTML page with a row for
+// every workspace.
+func WriteHTML(w io.Writer, r *Report) error {
+	return htmlTemplate.Execute(w, r)
+}
@@ -0,0 +1,216 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+)
+
+// junitSuiteName is the name of the test suite of the workspaces.
+const junitSuiteName = "src batch"
+
+// junitRunIDProperty is the name of the property of the test suite with the ID
+// of the execution.
+const junitRunIDProperty = "runID"
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr,omitempty"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitTestCase `xml:"testcase"`
+	SystemErr  string          `xml:"system-err,omitempty"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// WriteJUnit writes the report as JUnit XML. Every workspace is a test case
+// of a single test suite, with the timings of its steps and its diff
+// statistics as output, and the errors and standard error of its failed
+// steps as failure.
+func WriteJUnit(w io.Writer, r *Report) error {
+	suite := junitTestSuite{
+		Name:     junitSuiteName,
+		Tests:    len(r.Workspaces),
+		Failures: r.Failures(),
+		Skipped:  r.NotRun(),
+		Time:     junitTime(r.Duration()),
+		Properties: []junitProperty{
+			{Name: "cachedChangesetSpecs", Value: fmt.Sprint(r.CachedChangesetSpecs)},
+		},
+		SystemErr: r.Error,
+	}
+	if !r.Started.IsZero() {
+		suite.Timestamp = r.Started.UTC().Format(time.RFC3339)
+	}
+	if r.PreviewURL != "" {
+		suite.Properties = append(suite.Properties, junitProperty{Name: "previewURL", Value: r.PreviewURL})
+	}
+	if r.RunID != "" {
+		suite.Properties = append(suite.Properties, junitProperty{Name: junitRunIDProperty, Value: r.RunID})
+	}
+
+	for _, ws := range r.Workspaces {
+		tc := junitTestCase{
+			Name:      ws.Name(),
+			Classname: ws.Repository,
+			Time:      junitTime(ws.Duration()),
+			SystemOut: workspaceSummary(ws, r.PreviewURL),
+		}
+		switch ws.Status() {
+		case StatusFailed:
+			tc.Failure = &junitFailure{Message: ws.Error, Text: workspaceFailure(ws)}
+		case StatusNotRun:
+			tc.Skipped = &junitSkipped{Message: "the workspace wasn't executed"}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	suites := junitTestSuites{
+		Name:     suite.Name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// ReadRunID returns the ID of the execution from a JUnit XML report written by
+// WriteJUnit.
+func ReadRunID(r io.Reader) (string, error) {
+	var suites junitTestSuites
+	if err := xml.NewDecoder(r).Decode(&suites); err != nil {
+		return "", errors.Wrap(err, "reading JUnit XML report")
+	}
+	for _, suite := range suites.Suites {
+		for _, p := range suite.Properties {
+			if p.Name == junitRunIDProperty && p.Value != "" {
+				return p.Value, nil
+			}
+		}
+	}
+	return "", errors.New("the report doesn't contain the ID of the execution")
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// workspaceSummary describes the steps of the workspace and its diff, one
+// line each.
+func workspaceSummary(ws *Workspace, previewURL string) string {
+	var b strings.Builder
+	for _, step := range ws.Steps {
+		fmt.Fprintf(&b, "step %d: %s\n", step.Number, stepSummary(step))
+	}
+	if ws.Diff.Files > 0 {
+		fmt.Fprintf(&b, "diff: %s\n", ws.Diff)
+	}
+	if ws.ChangesetSpecs && previewURL != "" {
+		// There's no page for a single changeset spec, so the workspace
+		// links to the preview that lists all of them.
+		fmt.Fprintf(&b, "changeset specs built, listed in the preview: %s\n", previewURL)
+	}
+	return b.String()
+}
+
+// stepSummary describes the result of the step.
+func stepSummary(step *Step) string {
+	switch {
+	case step.Cached:
+		return "cached"
+	case step.Skipped:
+		return "skipped"
+	case step.Error != "":
+		return fmt.Sprintf("failed after %s", step.Duration().Round(time.Millisecond))
+	case step.Finished.IsZero():
+		return "not run"
+	default:
+		return step.Duration().Round(time.Millisecond).String()
+	}
+}
+
+// workspaceFailure describes the failed steps of the workspace with the tails
+// of their standard error.
+func workspaceFailure(ws *Workspace) string {
+	var b strings.Builder
+	for _, step := range ws.Steps {
+		if step.Error == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "step %d failed", step.Number)
+		if step.ExitCode != 0 {
+			fmt.Fprintf(&b, " with exit code %d", step.ExitCode)
+		}
+		fmt.Fprintf(&b, ": %s\n", step.Error)
+		if len(step.StderrTail) > 0 {
+			fmt.Fprintf(&b, "stderr:\n%s\n", strings.Join(step.StderrTail, "\n"))
+		}
+	}
+	if b.Len() == 0 {
+		return ws.Error
+	}
+	return b.String()
+}
+
+func (s DiffStat) String() string {
+	return fmt.Sprintf("%s changed, %s(+), %s(-)",
+		plural(s.Files, "file"), plural(s.Insertions, "insertion"), plural(s.Deletions, "deletion"))
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
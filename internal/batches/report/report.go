@@ -0,0 +1,367 @@
+// Package report builds reports of batch spec executions from the events
+// logged by the JSON lines UI, and writes them as JUnit XML or HTML.
+package report
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sourcegraph/go-diff/diff"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+)
+
+// stderrTailLines is the number of lines of the standard error of a step that
+// are kept in the report.
+const stderrTailLines = 20
+
+// Report is the record of a batch spec execution.
+type Report struct {
+	// RunID is the ID of the execution, which can be given to -retry-failed
+	// to retry its failed workspaces.
+	RunID    string
+	Started  time.Time
+	Finished time.Time
+	// Error is the error the execution failed with, if any.
+	Error string
+	// CachedChangesetSpecs is the number of changeset specs whose workspaces
+	// weren't executed, since the results of all their steps were cached.
+	CachedChangesetSpecs int
+	// PreviewURL is the URL of the preview of the batch spec, where its
+	// changeset specs are listed. It's empty if no batch spec was created.
+	PreviewURL string
+	// Workspaces are the executed workspaces.
+	Workspaces []*Workspace
+}
+
+// Duration returns how long the execution took.
+func (r *Report) Duration() time.Duration {
+	return duration(r.Started, r.Finished)
+}
+
+// Failures returns the number of workspaces that failed.
+func (r *Report) Failures() (n int) {
+	for _, ws := range r.Workspaces {
+		if ws.Status() == StatusFailed {
+			n++
+		}
+	}
+	return n
+}
+
+// NotRun returns the number of workspaces that weren't executed, e.g. because
+// the execution was aborted.
+func (r *Report) NotRun() (n int) {
+	for _, ws := range r.Workspaces {
+		if ws.Status() == StatusNotRun {
+			n++
+		}
+	}
+	return n
+}
+
+// Status is the result of the execution of a workspace.
+type Status string
+
+const (
+	StatusPassed Status = "passed"
+	StatusFailed Status = "failed"
+	StatusNotRun Status = "not run"
+)
+
+// Workspace is the record of the execution of the steps in a workspace.
+type Workspace struct {
+	Repository string
+	// Path is the workspace in the repository. "" is the root.
+	Path     string
+	Started  time.Time
+	Finished time.Time
+	Error    string
+	Steps    []*Step
+	// Diff are the statistics of the diff produced by the steps.
+	Diff DiffStat
+	// ChangesetSpecs is true if changeset specs were built from the diff.
+	ChangesetSpecs bool
+}
+
+// Name returns the name of the workspace, as shown in reports.
+func (ws *Workspace) Name() string {
+	if ws.Path == "" {
+		return ws.Repository
+	}
+	return ws.Repository + "/" + ws.Path
+}
+
+// Status returns the result of the execution of the workspace.
+func (ws *Workspace) Status() Status {
+	switch {
+	case ws.Error != "":
+		return StatusFailed
+	case ws.Started.IsZero():
+		return StatusNotRun
+	default:
+		return StatusPassed
+	}
+}
+
+// Duration returns how long the execution of the workspace took.
+func (ws *Workspace) Duration() time.Duration {
+	return duration(ws.Started, ws.Finished)
+}
+
+// Step is the record of the execution of a step in a workspace.
+type Step struct {
+	// Number is the number of the step, starting at 1.
+	Number int
+	// Cached is true if the step wasn't executed, since its result was
+	// cached.
+	Cached bool
+	// Skipped is true if the step wasn't executed, since its if condition
+	// was false.
+	Skipped  bool
+	Started  time.Time
+	Finished time.Time
+	ExitCode int
+	Error    string
+	// StderrTail are the last lines of the standard error of the step.
+	StderrTail []string
+}
+
+// Duration returns how long the execution of the step took.
+func (s *Step) Duration() time.Duration {
+	return duration(s.Started, s.Finished)
+}
+
+func duration(started, finished time.Time) time.Duration {
+	if started.IsZero() || finished.Before(started) {
+		return 0
+	}
+	return finished.Sub(started)
+}
+
+// DiffStat are the statistics of a diff.
+type DiffStat struct {
+	Files      int
+	Insertions int
+	Deletions  int
+}
+
+func newDiffStat(d []byte) DiffStat {
+	fileDiffs, err := diff.ParseMultiFileDiff(d)
+	if err != nil {
+		// The statistics are only informative, so a diff that can't be
+		// parsed, e.g. because it's binary, doesn't fail the report.
+		return DiffStat{}
+	}
+	stat := DiffStat{Files: len(fileDiffs)}
+	for _, f := range fileDiffs {
+		s := f.Stat()
+		stat.Insertions += int(s.Added) + int(s.Changed)
+		stat.Deletions += int(s.Deleted) + int(s.Changed)
+	}
+	return stat
+}
+
+// Recorder builds a Report from the events logged by the JSON lines UI. It's
+// safe for concurrent use.
+type Recorder struct {
+	mu         sync.Mutex
+	report     Report
+	workspaces map[string]*Workspace
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{workspaces: map[string]*Workspace{}}
+}
+
+// Record adds the event to the report.
+func (r *Recorder) Record(e batcheslib.LogEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.report.Started.IsZero() {
+		r.report.Started = e.Timestamp
+	}
+	r.report.Finished = e.Timestamp
+
+	switch m := e.Metadata.(type) {
+	case *batcheslib.BatchSpecExecutionMetadata:
+		if e.Status == batcheslib.LogEventStatusFailure {
+			r.report.Error = m.Error
+		}
+
+	case *batcheslib.CheckingCacheMetadata:
+		if e.Status == batcheslib.LogEventStatusSuccess {
+			r.report.CachedChangesetSpecs = m.CachedSpecsFound
+		}
+
+	case *batcheslib.ExecutingTasksMetadata:
+		for _, t := range m.Tasks {
+			ws := &Workspace{Repository: t.Repository, Path: t.Workspace}
+			for i := range t.Steps {
+				ws.Steps = append(ws.Steps, &Step{
+					Number: i + 1,
+					Cached: t.CachedStepResultsFound && i <= t.StartStep,
+				})
+			}
+			r.workspaces[t.ID] = ws
+			r.report.Workspaces = append(r.report.Workspaces, ws)
+		}
+		if e.Status == batcheslib.LogEventStatusFailure && r.report.Error == "" {
+			r.report.Error = m.Error
+		}
+
+	case *batcheslib.ExecutingTaskMetadata:
+		ws, ok := r.workspaces[m.TaskID]
+		if !ok {
+			return
+		}
+		switch e.Status {
+		case batcheslib.LogEventStatusStarted:
+			ws.Started = e.Timestamp
+		case batcheslib.LogEventStatusSuccess, batcheslib.LogEventStatusFailure:
+			ws.Finished = e.Timestamp
+			ws.Error = m.Error
+		}
+
+	case *batcheslib.TaskBuildChangesetSpecsMetadata:
+		if ws, ok := r.workspaces[m.TaskID]; ok {
+			ws.ChangesetSpecs = true
+		}
+
+	case *batcheslib.TaskStepSkippedMetadata:
+		if step := r.step(m.TaskID, m.Step); step != nil {
+			step.Skipped = true
+		}
+
+	case *batcheslib.TaskPreparingStepMetadata:
+		if step := r.step(m.TaskID, m.Step); step != nil && e.Status == batcheslib.LogEventStatusFailure {
+			step.Error = m.Error
+		}
+
+	case *batcheslib.TaskStepMetadata:
+		step := r.step(m.TaskID, m.Step)
+		if step == nil {
+			return
+		}
+		switch e.Status {
+		case batcheslib.LogEventStatusStarted:
+			step.Started = e.Timestamp
+		case batcheslib.LogEventStatusProgress:
+			step.StderrTail = appendStderr(step.StderrTail, m.Out)
+		case batcheslib.LogEventStatusSuccess:
+			step.Finished = e.Timestamp
+			// The diff of a step includes the changes of all previous
+			// steps, so the last one is the diff of the workspace.
+			r.workspaces[m.TaskID].Diff = newDiffStat(m.Diff)
+		case batcheslib.LogEventStatusFailure:
+			step.Finished = e.Timestamp
+			step.ExitCode = m.ExitCode
+			step.Error = m.Error
+		}
+
+	case *batcheslib.CreatingBatchSpecMetadata:
+		if e.Status == batcheslib.LogEventStatusSuccess {
+			r.report.PreviewURL = m.PreviewURL
+		}
+	}
+}
+
+// step returns the step with the given number of the task with the given ID,
+// or nil if there's none.
+func (r *Recorder) step(taskID string, number int) *Step {
+	ws, ok := r.workspaces[taskID]
+	if !ok || number < 1 || number > len(ws.Steps) {
+		return nil
+	}
+	return ws.Steps[number-1]
+}
+
+// appendStderr appends the lines of standard error in out, the prefixed output
+// of a step, to tail, and returns the last stderrTailLines lines.
+func appendStderr(tail []string, out string) []string {
+	for line := range strings.SplitSeq(strings.TrimRight(out, "\n"), "\n") {
+		if l, ok := strings.CutPrefix(line, "stderr: "); ok {
+			tail = append(tail, l)
+		}
+	}
+	if len(tail) > stderrTailLines {
+		tail = tail[len(tail)-stderrTailLines:]
+	}
+	return tail
+}
+
+// Report returns the report of the recorded events.
+func (r *Recorder) Report() *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := r.report
+	return &report
+}
+
+// ReadLog builds a report from a log of JSON lines, as written by
+// 'src batch preview -text-only'.
+func ReadLog(r io.Reader) (*Report, error) {
+	rec := NewRecorder()
+	scanner := bufio.NewScanner(r)
+	// Events can contain the diffs of steps, so lines can be long.
+	scanner.Buffer(make([]byte, 0, 64*1024), 256*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var e batcheslib.LogEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+		rec.Record(e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading log")
+	}
+	return rec.Report(), nil
+}
+
+// CheckFormat returns an error if the format of a report written to the given
+// file isn't known, so that it can be checked before the execution.
+func CheckFormat(file string) error {
+	_, err := writerFor(file)
+	return err
+}
+
+func writerFor(file string) (func(io.Writer, *Report) error, error) {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".xml":
+		return WriteJUnit, nil
+	case ".html", ".htm":
+		return WriteHTML, nil
+	}
+	return nil, errors.Newf("unknown report format of %s, use a .xml file for JUnit XML or a .html file for HTML", file)
+}
+
+// Write writes the report to the given file, as JUnit XML if it ends in .xml,
+// or as HTML if it ends in .html.
+func Write(file string, r *Report) error {
+	write, err := writerFor(file)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return errors.Wrap(err, "creating report")
+	}
+	if err := write(f, r); err != nil {
+		f.Close()
+		return errors.Wrap(err, "writing report")
+	}
+	return errors.Wrap(f.Close(), "writing report")
+}
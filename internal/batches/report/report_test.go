@@ -0,0 +1,143 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testLog = `{"operation":"CHECKING_CACHE","timestamp":"2024-01-01T10:00:00Z","status":"SUCCESS","metadata":{"cachedSpecsFound":2,"tasksToExecute":2}}
+{"operation":"EXECUTING_TASKS","timestamp":"2024-01-01T10:00:01Z","status":"STARTED","metadata":{"tasks":[{"id":"a","repository":"github.com/sourcegraph/src-cli","workspace":"","steps":[{"run":"true"},{"run":"true"}],"cachedStepResultFound":true,"startStep":0},{"id":"b","repository":"github.com/sourcegraph/sourcegraph","workspace":"client","steps":[{"run":"true"},{"run":"false"}],"cachedStepResultFound":false,"startStep":0}]}}
+{"operation":"EXECUTING_TASK","timestamp":"2024-01-01T10:00:01Z","status":"STARTED","metadata":{"taskID":"a"}}
+{"operation":"EXECUTING_TASK","timestamp":"2024-01-01T10:00:01Z","status":"STARTED","metadata":{"taskID":"b"}}
+{"operation":"TASK_STEP","timestamp":"2024-01-01T10:00:02Z","status":"STARTED","metadata":{"taskID":"a","step":2}}
+{"operation":"TASK_STEP","timestamp":"2024-01-01T10:00:04Z","status":"SUCCESS","metadata":{"taskID":"a","step":2,"diff":"diff --git a/README.md b/README.md\n--- a/README.md\n+++ b/README.md\n@@ -1 +1,2 @@\n hello\n+world\n"}}
+{"operation":"TASK_BUILD_CHANGESET_SPECS","timestamp":"2024-01-01T10:00:04Z","status":"SUCCESS","metadata":{"taskID":"a"}}
+{"operation":"EXECUTING_TASK","timestamp":"2024-01-01T10:00:05Z","status":"SUCCESS","metadata":{"taskID":"a"}}
+{"operation":"TASK_STEP_SKIPPED","timestamp":"2024-01-01T10:00:02Z","status":"PROGRESS","metadata":{"taskID":"b","step":1}}
+{"operation":"TASK_STEP","timestamp":"2024-01-01T10:00:02Z","status":"STARTED","metadata":{"taskID":"b","step":2}}
+{"operation":"TASK_STEP","timestamp":"2024-01-01T10:00:03Z","status":"PROGRESS","metadata":{"taskID":"b","step":2,"out":"stdout: building\nstderr: error: <missing>\n"}}
+{"operation":"TASK_STEP","timestamp":"2024-01-01T10:00:03Z","status":"FAILURE","metadata":{"taskID":"b","step":2,"exitCode":1,"error":"run: false: exit status 1"}}
+{"operation":"EXECUTING_TASK","timestamp":"2024-01-01T10:00:03Z","status":"FAILURE","metadata":{"taskID":"b","error":"step 2 failed"}}
+
+{"operation":"CREATING_BATCH_SPEC","timestamp":"2024-01-01T10:00:06Z","status":"SUCCESS","metadata":{"previewURL":"https://sourcegraph.test/batch-changes/preview/1"}}
+`
+
+func TestReadLog(t *testing.T) {
+	r, err := ReadLog(strings.NewReader(testLog))
+	require.NoError(t, err)
+
+	at := func(sec int) time.Time { return time.Date(2024, 1, 1, 10, 0, sec, 0, time.UTC) }
+	assert.Equal(t, &Report{
+		Started:              at(0),
+		Finished:             at(6),
+		CachedChangesetSpecs: 2,
+		PreviewURL:           "https://sourcegraph.test/batch-changes/preview/1",
+		Workspaces: []*Workspace{
+			{
+				Repository: "github.com/sourcegraph/src-cli",
+				Started:    at(1),
+				Finished:   at(5),
+				Steps: []*Step{
+					{Number: 1, Cached: true},
+					{Number: 2, Started: at(2), Finished: at(4)},
+				},
+				Diff:           DiffStat{Files: 1, Insertions: 1},
+				ChangesetSpecs: true,
+			},
+			{
+				Repository: "github.com/sourcegraph/sourcegraph",
+				Path:       "client",
+				Started:    at(1),
+				Finished:   at(3),
+				Error:      "step 2 failed",
+				Steps: []*Step{
+					{Number: 1, Skipped: true},
+					{Number: 2, Started: at(2), Finished: at(3), ExitCode: 1, Error: "run: false: exit status 1", StderrTail: []string{"error: <missing>"}},
+				},
+			},
+		},
+	}, r)
+	assert.Equal(t, 1, r.Failures())
+}
+
+func TestReadLog_Invalid(t *testing.T) {
+	_, err := ReadLog(strings.NewReader("{\"operation\":\"CHECKING_CACHE\",\"status\":\"STARTED\"}\nnot json\n"))
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestWriteJUnit(t *testing.T) {
+	r, err := ReadLog(strings.NewReader(testLog))
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, WriteJUnit(&out, r))
+
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="src batch" tests="2" failures="1" skipped="0" time="6.000">
+  <testsuite name="src batch" tests="2" failures="1" skipped="0" time="6.000" timestamp="2024-01-01T10:00:00Z">
+    <properties>
+      <property name="cachedChangesetSpecs" value="2"></property>
+      <property name="previewURL" value="https://sourcegraph.test/batch-changes/preview/1"></property>
+    </properties>
+    <testcase name="github.com/sourcegraph/src-cli" classname="github.com/sourcegraph/src-cli" time="4.000">
+      <system-out>step 1: cached&#xA;step 2: 2s&#xA;diff: 1 file changed, 1 insertion(+), 0 deletions(-)&#xA;changeset specs built, listed in the preview: https://sourcegraph.test/batch-changes/preview/1&#xA;</system-out>
+    </testcase>
+    <testcase name="github.com/sourcegraph/sourcegraph/client" classname="github.com/sourcegraph/sourcegraph" time="2.000">
+      <failure message="step 2 failed">step 2 failed with exit code 1: run: false: exit status 1&#xA;stderr:&#xA;error: &lt;missing&gt;&#xA;</failure>
+      <system-out>step 1: skipped&#xA;step 2: failed after 1s&#xA;</system-out>
+    </testcase>
+  </testsuite>
+</testsuites>
+`, out.String())
+}
+
+func TestReadRunID(t *testing.T) {
+	r, err := ReadLog(strings.NewReader(testLog))
+	require.NoError(t, err)
+	r.RunID = "0123abcd"
+
+	var out bytes.Buffer
+	require.NoError(t, WriteJUnit(&out, r))
+	id, err := ReadRunID(&out)
+	require.NoError(t, err)
+	assert.Equal(t, "0123abcd", id)
+
+	r.RunID = ""
+	out.Reset()
+	require.NoError(t, WriteJUnit(&out, r))
+	_, err = ReadRunID(&out)
+	assert.ErrorContains(t, err, "doesn't contain the ID")
+
+	_, err = ReadRunID(strings.NewReader("<html></html>"))
+	assert.Error(t, err)
+}
+
+func TestWriteHTML(t *testing.T) {
+	r, err := ReadLog(strings.NewReader(testLog))
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, WriteHTML(&out, r))
+
+	html := out.String()
+	assert.Contains(t, html, "2 workspaces executed, 1 failed; 2 changeset specs were cached.")
+	assert.Contains(t, html, `<td>github.com/sourcegraph/sourcegraph/client</td>
+<td class="failed">failed</td>`)
+	assert.Contains(t, html, "error: &lt;missing&gt;")
+	assert.Contains(t, html, `built, <a href="https://sourcegraph.test/batch-changes/preview/1">listed in the preview</a>`)
+}
+
+func TestWrite_UnknownFormat(t *testing.T) {
+	file := t.TempDir() + "/report.txt"
+	assert.ErrorContains(t, CheckFormat(file), "unknown report format")
+	assert.NoError(t, CheckFormat("report.XML"))
+
+	err := Write(file, &Report{})
+	assert.ErrorContains(t, err, "unknown report format")
+	assert.NoFileExists(t, file)
+}
@@ -0,0 +1,108 @@
+package repozip
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+)
+
+// NewLocalArchiveRegistry returns an ArchiveRegistry that creates the archives
+// of repositories with `git archive` from local checkouts. dirs maps the names
+// of the repositories to the directories they're checked out at. Archives
+// always contain the complete repository.
+func NewLocalArchiveRegistry(dirs map[string]string, tempDir string) ArchiveRegistry {
+	return &localArchiveRegistry{dirs: dirs, tempDir: tempDir}
+}
+
+type localArchiveRegistry struct {
+	dirs    map[string]string
+	tempDir string
+}
+
+func (r *localArchiveRegistry) Checkout(repo RepoRevision, _ string) Archive {
+	return NewLocalArchive(r.dirs[repo.RepoName], repo.Commit, r.tempDir)
+}
+
+// NewLocalArchive returns an Archive of the given revision of the git
+// repository checked out at dir. The ZIP archive is created in tempDir when
+// Ensure is called and deleted again on Close.
+func NewLocalArchive(dir, rev, tempDir string) Archive {
+	return &localArchive{dir: dir, rev: rev, tempDir: tempDir}
+}
+
+var _ Archive = &localArchive{}
+
+// localArchive is an Archive that is created with `git archive` from a
+// repository on the local filesystem instead of being downloaded from
+// Sourcegraph.
+type localArchive struct {
+	mu sync.Mutex
+
+	dir     string
+	rev     string
+	tempDir string
+
+	// zipPath is the path of the created ZIP archive. Empty until Ensure
+	// succeeded.
+	zipPath string
+}
+
+func (a *localArchive) Ensure(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.zipPath != "" {
+		return nil
+	}
+	if a.dir == "" {
+		return errors.New("repository is not checked out locally")
+	}
+
+	f, err := os.CreateTemp(a.tempDir, "local-archive-*.zip")
+	if err != nil {
+		return errors.Wrap(err, "creating archive file")
+	}
+	zipPath := f.Name()
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "closing archive file")
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "archive", "--format=zip", "--output", zipPath, a.rev)
+	cmd.Dir = a.dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(zipPath)
+		return errors.Wrapf(err, "archiving %q at %q: %s", a.dir, a.rev, out)
+	}
+
+	a.zipPath = zipPath
+	return nil
+}
+
+func (a *localArchive) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.zipPath == "" {
+		return nil
+	}
+
+	err := os.Remove(a.zipPath)
+	a.zipPath = ""
+	return err
+}
+
+func (a *localArchive) Path() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.zipPath
+}
+
+func (a *localArchive) AdditionalFilePaths() map[string]string {
+	// The archive always contains the full repository, so there are no
+	// additional files to copy.
+	return nil
+}
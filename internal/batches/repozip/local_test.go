@@ -0,0 +1,66 @@
+package repozip
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalArchive(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	repoDir := t.TempDir()
+	runGit := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{
+			"-c", "user.name=test",
+			"-c", "user.email=test@example.com",
+		}, args...)...)
+		cmd.Dir = repoDir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s: %s", args, err, out)
+		}
+	}
+
+	runGit("init", "--quiet")
+	if err := os.WriteFile(filepath.Join(repoDir, "README.md"), []byte("# README\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	runGit("add", "README.md")
+	runGit("commit", "--quiet", "-m", "initial")
+	// Uncommitted changes must not end up in the archive.
+	if err := os.WriteFile(filepath.Join(repoDir, "dirty.txt"), []byte("dirty\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := NewLocalArchive(repoDir, "HEAD", t.TempDir())
+	if err := archive.Ensure(context.Background()); err != nil {
+		t.Fatalf("Ensure returned error: %s", err)
+	}
+
+	r, err := zip.OpenReader(archive.Path())
+	if err != nil {
+		t.Fatalf("opening archive: %s", err)
+	}
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	r.Close()
+	if len(names) != 1 || names[0] != "README.md" {
+		t.Fatalf("wrong files in archive: %v", names)
+	}
+
+	path := archive.Path()
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Close returned error: %s", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("archive not deleted on Close: %v", err)
+	}
+}
@@ -0,0 +1,318 @@
+package service
+
+import (
+	"context"
+
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+)
+
+// changesetsPageSize is the number of changesets requested per page when
+// listing the changesets of a batch change.
+const changesetsPageSize = 100
+
+type pageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+const listBatchChangesQuery = `
+query ListBatchChanges($after: String, $states: [BatchChangeState!]) {
+    batchChanges(first: 100, after: $after, states: $states) {
+        nodes {
+            ...batchChangeFields
+        }
+        pageInfo {
+            hasNextPage
+            endCursor
+        }
+    }
+}
+` + graphql.BatchChangeFieldsFragment
+
+const listNamespaceBatchChangesQuery = `
+query ListNamespaceBatchChanges($namespace: ID!, $after: String, $states: [BatchChangeState!]) {
+    node(id: $namespace) {
+        ... on User {
+            batchChanges(first: 100, after: $after, states: $states) {
+                ...batchChangeConnectionFields
+            }
+        }
+        ... on Org {
+            batchChanges(first: 100, after: $after, states: $states) {
+                ...batchChangeConnectionFields
+            }
+        }
+    }
+}
+
+fragment batchChangeConnectionFields on BatchChangeConnection {
+    nodes {
+        ...batchChangeFields
+    }
+    pageInfo {
+        hasNextPage
+        endCursor
+    }
+}
+` + graphql.BatchChangeFieldsFragment
+
+type batchChangeConnection struct {
+	Nodes    []*graphql.BatchChange `json:"nodes"`
+	PageInfo pageInfo               `json:"pageInfo"`
+}
+
+// ListBatchChanges returns the batch changes in the given namespace, or all
+// batch changes the user can see if namespaceID is empty. If states are
+// given, only the batch changes in one of them are returned.
+func (svc *Service) ListBatchChanges(ctx context.Context, namespaceID string, states []string) ([]*graphql.BatchChange, error) {
+	var (
+		batchChanges []*graphql.BatchChange
+		after        *string
+	)
+	for {
+		vars := map[string]any{"after": after, "states": states}
+
+		var conn batchChangeConnection
+		if namespaceID == "" {
+			var resp struct {
+				BatchChanges batchChangeConnection `json:"batchChanges"`
+			}
+			if ok, err := svc.client.NewRequest(listBatchChangesQuery, vars).Do(ctx, &resp); err != nil || !ok {
+				return nil, err
+			}
+			conn = resp.BatchChanges
+		} else {
+			vars["namespace"] = namespaceID
+			var resp struct {
+				Node *struct {
+					BatchChanges batchChangeConnection `json:"batchChanges"`
+				} `json:"node"`
+			}
+			if ok, err := svc.client.NewRequest(listNamespaceBatchChangesQuery, vars).Do(ctx, &resp); err != nil || !ok {
+				return nil, err
+			}
+			if resp.Node == nil {
+				return nil, errors.Newf("namespace %q not found", namespaceID)
+			}
+			conn = resp.Node.BatchChanges
+		}
+
+		batchChanges = append(batchChanges, conn.Nodes...)
+		if !conn.PageInfo.HasNextPage {
+			return batchChanges, nil
+		}
+		after = &conn.PageInfo.EndCursor
+	}
+}
+
+const getBatchChangeQuery = `
+query GetBatchChange($namespace: ID!, $name: String!) {
+    batchChange(namespace: $namespace, name: $name) {
+        ...batchChangeFields
+    }
+}
+` + graphql.BatchChangeFieldsFragment
+
+// GetBatchChange returns the batch change with the given name in the
+// namespace.
+func (svc *Service) GetBatchChange(ctx context.Context, namespaceID, name string) (*graphql.BatchChange, error) {
+	var resp struct {
+		BatchChange *graphql.BatchChange `json:"batchChange"`
+	}
+	if ok, err := svc.client.NewRequest(getBatchChangeQuery, map[string]any{
+		"namespace": namespaceID,
+		"name":      name,
+	}).Do(ctx, &resp); err != nil || !ok {
+		return nil, err
+	}
+	if resp.BatchChange == nil {
+		return nil, errors.Newf("batch change %q not found", name)
+	}
+	return resp.BatchChange, nil
+}
+
+const listChangesetsQuery = `
+query ListChangesets(
+    $batchChange: ID!,
+    $first: Int!,
+    $after: String,
+    $state: ChangesetState,
+    $reviewState: ChangesetReviewState,
+    $checkState: ChangesetCheckState,
+    $search: String,
+) {
+    node(id: $batchChange) {
+        ... on BatchChange {
+            changesets(
+                first: $first,
+                after: $after,
+                state: $state,
+                reviewState: $reviewState,
+                checkState: $checkState,
+                search: $search,
+            ) {
+                nodes {
+                    ...changesetFields
+                }
+                pageInfo {
+                    hasNextPage
+                    endCursor
+                }
+            }
+        }
+    }
+}
+` + graphql.ChangesetFieldsFragment
+
+// ChangesetFilter selects changesets of a batch change. Empty fields match
+// all changesets.
+type ChangesetFilter struct {
+	// State is a ChangesetState, such as OPEN or MERGED.
+	State string
+	// ReviewState is a ChangesetReviewState, such as APPROVED.
+	ReviewState string
+	// CheckState is a ChangesetCheckState, such as FAILED.
+	CheckState string
+	// Search matches the title and repository name of changesets.
+	Search string
+}
+
+// ListChangesets returns the changesets of the batch change that match the
+// filter.
+func (svc *Service) ListChangesets(ctx context.Context, batchChangeID string, filter ChangesetFilter) ([]*graphql.Changeset, error) {
+	var (
+		changesets []*graphql.Changeset
+		after      *string
+	)
+	for {
+		var resp struct {
+			Node *struct {
+				Changesets struct {
+					Nodes    []*graphql.Changeset `json:"nodes"`
+					PageInfo pageInfo             `json:"pageInfo"`
+				} `json:"changesets"`
+			} `json:"node"`
+		}
+		if ok, err := svc.client.NewRequest(listChangesetsQuery, map[string]any{
+			"batchChange": batchChangeID,
+			"first":       changesetsPageSize,
+			"after":       after,
+			"state":       api.NullString(filter.State),
+			"reviewState": api.NullString(filter.ReviewState),
+			"checkState":  api.NullString(filter.CheckState),
+			"search":      api.NullString(filter.Search),
+		}).Do(ctx, &resp); err != nil || !ok {
+			return nil, err
+		}
+		if resp.Node == nil {
+			return nil, errors.Newf("batch change %q not found", batchChangeID)
+		}
+
+		changesets = append(changesets, resp.Node.Changesets.Nodes...)
+		if !resp.Node.Changesets.PageInfo.HasNextPage {
+			return changesets, nil
+		}
+		after = &resp.Node.Changesets.PageInfo.EndCursor
+	}
+}
+
+const publishChangesetsMutation = `
+mutation PublishChangesets($batchChange: ID!, $changesets: [ID!]!, $draft: Boolean) {
+    publishChangesets(batchChange: $batchChange, changesets: $changesets, draft: $draft) {
+        id
+        state
+    }
+}
+`
+
+// PublishChangesets starts a bulk operation that publishes the changesets,
+// as drafts if draft is true.
+func (svc *Service) PublishChangesets(ctx context.Context, batchChangeID string, changesetIDs []string, draft bool) (*graphql.BulkOperation, error) {
+	var resp struct {
+		BulkOperation *graphql.BulkOperation `json:"publishChangesets"`
+	}
+	if ok, err := svc.client.NewRequest(publishChangesetsMutation, map[string]any{
+		"batchChange": batchChangeID,
+		"changesets":  changesetIDs,
+		"draft":       draft,
+	}).Do(ctx, &resp); err != nil || !ok {
+		return nil, err
+	}
+	return resp.BulkOperation, nil
+}
+
+const closeChangesetsMutation = `
+mutation CloseChangesets($batchChange: ID!, $changesets: [ID!]!) {
+    closeChangesets(batchChange: $batchChange, changesets: $changesets) {
+        id
+        state
+    }
+}
+`
+
+// CloseChangesets starts a bulk operation that closes the changesets on
+// their code hosts.
+func (svc *Service) CloseChangesets(ctx context.Context, batchChangeID string, changesetIDs []string) (*graphql.BulkOperation, error) {
+	var resp struct {
+		BulkOperation *graphql.BulkOperation `json:"closeChangesets"`
+	}
+	if ok, err := svc.client.NewRequest(closeChangesetsMutation, map[string]any{
+		"batchChange": batchChangeID,
+		"changesets":  changesetIDs,
+	}).Do(ctx, &resp); err != nil || !ok {
+		return nil, err
+	}
+	return resp.BulkOperation, nil
+}
+
+const reenqueueChangesetsMutation = `
+mutation ReenqueueChangesets($batchChange: ID!, $changesets: [ID!]!) {
+    reenqueueChangesets(batchChange: $batchChange, changesets: $changesets) {
+        id
+        state
+    }
+}
+`
+
+// ReenqueueChangesets starts a bulk operation that retries publishing or
+// updating the changesets.
+func (svc *Service) ReenqueueChangesets(ctx context.Context, batchChangeID string, changesetIDs []string) (*graphql.BulkOperation, error) {
+	var resp struct {
+		BulkOperation *graphql.BulkOperation `json:"reenqueueChangesets"`
+	}
+	if ok, err := svc.client.NewRequest(reenqueueChangesetsMutation, map[string]any{
+		"batchChange": batchChangeID,
+		"changesets":  changesetIDs,
+	}).Do(ctx, &resp); err != nil || !ok {
+		return nil, err
+	}
+	return resp.BulkOperation, nil
+}
+
+const createChangesetCommentsMutation = `
+mutation CreateChangesetComments($batchChange: ID!, $changesets: [ID!]!, $body: String!) {
+    createChangesetComments(batchChange: $batchChange, changesets: $changesets, body: $body) {
+        id
+        state
+    }
+}
+`
+
+// CreateChangesetComments starts a bulk operation that posts a comment with
+// the given body on the changesets.
+func (svc *Service) CreateChangesetComments(ctx context.Context, batchChangeID string, changesetIDs []string, body string) (*graphql.BulkOperation, error) {
+	var resp struct {
+		BulkOperation *graphql.BulkOperation `json:"createChangesetComments"`
+	}
+	if ok, err := svc.client.NewRequest(createChangesetCommentsMutation, map[string]any{
+		"batchChange": batchChangeID,
+		"changesets":  changesetIDs,
+		"body":        body,
+	}).Do(ctx, &resp); err != nil || !ok {
+		return nil, err
+	}
+	return resp.BulkOperation, nil
+}
@@ -0,0 +1,114 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	mockclient "github.com/sourcegraph/src-cli/internal/api/mock"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+	"github.com/sourcegraph/src-cli/internal/batches/service"
+)
+
+func TestService_ListChangesets(t *testing.T) {
+	client := new(mockclient.Client)
+	svc := service.New(&service.Opts{Client: client})
+
+	state := "OPEN"
+	cursor := "cursor-1"
+	pages := []struct {
+		after    *string
+		response string
+	}{
+		{
+			response: `{"node":{"changesets":{
+				"nodes":[{"__typename":"ExternalChangeset","id":"c1","state":"OPEN","checkState":"FAILED","repository":{"name":"github.com/a/a"}}],
+				"pageInfo":{"hasNextPage":true,"endCursor":"cursor-1"}
+			}}}`,
+		},
+		{
+			after: &cursor,
+			response: `{"node":{"changesets":{
+				"nodes":[{"__typename":"HiddenExternalChangeset","id":"c2","state":"OPEN"}],
+				"pageInfo":{"hasNextPage":false}
+			}}}`,
+		},
+	}
+	for _, page := range pages {
+		req := new(mockclient.Request)
+		client.On("NewRequest", mock.Anything, map[string]any{
+			"batchChange": "bc",
+			"first":       100,
+			"after":       page.after,
+			"state":       &state,
+			"reviewState": (*string)(nil),
+			"checkState":  (*string)(nil),
+			"search":      (*string)(nil),
+		}).Return(req).Once()
+		response := page.response
+		req.On("Do", mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				require.NoError(t, json.Unmarshal([]byte(response), args[1]))
+			}).
+			Return(true, nil).
+			Once()
+	}
+
+	changesets, err := svc.ListChangesets(context.Background(), "bc", service.ChangesetFilter{State: "OPEN"})
+	require.NoError(t, err)
+	assert.Equal(t, []*graphql.Changeset{
+		{
+			Typename:   "ExternalChangeset",
+			ID:         "c1",
+			State:      "OPEN",
+			CheckState: "FAILED",
+			Repository: &graphql.ChangesetRepository{Name: "github.com/a/a"},
+		},
+		{Typename: "HiddenExternalChangeset", ID: "c2", State: "OPEN"},
+	}, changesets)
+	assert.False(t, changesets[0].Hidden())
+	assert.True(t, changesets[1].Hidden())
+	client.AssertExpectations(t)
+}
+
+func TestService_GetBatchChange_NotFound(t *testing.T) {
+	client := new(mockclient.Client)
+	req := new(mockclient.Request)
+	svc := service.New(&service.Opts{Client: client})
+
+	client.On("NewRequest", mock.Anything, map[string]any{"namespace": "ns", "name": "missing"}).Return(req).Once()
+	req.On("Do", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			require.NoError(t, json.Unmarshal([]byte(`{"batchChange":null}`), args[1]))
+		}).
+		Return(true, nil).
+		Once()
+
+	_, err := svc.GetBatchChange(context.Background(), "ns", "missing")
+	assert.EqualError(t, err, `batch change "missing" not found`)
+}
+
+func TestService_CloseChangesets(t *testing.T) {
+	client := new(mockclient.Client)
+	req := new(mockclient.Request)
+	svc := service.New(&service.Opts{Client: client})
+
+	client.On("NewRequest", mock.Anything, map[string]any{
+		"batchChange": "bc",
+		"changesets":  []string{"c1", "c2"},
+	}).Return(req).Once()
+	req.On("Do", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			require.NoError(t, json.Unmarshal([]byte(`{"closeChangesets":{"id":"op","state":"PROCESSING"}}`), args[1]))
+		}).
+		Return(true, nil).
+		Once()
+
+	op, err := svc.CloseChangesets(context.Background(), "bc", []string{"c1", "c2"})
+	require.NoError(t, err)
+	assert.Equal(t, &graphql.BulkOperation{ID: "op", State: "PROCESSING"}, op)
+}
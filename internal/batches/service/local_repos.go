@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log"
+	"os/exec"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+	"github.com/sourcegraph/src-cli/internal/servegit"
+)
+
+// LocalRepos are the git repositories found in a directory on the local
+// filesystem, keyed by their names. The name of a repository is its path
+// relative to the directory, like the names used by 'src serve-git'.
+type LocalRepos map[string]string
+
+// FindLocalRepos returns the git repositories in root and its
+// subdirectories.
+func FindLocalRepos(root string) (LocalRepos, error) {
+	discard := log.New(io.Discard, "", 0)
+	s := &servegit.Serve{Root: root, Info: discard, Debug: discard}
+
+	found, err := s.Repos()
+	if err != nil {
+		return nil, errors.Wrap(err, "finding local repositories")
+	}
+
+	repos := make(LocalRepos, len(found))
+	for _, repo := range found {
+		repos[repo.Name] = s.RepoDir(repo)
+	}
+	return repos, nil
+}
+
+// names returns the sorted names of the repositories.
+func (r LocalRepos) names() []string {
+	names := make([]string, 0, len(r))
+	for name := range r {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveLocalWorkspacesForBatchSpec is like ResolveWorkspacesForBatchSpec,
+// but resolves the workspaces against the given local repositories instead of
+// the repositories on the Sourcegraph instance.
+//
+// Entries in `on` can name repositories with glob patterns. Repository
+// queries are only supported if they consist of repo: filters. Without a
+// branch, the checked out HEAD of a repository is used.
+func (svc *Service) ResolveLocalWorkspacesForBatchSpec(ctx context.Context, spec *batcheslib.BatchSpec, repos LocalRepos) ([]RepoWorkspace, []*graphql.Repository, error) {
+	type revision struct{ name, branch string }
+	var revisions []revision
+
+	// Like on Sourcegraph, explicitly listed repositories take precedence
+	// over repositories matched by queries.
+	explicit := map[string]bool{}
+	for _, on := range spec.On {
+		if on.Repository == "" {
+			continue
+		}
+		branches, err := on.GetBranches()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(branches) == 0 {
+			branches = []string{""}
+		}
+
+		matched := false
+		for _, name := range repos.names() {
+			if ok, err := path.Match(on.Repository, name); err != nil {
+				return nil, nil, errors.Wrapf(err, "invalid repository pattern %q", on.Repository)
+			} else if !ok {
+				continue
+			}
+			matched = true
+			explicit[name] = true
+			for _, branch := range branches {
+				revisions = append(revisions, revision{name, branch})
+			}
+		}
+		if !matched {
+			return nil, nil, errors.Newf("repository %q not found in local repositories", on.Repository)
+		}
+	}
+
+	for _, on := range spec.On {
+		if on.RepositoriesMatchingQuery == "" {
+			continue
+		}
+		match, err := localRepoQueryMatcher(on.RepositoriesMatchingQuery)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, name := range repos.names() {
+			if match(name) && !explicit[name] {
+				revisions = append(revisions, revision{name: name})
+			}
+		}
+	}
+
+	var (
+		workspaces []RepoWorkspace
+		resolved   []*graphql.Repository
+		seen       = map[revision]bool{}
+	)
+	for _, rev := range revisions {
+		if seen[rev] {
+			continue
+		}
+		seen[rev] = true
+
+		repo, err := resolveLocalRepo(ctx, rev.name, repos[rev.name], rev.branch)
+		if err != nil {
+			return nil, nil, err
+		}
+		resolved = append(resolved, repo)
+
+		paths, err := localWorkspacePaths(ctx, spec.Workspaces, repos[rev.name], repo)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, p := range paths {
+			// Local archives always contain the complete repository, so
+			// OnlyFetchWorkspace doesn't save anything.
+			workspaces = append(workspaces, RepoWorkspace{Repo: repo, Path: p})
+		}
+	}
+
+	return workspaces, resolved, nil
+}
+
+// localRepoQueryMatcher returns a function that reports whether a repository
+// name matches the given query, which may only contain repo: and -repo:
+// filters with regular expressions.
+func localRepoQueryMatcher(query string) (func(name string) bool, error) {
+	var include, exclude []*regexp.Regexp
+	for _, field := range strings.Fields(query) {
+		negated := strings.HasPrefix(field, "-")
+		pattern, ok := strings.CutPrefix(strings.TrimPrefix(field, "-"), "repo:")
+		if !ok {
+			return nil, errors.Newf("unsupported query %q: only repo: filters can be used with local repositories", query)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid repo: filter in query %q", query)
+		}
+		if negated {
+			exclude = append(exclude, re)
+		} else {
+			include = append(include, re)
+		}
+	}
+
+	return func(name string) bool {
+		for _, re := range include {
+			if !re.MatchString(name) {
+				return false
+			}
+		}
+		for _, re := range exclude {
+			if re.MatchString(name) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// resolveLocalRepo returns the repository with the given name checked out at
+// dir, at the given branch or HEAD if branch is empty.
+func resolveLocalRepo(ctx context.Context, name, dir, branch string) (*graphql.Repository, error) {
+	head, err := localGit(ctx, dir, "rev-parse", "--verify", "HEAD^{commit}")
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolving HEAD of %s", name)
+	}
+	headBranch, err := localGit(ctx, dir, "symbolic-ref", "--quiet", "--short", "HEAD")
+	if err != nil {
+		// Detached HEAD.
+		headBranch = "HEAD"
+	}
+
+	repo := &graphql.Repository{
+		ID:            "local:" + name,
+		Name:          name,
+		DefaultBranch: &graphql.Branch{Name: headBranch, Target: graphql.Target{OID: head}},
+		FileMatches:   map[string]bool{},
+	}
+	repo.Commit = graphql.Target{OID: head}
+	repo.Branch = *repo.DefaultBranch
+
+	if branch != "" {
+		commit, err := localGit(ctx, dir, "rev-parse", "--verify", branch+"^{commit}")
+		if err != nil {
+			return nil, errors.Newf("branch %q not found in %s", branch, name)
+		}
+		repo.Commit = graphql.Target{OID: commit}
+		repo.Branch = graphql.Branch{Name: branch, Target: repo.Commit}
+	}
+
+	return repo, nil
+}
+
+// localWorkspacePaths returns the paths of the workspaces in the repository,
+// according to the first workspace configuration that applies to it.
+func localWorkspacePaths(ctx context.Context, configs []batcheslib.WorkspaceConfiguration, dir string, repo *graphql.Repository) ([]string, error) {
+	for _, conf := range configs {
+		if conf.In != "" {
+			if ok, err := path.Match(conf.In, repo.Name); err != nil {
+				return nil, errors.Wrapf(err, "invalid workspace pattern %q", conf.In)
+			} else if !ok {
+				continue
+			}
+		}
+
+		files, err := localGit(ctx, dir, "ls-tree", "-r", "--name-only", "-z", repo.Rev())
+		if err != nil {
+			return nil, errors.Wrapf(err, "listing files of %s", repo.Name)
+		}
+
+		seen := map[string]bool{}
+		var paths []string
+		for _, file := range strings.Split(files, "\x00") {
+			if file == "" || path.Base(file) != conf.RootAtLocationOf {
+				continue
+			}
+			p := path.Dir(file)
+			if p == "." {
+				p = ""
+			}
+			if !seen[p] {
+				seen[p] = true
+				paths = append(paths, p)
+			}
+		}
+		sort.Strings(paths)
+		return paths, nil
+	}
+
+	return []string{""}, nil
+}
+
+func localGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.Wrapf(err, "'git %s' failed", strings.Join(args, " "))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
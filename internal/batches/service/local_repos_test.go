@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+)
+
+func TestResolveLocalWorkspacesForBatchSpec(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+
+	srcCLI := createLocalTestRepo(t, filepath.Join(root, "github.com", "sourcegraph", "src-cli"), map[string]string{
+		"README.md":         "# src-cli\n",
+		"a/package.json":    "{}\n",
+		"a/b/package.json":  "{}\n",
+		"c/package.json":    "{}\n",
+		"d/not-package.txt": "\n",
+	})
+	runLocalTestGit(t, srcCLI, "checkout", "-q", "-b", "feature")
+	require.NoError(t, os.WriteFile(filepath.Join(srcCLI, "feature.txt"), []byte("feature\n"), 0644))
+	runLocalTestGit(t, srcCLI, "add", "--all")
+	runLocalTestGit(t, srcCLI, "commit", "-q", "-m", "Feature")
+	featureRev := runLocalTestGit(t, srcCLI, "rev-parse", "HEAD")
+	runLocalTestGit(t, srcCLI, "checkout", "-q", "main")
+	mainRev := runLocalTestGit(t, srcCLI, "rev-parse", "HEAD")
+
+	sourcegraph := createLocalTestRepo(t, filepath.Join(root, "github.com", "sourcegraph", "sourcegraph"), map[string]string{"README.md": "# sourcegraph\n"})
+	createLocalTestRepo(t, filepath.Join(root, "gitlab.com", "other"), map[string]string{"README.md": "# other\n"})
+
+	repos, err := FindLocalRepos(root)
+	require.NoError(t, err)
+	assert.Equal(t, LocalRepos{
+		"github.com/sourcegraph/src-cli":     srcCLI,
+		"github.com/sourcegraph/sourcegraph": sourcegraph,
+		"gitlab.com/other":                   filepath.Join(root, "gitlab.com", "other"),
+	}, repos)
+
+	svc := &Service{}
+
+	t.Run("repositories and branches", func(t *testing.T) {
+		workspaces, resolved, err := svc.ResolveLocalWorkspacesForBatchSpec(ctx, &batcheslib.BatchSpec{
+			On: []batcheslib.OnQueryOrRepository{
+				{Repository: "github.com/sourcegraph/*"},
+				{Repository: "github.com/sourcegraph/src-cli", Branch: "feature"},
+			},
+		}, repos)
+		require.NoError(t, err)
+
+		var names []string
+		for _, w := range workspaces {
+			names = append(names, w.Repo.Name+"@"+w.Repo.Branch.Name)
+		}
+		assert.Equal(t, []string{
+			"github.com/sourcegraph/sourcegraph@main",
+			"github.com/sourcegraph/src-cli@main",
+			"github.com/sourcegraph/src-cli@feature",
+		}, names)
+		assert.Len(t, resolved, 3)
+
+		assert.Equal(t, mainRev, workspaces[1].Repo.Rev())
+		assert.Equal(t, "refs/heads/main", workspaces[1].Repo.BaseRef())
+		assert.Equal(t, featureRev, workspaces[2].Repo.Rev())
+		assert.Equal(t, "refs/heads/feature", workspaces[2].Repo.BaseRef())
+		assert.Equal(t, "local:github.com/sourcegraph/src-cli", workspaces[2].Repo.ID)
+	})
+
+	t.Run("queries", func(t *testing.T) {
+		workspaces, _, err := svc.ResolveLocalWorkspacesForBatchSpec(ctx, &batcheslib.BatchSpec{
+			On: []batcheslib.OnQueryOrRepository{
+				{RepositoriesMatchingQuery: "repo:^github\\.com/ -repo:sourcegraph$"},
+			},
+		}, repos)
+		require.NoError(t, err)
+		require.Len(t, workspaces, 1)
+		assert.Equal(t, "github.com/sourcegraph/src-cli", workspaces[0].Repo.Name)
+
+		_, _, err = svc.ResolveLocalWorkspacesForBatchSpec(ctx, &batcheslib.BatchSpec{
+			On: []batcheslib.OnQueryOrRepository{{RepositoriesMatchingQuery: "file:README.md"}},
+		}, repos)
+		assert.ErrorContains(t, err, "only repo: filters")
+	})
+
+	t.Run("workspaces", func(t *testing.T) {
+		workspaces, _, err := svc.ResolveLocalWorkspacesForBatchSpec(ctx, &batcheslib.BatchSpec{
+			On: []batcheslib.OnQueryOrRepository{{Repository: "github.com/sourcegraph/src-cli"}},
+			Workspaces: []batcheslib.WorkspaceConfiguration{
+				{RootAtLocationOf: "package.json", In: "github.com/*/src-cli", OnlyFetchWorkspace: true},
+			},
+		}, repos)
+		require.NoError(t, err)
+
+		var paths []string
+		for _, w := range workspaces {
+			paths = append(paths, w.Path)
+			assert.False(t, w.OnlyFetchWorkspace)
+		}
+		assert.Equal(t, []string{"a", "a/b", "c"}, paths)
+	})
+
+	t.Run("missing repository", func(t *testing.T) {
+		_, _, err := svc.ResolveLocalWorkspacesForBatchSpec(ctx, &batcheslib.BatchSpec{
+			On: []batcheslib.OnQueryOrRepository{{Repository: "github.com/sourcegraph/missing"}},
+		}, repos)
+		assert.ErrorContains(t, err, "not found in local repositories")
+	})
+
+	t.Run("missing branch", func(t *testing.T) {
+		_, _, err := svc.ResolveLocalWorkspacesForBatchSpec(ctx, &batcheslib.BatchSpec{
+			On: []batcheslib.OnQueryOrRepository{{Repository: "gitlab.com/other", Branch: "missing"}},
+		}, repos)
+		assert.ErrorContains(t, err, `branch "missing" not found`)
+	})
+}
+
+func createLocalTestRepo(t *testing.T, dir string, files map[string]string) string {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	runLocalTestGit(t, dir, "init", "-q", "-b", "main")
+	runLocalTestGit(t, dir, "add", "--all")
+	runLocalTestGit(t, dir, "commit", "-q", "-m", "Initial commit")
+	return dir
+}
+
+func runLocalTestGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
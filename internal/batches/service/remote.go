@@ -327,3 +327,265 @@ func (svc *Service) GetBatchSpecWorkspaceResolution(ctx context.Context, id stri
 
 	return &resp.Node.WorkspaceResolution, nil
 }
+
+const batchSpecExecutionQuery = `
+query BatchSpecExecution($batchSpec: ID!, $after: String) {
+    node(id: $batchSpec) {
+        ... on BatchSpec {
+            state
+            failureMessage
+            workspaceResolution {
+                workspaces(first: 100, after: $after) {
+                    nodes {
+                        __typename
+                        id
+                        state
+                        ... on VisibleBatchSpecWorkspace {
+                            failureMessage
+                            repository {
+                                name
+                            }
+                            branch {
+                                displayName
+                            }
+                            path
+                        }
+                    }
+                    pageInfo {
+                        hasNextPage
+                        endCursor
+                    }
+                }
+            }
+        }
+    }
+}
+`
+
+// BatchSpecExecution is the state of the server-side execution of a batch
+// spec and of its workspaces.
+type BatchSpecExecution struct {
+	State          string
+	FailureMessage string
+	Workspaces     []*BatchSpecWorkspace
+}
+
+// Done returns true if the execution has finished, whether it succeeded or
+// not.
+func (e *BatchSpecExecution) Done() bool {
+	switch e.State {
+	case "COMPLETED", "FAILED", "CANCELED":
+		return true
+	}
+	return false
+}
+
+// BatchSpecWorkspace is a workspace of a server-side execution. Workspaces
+// in repositories the user can't access are hidden, and only have an ID and
+// a state.
+type BatchSpecWorkspace struct {
+	Typename       string `json:"__typename"`
+	ID             string `json:"id"`
+	State          string `json:"state"`
+	FailureMessage string `json:"failureMessage"`
+	Repository     struct {
+		Name string `json:"name"`
+	} `json:"repository"`
+	Branch struct {
+		DisplayName string `json:"displayName"`
+	} `json:"branch"`
+	Path string `json:"path"`
+}
+
+// Hidden returns true if the workspace is in a repository the user can't
+// access.
+func (w *BatchSpecWorkspace) Hidden() bool {
+	return w.Typename == "HiddenBatchSpecWorkspace"
+}
+
+// Done returns true if the workspace won't be executed any further.
+func (w *BatchSpecWorkspace) Done() bool {
+	switch w.State {
+	case "COMPLETED", "FAILED", "CANCELED", "SKIPPED":
+		return true
+	}
+	return false
+}
+
+// GetBatchSpecExecution returns the state of the execution of the batch spec
+// with the given ID and of all its workspaces.
+func (svc *Service) GetBatchSpecExecution(ctx context.Context, id string) (*BatchSpecExecution, error) {
+	var (
+		execution BatchSpecExecution
+		after     *string
+	)
+	for {
+		var resp struct {
+			Node *struct {
+				State               string `json:"state"`
+				FailureMessage      string `json:"failureMessage"`
+				WorkspaceResolution *struct {
+					Workspaces struct {
+						Nodes    []*BatchSpecWorkspace `json:"nodes"`
+						PageInfo pageInfo              `json:"pageInfo"`
+					} `json:"workspaces"`
+				} `json:"workspaceResolution"`
+			} `json:"node"`
+		}
+		if ok, err := svc.client.NewRequest(batchSpecExecutionQuery, map[string]any{
+			"batchSpec": id,
+			"after":     after,
+		}).Do(ctx, &resp); err != nil || !ok {
+			return nil, err
+		}
+		if resp.Node == nil {
+			return nil, errors.Newf("batch spec %q not found", id)
+		}
+
+		execution.State = resp.Node.State
+		execution.FailureMessage = resp.Node.FailureMessage
+		if resp.Node.WorkspaceResolution == nil {
+			return &execution, nil
+		}
+		workspaces := resp.Node.WorkspaceResolution.Workspaces
+		execution.Workspaces = append(execution.Workspaces, workspaces.Nodes...)
+		if !workspaces.PageInfo.HasNextPage {
+			return &execution, nil
+		}
+		after = &workspaces.PageInfo.EndCursor
+	}
+}
+
+// outputLinesPageSize is the number of lines of the log of a step that are
+// requested at once.
+const outputLinesPageSize = 1000
+
+const batchSpecWorkspaceStepsQuery = `
+query BatchSpecWorkspaceSteps($workspace: ID!, $first: Int!) {
+    node(id: $workspace) {
+        ... on VisibleBatchSpecWorkspace {
+            steps {
+                number
+                run
+                exitCode
+                outputLines(first: $first) {
+                    nodes
+                    pageInfo {
+                        hasNextPage
+                        endCursor
+                    }
+                }
+            }
+        }
+    }
+}
+`
+
+const batchSpecWorkspaceStepOutputLinesQuery = `
+query BatchSpecWorkspaceStepOutputLines($workspace: ID!, $step: Int!, $first: Int!, $after: String) {
+    node(id: $workspace) {
+        ... on VisibleBatchSpecWorkspace {
+            step(index: $step) {
+                outputLines(first: $first, after: $after) {
+                    nodes
+                    pageInfo {
+                        hasNextPage
+                        endCursor
+                    }
+                }
+            }
+        }
+    }
+}
+`
+
+// BatchSpecWorkspaceStep is a step executed in a workspace, with its log.
+type BatchSpecWorkspaceStep struct {
+	Number      int                 `json:"number"`
+	Run         string              `json:"run"`
+	ExitCode    *int                `json:"exitCode"`
+	OutputLines stepOutputLinesPage `json:"outputLines"`
+}
+
+type stepOutputLinesPage struct {
+	Nodes    []string `json:"nodes"`
+	PageInfo pageInfo `json:"pageInfo"`
+}
+
+// GetBatchSpecWorkspaceSteps returns the steps of the workspace with the
+// given ID, with their complete logs.
+func (svc *Service) GetBatchSpecWorkspaceSteps(ctx context.Context, id string) ([]BatchSpecWorkspaceStep, error) {
+	var resp struct {
+		Node *struct {
+			Steps []BatchSpecWorkspaceStep `json:"steps"`
+		} `json:"node"`
+	}
+	if ok, err := svc.client.NewRequest(batchSpecWorkspaceStepsQuery, map[string]any{
+		"workspace": id,
+		"first":     outputLinesPageSize,
+	}).Do(ctx, &resp); err != nil || !ok {
+		return nil, err
+	}
+	if resp.Node == nil {
+		return nil, errors.Newf("workspace %q not found", id)
+	}
+
+	// The logs are paged, and the end of a log is what's usually needed to
+	// find out why a step failed.
+	for i := range resp.Node.Steps {
+		step := &resp.Node.Steps[i]
+		for step.OutputLines.PageInfo.HasNextPage {
+			page, err := svc.getStepOutputLines(ctx, id, step.Number, step.OutputLines.PageInfo.EndCursor)
+			if err != nil || page == nil {
+				return nil, err
+			}
+			step.OutputLines.Nodes = append(step.OutputLines.Nodes, page.Nodes...)
+			step.OutputLines.PageInfo = page.PageInfo
+		}
+	}
+	return resp.Node.Steps, nil
+}
+
+func (svc *Service) getStepOutputLines(ctx context.Context, workspace string, step int, after string) (*stepOutputLinesPage, error) {
+	var resp struct {
+		Node *struct {
+			Step *struct {
+				OutputLines stepOutputLinesPage `json:"outputLines"`
+			} `json:"step"`
+		} `json:"node"`
+	}
+	if ok, err := svc.client.NewRequest(batchSpecWorkspaceStepOutputLinesQuery, map[string]any{
+		"workspace": workspace,
+		"step":      step,
+		"first":     outputLinesPageSize,
+		"after":     after,
+	}).Do(ctx, &resp); err != nil || !ok {
+		return nil, err
+	}
+	if resp.Node == nil || resp.Node.Step == nil {
+		return nil, errors.Newf("step %d of workspace %q not found", step, workspace)
+	}
+	return &resp.Node.Step.OutputLines, nil
+}
+
+const cancelBatchSpecExecutionMutation = `
+mutation CancelBatchSpecExecution($batchSpec: ID!) {
+    cancelBatchSpecExecution(batchSpec: $batchSpec) {
+        id
+    }
+}
+`
+
+// CancelBatchSpecExecution cancels the server-side execution of the batch
+// spec with the given ID.
+func (svc *Service) CancelBatchSpecExecution(ctx context.Context, id string) error {
+	var resp struct {
+		CancelBatchSpecExecution struct {
+			ID string `json:"id"`
+		} `json:"cancelBatchSpecExecution"`
+	}
+	_, err := svc.client.NewRequest(cancelBatchSpecExecutionMutation, map[string]any{
+		"batchSpec": id,
+	}).Do(ctx, &resp)
+	return err
+}
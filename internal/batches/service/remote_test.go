@@ -290,3 +290,90 @@ func cloneRequest(req *http.Request) (*http.Request, error) {
 	clone.Body = io.NopCloser(bytes.NewReader(b.Bytes()))
 	return clone, nil
 }
+
+func TestService_GetBatchSpecExecution(t *testing.T) {
+	client := new(mockclient.Client)
+	svc := service.New(&service.Opts{Client: client})
+
+	cursor := "next"
+	for _, page := range []struct {
+		after    *string
+		response string
+	}{
+		{
+			response: `{"node":{"state":"PROCESSING","workspaceResolution":{"workspaces":{
+				"nodes":[{"__typename":"VisibleBatchSpecWorkspace","id":"w1","state":"FAILED","failureMessage":"step 1 failed","repository":{"name":"github.com/a/a"},"branch":{"displayName":"main"}}],
+				"pageInfo":{"hasNextPage":true,"endCursor":"next"}
+			}}}}`,
+		},
+		{
+			after: &cursor,
+			response: `{"node":{"state":"PROCESSING","workspaceResolution":{"workspaces":{
+				"nodes":[{"__typename":"HiddenBatchSpecWorkspace","id":"w2","state":"PROCESSING"}],
+				"pageInfo":{"hasNextPage":false}
+			}}}}`,
+		},
+	} {
+		req := new(mockclient.Request)
+		client.On("NewRequest", mock.Anything, map[string]any{
+			"batchSpec": "spec",
+			"after":     page.after,
+		}).Return(req).Once()
+		response := page.response
+		req.On("Do", mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				json.Unmarshal([]byte(response), args[1])
+			}).
+			Return(true, nil).
+			Once()
+	}
+
+	execution, err := svc.GetBatchSpecExecution(context.Background(), "spec")
+	assert.NoError(t, err)
+	assert.False(t, execution.Done())
+	assert.Len(t, execution.Workspaces, 2)
+
+	failed := execution.Workspaces[0]
+	assert.True(t, failed.Done())
+	assert.False(t, failed.Hidden())
+	assert.Equal(t, "github.com/a/a", failed.Repository.Name)
+	assert.Equal(t, "step 1 failed", failed.FailureMessage)
+
+	hidden := execution.Workspaces[1]
+	assert.False(t, hidden.Done())
+	assert.True(t, hidden.Hidden())
+	client.AssertExpectations(t)
+}
+
+func TestService_GetBatchSpecWorkspaceSteps(t *testing.T) {
+	client := new(mockclient.Client)
+	svc := service.New(&service.Opts{Client: client})
+
+	respond := func(vars map[string]any, response string) {
+		req := new(mockclient.Request)
+		client.On("NewRequest", mock.Anything, vars).Return(req).Once()
+		req.On("Do", mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				json.Unmarshal([]byte(response), args[1])
+			}).
+			Return(true, nil).
+			Once()
+	}
+
+	respond(map[string]any{"workspace": "w1", "first": 1000}, `{"node":{"steps":[
+		{"number":1,"run":"true","exitCode":0,"outputLines":{"nodes":["one"],"pageInfo":{"hasNextPage":false}}},
+		{"number":2,"run":"false","exitCode":1,"outputLines":{"nodes":["a"],"pageInfo":{"hasNextPage":true,"endCursor":"1"}}}
+	]}}`)
+	respond(map[string]any{"workspace": "w1", "step": 2, "first": 1000, "after": "1"},
+		`{"node":{"step":{"outputLines":{"nodes":["b"],"pageInfo":{"hasNextPage":true,"endCursor":"2"}}}}}`)
+	respond(map[string]any{"workspace": "w1", "step": 2, "first": 1000, "after": "2"},
+		`{"node":{"step":{"outputLines":{"nodes":["c"],"pageInfo":{"hasNextPage":false}}}}}`)
+
+	steps, err := svc.GetBatchSpecWorkspaceSteps(context.Background(), "w1")
+	assert.NoError(t, err)
+	assert.Len(t, steps, 2)
+	assert.Equal(t, []string{"one"}, steps[0].OutputLines.Nodes)
+	// The log of the failed step is read up to its end.
+	assert.Equal(t, []string{"a", "b", "c"}, steps[1].OutputLines.Nodes)
+	client.AssertExpectations(t)
+}
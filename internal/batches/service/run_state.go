@@ -0,0 +1,402 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/src-cli/internal/batches/executor"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+	"github.com/sourcegraph/src-cli/internal/batches/util"
+)
+
+// RunStateMaxAge is the age after which a run state is no longer resumed.
+// Changeset specs that are not attached to a batch spec expire on the
+// Sourcegraph instance, so their IDs can't be reused forever.
+const RunStateMaxAge = 24 * time.Hour
+
+// RunState is the journal of a single execution of a batch spec. It records
+// the resolved workspaces, the outcome of every task, the uploaded changeset
+// specs and the created batch spec, and is written to disk after every
+// change. An interrupted execution can be resumed from it without executing
+// and uploading everything again.
+type RunState struct {
+	path string
+
+	mu   sync.Mutex
+	data runStateData
+}
+
+type runStateData struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Spec      RunSpec   `json:"spec"`
+
+	Workspaces   []RepoWorkspace       `json:"workspaces,omitempty"`
+	Repositories []*graphql.Repository `json:"repositories,omitempty"`
+
+	// Tasks maps the slugs of tasks to their outcome.
+	Tasks map[string]TaskState `json:"tasks,omitempty"`
+
+	// ChangesetSpecs maps the checksums of uploaded changeset specs to their
+	// IDs.
+	ChangesetSpecs map[string]graphql.ChangesetSpecID `json:"changesetSpecs,omitempty"`
+
+	BatchSpecID            graphql.BatchSpecID `json:"batchSpecID,omitempty"`
+	BatchSpecURL           string              `json:"batchSpecURL,omitempty"`
+	WorkspaceFilesUploaded bool                `json:"workspaceFilesUploaded,omitempty"`
+
+	// Completed is set once the execution has completed. The run states of
+	// completed executions are only kept if tasks failed, so that they can
+	// be retried.
+	Completed bool `json:"completed,omitempty"`
+}
+
+// TaskState is the outcome of a task recorded in a RunState.
+type TaskState struct {
+	// Specs are the changeset specs built for a task that finished
+	// successfully.
+	Specs []*batcheslib.ChangesetSpec `json:"specs,omitempty"`
+	// Error is set if the task failed.
+	Error string `json:"error,omitempty"`
+}
+
+// RunSpec identifies the batch spec an execution is run for, and where it's
+// run.
+type RunSpec struct {
+	Endpoint string `json:"endpoint"`
+	// Namespace is the ID of the namespace the batch spec is created in, as
+	// resolved by Service.ResolveNamespace. It's empty for local
+	// repositories.
+	Namespace    string `json:"namespace"`
+	BatchSpecDir string `json:"batchSpecDir"`
+	// SpecHash is the SHA-256 hash of the raw batch spec.
+	SpecHash string `json:"specHash"`
+	// WorkspacesHash is the SHA-256 hash of the parts of the batch spec the
+	// workspaces are resolved from.
+	WorkspacesHash string `json:"workspacesHash"`
+}
+
+// NewRunSpec returns the RunSpec of an execution of the given batch spec in the
+// namespace with the given ID.
+func NewRunSpec(endpoint, namespaceID, batchSpecDir, rawSpec string, spec *batcheslib.BatchSpec) (RunSpec, error) {
+	workspaces, err := json.Marshal(struct {
+		On         []batcheslib.OnQueryOrRepository    `json:"on"`
+		Workspaces []batcheslib.WorkspaceConfiguration `json:"workspaces"`
+	}{spec.On, spec.Workspaces})
+	if err != nil {
+		return RunSpec{}, errors.Wrap(err, "marshalling workspaces of batch spec")
+	}
+	return RunSpec{
+		Endpoint:       endpoint,
+		Namespace:      namespaceID,
+		BatchSpecDir:   batchSpecDir,
+		SpecHash:       sha256Hex([]byte(rawSpec)),
+		WorkspacesHash: sha256Hex(workspaces),
+	}, nil
+}
+
+// ID returns the ID of the run state for an execution of the spec. Executions
+// only share a run state if they have the same ID.
+func (s RunSpec) ID() string {
+	h := sha256.New()
+	for _, part := range []string{s.Endpoint, s.Namespace, s.BatchSpecDir, s.SpecHash} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// NewRunState returns a new, empty run state for an execution of the spec that
+// is persisted in dir.
+func NewRunState(dir string, spec RunSpec) *RunState {
+	id := spec.ID()
+	return &RunState{
+		path: runStatePath(dir, id),
+		data: runStateData{ID: id, CreatedAt: time.Now(), Spec: spec},
+	}
+}
+
+// LoadRunState loads the run state with the given ID from dir. If there is
+// none or it's older than RunStateMaxAge, found is false.
+func LoadRunState(dir, id string) (state *RunState, found bool, err error) {
+	path := runStatePath(dir, id)
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, errors.Wrap(err, "reading run state")
+	}
+
+	state = &RunState{path: path}
+	if err := json.Unmarshal(raw, &state.data); err != nil {
+		return nil, false, errors.Wrapf(err, "parsing run state %s", path)
+	}
+	if state.data.ID != id || time.Since(state.data.CreatedAt) > RunStateMaxAge {
+		return nil, false, nil
+	}
+	return state, true, nil
+}
+
+func runStatePath(dir, id string) string {
+	return filepath.Join(dir, "runs", id+".json")
+}
+
+// Path returns the path of the file the run state is persisted in.
+func (s *RunState) Path() string { return s.path }
+
+// ID returns the ID of the run state.
+func (s *RunState) ID() string { return s.data.ID }
+
+// ErrRunSpecChanged is returned by RunState.RetryFailed if the batch spec
+// changed since the execution.
+var ErrRunSpecChanged = errors.New("the batch spec changed since the execution")
+
+// RetryFailed returns a new run state for an execution of the spec, persisted
+// in dir, for retrying the failed tasks of the execution. It has the outcomes
+// of the tasks of the execution that finished successfully, so that only the
+// failed and unfinished tasks are executed again and the changeset specs of
+// the others are reused. The uploaded changeset specs and the batch spec
+// aren't carried over, since they belong to the batch spec created by the
+// execution.
+//
+// The execution must have been run for the same Sourcegraph instance and
+// namespace. If the batch spec changed, ErrRunSpecChanged is returned, unless
+// allowChangedSpec is true. The workspaces of the execution are only reused if
+// the parts of the batch spec they're resolved from didn't change.
+func (s *RunState) RetryFailed(dir string, spec RunSpec, allowChangedSpec bool) (*RunState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev := s.data.Spec
+	if prev.Endpoint != spec.Endpoint || prev.Namespace != spec.Namespace {
+		return nil, errors.New("the execution wasn't run for the same Sourcegraph instance and namespace")
+	}
+	if (prev.BatchSpecDir != spec.BatchSpecDir || prev.SpecHash != spec.SpecHash) && !allowChangedSpec {
+		return nil, ErrRunSpecChanged
+	}
+
+	retry := NewRunState(dir, spec)
+	if prev.WorkspacesHash == spec.WorkspacesHash {
+		retry.data.Workspaces = s.data.Workspaces
+		retry.data.Repositories = s.data.Repositories
+	}
+	for slug, state := range s.data.Tasks {
+		if state.Error != "" {
+			continue
+		}
+		if retry.data.Tasks == nil {
+			retry.data.Tasks = make(map[string]TaskState)
+		}
+		retry.data.Tasks[slug] = state
+	}
+	return retry, retry.save()
+}
+
+// Workspaces returns the recorded workspaces and repositories, if any.
+func (s *RunState) Workspaces() ([]RepoWorkspace, []*graphql.Repository, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.data.Workspaces, s.data.Repositories, s.data.Workspaces != nil
+}
+
+// SetWorkspaces records the resolved workspaces and repositories.
+func (s *RunState) SetWorkspaces(workspaces []RepoWorkspace, repos []*graphql.Repository) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Workspaces = workspaces
+	if s.data.Workspaces == nil {
+		s.data.Workspaces = []RepoWorkspace{}
+	}
+	s.data.Repositories = repos
+	return s.save()
+}
+
+var _ executor.TaskJournal = &RunState{}
+
+// TaskFinished implements executor.TaskJournal.
+func (s *RunState) TaskFinished(task *executor.Task, specs []*batcheslib.ChangesetSpec, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data.Tasks == nil {
+		s.data.Tasks = make(map[string]TaskState)
+	}
+	state := TaskState{Specs: specs}
+	if err != nil {
+		state = TaskState{Error: err.Error()}
+	}
+	s.data.Tasks[taskSlug(task)] = state
+	return s.save()
+}
+
+// FailedTasks returns the number of tasks that failed.
+func (s *RunState) FailedTasks() (n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, state := range s.data.Tasks {
+		if state.Error != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// SkipFinishedTasks returns the tasks that haven't finished successfully yet,
+// and the changeset specs built for the others.
+func (s *RunState) SkipFinishedTasks(tasks []*executor.Task) (remaining []*executor.Task, specs []*batcheslib.ChangesetSpec) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, task := range tasks {
+		state, ok := s.data.Tasks[taskSlug(task)]
+		if !ok || state.Error != "" {
+			remaining = append(remaining, task)
+			continue
+		}
+		specs = append(specs, state.Specs...)
+	}
+	return remaining, specs
+}
+
+// ChangesetSpecID returns the ID of the given changeset spec, if an identical
+// spec has already been uploaded.
+func (s *RunState) ChangesetSpecID(spec *batcheslib.ChangesetSpec) (graphql.ChangesetSpecID, bool, error) {
+	sum, err := changesetSpecChecksum(spec)
+	if err != nil {
+		return "", false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.data.ChangesetSpecs[sum]
+	return id, ok, nil
+}
+
+// ChangesetSpecUploaded records the ID of an uploaded changeset spec.
+func (s *RunState) ChangesetSpecUploaded(spec *batcheslib.ChangesetSpec, id graphql.ChangesetSpecID) error {
+	sum, err := changesetSpecChecksum(spec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data.ChangesetSpecs == nil {
+		s.data.ChangesetSpecs = make(map[string]graphql.ChangesetSpecID)
+	}
+	s.data.ChangesetSpecs[sum] = id
+	return s.save()
+}
+
+// BatchSpec returns the ID and URL of the created batch spec, if any.
+func (s *RunState) BatchSpec() (graphql.BatchSpecID, string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.data.BatchSpecID, s.data.BatchSpecURL, s.data.BatchSpecID != ""
+}
+
+// BatchSpecCreated records the ID and URL of the created batch spec.
+func (s *RunState) BatchSpecCreated(id graphql.BatchSpecID, url string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.BatchSpecID = id
+	s.data.BatchSpecURL = url
+	return s.save()
+}
+
+// WorkspaceFilesUploaded returns whether the workspace files of the batch
+// spec have been uploaded.
+func (s *RunState) WorkspaceFilesUploaded() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.data.WorkspaceFilesUploaded
+}
+
+// SetWorkspaceFilesUploaded records that the workspace files of the batch
+// spec have been uploaded.
+func (s *RunState) SetWorkspaceFilesUploaded() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.WorkspaceFilesUploaded = true
+	return s.save()
+}
+
+// Completed returns whether the execution has completed.
+func (s *RunState) Completed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.data.Completed
+}
+
+// SetCompleted records that the execution has completed.
+func (s *RunState) SetCompleted() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Completed = true
+	return s.save()
+}
+
+// Remove deletes the persisted run state. It's called once the execution
+// has completed, since there's nothing left to resume.
+func (s *RunState) Remove() error {
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "removing run state")
+	}
+	return nil
+}
+
+// save writes the run state to disk. The caller must hold s.mu.
+func (s *RunState) save() error {
+	raw, err := json.Marshal(&s.data)
+	if err != nil {
+		return errors.Wrap(err, "serializing run state")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return errors.Wrap(err, "creating run state directory")
+	}
+
+	// Write to a temporary file first, so that an interruption never leaves a
+	// truncated run state behind.
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0600); err != nil {
+		return errors.Wrap(err, "writing run state")
+	}
+	return errors.Wrap(os.Rename(tmp, s.path), "writing run state")
+}
+
+func taskSlug(task *executor.Task) string {
+	return util.SlugForPathInRepo(task.Repository.Name, task.Repository.Rev(), task.Path)
+}
+
+func changesetSpecChecksum(spec *batcheslib.ChangesetSpec) (string, error) {
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return "", errors.Wrap(err, "marshalling changeset spec JSON")
+	}
+	return sha256Hex(raw), nil
+}
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/batches/template"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/src-cli/internal/batches/docker"
+	"github.com/sourcegraph/src-cli/internal/batches/executor"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+	"github.com/sourcegraph/src-cli/internal/batches/mock"
+	"github.com/sourcegraph/src-cli/internal/batches/repozip"
+	"github.com/sourcegraph/src-cli/internal/batches/workspace"
+)
+
+func TestRunState(t *testing.T) {
+	dir := t.TempDir()
+	runSpec := testRunSpec(t, "https://sourcegraph.test", "name: test")
+	id := runSpec.ID()
+
+	repo1 := &graphql.Repository{ID: "repo-1", Name: "github.com/sourcegraph/src-cli", DefaultBranch: &graphql.Branch{Name: "main", Target: graphql.Target{OID: "c0ff33"}}}
+	repo2 := &graphql.Repository{ID: "repo-2", Name: "github.com/sourcegraph/sourcegraph", DefaultBranch: &graphql.Branch{Name: "main", Target: graphql.Target{OID: "d34db33f"}}}
+	workspaces := []RepoWorkspace{{Repo: repo1}, {Repo: repo2, Path: "a/b"}, {Repo: repo2, Path: "c"}}
+	tasks := buildTasks(nil, nil, workspaces)
+
+	spec := &batcheslib.ChangesetSpec{
+		BaseRepository: repo1.ID,
+		BaseRef:        "refs/heads/main",
+		BaseRev:        "c0ff33",
+		HeadRepository: repo1.ID,
+		HeadRef:        "refs/heads/test",
+		Title:          "Test",
+		Commits: []batcheslib.GitCommitDescription{
+			{Version: 2, Message: "Test", Diff: []byte("diff")},
+		},
+	}
+
+	_, found, err := LoadRunState(dir, id)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	state := NewRunState(dir, runSpec)
+	_, _, ok := state.Workspaces()
+	assert.False(t, ok)
+
+	require.NoError(t, state.SetWorkspaces(workspaces, []*graphql.Repository{repo1, repo2}))
+	require.NoError(t, state.TaskFinished(tasks[0], []*batcheslib.ChangesetSpec{spec}, nil))
+	require.NoError(t, state.TaskFinished(tasks[1], nil, errors.New("step failed")))
+	require.NoError(t, state.ChangesetSpecUploaded(spec, "spec-1"))
+	require.NoError(t, state.BatchSpecCreated("batch-spec-1", "/users/test/batch-changes/apply/batch-spec-1"))
+
+	// Executions of other batch specs don't share the run state.
+	_, found, err = LoadRunState(dir, testRunSpec(t, "https://sourcegraph.test", "name: other").ID())
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	resumed, found, err := LoadRunState(dir, id)
+	require.NoError(t, err)
+	require.True(t, found)
+
+	haveWorkspaces, haveRepos, ok := resumed.Workspaces()
+	require.True(t, ok)
+	assert.Equal(t, workspaces, haveWorkspaces)
+	assert.Equal(t, []*graphql.Repository{repo1, repo2}, haveRepos)
+
+	// Failed and unfinished tasks are executed again.
+	remaining, specs := resumed.SkipFinishedTasks(buildTasks(nil, nil, workspaces))
+	require.Len(t, remaining, 2)
+	assert.Equal(t, "a/b", remaining[0].Path)
+	assert.Equal(t, "c", remaining[1].Path)
+	require.Len(t, specs, 1)
+
+	// The resumed spec is recognized as uploaded.
+	specID, uploaded, err := resumed.ChangesetSpecID(specs[0])
+	require.NoError(t, err)
+	assert.True(t, uploaded)
+	assert.Equal(t, graphql.ChangesetSpecID("spec-1"), specID)
+
+	_, uploaded, err = resumed.ChangesetSpecID(&batcheslib.ChangesetSpec{HeadRef: "refs/heads/other"})
+	require.NoError(t, err)
+	assert.False(t, uploaded)
+
+	batchSpecID, url, ok := resumed.BatchSpec()
+	assert.True(t, ok)
+	assert.Equal(t, graphql.BatchSpecID("batch-spec-1"), batchSpecID)
+	assert.Equal(t, "/users/test/batch-changes/apply/batch-spec-1", url)
+	assert.False(t, resumed.WorkspaceFilesUploaded())
+
+	require.NoError(t, resumed.Remove())
+	assert.NoFileExists(t, resumed.Path())
+	_, found, err = LoadRunState(dir, id)
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestRunState_RetryFailed(t *testing.T) {
+	repo := &graphql.Repository{ID: "repo-1", Name: "github.com/sourcegraph/src-cli", DefaultBranch: &graphql.Branch{Name: "main", Target: graphql.Target{OID: "c0ff33"}}}
+	workspaces := []RepoWorkspace{{Repo: repo, Path: "a"}, {Repo: repo, Path: "b"}, {Repo: repo, Path: "c"}}
+	spec := &batcheslib.ChangesetSpec{BaseRepository: repo.ID, HeadRef: "refs/heads/a"}
+	runSpec := testRunSpec(t, "https://sourcegraph.test", "name: test\non:\n  - repository: github.com/sourcegraph/src-cli\n")
+
+	// previous returns the completed execution of runSpec, in which the
+	// first task succeeded, the second one failed and the third one didn't
+	// finish.
+	previous := func(t *testing.T, dir string) *RunState {
+		t.Helper()
+
+		tasks := buildTasks(nil, nil, workspaces)
+		state := NewRunState(dir, runSpec)
+		require.NoError(t, state.SetWorkspaces(workspaces, []*graphql.Repository{repo}))
+		require.NoError(t, state.TaskFinished(tasks[0], []*batcheslib.ChangesetSpec{spec}, nil))
+		require.NoError(t, state.TaskFinished(tasks[1], nil, errors.New("step failed")))
+		require.NoError(t, state.ChangesetSpecUploaded(spec, "spec-1"))
+		require.NoError(t, state.BatchSpecCreated("batch-spec-1", "/batch-changes/apply/batch-spec-1"))
+		require.NoError(t, state.SetCompleted())
+		assert.Equal(t, 1, state.FailedTasks())
+
+		loaded, found, err := LoadRunState(dir, runSpec.ID())
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.True(t, loaded.Completed())
+		return loaded
+	}
+
+	t.Run("same spec", func(t *testing.T) {
+		dir := t.TempDir()
+		retry, err := previous(t, dir).RetryFailed(dir, runSpec, false)
+		require.NoError(t, err)
+		assert.Equal(t, runSpec.ID(), retry.ID())
+		assert.FileExists(t, retry.Path())
+		assert.False(t, retry.Completed())
+
+		// The workspaces aren't resolved again.
+		haveWorkspaces, _, ok := retry.Workspaces()
+		require.True(t, ok)
+		assert.Equal(t, workspaces, haveWorkspaces)
+
+		// Only the failed and unfinished tasks are executed again, and the
+		// changeset specs of the successful ones are reused.
+		remaining, specs := retry.SkipFinishedTasks(buildTasks(nil, nil, workspaces))
+		require.Len(t, remaining, 2)
+		assert.Equal(t, "b", remaining[0].Path)
+		assert.Equal(t, "c", remaining[1].Path)
+		assert.Equal(t, []*batcheslib.ChangesetSpec{spec}, specs)
+		assert.Equal(t, 0, retry.FailedTasks())
+
+		// The changeset specs are uploaded again for the new batch spec.
+		_, uploaded, err := retry.ChangesetSpecID(spec)
+		require.NoError(t, err)
+		assert.False(t, uploaded)
+		_, _, ok = retry.BatchSpec()
+		assert.False(t, ok)
+	})
+
+	t.Run("changed spec", func(t *testing.T) {
+		dir := t.TempDir()
+		changed := testRunSpec(t, "https://sourcegraph.test", "name: test\non:\n  - repository: github.com/sourcegraph/src-cli\nsteps: []\n")
+
+		_, err := previous(t, dir).RetryFailed(dir, changed, false)
+		assert.ErrorIs(t, err, ErrRunSpecChanged)
+
+		// The workspaces are still reused if they're resolved from the
+		// same parts of the batch spec.
+		retry, err := previous(t, dir).RetryFailed(dir, changed, true)
+		require.NoError(t, err)
+		assert.Equal(t, changed.ID(), retry.ID())
+		_, _, ok := retry.Workspaces()
+		assert.True(t, ok)
+		remaining, _ := retry.SkipFinishedTasks(buildTasks(nil, nil, workspaces))
+		assert.Len(t, remaining, 2)
+	})
+
+	t.Run("changed workspaces", func(t *testing.T) {
+		dir := t.TempDir()
+		changed := testRunSpec(t, "https://sourcegraph.test", "name: test\non:\n  - repository: github.com/sourcegraph/sourcegraph\n")
+
+		retry, err := previous(t, dir).RetryFailed(dir, changed, true)
+		require.NoError(t, err)
+		_, _, ok := retry.Workspaces()
+		assert.False(t, ok)
+	})
+
+	t.Run("other instance", func(t *testing.T) {
+		dir := t.TempDir()
+		other := testRunSpec(t, "https://other.test", "name: test\non:\n  - repository: github.com/sourcegraph/src-cli\n")
+
+		_, err := previous(t, dir).RetryFailed(dir, other, true)
+		assert.ErrorContains(t, err, "same Sourcegraph instance")
+	})
+}
+
+func TestLoadRunState_Expired(t *testing.T) {
+	dir := t.TempDir()
+	state := NewRunState(dir, testRunSpec(t, "https://sourcegraph.test", "name: expired"))
+	state.data.CreatedAt = time.Now().Add(-RunStateMaxAge - time.Minute)
+	require.NoError(t, state.SetWorkspaces(nil, nil))
+
+	_, found, err := LoadRunState(dir, state.ID())
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestLoadRunState_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	state := NewRunState(dir, testRunSpec(t, "https://sourcegraph.test", "name: invalid"))
+	require.NoError(t, state.SetWorkspaces(nil, nil))
+	require.NoError(t, os.WriteFile(state.Path(), []byte("{"), 0600))
+
+	_, _, err := LoadRunState(dir, state.ID())
+	var syntaxErr *json.SyntaxError
+	assert.True(t, errors.As(err, &syntaxErr))
+}
+
+func testRunSpec(t *testing.T, endpoint, rawSpec string) RunSpec {
+	t.Helper()
+
+	spec, err := batcheslib.ParseBatchSpec([]byte(rawSpec))
+	require.NoError(t, err)
+	runSpec, err := NewRunSpec(endpoint, "", "/specs", rawSpec, spec)
+	require.NoError(t, err)
+	return runSpec
+}
+
+// cancellingJournal records tasks in a RunState and cancels the execution once
+// the first task finished.
+type cancellingJournal struct {
+	*RunState
+	cancel context.CancelFunc
+}
+
+func (j *cancellingJournal) TaskFinished(task *executor.Task, specs []*batcheslib.ChangesetSpec, err error) error {
+	defer j.cancel()
+	return j.RunState.TaskFinished(task, specs, err)
+}
+
+func TestRunState_InterruptedExecution(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test doesn't work on Windows because the fake runtime runs bash")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repoDir := createLocalTestRepo(t, t.TempDir(), map[string]string{"README.md": "# README\n"})
+	rev := runLocalTestGit(t, repoDir, "rev-parse", "HEAD")
+	newTask := func(name, run string) *executor.Task {
+		return &executor.Task{
+			Repository: &graphql.Repository{
+				ID:     name,
+				Name:   "github.com/sourcegraph/" + name,
+				Branch: graphql.Branch{Name: "main", Target: graphql.Target{OID: rev}},
+			},
+			Steps:                 []batcheslib.Step{{Container: "alpine:3", Run: run}},
+			BatchChangeAttributes: &template.BatchChangeAttributes{Name: "test"},
+		}
+	}
+	tasks := []*executor.Task{
+		newTask("fast", "echo fast >> README.md"),
+		newTask("slow", "exec sleep 30"),
+	}
+	batchSpec := &batcheslib.BatchSpec{
+		ChangesetTemplate: &batcheslib.ChangesetTemplate{
+			Title:  "Test",
+			Branch: "test",
+			Commit: batcheslib.ExpandedGitCommitDescription{Message: "Test"},
+		},
+	}
+
+	dir := t.TempDir()
+	runSpec := testRunSpec(t, "https://sourcegraph.test", "name: test")
+	state := NewRunState(dir, runSpec)
+
+	tempDir := t.TempDir()
+	rt := &mock.ContainerRuntime{}
+	images := map[string]docker.Image{"alpine:3": &mock.Image{RawDigest: "sha256:alpine"}}
+	wc, _ := workspace.NewCreator(ctx, rt, "bind", tempDir, tempDir, images)
+	coord := executor.NewCoordinator(executor.NewCoordinatorOpts{
+		ExecOpts: executor.NewExecutorOpts{
+			Creator: wc,
+			Runtime: rt,
+			RepoArchiveRegistry: repozip.NewLocalArchiveRegistry(map[string]string{
+				"github.com/sourcegraph/fast": repoDir,
+				"github.com/sourcegraph/slow": repoDir,
+			}, tempDir),
+			EnsureImage: func(_ context.Context, name string) (docker.Image, error) {
+				return images[name], nil
+			},
+			Logger:      mock.LogNoOpManager{},
+			TempDir:     tempDir,
+			Parallelism: 2,
+			Timeout:     time.Minute,
+		},
+		Cache:   executor.ExecutionDiskCache{Dir: t.TempDir()},
+		Logger:  mock.LogNoOpManager{},
+		Journal: &cancellingJournal{RunState: state, cancel: cancel},
+	})
+
+	_, _, err := coord.ExecuteAndBuildSpecs(ctx, batchSpec, tasks, executor.NoopTaskExecUI{})
+	require.Error(t, err)
+
+	// The task that finished before the execution was cancelled is in the
+	// state file, so that it isn't executed again.
+	resumed, found, err := LoadRunState(dir, runSpec.ID())
+	require.NoError(t, err)
+	require.True(t, found)
+	remaining, specs := resumed.SkipFinishedTasks([]*executor.Task{newTask("fast", ""), newTask("slow", "")})
+	require.Len(t, remaining, 1)
+	assert.Equal(t, "slow", remaining[0].Repository.ID)
+	require.Len(t, specs, 1)
+	assert.Equal(t, "fast", specs[0].HeadRepository)
+}
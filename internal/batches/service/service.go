@@ -285,7 +285,8 @@ func (svc *Service) ResolveWorkspacesForBatchSpec(ctx context.Context, spec *bat
 
 // EnsureDockerImages iterates over the steps within the batch spec to ensure the
 // images exist and to determine the exact content digest to be used when running
-// each step, including any required by the service itself.
+// each step, including any required by the service itself. Images created by
+// buildImage steps are built and returned under their generated names.
 //
 // Progress information is reported back to the given progress function.
 func (svc *Service) EnsureDockerImages(
@@ -299,7 +300,30 @@ func (svc *Service) EnsureDockerImages(
 	// still depend on runtime values, such as outputs from earlier steps, are
 	// resolved and pulled just-in-time by the executor.
 	names := map[string]struct{}{}
+	// Images created by buildImage steps are built once their base image has
+	// been pulled, as long as neither the base image nor the script depend on
+	// runtime values.
+	type imageBuild struct {
+		baseImage string
+		script    string
+	}
+	builds := map[imageBuild]struct{}{}
 	for i := range steps {
+		if b := steps[i].BuildImage; b != nil {
+			isStaticBase, baseImage, err := templatelib.IsStaticString(b.BaseImage, &templatelib.StepContext{})
+			if err != nil {
+				return nil, err
+			}
+			isStaticRun, script, err := templatelib.IsStaticString(b.Run, &templatelib.StepContext{})
+			if err != nil {
+				return nil, err
+			}
+			if isStaticBase && isStaticRun {
+				names[baseImage] = struct{}{}
+				builds[imageBuild{baseImage: baseImage, script: script}] = struct{}{}
+			}
+		}
+
 		isStatic, name, err := templatelib.IsStaticString(steps[i].Container, &templatelib.StepContext{})
 		if err != nil {
 			return nil, err
@@ -307,10 +331,14 @@ func (svc *Service) EnsureDockerImages(
 		if !isStatic {
 			continue
 		}
+		// Coding agent and buildImage steps may not declare an image at all.
+		if (steps[i].CodingAgent != nil || steps[i].BuildImage != nil) && name == "" {
+			continue
+		}
 		names[name] = struct{}{}
 	}
 
-	total := len(names)
+	total := len(names) + len(builds)
 	progress(0, total)
 
 	// Set up the channels that will be used in the parallel goroutines handling
@@ -332,8 +360,8 @@ func (svc *Service) EnsureDockerImages(
 	if parallelism < 1 {
 		parallelism = 1
 	}
-	if parallelism > total {
-		parallelism = total
+	if parallelism > len(names) {
+		parallelism = len(names)
 	}
 	var wg sync.WaitGroup
 	for i := 0; i < parallelism; i++ {
@@ -394,6 +422,17 @@ func (svc *Service) EnsureDockerImages(
 		progress(i, total)
 	}
 
+	for b := range builds {
+		name, img, err := imageCache.Build(ctx, b.baseImage, b.script)
+		if err != nil {
+			return nil, err
+		}
+
+		images[name] = img
+		i += 1
+		progress(i, total)
+	}
+
 	return images, nil
 }
 
@@ -483,15 +522,19 @@ func (e *duplicateBranchesErr) Error() string {
 	return out.String()
 }
 
-func (svc *Service) ParseBatchSpec(dir string, data []byte) (*batcheslib.BatchSpec, error) {
-	spec, err := batcheslib.ParseBatchSpec(data)
+// ParseBatchSpec expands the step libraries included by the batch spec in the
+// file with the given name in dir, and its variables with the given values,
+// then parses and validates it. The expanded batch spec is returned, too,
+// since that's what gets executed and uploaded.
+func (svc *Service) ParseBatchSpec(name, dir string, data []byte, vars map[string]string) (*batcheslib.BatchSpec, []byte, error) {
+	spec, expanded, err := batcheslib.ParseBatchSpecWithVariables(name, dir, data, vars)
 	if err != nil {
-		return nil, errors.Wrap(err, "parsing batch spec")
+		return nil, nil, errors.Wrap(err, "parsing batch spec")
 	}
 	if err = validateMount(dir, spec); err != nil {
-		return nil, errors.Wrap(err, "handling mount")
+		return nil, nil, errors.Wrap(err, "handling mount")
 	}
-	return spec, nil
+	return spec, expanded, nil
 }
 
 func validateMount(batchSpecDir string, spec *batcheslib.BatchSpec) error {
@@ -712,6 +755,38 @@ func (svc *Service) resolveRepositoryName(ctx context.Context, name string) (*gr
 	return result.Repository, nil
 }
 
+// ResolveRepositoryBranch resolves the repository with the given name and the
+// given branch in it. If branch is empty, the default branch of the repository
+// is used.
+func (svc *Service) ResolveRepositoryBranch(ctx context.Context, name, branch string) (*graphql.Repository, error) {
+	var result struct{ Repository *graphql.Repository }
+	if ok, err := svc.client.NewRequest(repositoryNameQuery, map[string]any{
+		"name":        name,
+		"queryCommit": branch != "",
+		"rev":         branch,
+	}).Do(ctx, &result); err != nil || !ok {
+		return nil, err
+	}
+	repo := result.Repository
+	if repo == nil {
+		return nil, errors.Newf("repository %q not found", name)
+	}
+
+	if branch == "" {
+		if repo.DefaultBranch == nil {
+			return nil, errors.Newf("repository %q has no default branch", name)
+		}
+		repo.Branch = *repo.DefaultBranch
+		return repo, nil
+	}
+
+	if repo.Commit.OID == "" {
+		return nil, errors.Newf("branch %q not found in repository %q", branch, name)
+	}
+	repo.Branch = graphql.Branch{Name: branch, Target: repo.Commit}
+	return repo, nil
+}
+
 func getGitConfig(attribute string) (string, error) {
 	cmd := exec.Command("git", "config", "--get", attribute)
 	out, err := cmd.CombinedOutput()
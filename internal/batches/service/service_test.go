@@ -15,6 +15,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/lib/errors"
 
 	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/batches/template"
 
 	"github.com/sourcegraph/src-cli/internal/batches/docker"
 	"github.com/sourcegraph/src-cli/internal/batches/graphql"
@@ -174,6 +175,42 @@ func TestEnsureDockerImages(t *testing.T) {
 				})
 			}
 		})
+
+		t.Run("built images", func(t *testing.T) {
+			var (
+				base  = &mock.Image{RawDigest: "base-digest"}
+				built = &mock.Image{RawDigest: "built-digest"}
+				name  = docker.BuiltImageName("base-digest", "apk add git")
+			)
+			images := map[string]docker.Image{
+				"alpine:3": base,
+				name:       built,
+			}
+
+			for _, parallelism := range parallelCases {
+				t.Run(fmt.Sprintf("%d worker(s)", parallelism), func(t *testing.T) {
+					progress := &mock.Progress{}
+
+					have, err := svc.EnsureDockerImages(
+						ctx,
+						&mock.ImageCache{Images: images},
+						[]batcheslib.Step{
+							{BuildImage: &batcheslib.BuildImageStep{BaseImage: "alpine:3", Run: "apk add git"}},
+							{Container: "${{ outputs.imageName }}", Run: "git version"},
+						},
+						parallelism,
+						progress.Callback(),
+					)
+					assert.Nil(t, err)
+					assert.Equal(t, images, have)
+					assert.Equal(t, []mock.ProgressCall{
+						{Done: 0, Total: 2},
+						{Done: 1, Total: 2},
+						{Done: 2, Total: 2},
+					}, progress.Calls)
+				})
+			}
+		})
 	})
 
 	t.Run("errors", func(t *testing.T) {
@@ -285,6 +322,43 @@ description: A test spec
 `,
 			expectedErr: errors.New("parsing batch spec: version: version must be one of the following: 1, 2, 3"),
 		},
+		{
+			name: "buildImage step declaring imageName",
+			rawSpec: `
+version: 3
+name: test-spec
+steps:
+  - buildImage:
+      baseImage: alpine:3
+      run: apk add git
+    outputs:
+      imageName:
+        value: other
+changesetTemplate:
+  title: Test
+  body: Test
+  branch: test
+  commit:
+    message: Test
+`,
+			expectedErr: errors.New("parsing batch spec: step 1: buildImage steps set the output imageName to the name of the built image, so it can't be declared in outputs"),
+		},
+		{
+			name: "supported template functions",
+			rawSpec: `
+name: test-spec
+templateFunctions: 2
+`,
+			expectedSpec: &batcheslib.BatchSpec{TemplateFunctions: 2, Name: "test-spec"},
+		},
+		{
+			name: "unsupported template functions",
+			rawSpec: `
+name: test-spec
+templateFunctions: 99
+`,
+			expectedErr: errors.Newf("parsing batch spec: batch spec requires template functions version 99, but only version %d is supported; please upgrade src-cli", template.FunctionsVersion),
+		},
 		{
 			name:         "mount absolute file",
 			batchSpecDir: tempDir,
@@ -639,7 +713,7 @@ changesetTemplate:
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			spec, err := svc.ParseBatchSpec(test.batchSpecDir, []byte(test.rawSpec))
+			spec, _, err := svc.ParseBatchSpec("batch.yaml", test.batchSpecDir, []byte(test.rawSpec), nil)
 			if test.expectedErr != nil {
 				assert.Equal(t, test.expectedErr.Error(), err.Error())
 			} else {
@@ -649,3 +723,230 @@ changesetTemplate:
 		})
 	}
 }
+
+func TestService_ParseBatchSpec_Includes(t *testing.T) {
+	svc := &Service{}
+
+	dir := t.TempDir()
+	writeFile := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	writeFile("steps/format.yaml", `
+params:
+  version: "1.21"
+  cpus: 1
+  packages: ~
+steps:
+  - run: gofmt -w ${{ params.packages }} ${{ repository.name }}
+    container: golang:${{ params.version }}
+    cpus: ${{ params.cpus }}
+`)
+	writeFile("hygiene/01-tidy.yaml", `
+steps:
+  - include: ../steps/format.yaml
+    with:
+      packages: ./tidy/...
+      cpus: 2
+`)
+	writeFile("hygiene/02-commit.yaml", `
+params:
+  message: hygiene
+steps:
+  - run: echo "${{ params.message }}" > MESSAGE
+    container: alpine:3
+`)
+	writeFile("mixed.yaml", `
+params:
+  prefix: src
+steps:
+  - run: echo ${{ printf "%s-%s" params.prefix repository.name }}
+    container: alpine:3
+`)
+	writeFile("cycle/a.yaml", `
+steps:
+  - include: b.yaml
+`)
+	writeFile("cycle/b.yaml", `
+steps:
+  - include: a.yaml
+`)
+
+	changesetTemplate := `
+changesetTemplate:
+  title: Test
+  body: Test
+  branch: test
+  commit:
+    message: Test
+`
+
+	t.Run("expanded", func(t *testing.T) {
+		raw := `name: test-spec
+steps:
+  - run: echo before
+    container: alpine:3
+  - include: steps
+    with:
+      packages: ./...
+      version: "1.22"
+  - include: ./hygiene
+` + changesetTemplate
+
+		spec, expanded, err := svc.ParseBatchSpec("batch.yaml", dir, []byte(raw), nil)
+		require.NoError(t, err)
+		assert.Equal(t, []batcheslib.Step{
+			{Run: "echo before", Container: "alpine:3"},
+			{Run: "gofmt -w ./... ${{ repository.name }}", Container: "golang:1.22", CPUs: 1},
+			{Run: "gofmt -w ./tidy/... ${{ repository.name }}", Container: "golang:1.21", CPUs: 2},
+			{Run: `echo "hygiene" > MESSAGE`, Container: "alpine:3"},
+		}, spec.Steps)
+
+		// The expanded spec parses to the same spec on its own, e.g. on the
+		// server.
+		assert.NotContains(t, string(expanded), "include")
+		reparsed, err := batcheslib.ParseBatchSpec(expanded)
+		require.NoError(t, err)
+		assert.Equal(t, spec, reparsed)
+	})
+
+	t.Run("without includes", func(t *testing.T) {
+		raw := `name: test-spec # unchanged
+steps:
+  - run: echo hello
+    container: alpine:3
+` + changesetTemplate
+
+		_, expanded, err := svc.ParseBatchSpec("batch.yaml", dir, []byte(raw), nil)
+		require.NoError(t, err)
+		assert.Equal(t, raw, string(expanded))
+	})
+
+	for name, tc := range map[string]struct {
+		steps   string
+		wantErr string
+	}{
+		"missing file": {
+			steps: `
+  - run: echo hello
+    container: alpine:3
+  - include: steps/missing.yaml`,
+			wantErr: `batch.yaml:5: including "steps/missing.yaml": `,
+		},
+		"missing parameter": {
+			steps: `
+  - include: steps/format.yaml`,
+			wantErr: `batch.yaml:3: including "steps/format.yaml": steps/format.yaml:5: missing required parameter "packages"`,
+		},
+		"unknown parameter": {
+			steps: `
+  - include: steps/format.yaml
+    with:
+      packages: ./...
+      pakages: ./...`,
+			wantErr: `batch.yaml:3: including "steps/format.yaml": unknown parameter "pakages"`,
+		},
+		"parameters mixed with runtime values": {
+			steps: `
+  - include: mixed.yaml`,
+			wantErr: `batch.yaml:3: including "mixed.yaml": mixed.yaml:5: template: params:1: function "repository" not defined`,
+		},
+		"other fields": {
+			steps: `
+  - include: steps/format.yaml
+    container: alpine:3`,
+			wantErr: `batch.yaml:3: including "steps/format.yaml": steps that include a step library can't set "container"`,
+		},
+		"cycle": {
+			steps: `
+  - include: cycle/a.yaml`,
+			wantErr: "include cycle: cycle/a.yaml -> cycle/b.yaml -> cycle/a.yaml",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			raw := "name: test-spec\nsteps:" + tc.steps + changesetTemplate
+			_, _, err := svc.ParseBatchSpec("batch.yaml", dir, []byte(raw), nil)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
+
+func TestService_ParseBatchSpec_Variables(t *testing.T) {
+	svc := &Service{}
+
+	raw := `name: test-spec
+variables:
+  org:
+    description: The organization.
+  go_version:
+    default: "1.20"
+  cpus:
+    type: number
+    default: 1
+  dry_run:
+    type: boolean
+    default: false
+on:
+  - repositoriesMatchingQuery: repo:^github.com/${{ vars.org }}/ file:go.mod
+steps:
+  - run: echo ${{ if vars.dry_run }}dry run${{ else }}go${{ end }} ${{ repository.name }}
+    container: golang:${{ vars.go_version }}
+    cpus: ${{ vars.cpus }}
+changesetTemplate:
+  title: Go ${{ vars.go_version }}
+  body: Test
+  branch: test
+  commit:
+    message: Test
+`
+
+	t.Run("expanded", func(t *testing.T) {
+		spec, expanded, err := svc.ParseBatchSpec("batch.yaml", "", []byte(raw), map[string]string{
+			"org":  "sourcegraph",
+			"cpus": "2",
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "repo:^github.com/sourcegraph/ file:go.mod", spec.On[0].RepositoriesMatchingQuery)
+		assert.Equal(t, []batcheslib.Step{
+			{Run: "echo go ${{ repository.name }}", Container: "golang:1.20", CPUs: 2},
+		}, spec.Steps)
+		assert.Equal(t, "Go 1.20", spec.ChangesetTemplate.Title)
+
+		// The variables are removed from the expanded spec, which is uploaded
+		// and parses to the same spec on its own.
+		assert.Nil(t, spec.Variables)
+		assert.NotContains(t, string(expanded), "variables:")
+		assert.NotContains(t, string(expanded), "vars.")
+		reparsed, err := batcheslib.ParseBatchSpec(expanded)
+		require.NoError(t, err)
+		assert.Equal(t, spec, reparsed)
+	})
+
+	for name, tc := range map[string]struct {
+		vars    map[string]string
+		wantErr string
+	}{
+		"missing variable": {
+			wantErr: `batch.yaml:3: variable "org": no value given, set it with -var org=VALUE`,
+		},
+		"unknown variable": {
+			vars:    map[string]string{"org": "sourcegraph", "orgs": "sourcegraph"},
+			wantErr: `batch.yaml: unknown variable "orgs"`,
+		},
+		"wrong type": {
+			vars:    map[string]string{"org": "sourcegraph", "cpus": "two"},
+			wantErr: `batch.yaml:7: variable "cpus": "two" isn't a number`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := svc.ParseBatchSpec("batch.yaml", "", []byte(raw), tc.vars)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
@@ -3,6 +3,7 @@ package ui
 import (
 	"github.com/sourcegraph/src-cli/internal/batches"
 	"github.com/sourcegraph/src-cli/internal/batches/executor"
+	"github.com/sourcegraph/src-cli/internal/batches/export"
 	"github.com/sourcegraph/src-cli/internal/batches/graphql"
 	"github.com/sourcegraph/src-cli/internal/batches/workspace"
 )
@@ -38,6 +39,10 @@ type ExecUI interface {
 	UploadingChangesetSpecsProgress(done, total int)
 	UploadingChangesetSpecsSuccess(ids []graphql.ChangesetSpecID)
 
+	ExportingChangesets(num int)
+	ExportingChangesetsProgress(done, total int)
+	ExportingChangesetsSuccess(result export.Result)
+
 	CreatingBatchSpec()
 	CreatingBatchSpecSuccess(previewURL string)
 	CreatingBatchSpecError(maxUnlicensedCS int, err error) error
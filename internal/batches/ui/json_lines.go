@@ -13,6 +13,7 @@ import (
 
 	"github.com/sourcegraph/src-cli/internal/batches"
 	"github.com/sourcegraph/src-cli/internal/batches/executor"
+	"github.com/sourcegraph/src-cli/internal/batches/export"
 	"github.com/sourcegraph/src-cli/internal/batches/graphql"
 	"github.com/sourcegraph/src-cli/internal/batches/workspace"
 
@@ -25,37 +26,40 @@ var _ ExecUI = &JSONLines{}
 
 type JSONLines struct {
 	BinaryDiffs bool
+	// Log is called with every event. If it's nil, the events are written to
+	// standard output as JSON lines.
+	Log func(batcheslib.LogEvent)
 }
 
 func (ui *JSONLines) ParsingBatchSpec() {
-	logOperationStart(batcheslib.LogEventOperationParsingBatchSpec, &batcheslib.ParsingBatchSpecMetadata{})
+	logOperationStart(ui.Log, batcheslib.LogEventOperationParsingBatchSpec, &batcheslib.ParsingBatchSpecMetadata{})
 }
 func (ui *JSONLines) ParsingBatchSpecSuccess() {
-	logOperationSuccess(batcheslib.LogEventOperationParsingBatchSpec, &batcheslib.ParsingBatchSpecMetadata{})
+	logOperationSuccess(ui.Log, batcheslib.LogEventOperationParsingBatchSpec, &batcheslib.ParsingBatchSpecMetadata{})
 }
 func (ui *JSONLines) ParsingBatchSpecFailure(err error) {
-	logOperationFailure(batcheslib.LogEventOperationParsingBatchSpec, &batcheslib.ParsingBatchSpecMetadata{Error: err.Error()})
+	logOperationFailure(ui.Log, batcheslib.LogEventOperationParsingBatchSpec, &batcheslib.ParsingBatchSpecMetadata{Error: err.Error()})
 }
 
 func (ui *JSONLines) ResolvingNamespace() {
-	logOperationStart(batcheslib.LogEventOperationResolvingNamespace, &batcheslib.ResolvingNamespaceMetadata{})
+	logOperationStart(ui.Log, batcheslib.LogEventOperationResolvingNamespace, &batcheslib.ResolvingNamespaceMetadata{})
 }
 func (ui *JSONLines) ResolvingNamespaceSuccess(namespace string) {
-	logOperationSuccess(batcheslib.LogEventOperationResolvingNamespace, &batcheslib.ResolvingNamespaceMetadata{NamespaceID: namespace})
+	logOperationSuccess(ui.Log, batcheslib.LogEventOperationResolvingNamespace, &batcheslib.ResolvingNamespaceMetadata{NamespaceID: namespace})
 }
 
 func (ui *JSONLines) PreparingContainerImages() {
-	logOperationStart(batcheslib.LogEventOperationPreparingDockerImages, &batcheslib.PreparingDockerImagesMetadata{})
+	logOperationStart(ui.Log, batcheslib.LogEventOperationPreparingDockerImages, &batcheslib.PreparingDockerImagesMetadata{})
 }
 func (ui *JSONLines) PreparingContainerImagesProgress(done, total int) {
-	logOperationProgress(batcheslib.LogEventOperationPreparingDockerImages, &batcheslib.PreparingDockerImagesMetadata{Done: done, Total: total})
+	logOperationProgress(ui.Log, batcheslib.LogEventOperationPreparingDockerImages, &batcheslib.PreparingDockerImagesMetadata{Done: done, Total: total})
 }
 func (ui *JSONLines) PreparingContainerImagesSuccess() {
-	logOperationSuccess(batcheslib.LogEventOperationPreparingDockerImages, &batcheslib.PreparingDockerImagesMetadata{})
+	logOperationSuccess(ui.Log, batcheslib.LogEventOperationPreparingDockerImages, &batcheslib.PreparingDockerImagesMetadata{})
 }
 
 func (ui *JSONLines) DeterminingWorkspaceCreatorType() {
-	logOperationStart(batcheslib.LogEventOperationDeterminingWorkspaceType, &batcheslib.DeterminingWorkspaceTypeMetadata{})
+	logOperationStart(ui.Log, batcheslib.LogEventOperationDeterminingWorkspaceType, &batcheslib.DeterminingWorkspaceTypeMetadata{})
 }
 func (ui *JSONLines) DeterminingWorkspaceCreatorTypeSuccess(wt workspace.CreatorType) {
 	var t string
@@ -64,15 +68,19 @@ func (ui *JSONLines) DeterminingWorkspaceCreatorTypeSuccess(wt workspace.Creator
 		t = "VOLUME"
 	case workspace.CreatorTypeBind:
 		t = "BIND"
+	case workspace.CreatorTypeHost:
+		t = "HOST"
+	case workspace.CreatorTypeWorktree:
+		t = "WORKTREE"
 	}
-	logOperationSuccess(batcheslib.LogEventOperationDeterminingWorkspaceType, &batcheslib.DeterminingWorkspaceTypeMetadata{Type: t})
+	logOperationSuccess(ui.Log, batcheslib.LogEventOperationDeterminingWorkspaceType, &batcheslib.DeterminingWorkspaceTypeMetadata{Type: t})
 }
 
 func (ui *JSONLines) DeterminingWorkspaces() {
-	logOperationStart(batcheslib.LogEventOperationDeterminingWorkspaces, &batcheslib.DeterminingWorkspacesMetadata{})
+	logOperationStart(ui.Log, batcheslib.LogEventOperationDeterminingWorkspaces, &batcheslib.DeterminingWorkspacesMetadata{})
 }
 func (ui *JSONLines) DeterminingWorkspacesSuccess(workspacesCount, reposCount int, unsupported batches.UnsupportedRepoSet, ignored batches.IgnoredRepoSet) {
-	logOperationSuccess(batcheslib.LogEventOperationDeterminingWorkspaces, &batcheslib.DeterminingWorkspacesMetadata{
+	logOperationSuccess(ui.Log, batcheslib.LogEventOperationDeterminingWorkspaces, &batcheslib.DeterminingWorkspacesMetadata{
 		Unsupported:    len(unsupported),
 		Ignored:        len(ignored),
 		RepoCount:      reposCount,
@@ -81,10 +89,10 @@ func (ui *JSONLines) DeterminingWorkspacesSuccess(workspacesCount, reposCount in
 }
 
 func (ui *JSONLines) CheckingCache() {
-	logOperationStart(batcheslib.LogEventOperationCheckingCache, &batcheslib.CheckingCacheMetadata{})
+	logOperationStart(ui.Log, batcheslib.LogEventOperationCheckingCache, &batcheslib.CheckingCacheMetadata{})
 }
 func (ui *JSONLines) CheckingCacheSuccess(cachedSpecsFound int, tasksToExecute int) {
-	logOperationSuccess(batcheslib.LogEventOperationCheckingCache, &batcheslib.CheckingCacheMetadata{
+	logOperationSuccess(ui.Log, batcheslib.LogEventOperationCheckingCache, &batcheslib.CheckingCacheMetadata{
 		CachedSpecsFound: cachedSpecsFound,
 		TasksToExecute:   tasksToExecute,
 	})
@@ -93,11 +101,12 @@ func (ui *JSONLines) CheckingCacheSuccess(cachedSpecsFound int, tasksToExecute i
 func (ui *JSONLines) ExecutingTasks(_ bool, _ int) executor.TaskExecutionUI {
 	return &taskExecutionJSONLines{
 		binaryDiffs: ui.BinaryDiffs,
+		log:         ui.Log,
 	}
 }
 
 func (ui *JSONLines) ExecutingTasksSkippingErrors(err error) {
-	logOperationSuccess(batcheslib.LogEventOperationExecutingTasks, &batcheslib.ExecutingTasksMetadata{
+	logOperationSuccess(ui.Log, batcheslib.LogEventOperationExecutingTasks, &batcheslib.ExecutingTasksMetadata{
 		Skipped: true,
 		Error:   err.Error(),
 	})
@@ -105,7 +114,7 @@ func (ui *JSONLines) ExecutingTasksSkippingErrors(err error) {
 
 func (ui *JSONLines) LogFilesKept(files []string) {
 	for _, path := range files {
-		logOperationSuccess(batcheslib.LogEventOperationLogFileKept, &batcheslib.LogFileKeptMetadata{Path: path})
+		logOperationSuccess(ui.Log, batcheslib.LogEventOperationLogFileKept, &batcheslib.LogFileKeptMetadata{Path: path})
 	}
 }
 
@@ -114,14 +123,14 @@ func (ui *JSONLines) NoChangesetSpecs() {
 }
 
 func (ui *JSONLines) UploadingChangesetSpecs(num int) {
-	logOperationStart(batcheslib.LogEventOperationUploadingChangesetSpecs, &batcheslib.UploadingChangesetSpecsMetadata{
+	logOperationStart(ui.Log, batcheslib.LogEventOperationUploadingChangesetSpecs, &batcheslib.UploadingChangesetSpecsMetadata{
 		Done:  0,
 		Total: num,
 	})
 }
 
 func (ui *JSONLines) UploadingChangesetSpecsProgress(done, total int) {
-	logOperationProgress(batcheslib.LogEventOperationUploadingChangesetSpecs, &batcheslib.UploadingChangesetSpecsMetadata{
+	logOperationProgress(ui.Log, batcheslib.LogEventOperationUploadingChangesetSpecs, &batcheslib.UploadingChangesetSpecsMetadata{
 		Done:  done,
 		Total: total,
 	})
@@ -132,25 +141,50 @@ func (ui *JSONLines) UploadingChangesetSpecsSuccess(ids []graphql.ChangesetSpecI
 	for i, id := range ids {
 		sIDs[i] = string(id)
 	}
-	logOperationSuccess(batcheslib.LogEventOperationUploadingChangesetSpecs, &batcheslib.UploadingChangesetSpecsMetadata{
+	logOperationSuccess(ui.Log, batcheslib.LogEventOperationUploadingChangesetSpecs, &batcheslib.UploadingChangesetSpecsMetadata{
 		Done:  len(ids),
 		Total: len(ids),
 		IDs:   sIDs,
 	})
 }
 
+func (ui *JSONLines) ExportingChangesets(num int) {
+	logOperationStart(ui.Log, batcheslib.LogEventOperationExportingChangesets, &batcheslib.ExportingChangesetsMetadata{
+		Done:  0,
+		Total: num,
+	})
+}
+
+func (ui *JSONLines) ExportingChangesetsProgress(done, total int) {
+	logOperationProgress(ui.Log, batcheslib.LogEventOperationExportingChangesets, &batcheslib.ExportingChangesetsMetadata{
+		Done:  done,
+		Total: total,
+	})
+}
+
+func (ui *JSONLines) ExportingChangesetsSuccess(result export.Result) {
+	branches := make([]string, len(result.Branches))
+	for i, branch := range result.Branches {
+		branches[i] = branch.Clone + ":" + branch.Name
+	}
+	logOperationSuccess(ui.Log, batcheslib.LogEventOperationExportingChangesets, &batcheslib.ExportingChangesetsMetadata{
+		Files:    result.Files,
+		Branches: branches,
+	})
+}
+
 func (ui *JSONLines) CreatingBatchSpec() {
-	logOperationStart(batcheslib.LogEventOperationCreatingBatchSpec, &batcheslib.CreatingBatchSpecMetadata{})
+	logOperationStart(ui.Log, batcheslib.LogEventOperationCreatingBatchSpec, &batcheslib.CreatingBatchSpecMetadata{})
 }
 
 func (ui *JSONLines) CreatingBatchSpecSuccess(batchSpecURL string) {
-	logOperationSuccess(batcheslib.LogEventOperationCreatingBatchSpec, &batcheslib.CreatingBatchSpecMetadata{
+	logOperationSuccess(ui.Log, batcheslib.LogEventOperationCreatingBatchSpec, &batcheslib.CreatingBatchSpecMetadata{
 		PreviewURL: batchSpecURL,
 	})
 }
 
 func (ui *JSONLines) CreatingBatchSpecError(_ int, err error) error {
-	logOperationFailure(batcheslib.LogEventOperationCreatingBatchSpec, &batcheslib.CreatingBatchSpecMetadata{})
+	logOperationFailure(ui.Log, batcheslib.LogEventOperationCreatingBatchSpec, &batcheslib.CreatingBatchSpecMetadata{})
 	return err
 }
 
@@ -159,19 +193,19 @@ func (ui *JSONLines) PreviewBatchSpec(batchSpecURL string) {
 }
 
 func (ui *JSONLines) ApplyingBatchSpec() {
-	logOperationStart(batcheslib.LogEventOperationApplyingBatchSpec, &batcheslib.ApplyingBatchSpecMetadata{})
+	logOperationStart(ui.Log, batcheslib.LogEventOperationApplyingBatchSpec, &batcheslib.ApplyingBatchSpecMetadata{})
 }
 
 func (ui *JSONLines) ApplyingBatchSpecSuccess(batchChangeURL string) {
-	logOperationSuccess(batcheslib.LogEventOperationApplyingBatchSpec, &batcheslib.ApplyingBatchSpecMetadata{BatchChangeURL: batchChangeURL})
+	logOperationSuccess(ui.Log, batcheslib.LogEventOperationApplyingBatchSpec, &batcheslib.ApplyingBatchSpecMetadata{BatchChangeURL: batchChangeURL})
 }
 
 func (ui *JSONLines) ExecutionError(err error) {
-	logOperationFailure(batcheslib.LogEventOperationBatchSpecExecution, &batcheslib.BatchSpecExecutionMetadata{Error: err.Error()})
+	logOperationFailure(ui.Log, batcheslib.LogEventOperationBatchSpecExecution, &batcheslib.BatchSpecExecutionMetadata{Error: err.Error()})
 }
 
 func (ui *JSONLines) WriteAfterStepResult(key string, value execution.AfterStepResult) {
-	logOperationSuccess(batcheslib.LogEventOperationCacheAfterStepResult, &batcheslib.CacheAfterStepResultMetadata{
+	logOperationSuccess(ui.Log, batcheslib.LogEventOperationCacheAfterStepResult, &batcheslib.CacheAfterStepResultMetadata{
 		Key:   key,
 		Value: value,
 	})
@@ -182,12 +216,13 @@ func (ui *JSONLines) DockerWatchDogWarning(err error) {
 If there's no progress in the next couple minutes, you may want to try restarting Docker and running the command again.
 Error: %s
 `, err.Error())
-	logOperationFailure(batcheslib.LogEventOperationDockerWatchDog, &batcheslib.DockerWatchDogMetadata{Error: message})
+	logOperationFailure(ui.Log, batcheslib.LogEventOperationDockerWatchDog, &batcheslib.DockerWatchDogMetadata{Error: message})
 }
 
 type taskExecutionJSONLines struct {
 	linesTasks  map[*executor.Task]batcheslib.JSONLinesTask
 	binaryDiffs bool
+	log         func(batcheslib.LogEvent)
 }
 
 // seededRand is used in randomID() to generate a "random" number.
@@ -200,6 +235,7 @@ func randomID() (string, error) {
 
 func (ui *taskExecutionJSONLines) Start(tasks []*executor.Task) {
 	ui.linesTasks = make(map[*executor.Task]batcheslib.JSONLinesTask, len(tasks))
+	linesTasks := make([]batcheslib.JSONLinesTask, 0, len(tasks))
 	for _, t := range tasks {
 		id, err := randomID()
 		if err != nil {
@@ -214,14 +250,19 @@ func (ui *taskExecutionJSONLines) Start(tasks []*executor.Task) {
 			StartStep:              t.CachedStepResult.StepIndex,
 		}
 		ui.linesTasks[t] = linesTask
+		linesTasks = append(linesTasks, linesTask)
 	}
+
+	// The tasks are logged so that the IDs in the events of the tasks can be
+	// mapped to their workspaces.
+	logOperationStart(ui.log, batcheslib.LogEventOperationExecutingTasks, &batcheslib.ExecutingTasksMetadata{Tasks: linesTasks})
 }
 func (ui *taskExecutionJSONLines) Success() {
-	logOperationSuccess(batcheslib.LogEventOperationExecutingTasks, &batcheslib.ExecutingTasksMetadata{})
+	logOperationSuccess(ui.log, batcheslib.LogEventOperationExecutingTasks, &batcheslib.ExecutingTasksMetadata{})
 }
 
 func (ui *taskExecutionJSONLines) Failed(err error) {
-	logOperationFailure(batcheslib.LogEventOperationExecutingTasks, &batcheslib.ExecutingTasksMetadata{Error: err.Error()})
+	logOperationFailure(ui.log, batcheslib.LogEventOperationExecutingTasks, &batcheslib.ExecutingTasksMetadata{Error: err.Error()})
 }
 
 func (ui *taskExecutionJSONLines) TaskStarted(task *executor.Task) {
@@ -230,7 +271,7 @@ func (ui *taskExecutionJSONLines) TaskStarted(task *executor.Task) {
 		panic("unknown task started")
 	}
 
-	logOperationStart(batcheslib.LogEventOperationExecutingTask, &batcheslib.ExecutingTaskMetadata{TaskID: lt.ID})
+	logOperationStart(ui.log, batcheslib.LogEventOperationExecutingTask, &batcheslib.ExecutingTaskMetadata{TaskID: lt.ID})
 }
 
 func (ui *taskExecutionJSONLines) TaskFinished(task *executor.Task, err error) {
@@ -240,14 +281,14 @@ func (ui *taskExecutionJSONLines) TaskFinished(task *executor.Task, err error) {
 	}
 
 	if err != nil {
-		logOperationFailure(batcheslib.LogEventOperationExecutingTask, &batcheslib.ExecutingTaskMetadata{
+		logOperationFailure(ui.log, batcheslib.LogEventOperationExecutingTask, &batcheslib.ExecutingTaskMetadata{
 			TaskID: lt.ID,
 			Error:  err.Error(),
 		})
 		return
 	}
 
-	logOperationSuccess(batcheslib.LogEventOperationExecutingTask, &batcheslib.ExecutingTaskMetadata{TaskID: lt.ID})
+	logOperationSuccess(ui.log, batcheslib.LogEventOperationExecutingTask, &batcheslib.ExecutingTaskMetadata{TaskID: lt.ID})
 }
 
 func (ui *taskExecutionJSONLines) TaskChangesetSpecsBuilt(task *executor.Task, specs []*batcheslib.ChangesetSpec) {
@@ -256,7 +297,7 @@ func (ui *taskExecutionJSONLines) TaskChangesetSpecsBuilt(task *executor.Task, s
 		panic("unknown task started")
 	}
 
-	logOperationSuccess(batcheslib.LogEventOperationTaskBuildChangesetSpecs, &batcheslib.TaskBuildChangesetSpecsMetadata{TaskID: lt.ID})
+	logOperationSuccess(ui.log, batcheslib.LogEventOperationTaskBuildChangesetSpecs, &batcheslib.TaskBuildChangesetSpecsMetadata{TaskID: lt.ID})
 }
 
 func (ui *taskExecutionJSONLines) StepsExecutionUI(task *executor.Task) executor.StepsExecutionUI {
@@ -265,12 +306,13 @@ func (ui *taskExecutionJSONLines) StepsExecutionUI(task *executor.Task) executor
 		panic("unknown task started")
 	}
 
-	return &stepsExecutionJSONLines{linesTask: &lt}
+	return &stepsExecutionJSONLines{linesTask: &lt, log: ui.log}
 }
 
 type stepsExecutionJSONLines struct {
 	linesTask   *batcheslib.JSONLinesTask
 	binaryDiffs bool
+	log         func(batcheslib.LogEvent)
 }
 
 const stepFlushDuration = 500 * time.Millisecond
@@ -290,25 +332,26 @@ func (ui *stepsExecutionJSONLines) WorkspaceInitializationFinished() {
 }
 
 func (ui *stepsExecutionJSONLines) SkippingStepsUpto(startStep int) {
-	logOperationProgress(batcheslib.LogEventOperationTaskSkippingSteps, &batcheslib.TaskSkippingStepsMetadata{TaskID: ui.linesTask.ID, StartStep: startStep})
+	logOperationProgress(ui.log, batcheslib.LogEventOperationTaskSkippingSteps, &batcheslib.TaskSkippingStepsMetadata{TaskID: ui.linesTask.ID, StartStep: startStep})
 }
 
 func (ui *stepsExecutionJSONLines) StepSkipped(step int) {
-	logOperationProgress(batcheslib.LogEventOperationTaskStepSkipped, &batcheslib.TaskStepSkippedMetadata{TaskID: ui.linesTask.ID, Step: step})
+	logOperationProgress(ui.log, batcheslib.LogEventOperationTaskStepSkipped, &batcheslib.TaskStepSkippedMetadata{TaskID: ui.linesTask.ID, Step: step})
 }
 
 func (ui *stepsExecutionJSONLines) StepPreparingStart(step int) {
-	logOperationStart(batcheslib.LogEventOperationTaskPreparingStep, &batcheslib.TaskPreparingStepMetadata{TaskID: ui.linesTask.ID, Step: step})
+	logOperationStart(ui.log, batcheslib.LogEventOperationTaskPreparingStep, &batcheslib.TaskPreparingStepMetadata{TaskID: ui.linesTask.ID, Step: step})
 }
 func (ui *stepsExecutionJSONLines) StepPreparingSuccess(step int) {
-	logOperationSuccess(batcheslib.LogEventOperationTaskPreparingStep, &batcheslib.TaskPreparingStepMetadata{TaskID: ui.linesTask.ID, Step: step})
+	logOperationSuccess(ui.log, batcheslib.LogEventOperationTaskPreparingStep, &batcheslib.TaskPreparingStepMetadata{TaskID: ui.linesTask.ID, Step: step})
 }
 func (ui *stepsExecutionJSONLines) StepPreparingFailed(step int, err error) {
-	logOperationFailure(batcheslib.LogEventOperationTaskPreparingStep, &batcheslib.TaskPreparingStepMetadata{TaskID: ui.linesTask.ID, Step: step, Error: err.Error()})
+	logOperationFailure(ui.log, batcheslib.LogEventOperationTaskPreparingStep, &batcheslib.TaskPreparingStepMetadata{TaskID: ui.linesTask.ID, Step: step, Error: err.Error()})
 }
 
 func (ui *stepsExecutionJSONLines) StepStarted(step int, runScript string, env map[string]string) {
 	logOperationStart(
+		ui.log,
 		batcheslib.LogEventOperationTaskStep,
 		&batcheslib.TaskStepMetadata{
 			Version: version(ui.binaryDiffs),
@@ -321,6 +364,7 @@ func (ui *stepsExecutionJSONLines) StepStarted(step int, runScript string, env m
 func (ui *stepsExecutionJSONLines) StepOutputWriter(ctx context.Context, task *executor.Task, step int) executor.StepOutputWriter {
 	sink := func(data string) {
 		logOperationProgress(
+			ui.log,
 			batcheslib.LogEventOperationTaskStep,
 			&batcheslib.TaskStepMetadata{
 				Version: version(ui.binaryDiffs),
@@ -333,8 +377,25 @@ func (ui *stepsExecutionJSONLines) StepOutputWriter(ctx context.Context, task *e
 	return NewIntervalProcessWriter(ctx, stepFlushDuration, sink)
 }
 
+func (ui *stepsExecutionJSONLines) StepAttemptFailed(step int, attempt, maxAttempts int, err error, exitCode int, retryIn time.Duration) {
+	logOperationProgress(
+		ui.log,
+		batcheslib.LogEventOperationTaskStepAttempt,
+		&batcheslib.TaskStepAttemptMetadata{
+			TaskID:      ui.linesTask.ID,
+			Step:        step,
+			Attempt:     attempt,
+			MaxAttempts: maxAttempts,
+			RetryIn:     retryIn.Milliseconds(),
+			ExitCode:    exitCode,
+			Error:       err.Error(),
+		},
+	)
+}
+
 func (ui *stepsExecutionJSONLines) StepFinished(step int, diff []byte, changes git.Changes, outputs map[string]any) {
 	logOperationSuccess(
+		ui.log,
 		batcheslib.LogEventOperationTaskStep,
 		&batcheslib.TaskStepMetadata{
 			Version: version(ui.binaryDiffs),
@@ -348,6 +409,7 @@ func (ui *stepsExecutionJSONLines) StepFinished(step int, diff []byte, changes g
 
 func (ui *stepsExecutionJSONLines) StepFailed(step int, err error, exitCode int) {
 	logOperationFailure(
+		ui.log,
 		batcheslib.LogEventOperationTaskStep,
 		&batcheslib.TaskStepMetadata{
 			Version:  version(ui.binaryDiffs),
@@ -371,24 +433,28 @@ func (ui *JSONLines) UploadingWorkspaceFilesSuccess() {
 	// No workspace file upload required for executor mode.
 }
 
-func logOperationStart(op batcheslib.LogEventOperation, metadata any) {
-	logEvent(batcheslib.LogEvent{Operation: op, Status: batcheslib.LogEventStatusStarted, Metadata: metadata})
+func logOperationStart(log func(batcheslib.LogEvent), op batcheslib.LogEventOperation, metadata any) {
+	logEvent(log, batcheslib.LogEvent{Operation: op, Status: batcheslib.LogEventStatusStarted, Metadata: metadata})
 }
 
-func logOperationSuccess(op batcheslib.LogEventOperation, metadata any) {
-	logEvent(batcheslib.LogEvent{Operation: op, Status: batcheslib.LogEventStatusSuccess, Metadata: metadata})
+func logOperationSuccess(log func(batcheslib.LogEvent), op batcheslib.LogEventOperation, metadata any) {
+	logEvent(log, batcheslib.LogEvent{Operation: op, Status: batcheslib.LogEventStatusSuccess, Metadata: metadata})
 }
 
-func logOperationFailure(op batcheslib.LogEventOperation, metadata any) {
-	logEvent(batcheslib.LogEvent{Operation: op, Status: batcheslib.LogEventStatusFailure, Metadata: metadata})
+func logOperationFailure(log func(batcheslib.LogEvent), op batcheslib.LogEventOperation, metadata any) {
+	logEvent(log, batcheslib.LogEvent{Operation: op, Status: batcheslib.LogEventStatusFailure, Metadata: metadata})
 }
 
-func logOperationProgress(op batcheslib.LogEventOperation, metadata any) {
-	logEvent(batcheslib.LogEvent{Operation: op, Status: batcheslib.LogEventStatusProgress, Metadata: metadata})
+func logOperationProgress(log func(batcheslib.LogEvent), op batcheslib.LogEventOperation, metadata any) {
+	logEvent(log, batcheslib.LogEvent{Operation: op, Status: batcheslib.LogEventStatusProgress, Metadata: metadata})
 }
 
-func logEvent(e batcheslib.LogEvent) {
+func logEvent(log func(batcheslib.LogEvent), e batcheslib.LogEvent) {
 	e.Timestamp = time.Now().UTC().Truncate(time.Millisecond)
+	if log != nil {
+		log(e)
+		return
+	}
 	err := json.NewEncoder(os.Stdout).Encode(e)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
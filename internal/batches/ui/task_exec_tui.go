@@ -496,6 +496,11 @@ func (ui stepsExecTUI) StepOutputWriter(ctx context.Context, task *executor.Task
 	return executor.NoopStepOutputWriter{}
 }
 
+func (ui stepsExecTUI) StepAttemptFailed(idx int, attempt, maxAttempts int, err error, exitCode int, retryIn time.Duration) {
+	ui.updateStatusBar(fmt.Sprintf("Retrying step %d in %s (attempt %d of %d failed)", idx, retryIn, attempt, maxAttempts))
+	ui.out.Verbosef("[%s] Step %d attempt %d of %d failed (exit code %d), retrying in %s: %v", ui.task.Repository.Name, idx, attempt, maxAttempts, exitCode, retryIn, err)
+}
+
 func (ui stepsExecTUI) StepFinished(idx int, diff []byte, changes git.Changes, outputs map[string]any) {
 	ui.out.Verbosef("[%s] Step %d finished successfully", ui.task.Repository.Name, idx)
 	if len(diff) > 0 {
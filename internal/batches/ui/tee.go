@@ -0,0 +1,312 @@
+package ui
+
+import (
+	"context"
+	"io"
+	"time"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/batches/git"
+
+	"github.com/sourcegraph/src-cli/internal/batches"
+	"github.com/sourcegraph/src-cli/internal/batches/executor"
+	"github.com/sourcegraph/src-cli/internal/batches/export"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+	"github.com/sourcegraph/src-cli/internal/batches/workspace"
+)
+
+// Tee is an ExecUI that forwards every call to both of its UIs, e.g. to
+// record the events of an execution shown in the TUI with JSONLines.
+type Tee struct {
+	// Primary is the UI whose return values are used.
+	Primary   ExecUI
+	Secondary ExecUI
+}
+
+var _ ExecUI = &Tee{}
+
+func (ui *Tee) ParsingBatchSpec() {
+	ui.Primary.ParsingBatchSpec()
+	ui.Secondary.ParsingBatchSpec()
+}
+func (ui *Tee) ParsingBatchSpecSuccess() {
+	ui.Primary.ParsingBatchSpecSuccess()
+	ui.Secondary.ParsingBatchSpecSuccess()
+}
+func (ui *Tee) ParsingBatchSpecFailure(err error) {
+	ui.Primary.ParsingBatchSpecFailure(err)
+	ui.Secondary.ParsingBatchSpecFailure(err)
+}
+
+func (ui *Tee) ResolvingNamespace() {
+	ui.Primary.ResolvingNamespace()
+	ui.Secondary.ResolvingNamespace()
+}
+func (ui *Tee) ResolvingNamespaceSuccess(namespace string) {
+	ui.Primary.ResolvingNamespaceSuccess(namespace)
+	ui.Secondary.ResolvingNamespaceSuccess(namespace)
+}
+
+func (ui *Tee) PreparingContainerImages() {
+	ui.Primary.PreparingContainerImages()
+	ui.Secondary.PreparingContainerImages()
+}
+func (ui *Tee) PreparingContainerImagesProgress(done, total int) {
+	ui.Primary.PreparingContainerImagesProgress(done, total)
+	ui.Secondary.PreparingContainerImagesProgress(done, total)
+}
+func (ui *Tee) PreparingContainerImagesSuccess() {
+	ui.Primary.PreparingContainerImagesSuccess()
+	ui.Secondary.PreparingContainerImagesSuccess()
+}
+
+func (ui *Tee) DeterminingWorkspaceCreatorType() {
+	ui.Primary.DeterminingWorkspaceCreatorType()
+	ui.Secondary.DeterminingWorkspaceCreatorType()
+}
+func (ui *Tee) DeterminingWorkspaceCreatorTypeSuccess(wt workspace.CreatorType) {
+	ui.Primary.DeterminingWorkspaceCreatorTypeSuccess(wt)
+	ui.Secondary.DeterminingWorkspaceCreatorTypeSuccess(wt)
+}
+
+func (ui *Tee) DeterminingWorkspaces() {
+	ui.Primary.DeterminingWorkspaces()
+	ui.Secondary.DeterminingWorkspaces()
+}
+func (ui *Tee) DeterminingWorkspacesSuccess(workspacesCount, reposCount int, unsupported batches.UnsupportedRepoSet, ignored batches.IgnoredRepoSet) {
+	ui.Primary.DeterminingWorkspacesSuccess(workspacesCount, reposCount, unsupported, ignored)
+	ui.Secondary.DeterminingWorkspacesSuccess(workspacesCount, reposCount, unsupported, ignored)
+}
+
+func (ui *Tee) CheckingCache() {
+	ui.Primary.CheckingCache()
+	ui.Secondary.CheckingCache()
+}
+func (ui *Tee) CheckingCacheSuccess(cachedSpecsFound int, tasksToExecute int) {
+	ui.Primary.CheckingCacheSuccess(cachedSpecsFound, tasksToExecute)
+	ui.Secondary.CheckingCacheSuccess(cachedSpecsFound, tasksToExecute)
+}
+
+func (ui *Tee) ExecutingTasks(verbose bool, parallelism int) executor.TaskExecutionUI {
+	return &teeTaskExecutionUI{
+		primary:   ui.Primary.ExecutingTasks(verbose, parallelism),
+		secondary: ui.Secondary.ExecutingTasks(verbose, parallelism),
+	}
+}
+func (ui *Tee) ExecutingTasksSkippingErrors(err error) {
+	ui.Primary.ExecutingTasksSkippingErrors(err)
+	ui.Secondary.ExecutingTasksSkippingErrors(err)
+}
+
+func (ui *Tee) LogFilesKept(files []string) {
+	ui.Primary.LogFilesKept(files)
+	ui.Secondary.LogFilesKept(files)
+}
+
+func (ui *Tee) NoChangesetSpecs() {
+	ui.Primary.NoChangesetSpecs()
+	ui.Secondary.NoChangesetSpecs()
+}
+func (ui *Tee) UploadingChangesetSpecs(num int) {
+	ui.Primary.UploadingChangesetSpecs(num)
+	ui.Secondary.UploadingChangesetSpecs(num)
+}
+func (ui *Tee) UploadingChangesetSpecsProgress(done, total int) {
+	ui.Primary.UploadingChangesetSpecsProgress(done, total)
+	ui.Secondary.UploadingChangesetSpecsProgress(done, total)
+}
+func (ui *Tee) UploadingChangesetSpecsSuccess(ids []graphql.ChangesetSpecID) {
+	ui.Primary.UploadingChangesetSpecsSuccess(ids)
+	ui.Secondary.UploadingChangesetSpecsSuccess(ids)
+}
+
+func (ui *Tee) ExportingChangesets(num int) {
+	ui.Primary.ExportingChangesets(num)
+	ui.Secondary.ExportingChangesets(num)
+}
+func (ui *Tee) ExportingChangesetsProgress(done, total int) {
+	ui.Primary.ExportingChangesetsProgress(done, total)
+	ui.Secondary.ExportingChangesetsProgress(done, total)
+}
+func (ui *Tee) ExportingChangesetsSuccess(result export.Result) {
+	ui.Primary.ExportingChangesetsSuccess(result)
+	ui.Secondary.ExportingChangesetsSuccess(result)
+}
+
+func (ui *Tee) CreatingBatchSpec() {
+	ui.Primary.CreatingBatchSpec()
+	ui.Secondary.CreatingBatchSpec()
+}
+func (ui *Tee) CreatingBatchSpecSuccess(previewURL string) {
+	ui.Primary.CreatingBatchSpecSuccess(previewURL)
+	ui.Secondary.CreatingBatchSpecSuccess(previewURL)
+}
+func (ui *Tee) CreatingBatchSpecError(maxUnlicensedCS int, err error) error {
+	ui.Secondary.CreatingBatchSpecError(maxUnlicensedCS, err)
+	return ui.Primary.CreatingBatchSpecError(maxUnlicensedCS, err)
+}
+
+func (ui *Tee) PreviewBatchSpec(previewURL string) {
+	ui.Primary.PreviewBatchSpec(previewURL)
+	ui.Secondary.PreviewBatchSpec(previewURL)
+}
+
+func (ui *Tee) ApplyingBatchSpec() {
+	ui.Primary.ApplyingBatchSpec()
+	ui.Secondary.ApplyingBatchSpec()
+}
+func (ui *Tee) ApplyingBatchSpecSuccess(batchChangeURL string) {
+	ui.Primary.ApplyingBatchSpecSuccess(batchChangeURL)
+	ui.Secondary.ApplyingBatchSpecSuccess(batchChangeURL)
+}
+
+func (ui *Tee) ExecutionError(err error) {
+	ui.Primary.ExecutionError(err)
+	ui.Secondary.ExecutionError(err)
+}
+
+func (ui *Tee) UploadingWorkspaceFiles() {
+	ui.Primary.UploadingWorkspaceFiles()
+	ui.Secondary.UploadingWorkspaceFiles()
+}
+func (ui *Tee) UploadingWorkspaceFilesWarning(err error) {
+	ui.Primary.UploadingWorkspaceFilesWarning(err)
+	ui.Secondary.UploadingWorkspaceFilesWarning(err)
+}
+func (ui *Tee) UploadingWorkspaceFilesSuccess() {
+	ui.Primary.UploadingWorkspaceFilesSuccess()
+	ui.Secondary.UploadingWorkspaceFilesSuccess()
+}
+
+func (ui *Tee) DockerWatchDogWarning(err error) {
+	ui.Primary.DockerWatchDogWarning(err)
+	ui.Secondary.DockerWatchDogWarning(err)
+}
+
+type teeTaskExecutionUI struct {
+	primary, secondary executor.TaskExecutionUI
+}
+
+func (ui *teeTaskExecutionUI) Start(tasks []*executor.Task) {
+	ui.primary.Start(tasks)
+	ui.secondary.Start(tasks)
+}
+func (ui *teeTaskExecutionUI) Success() {
+	ui.primary.Success()
+	ui.secondary.Success()
+}
+func (ui *teeTaskExecutionUI) Failed(err error) {
+	ui.primary.Failed(err)
+	ui.secondary.Failed(err)
+}
+
+func (ui *teeTaskExecutionUI) TaskStarted(task *executor.Task) {
+	ui.primary.TaskStarted(task)
+	ui.secondary.TaskStarted(task)
+}
+func (ui *teeTaskExecutionUI) TaskFinished(task *executor.Task, err error) {
+	ui.primary.TaskFinished(task, err)
+	ui.secondary.TaskFinished(task, err)
+}
+
+func (ui *teeTaskExecutionUI) TaskChangesetSpecsBuilt(task *executor.Task, specs []*batcheslib.ChangesetSpec) {
+	ui.primary.TaskChangesetSpecsBuilt(task, specs)
+	ui.secondary.TaskChangesetSpecsBuilt(task, specs)
+}
+
+func (ui *teeTaskExecutionUI) StepsExecutionUI(task *executor.Task) executor.StepsExecutionUI {
+	return &teeStepsExecutionUI{
+		primary:   ui.primary.StepsExecutionUI(task),
+		secondary: ui.secondary.StepsExecutionUI(task),
+	}
+}
+
+type teeStepsExecutionUI struct {
+	primary, secondary executor.StepsExecutionUI
+}
+
+func (ui *teeStepsExecutionUI) ArchiveDownloadStarted() {
+	ui.primary.ArchiveDownloadStarted()
+	ui.secondary.ArchiveDownloadStarted()
+}
+func (ui *teeStepsExecutionUI) ArchiveDownloadFinished(err error) {
+	ui.primary.ArchiveDownloadFinished(err)
+	ui.secondary.ArchiveDownloadFinished(err)
+}
+
+func (ui *teeStepsExecutionUI) WorkspaceInitializationStarted() {
+	ui.primary.WorkspaceInitializationStarted()
+	ui.secondary.WorkspaceInitializationStarted()
+}
+func (ui *teeStepsExecutionUI) WorkspaceInitializationFinished() {
+	ui.primary.WorkspaceInitializationFinished()
+	ui.secondary.WorkspaceInitializationFinished()
+}
+
+func (ui *teeStepsExecutionUI) SkippingStepsUpto(startStep int) {
+	ui.primary.SkippingStepsUpto(startStep)
+	ui.secondary.SkippingStepsUpto(startStep)
+}
+
+func (ui *teeStepsExecutionUI) StepSkipped(step int) {
+	ui.primary.StepSkipped(step)
+	ui.secondary.StepSkipped(step)
+}
+
+func (ui *teeStepsExecutionUI) StepPreparingStart(step int) {
+	ui.primary.StepPreparingStart(step)
+	ui.secondary.StepPreparingStart(step)
+}
+func (ui *teeStepsExecutionUI) StepPreparingSuccess(step int) {
+	ui.primary.StepPreparingSuccess(step)
+	ui.secondary.StepPreparingSuccess(step)
+}
+func (ui *teeStepsExecutionUI) StepPreparingFailed(step int, err error) {
+	ui.primary.StepPreparingFailed(step, err)
+	ui.secondary.StepPreparingFailed(step, err)
+}
+func (ui *teeStepsExecutionUI) StepStarted(step int, runScript string, env map[string]string) {
+	ui.primary.StepStarted(step, runScript, env)
+	ui.secondary.StepStarted(step, runScript, env)
+}
+
+func (ui *teeStepsExecutionUI) StepOutputWriter(ctx context.Context, task *executor.Task, step int) executor.StepOutputWriter {
+	return &teeStepOutputWriter{
+		primary:   ui.primary.StepOutputWriter(ctx, task, step),
+		secondary: ui.secondary.StepOutputWriter(ctx, task, step),
+	}
+}
+
+func (ui *teeStepsExecutionUI) StepAttemptFailed(step int, attempt, maxAttempts int, err error, exitCode int, retryIn time.Duration) {
+	ui.primary.StepAttemptFailed(step, attempt, maxAttempts, err, exitCode, retryIn)
+	ui.secondary.StepAttemptFailed(step, attempt, maxAttempts, err, exitCode, retryIn)
+}
+
+func (ui *teeStepsExecutionUI) StepFinished(step int, diff []byte, changes git.Changes, outputs map[string]any) {
+	ui.primary.StepFinished(step, diff, changes, outputs)
+	ui.secondary.StepFinished(step, diff, changes, outputs)
+}
+func (ui *teeStepsExecutionUI) StepFailed(step int, err error, exitCode int) {
+	ui.primary.StepFailed(step, err, exitCode)
+	ui.secondary.StepFailed(step, err, exitCode)
+}
+
+type teeStepOutputWriter struct {
+	primary, secondary executor.StepOutputWriter
+}
+
+func (w *teeStepOutputWriter) StdoutWriter() io.Writer {
+	return io.MultiWriter(w.primary.StdoutWriter(), w.secondary.StdoutWriter())
+}
+
+func (w *teeStepOutputWriter) StderrWriter() io.Writer {
+	return io.MultiWriter(w.primary.StderrWriter(), w.secondary.StderrWriter())
+}
+
+func (w *teeStepOutputWriter) Close() error {
+	err := w.primary.Close()
+	if serr := w.secondary.Close(); err == nil {
+		err = serr
+	}
+	return err
+}
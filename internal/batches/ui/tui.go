@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"os/exec"
+	"strings"
 
 	"github.com/neelance/parallel"
 
@@ -14,6 +15,7 @@ import (
 	"github.com/sourcegraph/src-cli/internal/api"
 	"github.com/sourcegraph/src-cli/internal/batches"
 	"github.com/sourcegraph/src-cli/internal/batches/executor"
+	"github.com/sourcegraph/src-cli/internal/batches/export"
 	"github.com/sourcegraph/src-cli/internal/batches/graphql"
 	"github.com/sourcegraph/src-cli/internal/batches/workspace"
 	"github.com/sourcegraph/src-cli/internal/cmderrors"
@@ -94,6 +96,10 @@ func (ui *TUI) DeterminingWorkspaceCreatorTypeSuccess(wt workspace.CreatorType)
 		ui.pending.VerboseLine(output.Linef("🚧", output.StyleSuccess, "Workspace creator: bind"))
 	case workspace.CreatorTypeVolume:
 		ui.pending.VerboseLine(output.Linef("🚧", output.StyleSuccess, "Workspace creator: volume"))
+	case workspace.CreatorTypeHost:
+		ui.pending.VerboseLine(output.Linef("🚧", output.StyleSuccess, "Workspace creator: host"))
+	case workspace.CreatorTypeWorktree:
+		ui.pending.VerboseLine(output.Linef("🚧", output.StyleSuccess, "Workspace creator: worktree"))
 	}
 
 	batchCompletePending(ui.pending, "Set workspace type")
@@ -215,6 +221,38 @@ func (ui *TUI) UploadingChangesetSpecsSuccess(ids []graphql.ChangesetSpecID) {
 	ui.progress.Complete()
 }
 
+func (ui *TUI) ExportingChangesets(num int) {
+	var label string
+	if num == 1 {
+		label = "Exporting changeset"
+	} else {
+		label = fmt.Sprintf("Exporting %d changesets", num)
+	}
+
+	ui.progress = ui.Out.Progress([]output.ProgressBar{
+		{Label: label, Max: float64(num)},
+	}, nil)
+}
+
+func (ui *TUI) ExportingChangesetsProgress(done, total int) {
+	ui.progress.SetValue(0, float64(done))
+}
+
+func (ui *TUI) ExportingChangesetsSuccess(result export.Result) {
+	ui.progress.Complete()
+
+	ui.Out.Write("")
+	block := ui.Out.Block(output.Line(batchSuccessEmoji, batchSuccessColor, "Exported changesets:"))
+	defer block.Close()
+
+	for _, file := range result.Files {
+		block.Write(file)
+	}
+	for _, branch := range result.Branches {
+		block.Writef("%s in %s (%s)", branch.Name, branch.Clone, branch.Commit)
+	}
+}
+
 func (ui *TUI) CreatingBatchSpec() {
 	ui.pending = batchCreatePending(ui.Out, "Creating batch spec on Sourcegraph")
 }
@@ -308,6 +346,50 @@ func (ui *TUI) RemoteSuccess(url string) {
 	ui.Out.WriteLine(output.Line(output.EmojiLightbulb, output.Fg256Color(12), "Executing at: "+url))
 }
 
+func (ui *TUI) WatchingExecution(total int) {
+	ui.progress = ui.Out.Progress([]output.ProgressBar{{
+		Label: fmt.Sprintf("Executing workspaces (0/%d, 0 failed)", total),
+		Max:   1.0,
+	}}, nil)
+}
+
+func (ui *TUI) WatchingExecutionProgress(done, failed, total int) {
+	ui.progress.SetLabelAndRecalc(0, fmt.Sprintf("Executing workspaces (%d/%d, %d failed)", done, total, failed))
+	if total > 0 {
+		ui.progress.SetValue(0, float64(done)/float64(total))
+	}
+}
+
+// WorkspaceFailed prints the failure of a workspace of a server-side
+// execution, followed by the logs of its failed steps.
+func (ui *TUI) WorkspaceFailed(name, message string, logs []string) {
+	ui.progress.WriteLine(output.Linef(output.EmojiFailure, output.StyleWarning, "%s failed: %s", name, message))
+	for _, line := range logs {
+		ui.progress.Write("    " + line)
+	}
+}
+
+func (ui *TUI) WatchingExecutionInterrupted() {
+	ui.progress.Destroy()
+}
+
+func (ui *TUI) WatchingExecutionSuccess(state string, failed int) {
+	ui.progress.Complete()
+	if failed > 0 || state != "COMPLETED" {
+		ui.Out.WriteLine(output.Linef(output.EmojiFailure, output.StyleWarning, "Execution %s with %d failed workspaces", strings.ToLower(state), failed))
+		return
+	}
+	ui.Out.WriteLine(output.Line(batchSuccessEmoji, batchSuccessColor, "Execution completed"))
+}
+
+func (ui *TUI) CancelingExecution() {
+	ui.pending = batchCreatePending(ui.Out, "Canceling execution")
+}
+
+func (ui *TUI) CancelingExecutionSuccess() {
+	batchCompletePending(ui.pending, "Canceling execution")
+}
+
 // prettyPrintBatchUnlicensedError introspects the given error returned when
 // creating a batch spec and ascertains whether it's a licensing error. If it
 // is, then a better message is output. Regardless, the return value of this
@@ -0,0 +1,34 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LockOwner returns the owner of locks taken by this process, to be stored in
+// lock files or lock reasons. StaleLock can check whether the owner is still
+// running.
+func LockOwner() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("src-cli %s %d", hostname, os.Getpid())
+}
+
+// StaleLock returns whether the lock with the given owner, as returned by
+// LockOwner, was taken by a process on this host that isn't running anymore.
+// Locks of other hosts and unknown owners are never stale.
+func StaleLock(owner string) bool {
+	fields := strings.Fields(owner)
+	if len(fields) != 3 || fields[0] != "src-cli" {
+		return false
+	}
+	if hostname, _ := os.Hostname(); fields[1] != hostname {
+		return false
+	}
+	pid, err := strconv.Atoi(fields[2])
+	if err != nil || pid == os.Getpid() {
+		return false
+	}
+	return !processAlive(pid)
+}
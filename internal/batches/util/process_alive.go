@@ -0,0 +1,16 @@
+//go:build !windows
+
+package util
+
+import (
+	"syscall"
+
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+)
+
+// processAlive returns whether a process with the given pid is running.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	// EPERM means the process exists, but belongs to another user.
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,15 @@
+package util
+
+import "os"
+
+// processAlive returns whether a process with the given pid is running.
+func processAlive(pid int) bool {
+	// On Windows, FindProcess opens a handle to the process, which fails if
+	// it doesn't exist.
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -170,6 +170,77 @@ func (w *dockerBindWorkspace) ApplyDiff(ctx context.Context, diff []byte) error
 	return err
 }
 
+func (w *dockerBindWorkspace) Reset(ctx context.Context) error {
+	if _, err := runGitCmd(ctx, w.dir, "reset", "--hard", "--quiet"); err != nil {
+		return errors.Wrap(err, "git reset failed")
+	}
+	// Ignored files are left alone, just like they are ignored by Diff.
+	if _, err := runGitCmd(ctx, w.dir, "clean", "-d", "--force", "--quiet"); err != nil {
+		return errors.Wrap(err, "git clean failed")
+	}
+	return nil
+}
+
+func (w *dockerBindWorkspace) CollectArtifacts(ctx context.Context, patterns []string, dir string) ([]string, error) {
+	// Untracked files include ignored ones, since steps commonly write their
+	// reports to ignored directories.
+	out, err := runGitCmd(ctx, w.dir, "ls-files", "--others", "-z")
+	if err != nil {
+		return nil, errors.Wrap(err, "git ls-files failed")
+	}
+	files, err := matchArtifacts(patterns, splitNUL(out))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		src := filepath.Join(w.dir, filepath.FromSlash(file))
+		// The workspace is on the host, so a symbolic link created by a
+		// step could point to any file on the host.
+		st, err := os.Lstat(src)
+		if err != nil {
+			return nil, errors.Wrapf(err, "collecting artifact %s", file)
+		}
+		if !st.Mode().IsRegular() {
+			return nil, errors.Newf("artifact %s is not a regular file", file)
+		}
+		dest := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return nil, err
+		}
+		if err := moveFile(src, dest); err != nil {
+			return nil, errors.Wrapf(err, "collecting artifact %s", file)
+		}
+	}
+	return files, nil
+}
+
+// moveFile moves the file src to dest, copying it if it can't be renamed,
+// e.g. because dest is on another file system.
+func moveFile(src, dest string) error {
+	if err := os.Rename(src, dest); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
 func unzipToTempDir(ctx context.Context, zipFile, tempDir, tempFilePrefix string) (string, error) {
 	volumeDir, err := os.MkdirTemp(tempDir, tempFilePrefix)
 	if err != nil {
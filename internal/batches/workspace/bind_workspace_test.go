@@ -217,6 +217,125 @@ index 0000000..7bb2542
 	})
 }
 
+func TestDockerBindWorkspace_Reset(t *testing.T) {
+	fakeFilesTmpDir := t.TempDir()
+	filesInZip := map[string]string{
+		"README.md": "# Welcome to the README\n",
+	}
+	archivePath := zipUpFiles(t, fakeFilesTmpDir, filesInZip)
+
+	testTempDir := t.TempDir()
+
+	archive := &fakeRepoArchive{mockPath: archivePath}
+	creator := &dockerBindWorkspaceCreator{Dir: testTempDir}
+	workspace, err := creator.Create(context.Background(), repo, nil, archive)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	dir := *workspace.WorkDir()
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new-file.txt"), []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure staged changes are discarded too.
+	if _, err := workspace.Diff(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := workspace.Reset(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	haveFiles, err := readWorkspaceFiles(workspace)
+	if err != nil {
+		t.Fatalf("error walking workspace: %s", err)
+	}
+	if !cmp.Equal(filesInZip, haveFiles) {
+		t.Fatalf("wrong files in workspace:\n%s", cmp.Diff(filesInZip, haveFiles))
+	}
+}
+
+func TestDockerBindWorkspace_CollectArtifacts(t *testing.T) {
+	fakeFilesTmpDir := t.TempDir()
+	filesInZip := map[string]string{
+		"README.md":        "# Welcome to the README\n",
+		"reports/keep.txt": "part of the repository\n",
+	}
+	archivePath := zipUpFiles(t, fakeFilesTmpDir, filesInZip)
+
+	testTempDir := t.TempDir()
+
+	archive := &fakeRepoArchive{mockPath: archivePath}
+	creator := &dockerBindWorkspaceCreator{Dir: testTempDir}
+	workspace, err := creator.Create(context.Background(), repo, nil, archive)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	dir := *workspace.WorkDir()
+	for name, content := range map[string]string{
+		"README.md":             "changed\n",
+		"reports/lint.json":     "{}\n",
+		"reports/sub/sbom.json": "[]\n",
+		"other.txt":             "other\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	artifactsDir := t.TempDir()
+	files, err := workspace.CollectArtifacts(context.Background(), []string{"reports/**", "*.md"}, artifactsDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Files of the repository aren't collected, even if they match.
+	wantFiles := []string{"reports/lint.json", "reports/sub/sbom.json"}
+	if !cmp.Equal(wantFiles, files) {
+		t.Fatalf("wrong artifacts:\n%s", cmp.Diff(wantFiles, files))
+	}
+	for _, file := range wantFiles {
+		if _, err := os.Stat(filepath.Join(artifactsDir, file)); err != nil {
+			t.Errorf("artifact %s not collected: %s", file, err)
+		}
+	}
+
+	diff, err := workspace.Diff(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Contains(string(diff), "reports/") {
+		t.Errorf("diff contains artifacts:\n%s", diff)
+	}
+	if !strings.Contains(string(diff), "other.txt") {
+		t.Errorf("diff doesn't contain other.txt:\n%s", diff)
+	}
+
+	// Links to files on the host aren't collected.
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(dir, "reports", "secret.txt")); err != nil {
+		t.Skipf("can't create symbolic link: %s", err)
+	}
+	artifactsDir = t.TempDir()
+	_, err = workspace.CollectArtifacts(context.Background(), []string{"reports/*.txt"}, artifactsDir)
+	if err == nil || !strings.Contains(err.Error(), "not a regular file") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(artifactsDir, "reports", "secret.txt")); !os.IsNotExist(err) {
+		t.Errorf("link was collected: %v", err)
+	}
+}
+
 func TestMkdirAll(t *testing.T) {
 	// TestEnsureAll does most of the heavy lifting here; we're just testing the
 	// MkdirAll scenarios here around whether the directory exists.
@@ -1,7 +1,6 @@
 package workspace
 
 import (
-	"bytes"
 	"context"
 	"crypto/rand"
 	"encoding/hex"
@@ -17,13 +16,13 @@ import (
 	"github.com/sourcegraph/src-cli/internal/batches/docker"
 	"github.com/sourcegraph/src-cli/internal/batches/graphql"
 	"github.com/sourcegraph/src-cli/internal/batches/repozip"
-	"github.com/sourcegraph/src-cli/internal/exec"
 	"github.com/sourcegraph/src-cli/internal/version"
 )
 
 type imageEnsurer func(ctx context.Context, image string) (docker.Image, error)
 
 type dockerVolumeWorkspaceCreator struct {
+	runtime     docker.ContainerRuntime
 	tempDir     string
 	EnsureImage imageEnsurer
 }
@@ -32,30 +31,36 @@ var _ Creator = &dockerVolumeWorkspaceCreator{}
 
 func (wc *dockerVolumeWorkspaceCreator) Create(ctx context.Context, repo *graphql.Repository,
 	steps []batcheslib.Step, archive repozip.Archive) (ws Workspace, err error) {
-	volume, err := wc.createVolume(ctx)
+	volume, err := wc.runtime.CreateVolume(ctx)
 	if err != nil {
-		return nil, errors.Wrap(err, "creating Docker volume")
+		return nil, errors.Wrap(err, "creating volume")
 	}
 
 	defer func() {
 		if err != nil {
-			deleteVolume(ctx, volume)
+			wc.runtime.RemoveVolume(ctx, volume)
 		}
 	}()
 
 	// Figure out the user that containers will be run as.
 	ug := docker.UIDGID{}
-	if len(steps) > 0 {
-		img, err := wc.EnsureImage(ctx, steps[0].Container)
+	for _, step := range steps {
+		// Coding agent and buildImage steps don't necessarily have an image.
+		if (step.CodingAgent != nil || step.BuildImage != nil) && step.Container == "" {
+			continue
+		}
+		img, err := wc.EnsureImage(ctx, step.Container)
 		if err != nil {
 			return nil, err
 		}
 		if ug, err = img.UIDGID(ctx); err != nil {
 			return nil, errors.Wrap(err, "getting container UID and GID")
 		}
+		break
 	}
 
 	w := &dockerVolumeWorkspace{
+		runtime: wc.runtime,
 		tempDir: wc.tempDir,
 		volume:  volume,
 		uidGid:  ug,
@@ -71,19 +76,6 @@ func (wc *dockerVolumeWorkspaceCreator) Create(ctx context.Context, repo *graphq
 	return w, errors.Wrap(wc.prepareGitRepo(ctx, w), "preparing local git repo")
 }
 
-func (*dockerVolumeWorkspaceCreator) createVolume(ctx context.Context) (string, error) {
-	out, err := exec.CommandContext(ctx, "docker", "volume", "create").CombinedOutput()
-	if err != nil {
-		return "", err
-	}
-
-	return string(bytes.TrimSpace(out)), nil
-}
-
-func deleteVolume(ctx context.Context, volume string) error {
-	return exec.CommandContext(ctx, "docker", "volume", "rm", volume).Run()
-}
-
 func (*dockerVolumeWorkspaceCreator) prepareGitRepo(ctx context.Context, w *dockerVolumeWorkspace) error {
 	script := `#!/bin/sh
 	
@@ -135,7 +127,6 @@ func (wc *dockerVolumeWorkspaceCreator) unzipRepoIntoVolume(ctx context.Context,
 	// encoded in this function. Running `docker run` twice isn't ideal, but
 	// should be quick enough in general that it's not a huge concern.
 	opts := append([]string{
-		"run",
 		"--rm",
 		"--init",
 		"--workdir", "/work",
@@ -147,13 +138,12 @@ func (wc *dockerVolumeWorkspaceCreator) unzipRepoIntoVolume(ctx context.Context,
 		fmt.Sprintf("touch /work/%s; chown -R %s /work", dummy, w.uidGid.String()),
 	)
 
-	if out, err := exec.CommandContext(ctx, "docker", opts...).CombinedOutput(); err != nil {
+	if out, err := w.runContainer(ctx, opts...); err != nil {
 		return errors.Wrapf(err, "chown output:\n\n%s\n\n", string(out))
 	}
 
 	// Now we can unzip the archive as the user and clean up the temporary file.
 	opts = append([]string{
-		"run",
 		"--rm",
 		"--init",
 		"--workdir", "/work",
@@ -166,7 +156,7 @@ func (wc *dockerVolumeWorkspaceCreator) unzipRepoIntoVolume(ctx context.Context,
 		fmt.Sprintf("unzip /tmp/zip; rm /work/%s", dummy),
 	)
 
-	if out, err := exec.CommandContext(ctx, "docker", opts...).CombinedOutput(); err != nil {
+	if out, err := w.runContainer(ctx, opts...); err != nil {
 		return errors.Wrapf(err, "unzip output:\n\n%s\n\n", string(out))
 	}
 
@@ -179,7 +169,6 @@ func (wc *dockerVolumeWorkspaceCreator) copyFilesIntoVolumes(ctx context.Context
 	}
 
 	opts := append([]string{
-		"run",
 		"--rm",
 		"--init",
 		"--workdir", "/work",
@@ -209,7 +198,7 @@ func (wc *dockerVolumeWorkspaceCreator) copyFilesIntoVolumes(ctx context.Context
 		strings.Join(copyCmds, " && ")+";",
 	)
 
-	if out, err := exec.CommandContext(ctx, "docker", opts...).CombinedOutput(); err != nil {
+	if out, err := w.runContainer(ctx, opts...); err != nil {
 		return errors.Wrapf(err, "unzip output:\n\n%s\n\n", string(out))
 	}
 	return nil
@@ -220,6 +209,7 @@ func (wc *dockerVolumeWorkspaceCreator) copyFilesIntoVolumes(ctx context.Context
 // advantages if bind mounts are slow, such as on Docker for Mac, but could make
 // debugging harder and is slower when it's time to actually retrieve the diff.
 type dockerVolumeWorkspace struct {
+	runtime docker.ContainerRuntime
 	tempDir string
 	volume  string
 	uidGid  docker.UIDGID
@@ -228,8 +218,8 @@ type dockerVolumeWorkspace struct {
 var _ Workspace = &dockerVolumeWorkspace{}
 
 func (w *dockerVolumeWorkspace) Close(ctx context.Context) error {
-	// Cleanup here is easy: we just get rid of the Docker volume.
-	return deleteVolume(ctx, w.volume)
+	// Cleanup here is easy: we just get rid of the volume.
+	return w.runtime.RemoveVolume(ctx, w.volume)
 }
 
 func (w *dockerVolumeWorkspace) DockerRunOpts(ctx context.Context, target string) ([]string, error) {
@@ -284,6 +274,70 @@ git add --all > /dev/null
 	return nil
 }
 
+func (w *dockerVolumeWorkspace) Reset(ctx context.Context) error {
+	// Ignored files are left alone, just like they are ignored by Diff.
+	script := `#!/bin/sh
+
+set -e
+
+git reset --hard --quiet
+git clean -d --force --quiet
+`
+
+	out, err := w.runScript(ctx, "/work", script)
+	if err != nil {
+		return errors.Wrapf(err, "git reset:\n\n%s", string(out))
+	}
+
+	return nil
+}
+
+func (w *dockerVolumeWorkspace) CollectArtifacts(ctx context.Context, patterns []string, dir string) ([]string, error) {
+	// Untracked files include ignored ones, since steps commonly write their
+	// reports to ignored directories.
+	script := `#!/bin/sh
+
+set -e
+
+exec git ls-files --others -z
+`
+
+	out, err := w.runScript(ctx, "/work", script)
+	if err != nil {
+		return nil, errors.Wrapf(err, "git ls-files:\n\n%s", string(out))
+	}
+	files, err := matchArtifacts(patterns, splitNUL(out))
+	if err != nil || len(files) == 0 {
+		return files, err
+	}
+
+	for _, file := range files {
+		if strings.Contains(file, "\n") {
+			return nil, errors.Errorf("can't collect artifact %q with a line break in its path", file)
+		}
+	}
+
+	// The files are moved to dir, which is mounted into the container.
+	script = fmt.Sprintf(`#!/bin/sh
+
+set -e
+
+while IFS= read -r f; do
+  mkdir -p "/artifacts/$(dirname "$f")"
+  cp "$f" "/artifacts/$f"
+  rm "$f"
+done <<'EOF'
+%s
+EOF
+`, strings.Join(files, "\n"))
+
+	out, err = w.runScript(ctx, "/work", script, "--mount", "type=bind,source="+dir+",target=/artifacts")
+	if err != nil {
+		return nil, errors.Wrapf(err, "collecting artifacts:\n\n%s", string(out))
+	}
+	return files, nil
+}
+
 // DockerVolumeWorkspaceImage is the Docker image we'll run our unzip and git
 // commands in. This needs to match the name defined in
 // .github/workflows/docker.yml.
@@ -300,8 +354,9 @@ func init() {
 
 // runScript is a utility function to mount the given shell script into a Docker
 // container started from the dockerWorkspaceImage, then run it and return the
-// output.
-func (w *dockerVolumeWorkspace) runScript(ctx context.Context, target, script string) ([]byte, error) {
+// output. extraOpts are passed to `docker run`, e.g. to mount more
+// directories.
+func (w *dockerVolumeWorkspace) runScript(ctx context.Context, target, script string, extraOpts ...string) ([]byte, error) {
 	f, err := os.CreateTemp(w.tempDir, "src-run-*")
 	if err != nil {
 		return nil, errors.Wrap(err, "creating run script")
@@ -328,15 +383,15 @@ func (w *dockerVolumeWorkspace) runScript(ctx context.Context, target, script st
 	}
 
 	opts := append([]string{
-		"run",
 		"--rm",
 		"--init",
 		"--workdir", target,
 		"--mount", "type=bind,source=" + name + ",target=/run.sh,ro",
 	}, common...)
+	opts = append(opts, extraOpts...)
 	opts = append(opts, DockerVolumeWorkspaceImage, "sh", "/run.sh")
 
-	out, err := exec.CommandContext(ctx, "docker", opts...).CombinedOutput()
+	out, err := w.runContainer(ctx, opts...)
 	if err != nil {
 		return out, errors.Wrapf(err, "Docker output:\n\n%s\n\n", string(out))
 	}
@@ -344,6 +399,16 @@ func (w *dockerVolumeWorkspace) runScript(ctx context.Context, target, script st
 	return out, nil
 }
 
+// runContainer runs a container with the given `docker run` arguments and
+// returns its combined output.
+func (w *dockerVolumeWorkspace) runContainer(ctx context.Context, args ...string) ([]byte, error) {
+	cmd, err := w.runtime.Run(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return cmd.CombinedOutput()
+}
+
 func (w *dockerVolumeWorkspace) dockerRunOptsWithUser(ug docker.UIDGID, target string) []string {
 	return []string{
 		"--user", ug.String(),
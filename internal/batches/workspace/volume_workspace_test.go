@@ -49,7 +49,7 @@ func TestVolumeWorkspaceCreator(t *testing.T) {
 		archiveWithAdditionalFiles.mockAdditionalFilePaths[name] = path
 	}
 
-	wc := &dockerVolumeWorkspaceCreator{}
+	wc := &dockerVolumeWorkspaceCreator{runtime: docker.NewDockerRuntime()}
 	// We'll set up a fake repository with just enough fields defined for init()
 	// and friends.
 	repo := &graphql.Repository{
@@ -387,7 +387,7 @@ func TestVolumeWorkspaceCreator(t *testing.T) {
 
 func TestVolumeWorkspace_Close(t *testing.T) {
 	ctx := context.Background()
-	w := &dockerVolumeWorkspace{volume: volumeID}
+	w := &dockerVolumeWorkspace{runtime: docker.NewDockerRuntime(), volume: volumeID}
 
 	t.Run("success", func(t *testing.T) {
 		expect.Commands(
@@ -446,7 +446,7 @@ func TestVolumeWorkspace_WorkDir(t *testing.T) {
 
 func TestVolumeWorkspace_Diff(t *testing.T) {
 	ctx := context.Background()
-	w := &dockerVolumeWorkspace{volume: volumeID}
+	w := &dockerVolumeWorkspace{runtime: docker.NewDockerRuntime(), volume: volumeID}
 
 	t.Run("success", func(t *testing.T) {
 		for name, tc := range map[string]string{
@@ -517,7 +517,7 @@ index 06471f4..5f9d3fa 100644
 
 func TestVolumeWorkspace_ApplyDiff(t *testing.T) {
 	ctx := context.Background()
-	w := &dockerVolumeWorkspace{volume: volumeID}
+	w := &dockerVolumeWorkspace{runtime: docker.NewDockerRuntime(), volume: volumeID}
 
 	expect.Commands(
 		t,
@@ -538,13 +538,36 @@ func TestVolumeWorkspace_ApplyDiff(t *testing.T) {
 	}
 }
 
+func TestVolumeWorkspace_Reset(t *testing.T) {
+	ctx := context.Background()
+	w := &dockerVolumeWorkspace{runtime: docker.NewDockerRuntime(), volume: volumeID}
+
+	expect.Commands(
+		t,
+		expect.NewGlob(
+			expect.Behaviour{ExitCode: 0},
+			"docker", "run", "--rm", "--init", "--workdir", "/work",
+			"--mount", "type=bind,source=*,target=/run.sh,ro",
+			"--user", "0:0",
+			"--mount", "type=volume,source="+volumeID+",target=/work",
+			DockerVolumeWorkspaceImage,
+			"sh", "/run.sh",
+		),
+	)
+
+	err := w.Reset(ctx)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
 func TestVolumeWorkspace_runScript(t *testing.T) {
 	// Since the above tests have thoroughly tested our error handling, this
 	// test just fills in the one logical gap we have in our test coverage: is
 	// the temporary script file correct?
 	const script = "#!/bin/sh\n\necho FOO"
 	ctx := context.Background()
-	w := &dockerVolumeWorkspace{volume: volumeID}
+	w := &dockerVolumeWorkspace{runtime: docker.NewDockerRuntime(), volume: volumeID}
 
 	expect.Commands(
 		t,
@@ -3,6 +3,10 @@ package workspace
 import (
 	"context"
 	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/gobwas/glob"
 
 	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
 	"github.com/sourcegraph/sourcegraph/lib/errors"
@@ -45,6 +49,18 @@ type Workspace interface {
 	// ApplyDiff applies the given diff to the current workspace. Used when replaying
 	// a cache entry onto the workspace.
 	ApplyDiff(ctx context.Context, diff []byte) error
+
+	// Reset discards all changes made to the workspace since it was created.
+	// Together with Diff and ApplyDiff, it is used to restore the state before
+	// a step when the step is retried.
+	Reset(ctx context.Context) error
+
+	// CollectArtifacts moves the files that the steps created in the
+	// workspace and that match one of the given glob patterns to dir, and
+	// returns their paths relative to the workspace. Since the files are
+	// removed from the workspace, they aren't part of the diff. Files of the
+	// repository are never collected.
+	CollectArtifacts(ctx context.Context, patterns []string, dir string) ([]string, error)
 }
 
 type CreatorType int
@@ -52,15 +68,27 @@ type CreatorType int
 const (
 	CreatorTypeBind CreatorType = iota
 	CreatorTypeVolume
+	// CreatorTypeHost creates the same workspaces as CreatorTypeBind, but the
+	// steps are run directly on the host instead of in containers. It's only
+	// used when requested explicitly.
+	CreatorTypeHost
+	// CreatorTypeWorktree creates workspaces as git worktrees, which are bind
+	// mounted into the containers like CreatorTypeBind workspaces. It's only
+	// used when requested explicitly.
+	CreatorTypeWorktree
 )
 
-func NewCreator(ctx context.Context, preference, cacheDir, tempDir string, images map[string]docker.Image) (Creator, CreatorType) {
+func NewCreator(ctx context.Context, rt docker.ContainerRuntime, preference, cacheDir, tempDir string, images map[string]docker.Image) (Creator, CreatorType) {
 	var workspaceType CreatorType
 	switch preference {
 	case "volume":
 		workspaceType = CreatorTypeVolume
 	case "bind":
 		workspaceType = CreatorTypeBind
+	case "host":
+		workspaceType = CreatorTypeHost
+	case "worktree":
+		workspaceType = CreatorTypeWorktree
 	default:
 		workspaceType = BestCreatorType(ctx, images)
 	}
@@ -73,7 +101,11 @@ func NewCreator(ctx context.Context, preference, cacheDir, tempDir string, image
 			}
 			return img, nil
 		}
-		return &dockerVolumeWorkspaceCreator{tempDir: tempDir, EnsureImage: ensureImage}, workspaceType
+		return &dockerVolumeWorkspaceCreator{runtime: rt, tempDir: tempDir, EnsureImage: ensureImage}, workspaceType
+	}
+
+	if workspaceType == CreatorTypeWorktree {
+		return NewWorktreeCreator(cacheDir, nil), workspaceType
 	}
 
 	return &dockerBindWorkspaceCreator{Dir: cacheDir}, workspaceType
@@ -139,3 +171,36 @@ func detectBestCreatorType(ctx context.Context, images map[string]docker.Image)
 
 	return CreatorTypeVolume
 }
+
+// matchArtifacts returns the files that match one of the glob patterns, which
+// can use ** to match any number of directories, sorted by path.
+func matchArtifacts(patterns []string, files []string) ([]string, error) {
+	globs := make([]glob.Glob, 0, len(patterns))
+	for _, pattern := range patterns {
+		g, err := glob.Compile(pattern, '/')
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid artifact pattern %q", pattern)
+		}
+		globs = append(globs, g)
+	}
+
+	var matched []string
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		for _, g := range globs {
+			if g.Match(file) {
+				matched = append(matched, file)
+				break
+			}
+		}
+	}
+	sort.Strings(matched)
+	return matched, nil
+}
+
+// splitNUL splits the NUL-separated output of git commands run with -z.
+func splitNUL(out []byte) []string {
+	return strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+}
@@ -0,0 +1,504 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	batcheslib "github.com/sourcegraph/sourcegraph/lib/batches"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+	"github.com/sourcegraph/src-cli/internal/batches/repozip"
+	"github.com/sourcegraph/src-cli/internal/batches/util"
+)
+
+// Mirrors returns the directory of a local git mirror of the repository with
+// the given name, if there is one. Mirrors can be bare repositories or
+// checkouts.
+type Mirrors func(repoName string) (dir string, ok bool)
+
+// MirrorsInDir returns Mirrors that finds the mirrors of repositories at
+// <dir>/<repository name>.
+func MirrorsInDir(dir string) Mirrors {
+	return func(repoName string) (string, bool) {
+		mirror := filepath.Join(dir, filepath.FromSlash(repoName))
+		st, err := os.Stat(mirror)
+		return mirror, err == nil && st.IsDir()
+	}
+}
+
+// MirrorCreator is implemented by creators that can create workspaces from
+// local git mirrors instead of repository archives.
+type MirrorCreator interface {
+	Creator
+
+	// HasMirror returns whether the revision of the repository is available
+	// in a local mirror. If so, Create doesn't use the archive, so it doesn't
+	// need to be fetched.
+	HasMirror(ctx context.Context, repo *graphql.Repository) bool
+}
+
+// NewWorktreeCreator returns a creator that creates workspaces as git
+// worktrees. The worktrees are added to the mirror of the repository, if
+// mirrors has one with the required revision. Otherwise, the repository
+// archive is unzipped and committed once into a git repository in dir, which
+// is then shared by all workspaces created from the same archive. The
+// worktrees are created in dir as well.
+//
+// Every worktree gets a private git directory that borrows the objects of the
+// shared repository, so that neither steps nor diffing the workspace can
+// change the shared repository: its objects are only mounted read-only.
+func NewWorktreeCreator(dir string, mirrors Mirrors) Creator {
+	return &worktreeWorkspaceCreator{Dir: dir, Mirrors: mirrors}
+}
+
+type worktreeWorkspaceCreator struct {
+	Dir     string
+	Mirrors Mirrors
+
+	mu sync.Mutex
+	// bases maps the directories of the git repositories worktrees are added
+	// to to their state.
+	bases map[string]*worktreeBase
+}
+
+// worktreeBase is a git repository worktrees are added to.
+type worktreeBase struct {
+	mu sync.Mutex
+
+	dir string
+	// commonDir is the absolute path of the common git directory of the
+	// repository, which contains the administrative files of its worktrees.
+	commonDir string
+	// objectsDir is the absolute path of the object store of the repository.
+	objectsDir string
+	// prepared is true once commonDir and objectsDir are set and stale
+	// worktrees were removed.
+	prepared bool
+	// fromArchive is true if the repository was created from an archive,
+	// in which case it's removed when the creator is closed.
+	fromArchive bool
+}
+
+var (
+	_ Creator       = &worktreeWorkspaceCreator{}
+	_ MirrorCreator = &worktreeWorkspaceCreator{}
+)
+
+// worktreeBasesDir is the directory in Dir the repositories created from
+// archives are stored in. It starts with "workspace-", so the cache commands
+// ignore it.
+const worktreeBasesDir = "workspace-worktree-bases"
+
+func (wc *worktreeWorkspaceCreator) HasMirror(ctx context.Context, repo *graphql.Repository) bool {
+	_, ok := wc.mirror(ctx, repo)
+	return ok
+}
+
+func (wc *worktreeWorkspaceCreator) mirror(ctx context.Context, repo *graphql.Repository) (string, bool) {
+	if wc.Mirrors == nil {
+		return "", false
+	}
+	dir, ok := wc.Mirrors(repo.Name)
+	if !ok {
+		return "", false
+	}
+	_, err := runGitCmd(ctx, dir, "cat-file", "-e", repo.Rev()+"^{commit}")
+	return dir, err == nil
+}
+
+func (wc *worktreeWorkspaceCreator) Create(ctx context.Context, repo *graphql.Repository, steps []batcheslib.Step, archive repozip.Archive) (Workspace, error) {
+	var (
+		base *worktreeBase
+		rev  string
+		err  error
+	)
+	if dir, ok := wc.mirror(ctx, repo); ok {
+		base, err = wc.base(ctx, dir, nil)
+		rev = repo.Rev()
+	} else {
+		base, err = wc.baseFromArchive(ctx, archive)
+		// The archive is committed as the only commit of the repository.
+		rev = "HEAD"
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "preparing repository for worktree")
+	}
+
+	dir, err := os.MkdirTemp(wc.Dir, "workspace-worktree-"+util.SlugForRepo(repo.Name, repo.Rev())+"-")
+	if err != nil {
+		return nil, err
+	}
+	// The worktree is locked with a reason naming this process, so that
+	// worktrees left behind by crashed processes can be recognized and
+	// removed. See removeStaleWorktrees.
+	if _, err := runGitCmd(ctx, base.dir, "worktree", "add", "--detach", "--lock", "--reason", util.LockOwner(), dir, rev); err != nil {
+		os.RemoveAll(dir)
+		return nil, errors.Wrap(err, "adding worktree")
+	}
+
+	w := &worktreeWorkspace{
+		dockerBindWorkspace: dockerBindWorkspace{tempDir: wc.Dir, dir: dir},
+		base:                base,
+		gitDir:              privateGitDir(dir),
+	}
+	if err := w.initGitDir(ctx, rev); err != nil {
+		w.Close(ctx)
+		return nil, errors.Wrap(err, "creating git directory of worktree")
+	}
+	// Since the container might not run as the same user, the files need to
+	// be writable for everyone, like in bind workspaces.
+	if err := makeWritable(dir); err != nil {
+		w.Close(ctx)
+		return nil, errors.Wrap(err, "making worktree writable")
+	}
+	if err := makeWritable(w.gitDir); err != nil {
+		w.Close(ctx)
+		return nil, errors.Wrap(err, "making git directory of worktree writable")
+	}
+	return w, nil
+}
+
+// privateGitDir returns the private git directory of the worktree at dir.
+func privateGitDir(dir string) string { return dir + "-git" }
+
+// initGitDir creates the private git directory of the worktree, with HEAD
+// detached at rev and the index of the checkout, and points the worktree to
+// it. New objects are written to the private git directory, existing ones are
+// read from the base repository.
+func (w *worktreeWorkspace) initGitDir(ctx context.Context, rev string) error {
+	out, err := runGitCmd(ctx, w.dir, "rev-parse", "--absolute-git-dir", rev+"^{commit}")
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return errors.Newf("unexpected output of git rev-parse: %q", out)
+	}
+	adminDir, commit := fields[0], fields[1]
+
+	if _, err := runGitCmd(ctx, w.base.dir, "init", "--quiet", "--bare", w.gitDir); err != nil {
+		return err
+	}
+	if _, err := runGitCmd(ctx, w.dir, "config", "--file", filepath.Join(w.gitDir, "config"), "core.bare", "false"); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(w.gitDir, "objects", "info", "alternates"), []byte(w.base.objectsDir+"\n"), 0666); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(w.gitDir, "HEAD"), []byte(commit+"\n"), 0666); err != nil {
+		return err
+	}
+	// The index of the checkout has the stat information of the files, so
+	// git doesn't need to hash them all again.
+	index, err := os.ReadFile(filepath.Join(adminDir, "index"))
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(w.gitDir, "index"), index, 0666); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(w.dir, ".git"), []byte("gitdir: "+w.gitDir+"\n"), 0666)
+}
+
+// baseFromArchive returns the git repository containing the contents of the
+// archive, creating it if it doesn't exist yet.
+func (wc *worktreeWorkspaceCreator) baseFromArchive(ctx context.Context, archive repozip.Archive) (*worktreeBase, error) {
+	// The archive paths are unique for every repository revision and path
+	// fetched, so archives that only contain a workspace get their own
+	// repository.
+	name := strings.TrimSuffix(filepath.Base(archive.Path()), filepath.Ext(archive.Path()))
+	dir := filepath.Join(wc.Dir, worktreeBasesDir, name)
+
+	return wc.base(ctx, dir, func() error {
+		return wc.createArchiveRepo(ctx, archive, dir)
+	})
+}
+
+// base returns the prepared base repository at dir. If create isn't nil, the
+// repository was created from an archive and create is called to create it
+// the first time it's used.
+func (wc *worktreeWorkspaceCreator) base(ctx context.Context, dir string, create func() error) (*worktreeBase, error) {
+	wc.mu.Lock()
+	if wc.bases == nil {
+		wc.bases = make(map[string]*worktreeBase)
+	}
+	base, ok := wc.bases[dir]
+	if !ok {
+		base = &worktreeBase{dir: dir, fromArchive: create != nil}
+		wc.bases[dir] = base
+	}
+	wc.mu.Unlock()
+
+	base.mu.Lock()
+	defer base.mu.Unlock()
+
+	if base.prepared {
+		return base, nil
+	}
+
+	if create != nil {
+		if err := create(); err != nil {
+			return nil, err
+		}
+	}
+
+	out, err := runGitCmd(ctx, dir, "rev-parse", "--git-common-dir")
+	if err != nil {
+		return nil, err
+	}
+	commonDir := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(commonDir) {
+		commonDir = filepath.Join(dir, commonDir)
+	}
+	base.commonDir = commonDir
+	base.objectsDir = filepath.Join(commonDir, "objects")
+
+	if err := removeStaleWorktrees(ctx, dir, commonDir); err != nil {
+		return nil, errors.Wrap(err, "removing stale worktrees")
+	}
+
+	base.prepared = true
+	return base, nil
+}
+
+// createArchiveRepo unzips the archive and commits its contents to a new git
+// repository at dir. Other processes may do the same concurrently, so the
+// repository is created in a temporary directory and moved into place.
+func (wc *worktreeWorkspaceCreator) createArchiveRepo(ctx context.Context, archive repozip.Archive, dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0777); err != nil {
+		return err
+	}
+	tmp, err := unzipToTempDir(ctx, archive.Path(), filepath.Dir(dir), "tmp-")
+	if err != nil {
+		os.RemoveAll(tmp)
+		return errors.Wrap(err, "unzipping the ZIP archive")
+	}
+
+	bind := &dockerBindWorkspaceCreator{Dir: wc.Dir}
+	w := &dockerBindWorkspace{tempDir: wc.Dir, dir: tmp}
+	if err := bind.copyToWorkspace(ctx, w, archive.AdditionalFilePaths()); err != nil {
+		os.RemoveAll(tmp)
+		return errors.Wrap(err, "copying additional files into workspace")
+	}
+	if err := bind.prepareGitRepo(ctx, w); err != nil {
+		os.RemoveAll(tmp)
+		return errors.Wrap(err, "preparing local git repo")
+	}
+
+	if err := os.Rename(tmp, dir); err != nil {
+		os.RemoveAll(tmp)
+		if _, statErr := os.Stat(filepath.Join(dir, ".git")); statErr == nil {
+			// Another process was faster.
+			return nil
+		}
+		return errors.Wrap(err, "moving repository into place")
+	}
+	return nil
+}
+
+// Close removes the repositories created from archives, unless other
+// processes still have worktrees in them.
+func (wc *worktreeWorkspaceCreator) Close() error {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	var errs errors.MultiError
+	for dir, base := range wc.bases {
+		if !base.fromArchive || !base.prepared {
+			continue
+		}
+		worktrees, err := listWorktrees(context.Background(), dir)
+		if err != nil {
+			errs = errors.Append(errs, err)
+			continue
+		}
+		// The first worktree is the repository itself.
+		if len(worktrees) > 1 {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			errs = errors.Append(errs, err)
+		}
+		delete(wc.bases, dir)
+	}
+	return errs
+}
+
+// worktreeWorkspace is a bind workspace whose directory is a git worktree.
+type worktreeWorkspace struct {
+	dockerBindWorkspace
+
+	base *worktreeBase
+	// gitDir is the private git directory of the worktree.
+	gitDir string
+}
+
+var _ Workspace = &worktreeWorkspace{}
+
+func (w *worktreeWorkspace) DockerRunOpts(ctx context.Context, target string) ([]string, error) {
+	opts, err := w.dockerBindWorkspace.DockerRunOpts(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	// The .git file of the worktree points to its private git directory,
+	// which borrows the objects of the base repository. Both are mounted at
+	// the same paths so that git commands in steps work, but the objects of
+	// the base repository are read-only, since they're shared.
+	return append(opts,
+		"--mount",
+		fmt.Sprintf("type=bind,source=%s,target=%s", w.gitDir, w.gitDir),
+		"--mount",
+		fmt.Sprintf("type=bind,source=%s,target=%s,readonly", w.base.objectsDir, w.base.objectsDir),
+	), nil
+}
+
+func (w *worktreeWorkspace) Close(ctx context.Context) error {
+	return removeWorktree(w.base.commonDir, w.dir)
+}
+
+// removeWorktree removes the worktree at dir of the repository with the given
+// common git directory, along with its private git directory.
+//
+// The worktree doesn't point to the git directory it was registered with
+// anymore, so git worktree remove refuses it. Its administrative files are
+// removed directly instead of with git worktree prune, which would also remove
+// those of the user's worktrees whose directories are missing, e.g. because
+// they're on an unmounted drive.
+func removeWorktree(commonDir, dir string) error {
+	var errs errors.MultiError
+	adminDir, err := worktreeAdminDir(commonDir, dir)
+	if err != nil {
+		errs = errors.Append(errs, err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		errs = errors.Append(errs, err)
+	}
+	if err := os.RemoveAll(privateGitDir(dir)); err != nil {
+		errs = errors.Append(errs, err)
+	}
+	if adminDir != "" {
+		if err := os.RemoveAll(adminDir); err != nil {
+			errs = errors.Append(errs, err)
+		}
+	}
+	return errs
+}
+
+// worktreeAdminDir returns the directory in commonDir with the administrative
+// files of the worktree at dir, i.e. the one whose gitdir file points to the
+// .git file of the worktree. It returns an empty string if there is none.
+func worktreeAdminDir(commonDir, dir string) (string, error) {
+	worktreesDir := filepath.Join(commonDir, "worktrees")
+	entries, err := os.ReadDir(worktreesDir)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	want := filepath.Join(dir, ".git")
+	wantInfo, wantErr := os.Stat(want)
+	for _, e := range entries {
+		adminDir := filepath.Join(worktreesDir, e.Name())
+		content, err := os.ReadFile(filepath.Join(adminDir, "gitdir"))
+		if err != nil {
+			continue
+		}
+		gitFile := strings.TrimSpace(string(content))
+		if !filepath.IsAbs(gitFile) {
+			gitFile = filepath.Join(adminDir, gitFile)
+		}
+		if filepath.Clean(gitFile) == want {
+			return adminDir, nil
+		}
+		// The path might have been recorded through a symlink.
+		if wantErr == nil {
+			if info, err := os.Stat(gitFile); err == nil && os.SameFile(info, wantInfo) {
+				return adminDir, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// removeStaleWorktrees removes the worktrees of the repository at dir, with the
+// given common git directory, that were created by processes on this host that
+// aren't running anymore.
+func removeStaleWorktrees(ctx context.Context, dir, commonDir string) error {
+	worktrees, err := listWorktrees(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, wt := range worktrees {
+		if !util.StaleLock(wt.lockReason) {
+			continue
+		}
+		if err := removeWorktree(commonDir, wt.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type worktree struct {
+	path       string
+	lockReason string
+}
+
+func listWorktrees(ctx context.Context, dir string) ([]worktree, error) {
+	out, err := runGitCmd(ctx, dir, "worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+
+	var worktrees []worktree
+	for _, block := range strings.Split(strings.TrimSpace(string(out)), "\n\n") {
+		var wt worktree
+		for _, line := range strings.Split(block, "\n") {
+			if path, ok := strings.CutPrefix(line, "worktree "); ok {
+				wt.path = path
+			} else if reason, ok := strings.CutPrefix(line, "locked "); ok {
+				wt.lockReason = reason
+			}
+		}
+		if wt.path != "" {
+			worktrees = append(worktrees, wt)
+		}
+	}
+	return worktrees, nil
+}
+
+// makeWritable makes all files and directories in dir writable for everyone,
+// except for the .git file of the worktree.
+func makeWritable(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 || (path == filepath.Join(dir, ".git")) {
+			return nil
+		}
+		if d.IsDir() {
+			return os.Chmod(path, 0777)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Mode()&0111 != 0 {
+			return os.Chmod(path, 0777)
+		}
+		return os.Chmod(path, 0666)
+	})
+}
@@ -0,0 +1,243 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+	"github.com/sourcegraph/src-cli/internal/batches/util"
+)
+
+func TestWorktreeWorkspaceCreator_Mirror(t *testing.T) {
+	ctx := context.Background()
+	mirrors := t.TempDir()
+	cacheDir := t.TempDir()
+
+	mirror := filepath.Join(mirrors, "github.com", "sourcegraph", "src-cli")
+	require.NoError(t, os.MkdirAll(mirror, 0755))
+	runWorktreeTestGit(t, mirror, "init", "-q", "-b", "main")
+	require.NoError(t, os.WriteFile(filepath.Join(mirror, "README.md"), []byte("# README\n"), 0644))
+	runWorktreeTestGit(t, mirror, "add", "--all")
+	runWorktreeTestGit(t, mirror, "commit", "-q", "-m", "Initial commit")
+	rev := runWorktreeTestGit(t, mirror, "rev-parse", "HEAD")
+
+	repo := &graphql.Repository{
+		Name:          "github.com/sourcegraph/src-cli",
+		DefaultBranch: &graphql.Branch{Name: "main", Target: graphql.Target{OID: rev}},
+	}
+	wc := NewWorktreeCreator(cacheDir, MirrorsInDir(mirrors)).(*worktreeWorkspaceCreator)
+
+	assert.True(t, wc.HasMirror(ctx, repo))
+	assert.False(t, wc.HasMirror(ctx, &graphql.Repository{
+		Name:          repo.Name,
+		DefaultBranch: &graphql.Branch{Name: "main", Target: graphql.Target{OID: strings.Repeat("1", 40)}},
+	}))
+	assert.False(t, wc.HasMirror(ctx, &graphql.Repository{Name: "github.com/sourcegraph/missing", DefaultBranch: repo.DefaultBranch}))
+
+	// The archive isn't used, so it doesn't exist.
+	w, err := wc.Create(ctx, repo, nil, &fakeRepoArchive{mockPath: "/does/not/exist.zip"})
+	require.NoError(t, err)
+	dir := *w.WorkDir()
+	assert.Equal(t, cacheDir, filepath.Dir(dir))
+
+	files, err := readWorkspaceFiles(w)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"README.md": "# README\n"}, files)
+
+	// The worktree has a private git directory, and the objects of the mirror
+	// are only mounted read-only.
+	opts, err := w.DockerRunOpts(ctx, "/work")
+	require.NoError(t, err)
+	gitDir := dir + "-git"
+	objectsDir := filepath.Join(mirror, ".git", "objects")
+	assert.Equal(t, []string{
+		"--mount", fmt.Sprintf("type=bind,source=%s,target=/work", dir),
+		"--mount", fmt.Sprintf("type=bind,source=%s,target=%s", gitDir, gitDir),
+		"--mount", fmt.Sprintf("type=bind,source=%s,target=%s,readonly", objectsDir, objectsDir),
+	}, opts)
+	assert.Equal(t, rev, runWorktreeTestGit(t, dir, "rev-parse", "HEAD"))
+	assert.Equal(t, gitDir, runWorktreeTestGit(t, dir, "rev-parse", "--absolute-git-dir"))
+	objects := runWorktreeTestGit(t, mirror, "count-objects")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("# README\nHello\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new\n"), 0644))
+	diff, err := w.Diff(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, string(diff), "+Hello")
+	assert.Contains(t, string(diff), "new file mode")
+
+	require.NoError(t, w.Reset(ctx))
+	files, err = readWorkspaceFiles(w)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"README.md": "# README\n"}, files)
+
+	require.NoError(t, w.ApplyDiff(ctx, diff))
+	files, err = readWorkspaceFiles(w)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"README.md": "# README\nHello\n", "new.txt": "new\n"}, files)
+
+	// The mirror itself is untouched, and diffing didn't write objects to it.
+	assert.Equal(t, "", runWorktreeTestGit(t, mirror, "status", "--porcelain"))
+	assert.Equal(t, objects, runWorktreeTestGit(t, mirror, "count-objects"))
+
+	require.NoError(t, w.Close(ctx))
+	assert.NoDirExists(t, dir)
+	assert.NoDirExists(t, gitDir)
+	assert.NotContains(t, runWorktreeTestGit(t, mirror, "worktree", "list"), dir)
+
+	// Mirrors aren't removed.
+	require.NoError(t, wc.Close())
+	assert.DirExists(t, mirror)
+}
+
+func TestWorktreeWorkspaceCreator_Archive(t *testing.T) {
+	ctx := context.Background()
+	cacheDir := t.TempDir()
+
+	archive := &fakeRepoArchive{
+		mockPath: zipUpFiles(t, t.TempDir(), map[string]string{"README.md": "# README\n"}),
+		mockAdditionalFilePaths: map[string]string{
+			".gitignore": writeWorktreeTestFile(t, "*.log\n"),
+		},
+	}
+	wc := NewWorktreeCreator(cacheDir, nil).(*worktreeWorkspaceCreator)
+	assert.False(t, wc.HasMirror(ctx, repo))
+
+	var workspaces []Workspace
+	for range 2 {
+		w, err := wc.Create(ctx, repo, nil, archive)
+		require.NoError(t, err)
+		workspaces = append(workspaces, w)
+
+		files, err := readWorkspaceFiles(w)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"README.md": "# README\n", ".gitignore": "*.log\n"}, files)
+	}
+
+	// Both workspaces share a single repository.
+	bases, err := os.ReadDir(filepath.Join(cacheDir, worktreeBasesDir))
+	require.NoError(t, err)
+	require.Len(t, bases, 1)
+	base := filepath.Join(cacheDir, worktreeBasesDir, bases[0].Name())
+
+	// Ignored files aren't part of the diff, like in bind workspaces.
+	dir := *workspaces[0].WorkDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "out.log"), []byte("log\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new\n"), 0644))
+	diff, err := workspaces[0].Diff(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, string(diff), "new.txt")
+	assert.NotContains(t, string(diff), "out.log")
+
+	// The repository is only removed once all worktrees are gone.
+	require.NoError(t, workspaces[0].Close(ctx))
+	require.NoError(t, wc.Close())
+	assert.DirExists(t, base)
+
+	require.NoError(t, workspaces[1].Close(ctx))
+	require.NoError(t, wc.Close())
+	assert.NoDirExists(t, base)
+}
+
+func TestWorktreeWorkspaceCreator_RemovesStaleWorktrees(t *testing.T) {
+	ctx := context.Background()
+	cacheDir := t.TempDir()
+	mirror := t.TempDir()
+
+	runWorktreeTestGit(t, mirror, "init", "-q", "-b", "main")
+	runWorktreeTestGit(t, mirror, "commit", "-q", "--allow-empty", "-m", "Initial commit")
+	rev := runWorktreeTestGit(t, mirror, "rev-parse", "HEAD")
+
+	// A process that has exited.
+	cmd := exec.Command("git", "--version")
+	require.NoError(t, cmd.Run())
+	deadPID := cmd.Process.Pid
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	stale := filepath.Join(cacheDir, "stale")
+	runWorktreeTestGit(t, mirror, "worktree", "add", "-q", "--detach", "--lock", "--reason", fmt.Sprintf("src-cli %s %d", hostname, deadPID), stale, rev)
+	alive := filepath.Join(cacheDir, "alive")
+	runWorktreeTestGit(t, mirror, "worktree", "add", "-q", "--detach", "--lock", "--reason", fmt.Sprintf("src-cli %s %d", hostname, os.Getppid()), alive, rev)
+	other := filepath.Join(cacheDir, "other")
+	runWorktreeTestGit(t, mirror, "worktree", "add", "-q", "--detach", "--lock", "--reason", "someone else", other, rev)
+
+	repo := &graphql.Repository{
+		Name:          "github.com/sourcegraph/src-cli",
+		DefaultBranch: &graphql.Branch{Name: "main", Target: graphql.Target{OID: rev}},
+	}
+	wc := NewWorktreeCreator(cacheDir, func(string) (string, bool) { return mirror, true })
+	w, err := wc.Create(ctx, repo, nil, nil)
+	require.NoError(t, err)
+	defer w.Close(ctx)
+
+	assert.NoDirExists(t, stale)
+	assert.DirExists(t, alive)
+	assert.DirExists(t, other)
+
+	worktrees := runWorktreeTestGit(t, mirror, "worktree", "list", "--porcelain")
+	assert.NotContains(t, worktrees, stale)
+	assert.Contains(t, worktrees, "locked "+util.LockOwner())
+}
+
+func TestWorktreeWorkspace_CloseKeepsOtherWorktrees(t *testing.T) {
+	ctx := context.Background()
+	cacheDir := t.TempDir()
+	mirror := t.TempDir()
+
+	runWorktreeTestGit(t, mirror, "init", "-q", "-b", "main")
+	runWorktreeTestGit(t, mirror, "commit", "-q", "--allow-empty", "-m", "Initial commit")
+	rev := runWorktreeTestGit(t, mirror, "rev-parse", "HEAD")
+
+	// A worktree of the user whose directory is missing, e.g. because it's on
+	// an unmounted drive.
+	unmounted := filepath.Join(t.TempDir(), "unmounted")
+	runWorktreeTestGit(t, mirror, "worktree", "add", "-q", "--detach", unmounted, rev)
+	require.NoError(t, os.RemoveAll(unmounted))
+
+	repo := &graphql.Repository{
+		Name:          "github.com/sourcegraph/src-cli",
+		DefaultBranch: &graphql.Branch{Name: "main", Target: graphql.Target{OID: rev}},
+	}
+	wc := NewWorktreeCreator(cacheDir, func(string) (string, bool) { return mirror, true })
+	w, err := wc.Create(ctx, repo, nil, nil)
+	require.NoError(t, err)
+	dir := *w.WorkDir()
+	require.NoError(t, w.Close(ctx))
+
+	worktrees := runWorktreeTestGit(t, mirror, "worktree", "list", "--porcelain")
+	assert.Contains(t, worktrees, "worktree "+unmounted)
+	assert.NotContains(t, worktrees, dir)
+	assert.NoDirExists(t, dir)
+	assert.NoDirExists(t, privateGitDir(dir))
+}
+
+func writeWorktreeTestFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func runWorktreeTestGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
@@ -66,6 +66,12 @@ type Repo struct {
 	ClonePath string
 }
 
+// RepoDir returns the directory on the local filesystem of a repository
+// returned by Repos.
+func (s *Serve) RepoDir(repo Repo) string {
+	return filepath.Join(s.Root, filepath.FromSlash(strings.TrimPrefix(repo.URI, "/repos/")))
+}
+
 func (s *Serve) handler() http.Handler {
 	mux := &http.ServeMux{}
 
@@ -3,7 +3,9 @@ package batches
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/sourcegraph/sourcegraph/lib/batches/env"
 	"github.com/sourcegraph/sourcegraph/lib/batches/overridable"
@@ -31,6 +33,7 @@ import (
 
 type BatchSpec struct {
 	Version           int                      `json:"version,omitempty" yaml:"version"`
+	TemplateFunctions int                      `json:"templateFunctions,omitempty" yaml:"templateFunctions,omitempty"`
 	Name              string                   `json:"name,omitempty" yaml:"name"`
 	Description       string                   `json:"description,omitempty" yaml:"description"`
 	On                []OnQueryOrRepository    `json:"on,omitempty" yaml:"on"`
@@ -40,6 +43,8 @@ type BatchSpec struct {
 	ImportChangesets  []ImportChangeset        `json:"importChangesets,omitempty" yaml:"importChangesets"`
 	ChangesetTemplate *ChangesetTemplate       `json:"changesetTemplate,omitempty" yaml:"changesetTemplate"`
 	ChangesetHooks    *ChangesetHooks          `json:"changesetHooks,omitempty" yaml:"hooks,omitempty"`
+	Caches            []StepCache              `json:"caches,omitempty" yaml:"caches,omitempty"`
+	Variables         map[string]Variable      `json:"variables,omitempty" yaml:"variables,omitempty"`
 }
 
 // Hooks declares side-effect actions to run at well-defined changeset
@@ -56,6 +61,18 @@ type ChangesetHookAction struct {
 	Steps []Step `json:"steps,omitempty" yaml:"steps,omitempty"`
 }
 
+// Action returns the action declared for the hook event with the given name.
+// The second return value is false if event is not a known hook event.
+func (h *ChangesetHooks) Action(event string) (ChangesetHookAction, bool) {
+	switch changesetHookEvent(event) {
+	case ChangesetHookEventOnCIFailure:
+		return h.OnCIFailure, true
+	case ChangesetHookEventOnMergeConflict:
+		return h.OnMergeConflict, true
+	}
+	return ChangesetHookAction{}, false
+}
+
 type changesetHookEvent string
 
 // Hook event names. Kept here so callers don't pass typoed strings.
@@ -120,6 +137,12 @@ type Step struct {
 	Container   string            `json:"container,omitempty" yaml:"container"`
 	Image       string            `json:"image,omitempty" yaml:"image"`
 	MaxAttempts int               `json:"maxAttempts,omitempty" yaml:"maxAttempts,omitempty"`
+	CPUs        float64           `json:"cpus,omitempty" yaml:"cpus,omitempty"`
+	Memory      string            `json:"memory,omitempty" yaml:"memory,omitempty"`
+	Network     string            `json:"network,omitempty" yaml:"network,omitempty"`
+	Timeout     string            `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Caches      []StepCache       `json:"caches,omitempty" yaml:"caches,omitempty"`
+	Artifacts   []string          `json:"artifacts,omitempty" yaml:"artifacts,omitempty"`
 	Env         env.Environment   `json:"env" yaml:"env"`
 	Files       map[string]string `json:"files,omitempty" yaml:"files,omitempty"`
 	Outputs     Outputs           `json:"outputs,omitempty" yaml:"outputs,omitempty"`
@@ -132,6 +155,12 @@ type CodingAgentStep struct {
 	Prompt string `json:"prompt,omitempty" yaml:"prompt"`
 }
 
+// BuiltImageOutput is the name of the output that buildImage steps set to the
+// name of the image they built, so that later steps can use it as
+// ${{ outputs.imageName }}. buildImage steps can't declare an output with this
+// name themselves.
+const BuiltImageOutput = "imageName"
+
 type BuildImageStep struct {
 	Run       string `json:"run" yaml:"run"`
 	BaseImage string `json:"baseImage" yaml:"baseImage"`
@@ -156,6 +185,31 @@ func (s Step) MarshalJSON() ([]byte, error) {
 	return json.Marshal(canon)
 }
 
+// The values of Step.Network.
+const (
+	// StepNetworkDefault gives the step container the default network of the
+	// container runtime.
+	StepNetworkDefault = "default"
+	// StepNetworkNone runs the step container without network access.
+	StepNetworkNone = "none"
+)
+
+// TimeoutDuration returns the parsed Timeout of the step, or 0 if the step
+// has no timeout.
+func (s *Step) TimeoutDuration() (time.Duration, error) {
+	if s.Timeout == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s.Timeout)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, errors.Newf("timeout must be positive, got %s", s.Timeout)
+	}
+	return d, nil
+}
+
 func (s *Step) IfCondition() string {
 	switch v := s.If.(type) {
 	case bool:
@@ -192,6 +246,14 @@ type Mount struct {
 	Path       string `json:"path" yaml:"path"`
 }
 
+// StepCache is a named cache directory that is mounted into step containers.
+// Its contents persist across workspaces and executions, and aren't part of
+// the diff of a step.
+type StepCache struct {
+	Name       string `json:"name" yaml:"name"`
+	Mountpoint string `json:"mountpoint" yaml:"mountpoint"`
+}
+
 func ParseBatchSpec(data []byte) (*BatchSpec, error) {
 	return parseBatchSpec(schema.BatchSpecJSON, data)
 }
@@ -228,7 +290,23 @@ func parseBatchSpec(schema string, data []byte) (*BatchSpec, error) {
 		}
 	}
 
+	// Caches declared for the whole batch spec are used by every step, unless
+	// the step declares a cache at the same mountpoint itself.
+	for i := range spec.Steps {
+		spec.Steps[i].Caches = mergeStepCaches(spec.Steps[i].Caches, spec.Caches)
+	}
+	if spec.ChangesetHooks != nil {
+		for _, action := range []*ChangesetHookAction{&spec.ChangesetHooks.OnCIFailure, &spec.ChangesetHooks.OnMergeConflict} {
+			for i := range action.Steps {
+				action.Steps[i].Caches = mergeStepCaches(action.Steps[i].Caches, spec.Caches)
+			}
+		}
+	}
+
 	var errs error
+	if spec.TemplateFunctions > template.FunctionsVersion {
+		errs = errors.Append(errs, NewValidationError(errors.Newf("batch spec requires template functions version %d, but only version %d is supported; please upgrade src-cli", spec.TemplateFunctions, template.FunctionsVersion)))
+	}
 	if len(spec.Steps) != 0 && spec.ChangesetTemplate == nil {
 		errs = errors.Append(errs, NewValidationError(errors.New("batch spec includes steps but no changesetTemplate")))
 	}
@@ -255,11 +333,27 @@ func parseBatchSpec(schema string, data []byte) (*BatchSpec, error) {
 		if step.BuildImage != nil && step.Run != "" {
 			errs = errors.Append(errs, NewValidationError(errors.Newf("step %d: buildImage and run cannot be combined in the same step", i+1)))
 		}
+		if _, ok := step.Outputs[BuiltImageOutput]; ok && step.BuildImage != nil {
+			errs = errors.Append(errs, NewValidationError(errors.Newf("step %d: buildImage steps set the output %s to the name of the built image, so it can't be declared in outputs", i+1, BuiltImageOutput)))
+		}
 		for name := range step.Files {
 			if strings.Contains(name, invalidMountCharacters) {
 				errs = errors.Append(errs, NewValidationError(errors.Newf("step %d files target path contains invalid characters", i+1)))
 			}
 		}
+		if _, err := step.TimeoutDuration(); err != nil {
+			errs = errors.Append(errs, NewValidationError(errors.Newf("step %d: invalid timeout: %s", i+1, err)))
+		}
+		mountpoints := map[string]bool{}
+		for _, c := range step.Caches {
+			if strings.Contains(c.Mountpoint, invalidMountCharacters) {
+				errs = errors.Append(errs, NewValidationError(errors.Newf("step %d cache %q mountpoint contains invalid characters", i+1, c.Name)))
+			}
+			if mountpoints[c.Mountpoint] {
+				errs = errors.Append(errs, NewValidationError(errors.Newf("step %d has multiple caches at mountpoint %s", i+1, c.Mountpoint)))
+			}
+			mountpoints[c.Mountpoint] = true
+		}
 	}
 
 	if hookErr := validateHooks(&spec); hookErr != nil {
@@ -299,6 +393,11 @@ func validateHooks(spec *BatchSpec) error {
 					)))
 				}
 			}
+			if _, err := step.TimeoutDuration(); err != nil {
+				errs = errors.Append(errs, NewValidationError(errors.Newf(
+					"hooks.%s step %d: invalid timeout: %s", event, i+1, err,
+				)))
+			}
 		}
 	}
 
@@ -310,6 +409,22 @@ func validateHooks(spec *BatchSpec) error {
 
 const invalidMountCharacters = ","
 
+// mergeStepCaches returns the caches of a step followed by the given spec
+// caches, except for those at mountpoints the step already has a cache at.
+func mergeStepCaches(step, spec []StepCache) []StepCache {
+	if len(spec) == 0 {
+		return step
+	}
+
+	merged := slices.Clone(step)
+	for _, c := range spec {
+		if !slices.ContainsFunc(step, func(s StepCache) bool { return s.Mountpoint == c.Mountpoint }) {
+			merged = append(merged, c)
+		}
+	}
+	return merged
+}
+
 func (on *OnQueryOrRepository) String() string {
 	if on.RepositoriesMatchingQuery != "" {
 		return on.RepositoriesMatchingQuery
@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"sort"
 	"time"
 
@@ -115,6 +116,11 @@ type CacheKey struct {
 	// Ignore from serialization.
 	GlobalEnv []string `json:"-"`
 
+	// Runner is the runner the steps are executed with, e.g. "host" when
+	// steps are run without containers. It's empty for containers, so that
+	// existing cache keys stay valid.
+	Runner string `json:",omitempty"`
+
 	StepIndex int
 }
 
@@ -124,7 +130,11 @@ func (key CacheKey) Key() (string, error) {
 	// Setup a copy of the cache key that only includes the Steps up to and
 	// including key.StepIndex.
 	clone := key
-	clone.Steps = key.Steps[0 : key.StepIndex+1]
+	clone.Steps = slices.Clone(key.Steps[0 : key.StepIndex+1])
+	// Step caches only speed up steps, they don't change their results.
+	for i := range clone.Steps {
+		clone.Steps[i].Caches = nil
+	}
 
 	// Resolve environment only for the subset of Steps.
 	envs, err := resolveStepsEnvironment(key.GlobalEnv, clone.Steps)
@@ -29,3 +29,42 @@ func TestKeyer_Key_PerRunEnvVarsIgnored(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, unset, resolved)
 }
+
+func TestKeyer_Key_StepLimits(t *testing.T) {
+	repo := batches.Repository{ID: "r", Name: "r"}
+	key := func(step batches.Step) string {
+		k, err := (&CacheKey{Repository: repo, Steps: []batches.Step{step}, StepIndex: 0}).Key()
+		require.NoError(t, err)
+		return k
+	}
+
+	base := key(batches.Step{Run: "foo"})
+	keys := map[string]string{"": base}
+	for name, step := range map[string]batches.Step{
+		"cpus":    {Run: "foo", CPUs: 2},
+		"memory":  {Run: "foo", Memory: "512m"},
+		"network": {Run: "foo", Network: batches.StepNetworkNone},
+		"timeout": {Run: "foo", Timeout: "10m"},
+	} {
+		k := key(step)
+		for other, otherKey := range keys {
+			require.NotEqual(t, otherKey, k, "%s and %q have the same key", name, other)
+		}
+		keys[name] = k
+	}
+}
+
+func TestKeyer_Key_StepCachesIgnored(t *testing.T) {
+	repo := batches.Repository{ID: "r", Name: "r"}
+	steps := []batches.Step{{Run: "foo"}}
+	withCaches := []batches.Step{{Run: "foo", Caches: []batches.StepCache{{Name: "go", Mountpoint: "/go/pkg/mod"}}}}
+
+	without, err := (&CacheKey{Repository: repo, Steps: steps, StepIndex: 0}).Key()
+	require.NoError(t, err)
+	with, err := (&CacheKey{Repository: repo, Steps: withCaches, StepIndex: 0}).Key()
+	require.NoError(t, err)
+	require.Equal(t, without, with)
+
+	// The steps of the key aren't modified.
+	require.Len(t, withCaches[0].Caches, 1)
+}
@@ -24,6 +24,23 @@ type AfterStepResult struct {
 	Outputs map[string]any `json:"outputs"`
 	// Skipped determines whether the step was skipped.
 	Skipped bool `json:"skipped"`
+	// Artifacts are the files collected from the workspace by the step and
+	// the steps before it.
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+}
+
+// Artifact is a file collected from the workspace by a step. Only its listing
+// is recorded in the results, its content is stored separately by its
+// SHA-256 hash.
+type Artifact struct {
+	// StepIndex is the index of the step that collected the file.
+	StepIndex int `json:"stepIndex"`
+	// Path is the path of the file, relative to the workspace.
+	Path string `json:"path"`
+	// Size is the size of the file in bytes.
+	Size int64 `json:"size"`
+	// SHA256 is the hex encoded SHA-256 hash of the content of the file.
+	SHA256 string `json:"sha256"`
 }
 
 func (a AfterStepResult) MarshalJSON() ([]byte, error) {
@@ -37,6 +54,7 @@ func (a AfterStepResult) MarshalJSON() ([]byte, error) {
 		StepIndex:    a.StepIndex,
 		Diff:         string(a.Diff),
 		Outputs:      a.Outputs,
+		Artifacts:    a.Artifacts,
 	})
 }
 
@@ -58,6 +76,7 @@ func (a *AfterStepResult) UnmarshalJSON(data []byte) error {
 		a.Diff = v2.Diff
 		a.Outputs = v2.Outputs
 		a.Skipped = v2.Skipped
+		a.Artifacts = v2.Artifacts
 		return nil
 	}
 	var v1 v1AfterStepResult
@@ -70,6 +89,7 @@ func (a *AfterStepResult) UnmarshalJSON(data []byte) error {
 	a.StepIndex = v1.StepIndex
 	a.Diff = []byte(v1.Diff)
 	a.Outputs = v1.Outputs
+	a.Artifacts = v1.Artifacts
 	return nil
 }
 
@@ -86,6 +106,7 @@ type v2AfterStepResult struct {
 	Diff         []byte         `json:"diff"`
 	Outputs      map[string]any `json:"outputs"`
 	Skipped      bool           `json:"skipped"`
+	Artifacts    []Artifact     `json:"artifacts,omitempty"`
 }
 
 type v1AfterStepResult struct {
@@ -95,4 +116,5 @@ type v1AfterStepResult struct {
 	StepIndex    int            `json:"stepIndex"`
 	Diff         string         `json:"diff"`
 	Outputs      map[string]any `json:"outputs"`
+	Artifacts    []Artifact     `json:"artifacts,omitempty"`
 }
@@ -0,0 +1,365 @@
+package batches
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+
+	"github.com/sourcegraph/sourcegraph/lib/batches/template"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+)
+
+// Steps of a batch spec can include the steps of a step library instead of
+// declaring them inline:
+//
+//	steps:
+//	  - include: ./steps/go-format.yaml
+//	    with:
+//	      version: "1.22"
+//
+// A step library is a YAML file that contains a list of steps and the
+// parameters they accept, with their default values. Parameters without a
+// default value are required:
+//
+//	params:
+//	  version: "1.21"
+//	  packages: ~
+//	steps:
+//	  - run: go fmt ${{ params.packages }}
+//	    container: golang:${{ params.version }}
+//
+// Including a directory includes all step libraries in it, in the order of
+// their file names. Step libraries can include other step libraries, relative
+// to their own directory.
+const (
+	includeKey       = "include"
+	includeParamsKey = "with"
+)
+
+// ExpandIncludes replaces the steps of the batch spec in data that include a
+// step library with the steps of the library. Paths are resolved relative to
+// dir, and name is the name of the batch spec used in errors.
+//
+// If the batch spec doesn't include any step libraries, data is returned as is.
+func ExpandIncludes(name, dir string, data []byte) ([]byte, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		// Leave reporting syntax errors to the schema validation.
+		return data, nil
+	}
+	expanded, err := expandIncludes(name, dir, &doc)
+	if err != nil || !expanded {
+		return data, err
+	}
+	return encodeBatchSpec(&doc)
+}
+
+// expandIncludes expands the includes in the given document in place, and
+// returns whether the batch spec includes any step libraries.
+func expandIncludes(name, dir string, doc *yamlv3.Node) (bool, error) {
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return false, nil
+	}
+	root := doc.Content[0]
+
+	lists := []*yamlv3.Node{mappingValue(root, "steps")}
+	if hooks := mappingValue(root, "changesetHooks"); hooks != nil && hooks.Kind == yamlv3.MappingNode {
+		for i := 1; i < len(hooks.Content); i += 2 {
+			lists = append(lists, mappingValue(hooks.Content[i], "steps"))
+		}
+	}
+
+	var expanded bool
+	e := &includeExpander{dir: dir}
+	for _, list := range lists {
+		if list == nil || !containsIncludes(list) {
+			continue
+		}
+		if err := e.expandSteps(name, dir, list); err != nil {
+			return false, err
+		}
+		expanded = true
+	}
+	return expanded, nil
+}
+
+func encodeBatchSpec(doc *yamlv3.Node) ([]byte, error) {
+	var out bytes.Buffer
+	enc := yamlv3.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, errors.Wrap(err, "marshalling expanded batch spec")
+	}
+	return out.Bytes(), nil
+}
+
+// ParseBatchSpecWithIncludes expands the includes of the batch spec with
+// ExpandIncludes and parses the expanded batch spec, which is returned, too.
+func ParseBatchSpecWithIncludes(name, dir string, data []byte) (*BatchSpec, []byte, error) {
+	expanded, err := ExpandIncludes(name, dir, data)
+	if err != nil {
+		return nil, nil, NewValidationError(err)
+	}
+	spec, err := ParseBatchSpec(expanded)
+	return spec, expanded, err
+}
+
+type includeExpander struct {
+	// dir is the directory of the batch spec. Paths of step libraries in
+	// errors are relative to it.
+	dir string
+	// stack contains the step libraries that are currently being expanded,
+	// to detect cycles.
+	stack []string
+}
+
+// expandSteps replaces the include entries in the given sequence of steps
+// in place.
+func (e *includeExpander) expandSteps(name, dir string, list *yamlv3.Node) error {
+	if list.Kind != yamlv3.SequenceNode {
+		return nil
+	}
+
+	var steps []*yamlv3.Node
+	for _, step := range list.Content {
+		include := mappingValue(step, includeKey)
+		if include == nil {
+			steps = append(steps, step)
+			continue
+		}
+
+		included, err := e.include(dir, step, include)
+		if err != nil {
+			return errors.Newf("%s:%d: including %q: %s", name, include.Line, include.Value, err)
+		}
+		steps = append(steps, included...)
+	}
+	list.Content = steps
+	return nil
+}
+
+// include returns the expanded steps of the step libraries included by the
+// given step.
+func (e *includeExpander) include(dir string, step, include *yamlv3.Node) ([]*yamlv3.Node, error) {
+	if include.Kind != yamlv3.ScalarNode || include.Value == "" {
+		return nil, errors.New("include must be a path")
+	}
+	for i := 0; i < len(step.Content); i += 2 {
+		if key := step.Content[i].Value; key != includeKey && key != includeParamsKey {
+			return nil, errors.Newf("steps that include a step library can't set %q", key)
+		}
+	}
+
+	params := map[string]any{}
+	if with := mappingValue(step, includeParamsKey); with != nil {
+		if err := with.Decode(&params); err != nil {
+			return nil, errors.Wrap(err, "decoding parameters")
+		}
+	}
+
+	path := include.Value
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		files, err = stepLibraryFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, errors.New("directory doesn't contain any step libraries")
+		}
+	}
+
+	var (
+		steps    []*yamlv3.Node
+		declared = map[string]bool{}
+	)
+	for _, file := range files {
+		libSteps, libParams, err := e.expandLibrary(file, params)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, libSteps...)
+		for _, p := range libParams {
+			declared[p] = true
+		}
+	}
+
+	for p := range params {
+		if !declared[p] {
+			return nil, errors.Newf("unknown parameter %q", p)
+		}
+	}
+	return steps, nil
+}
+
+// expandLibrary returns the steps of the step library in the given file, with
+// the parameters substituted and its own includes expanded, and the names of
+// the parameters it declares.
+func (e *includeExpander) expandLibrary(file string, with map[string]any) ([]*yamlv3.Node, []string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	if slices.Contains(e.stack, abs) {
+		var cycle []string
+		for _, f := range append(e.stack, abs) {
+			cycle = append(cycle, e.display(f))
+		}
+		return nil, nil, errors.Newf("include cycle: %s", strings.Join(cycle, " -> "))
+	}
+	e.stack = append(e.stack, abs)
+	defer func() { e.stack = e.stack[:len(e.stack)-1] }()
+
+	name := e.display(file)
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, nil, errors.Wrapf(err, "parsing %s", name)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return nil, nil, errors.Newf("%s: step library must be a mapping with steps", name)
+	}
+	root := doc.Content[0]
+
+	for i := 0; i < len(root.Content); i += 2 {
+		if key := root.Content[i]; key.Value != "params" && key.Value != "steps" {
+			return nil, nil, errors.Newf("%s:%d: unknown field %q in step library", name, key.Line, key.Value)
+		}
+	}
+
+	// Parameters that aren't passed use their default values.
+	params := map[string]any{}
+	var declared []string
+	if defaults := mappingValue(root, "params"); defaults != nil {
+		if defaults.Kind != yamlv3.MappingNode {
+			return nil, nil, errors.Newf("%s:%d: params must be a mapping", name, defaults.Line)
+		}
+		for i := 0; i < len(defaults.Content); i += 2 {
+			key, value := defaults.Content[i], defaults.Content[i+1]
+			declared = append(declared, key.Value)
+
+			if v, ok := with[key.Value]; ok {
+				params[key.Value] = v
+				continue
+			}
+			if value.Tag == "!!null" {
+				return nil, nil, errors.Newf("%s:%d: missing required parameter %q", name, key.Line, key.Value)
+			}
+			var v any
+			if err := value.Decode(&v); err != nil {
+				return nil, nil, errors.Wrapf(err, "%s:%d: decoding parameter %q", name, key.Line, key.Value)
+			}
+			params[key.Value] = v
+		}
+	}
+
+	steps := mappingValue(root, "steps")
+	if steps == nil || steps.Kind != yamlv3.SequenceNode {
+		return nil, nil, errors.Newf("%s: step library must contain a list of steps", name)
+	}
+	renderParams := func(tmpl string) (string, error) { return template.RenderParams("params", tmpl, params) }
+	if err := renderStrings(name, steps, renderParams); err != nil {
+		return nil, nil, err
+	}
+	if err := e.expandSteps(name, filepath.Dir(file), steps); err != nil {
+		return nil, nil, err
+	}
+	return steps.Content, declared, nil
+}
+
+// display returns the path of the given step library for errors.
+func (e *includeExpander) display(file string) string {
+	if rel, err := filepath.Rel(e.dir, file); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return file
+}
+
+// renderStrings renders all strings in the given node that contain template
+// actions with render.
+func renderStrings(name string, n *yamlv3.Node, render func(tmpl string) (string, error)) error {
+	switch n.Kind {
+	case yamlv3.ScalarNode:
+		if !template.ContainsTemplateAction(n.Value) {
+			return nil
+		}
+		rendered, err := render(n.Value)
+		if err != nil {
+			return errors.Wrapf(err, "%s:%d", name, n.Line)
+		}
+		if rendered != n.Value && n.Style&(yamlv3.DoubleQuotedStyle|yamlv3.SingleQuotedStyle|yamlv3.LiteralStyle|yamlv3.FoldedStyle) == 0 {
+			// Unquoted values are resolved again, so that a parameter or
+			// variable can be used for a number, for example.
+			n.Tag = ""
+		}
+		n.Value = rendered
+	default:
+		for _, c := range n.Content {
+			if err := renderStrings(name, c, render); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// stepLibraryFiles returns the YAML files in the given directory, sorted by
+// name.
+func stepLibraryFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if ext := filepath.Ext(entry.Name()); !entry.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// containsIncludes returns true if the given sequence of steps includes a
+// step library.
+func containsIncludes(list *yamlv3.Node) bool {
+	if list.Kind != yamlv3.SequenceNode {
+		return false
+	}
+	for _, step := range list.Content {
+		if mappingValue(step, includeKey) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// mappingValue returns the value of the key in the given mapping node, or nil.
+func mappingValue(n *yamlv3.Node, key string) *yamlv3.Node {
+	if n == nil || n.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
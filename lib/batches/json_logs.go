@@ -51,6 +51,8 @@ func (l *LogEvent) UnmarshalJSON(data []byte) error {
 		l.Metadata = new(LogFileKeptMetadata)
 	case LogEventOperationUploadingChangesetSpecs:
 		l.Metadata = new(UploadingChangesetSpecsMetadata)
+	case LogEventOperationExportingChangesets:
+		l.Metadata = new(ExportingChangesetsMetadata)
 	case LogEventOperationCreatingBatchSpec:
 		l.Metadata = new(CreatingBatchSpecMetadata)
 	case LogEventOperationApplyingBatchSpec:
@@ -69,6 +71,8 @@ func (l *LogEvent) UnmarshalJSON(data []byte) error {
 		l.Metadata = new(TaskPreparingStepMetadata)
 	case LogEventOperationTaskStep:
 		l.Metadata = new(TaskStepMetadata)
+	case LogEventOperationTaskStepAttempt:
+		l.Metadata = new(TaskStepAttemptMetadata)
 	case LogEventOperationCacheAfterStepResult:
 		l.Metadata = new(CacheAfterStepResultMetadata)
 	case LogEventOperationDockerWatchDog:
@@ -98,6 +102,7 @@ const (
 	LogEventOperationExecutingTasks           LogEventOperation = "EXECUTING_TASKS"
 	LogEventOperationLogFileKept              LogEventOperation = "LOG_FILE_KEPT"
 	LogEventOperationUploadingChangesetSpecs  LogEventOperation = "UPLOADING_CHANGESET_SPECS"
+	LogEventOperationExportingChangesets      LogEventOperation = "EXPORTING_CHANGESETS"
 	LogEventOperationCreatingBatchSpec        LogEventOperation = "CREATING_BATCH_SPEC"
 	LogEventOperationApplyingBatchSpec        LogEventOperation = "APPLYING_BATCH_SPEC"
 	LogEventOperationBatchSpecExecution       LogEventOperation = "BATCH_SPEC_EXECUTION"
@@ -107,6 +112,7 @@ const (
 	LogEventOperationTaskStepSkipped          LogEventOperation = "TASK_STEP_SKIPPED"
 	LogEventOperationTaskPreparingStep        LogEventOperation = "TASK_PREPARING_STEP"
 	LogEventOperationTaskStep                 LogEventOperation = "TASK_STEP"
+	LogEventOperationTaskStepAttempt          LogEventOperation = "TASK_STEP_ATTEMPT"
 	LogEventOperationCacheAfterStepResult     LogEventOperation = "CACHE_AFTER_STEP_RESULT"
 	LogEventOperationDockerWatchDog           LogEventOperation = "DOCKER_WATCH_DOG"
 )
@@ -175,6 +181,16 @@ type UploadingChangesetSpecsMetadata struct {
 	IDs []string `json:"ids,omitempty"`
 }
 
+type ExportingChangesetsMetadata struct {
+	Done  int `json:"done,omitempty"`
+	Total int `json:"total,omitempty"`
+	// Files are the paths of the written patch files and bundles.
+	Files []string `json:"files,omitempty"`
+	// Branches are the branches created in local clones, as
+	// <clone directory>:<branch>.
+	Branches []string `json:"branches,omitempty"`
+}
+
 type CreatingBatchSpecMetadata struct {
 	PreviewURL string `json:"previewURL,omitempty"`
 }
@@ -324,6 +340,19 @@ type v1TaskStepMetadata struct {
 	Error     string            `json:"error,omitempty"`
 }
 
+// TaskStepAttemptMetadata describes a failed attempt of a step that is
+// retried.
+type TaskStepAttemptMetadata struct {
+	TaskID      string `json:"taskID,omitempty"`
+	Step        int    `json:"step,omitempty"`
+	Attempt     int    `json:"attempt,omitempty"`
+	MaxAttempts int    `json:"maxAttempts,omitempty"`
+	// RetryIn is the backoff before the next attempt starts, in milliseconds.
+	RetryIn  int64  `json:"retryIn,omitempty"`
+	ExitCode int    `json:"exitCode,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
 type CacheAfterStepResultMetadata struct {
 	Key   string                    `json:"key,omitempty"`
 	Value execution.AfterStepResult `json:"value"`
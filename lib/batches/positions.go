@@ -0,0 +1,131 @@
+package batches
+
+import (
+	"sort"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Position is a line and column in a batch spec, starting at 1.
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) before(o Position) bool {
+	if p.Line != o.Line {
+		return p.Line < o.Line
+	}
+	return p.Column < o.Column
+}
+
+// PositionMap maps positions in an expanded batch spec to the positions in the
+// batch spec file it was expanded from. A nil PositionMap maps every position
+// to itself, for batch specs that aren't changed by the expansion.
+type PositionMap struct {
+	// nodes are the nodes of the expanded batch spec, sorted by position.
+	nodes []mappedNode
+}
+
+type mappedNode struct {
+	expanded Position
+	// source is the position of the node in the file, or the zero Position
+	// if it was included from a step library.
+	source Position
+	// exact is false if the value of the node was changed by the expansion,
+	// so that positions within it can't be mapped.
+	exact bool
+}
+
+// Source returns the position in the batch spec file that the given position
+// in the expanded batch spec comes from. ok is false if it doesn't come from
+// the file, e.g. because it's in a step included from a step library.
+func (m *PositionMap) Source(p Position) (_ Position, ok bool) {
+	if m == nil {
+		return p, true
+	}
+
+	// Find the last node that starts at or before the position, which is the
+	// one the position is in.
+	i := sort.Search(len(m.nodes), func(i int) bool { return p.before(m.nodes[i].expanded) }) - 1
+	if i < 0 || m.nodes[i].source.Line == 0 {
+		return Position{}, false
+	}
+	n := m.nodes[i]
+	if !n.exact {
+		return n.source, true
+	}
+	if p.Line != n.expanded.Line {
+		// In a block scalar, whose indentation may have changed.
+		return Position{Line: n.source.Line + p.Line - n.expanded.Line}, true
+	}
+	if p.Column == 0 {
+		return Position{Line: n.source.Line}, true
+	}
+	return Position{Line: n.source.Line, Column: n.source.Column + p.Column - n.expanded.Column}, true
+}
+
+// ExpandBatchSpec expands the includes of the batch spec in data with
+// ExpandIncludes and its variables with ExpandVariables. The positions of the
+// expanded batch spec are mapped to the positions in data by the returned
+// PositionMap, which is nil if data isn't changed.
+func ExpandBatchSpec(name, dir string, data []byte, values map[string]string) ([]byte, *PositionMap, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		// Leave reporting syntax errors to the schema validation.
+		return data, nil, nil
+	}
+
+	// Remember the nodes of the file, and their values, to tell them apart
+	// from included and rendered ones after the expansion.
+	original := map[*yamlv3.Node]string{}
+	walkNodes(&doc, func(n *yamlv3.Node) { original[n] = n.Value })
+
+	included, err := expandIncludes(name, dir, &doc)
+	if err != nil {
+		return nil, nil, NewValidationError(err)
+	}
+	expanded, err := expandVariables(name, &doc, values)
+	if err != nil {
+		return nil, nil, NewValidationError(err)
+	}
+	if !included && !expanded {
+		return data, nil, nil
+	}
+
+	out, err := encodeBatchSpec(&doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	var reparsed yamlv3.Node
+	if err := yamlv3.Unmarshal(out, &reparsed); err != nil {
+		return nil, nil, err
+	}
+
+	m := &PositionMap{}
+	mapPositions(m, original, &doc, &reparsed)
+	sort.SliceStable(m.nodes, func(i, j int) bool { return m.nodes[i].expanded.before(m.nodes[j].expanded) })
+	return out, m, nil
+}
+
+// mapPositions adds the nodes of reparsed, which is the encoded and parsed
+// node n, to m.
+func mapPositions(m *PositionMap, original map[*yamlv3.Node]string, n, reparsed *yamlv3.Node) {
+	mn := mappedNode{expanded: Position{Line: reparsed.Line, Column: reparsed.Column}}
+	if value, ok := original[n]; ok {
+		mn.source = Position{Line: n.Line, Column: n.Column}
+		mn.exact = value == n.Value
+	}
+	m.nodes = append(m.nodes, mn)
+
+	for i := 0; i < len(n.Content) && i < len(reparsed.Content); i++ {
+		mapPositions(m, original, n.Content[i], reparsed.Content[i])
+	}
+}
+
+func walkNodes(n *yamlv3.Node, f func(*yamlv3.Node)) {
+	f(n)
+	for _, c := range n.Content {
+		walkNodes(c, f)
+	}
+}
@@ -71,6 +71,26 @@ const BatchSpecJSON = `{
         }
       }
     },
+    "Variable": {
+      "title": "Variable",
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "type": {
+          "type": "string",
+          "description": "The type of the variable. Defaults to string.",
+          "enum": ["string", "number", "boolean"]
+        },
+        "default": {
+          "type": ["string", "number", "boolean", "null"],
+          "description": "The value of the variable if it isn't set. Variables without a default are required."
+        },
+        "description": {
+          "type": "string",
+          "description": "The description of the variable."
+        }
+      }
+    },
     "Mount": {
       "title": "Mount",
       "type": "object",
@@ -89,6 +109,27 @@ const BatchSpecJSON = `{
         }
       }
     },
+    "StepCache": {
+      "title": "StepCache",
+      "type": "object",
+      "description": "A named cache directory that is mounted into the step container. Its contents persist across workspaces and executions, and are not part of the changes made by the step.",
+      "additionalProperties": false,
+      "required": ["name", "mountpoint"],
+      "properties": {
+        "name": {
+          "type": "string",
+          "description": "The name of the cache. Steps that use the same name share the cache.",
+          "pattern": "^[A-Za-z0-9][A-Za-z0-9_.-]*$",
+          "examples": ["go-modules", "npm"]
+        },
+        "mountpoint": {
+          "type": "string",
+          "description": "The absolute path in the container to mount the cache to.",
+          "pattern": "^/",
+          "examples": ["/root/go/pkg/mod", "/root/.npm"]
+        }
+      }
+    },
     "CodingAgent": {
       "title": "CodingAgent",
       "type": "object",
@@ -98,8 +139,8 @@ const BatchSpecJSON = `{
       "properties": {
         "type": {
           "type": "string",
-          "description": "The coding agent to use.",
-          "enum": ["codex", "claude-code"]
+          "description": "The coding agent to use. The command agent runs the binary given to src batch preview/apply with -coding-agent-command inside the step container.",
+          "enum": ["codex", "claude-code", "command"]
         },
         "prompt": {
           "type": "string",
@@ -109,7 +150,7 @@ const BatchSpecJSON = `{
     },
     "BuildImage": {
       "type": "object",
-      "description": "A step that creates a local image by running a shell command in a base image using buildah. Later steps can use the generated image via ${{ outputs.imageName }}. The generated image name is deterministic for the exact baseImage and run values.",
+      "description": "A step that creates a local image by running a shell command in a base image using buildah. Later steps can use the generated image via ${{ outputs.imageName }}, which the step sets itself, so it can't declare an output named imageName. Later steps that declare an output named imageName replace it. The generated image name is deterministic for the exact baseImage and run values.",
       "additionalProperties": false,
       "required": ["run", "baseImage"],
       "properties": {
@@ -225,6 +266,48 @@ const BatchSpecJSON = `{
           "items": {
             "$ref": "#/definitions/Mount"
           }
+        },
+        "cpus": {
+          "type": "number",
+          "description": "The number of CPUs the step container may use, like the --cpus option of docker run. Has no effect when steps are run on the host.",
+          "exclusiveMinimum": 0,
+          "examples": [1, 0.5]
+        },
+        "memory": {
+          "type": "string",
+          "description": "The maximum amount of memory the step container may use, like the --memory option of docker run: a number with an optional unit of b, k, m or g. The step fails if it is killed for exceeding the limit. Has no effect when steps are run on the host.",
+          "pattern": "^[0-9]+[bkmgBKMG]?$",
+          "examples": ["512m", "2g"]
+        },
+        "network": {
+          "type": "string",
+          "description": "The network of the step container. With none, the step has no network access. Steps with network none cannot be run on the host.",
+          "enum": ["default", "none"]
+        },
+        "timeout": {
+          "type": "string",
+          "description": "The maximum duration of the step, as a Go duration string. The step is stopped and fails once it is exceeded. The -timeout of src batch still limits the execution of all steps in a workspace.",
+          "examples": ["10m", "1h30m"]
+        },
+        "caches": {
+          "description": "Named cache directories that are mounted into the step container, in addition to the caches of the batch spec.",
+          "type": ["array", "null"],
+          "items": {
+            "$ref": "#/definitions/StepCache"
+          }
+        },
+        "artifacts": {
+          "description": "Glob patterns of files relative to the workspace that the step creates and that are collected to the local machine after the step, such as reports. Artifacts are removed from the workspace, so they aren't part of the diff. ** matches any number of directories.",
+          "type": ["array", "null"],
+          "items": {
+            "type": "string"
+          },
+          "examples": [["lint-report.json"], ["reports/**"]]
+        },
+        "maxAttempts": {
+          "type": "integer",
+          "description": "The maximum number of times this step will be attempted before it is considered failed. Failed attempts are retried with exponential backoff, starting from the state of the workspace before the step. Has no effect on buildImage steps. Defaults to 1 (no retries).",
+          "minimum": 1
         }
       }
     },
@@ -322,6 +405,43 @@ const BatchSpecJSON = `{
             "$ref": "#/definitions/Mount"
           }
         },
+        "cpus": {
+          "type": "number",
+          "description": "The number of CPUs the step container may use, like the --cpus option of docker run. Has no effect when steps are run on the host.",
+          "exclusiveMinimum": 0,
+          "examples": [1, 0.5]
+        },
+        "memory": {
+          "type": "string",
+          "description": "The maximum amount of memory the step container may use, like the --memory option of docker run: a number with an optional unit of b, k, m or g. The step fails if it is killed for exceeding the limit. Has no effect when steps are run on the host.",
+          "pattern": "^[0-9]+[bkmgBKMG]?$",
+          "examples": ["512m", "2g"]
+        },
+        "network": {
+          "type": "string",
+          "description": "The network of the step container. With none, the step has no network access. Steps with network none cannot be run on the host.",
+          "enum": ["default", "none"]
+        },
+        "timeout": {
+          "type": "string",
+          "description": "The maximum duration of the step, as a Go duration string. The step is stopped and fails once it is exceeded. The -timeout of src batch still limits the execution of all steps in a workspace.",
+          "examples": ["10m", "1h30m"]
+        },
+        "caches": {
+          "description": "Named cache directories that are mounted into the step container, in addition to the caches of the batch spec.",
+          "type": ["array", "null"],
+          "items": {
+            "$ref": "#/definitions/StepCache"
+          }
+        },
+        "artifacts": {
+          "description": "Glob patterns of files relative to the workspace that the step creates and that are collected to the local machine after the step, such as reports. Artifacts are removed from the workspace, so they aren't part of the diff. ** matches any number of directories.",
+          "type": ["array", "null"],
+          "items": {
+            "type": "string"
+          },
+          "examples": [["lint-report.json"], ["reports/**"]]
+        },
         "maxAttempts": {
           "type": "integer",
           "description": "The maximum number of times this step will be attempted before the hook action is considered failed. Defaults to 1 (no retries).",
@@ -352,6 +472,11 @@ const BatchSpecJSON = `{
       "description": "The version of the batch spec schema. Defaults to 1.",
       "enum": [1, 2, 3]
     },
+    "templateFunctions": {
+      "type": "integer",
+      "description": "The version of the template functions the batch spec uses. Batch specs that require a newer version than the one supported by src-cli fail to parse, instead of failing when one of the functions is called. The functions and the versions that added them are listed by src batch functions.",
+      "minimum": 1
+    },
     "name": {
       "type": "string",
       "description": "The name of the batch change, which is unique among all batch changes in the namespace. A batch change's name is case-preserving.",
@@ -637,6 +762,23 @@ const BatchSpecJSON = `{
           "$ref": "#/definitions/ChangesetHookAction"
         }
       }
+    },
+    "caches": {
+      "description": "Named cache directories that are mounted into the containers of all steps, for example to share downloaded dependencies across workspaces. Steps can declare additional caches.",
+      "type": ["array", "null"],
+      "items": {
+        "$ref": "#/definitions/StepCache"
+      }
+    },
+    "variables": {
+      "type": ["object", "null"],
+      "description": "Variables of the batch spec, which are set with the -var and -var-file flags of src batch and can be referenced everywhere in the batch spec via vars.<name-of-variable>. Variables without a default are required.",
+      "propertyNames": {
+        "pattern": "^[A-Za-z_][A-Za-z0-9_]*$"
+      },
+      "additionalProperties": {
+        "$ref": "#/definitions/Variable"
+      }
     }
   }
 }
@@ -0,0 +1,448 @@
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/gobwas/glob"
+	"github.com/grafana/regexp"
+	yamlv3 "gopkg.in/yaml.v3"
+
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+)
+
+// FunctionsVersion is the version of the set of Functions. It's incremented
+// whenever functions are added. Batch specs can require a version with
+// templateFunctions.
+const FunctionsVersion = 2
+
+// Function is a function that's available in all templates of a batch spec:
+// in steps, outputs, and the changeset template.
+type Function struct {
+	Name string `json:"name"`
+	// Usage shows the arguments of the function.
+	Usage       string `json:"usage"`
+	Description string `json:"description"`
+	// Since is the FunctionsVersion that added the function.
+	Since int `json:"since"`
+	// Impure functions can return different results for the same arguments,
+	// so templates calling them can't be evaluated ahead of time.
+	Impure bool `json:"impure,omitempty"`
+
+	fn any
+}
+
+// Functions are the functions available in templates, in addition to the
+// ones text/template predefines.
+var Functions = []Function{
+	{
+		Name: "join", Usage: "join LIST SEP", Since: 1,
+		Description: "Joins the elements of LIST with SEP.",
+		fn:          strings.Join,
+	},
+	{
+		Name: "join_if", Usage: "join_if SEP ELEMS...", Since: 1,
+		Description: "Joins the ELEMS that aren't empty with SEP.",
+		fn: func(sep string, elems ...string) string {
+			var nonBlank []string
+			for _, e := range elems {
+				if e != "" {
+					nonBlank = append(nonBlank, e)
+				}
+			}
+			return strings.Join(nonBlank, sep)
+		},
+	},
+	{
+		Name: "split", Usage: "split S SEP", Since: 1,
+		Description: "Splits S into the substrings separated by SEP.",
+		fn:          strings.Split,
+	},
+	{
+		Name: "replace", Usage: "replace S OLD NEW", Since: 1,
+		Description: "Replaces all occurrences of OLD in S with NEW.",
+		fn:          strings.ReplaceAll,
+	},
+	{
+		Name: "matches", Usage: "matches S PATTERN", Since: 1,
+		Description: "Reports whether S matches the glob PATTERN.",
+		fn: func(in, pattern string) (bool, error) {
+			g, err := glob.Compile(pattern)
+			if err != nil {
+				return false, err
+			}
+			return g.Match(in), nil
+		},
+	},
+
+	{
+		Name: "to_json", Usage: "to_json VALUE", Since: 2,
+		Description: "Encodes VALUE as JSON.",
+		fn: func(v any) (string, error) {
+			out, err := json.Marshal(v)
+			return string(out), err
+		},
+	},
+	{
+		Name: "from_json", Usage: "from_json S", Since: 2,
+		Description: "Decodes the JSON in S.",
+		fn: func(s string) (any, error) {
+			var v any
+			err := json.Unmarshal([]byte(s), &v)
+			return v, err
+		},
+	},
+	{
+		Name: "to_yaml", Usage: "to_yaml VALUE", Since: 2,
+		Description: "Encodes VALUE as YAML.",
+		fn: func(v any) (string, error) {
+			out, err := yamlv3.Marshal(v)
+			return strings.TrimSuffix(string(out), "\n"), err
+		},
+	},
+	{
+		Name: "from_yaml", Usage: "from_yaml S", Since: 2,
+		Description: "Decodes the YAML in S.",
+		fn: func(s string) (any, error) {
+			var v any
+			err := yamlv3.Unmarshal([]byte(s), &v)
+			return v, err
+		},
+	},
+
+	{
+		Name: "regex_replace", Usage: "regex_replace S PATTERN REPLACEMENT", Since: 2,
+		Description: "Replaces all matches of the regular expression PATTERN in S with REPLACEMENT, in which $1 refers to the first submatch.",
+		fn: func(s, pattern, replacement string) (string, error) {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return "", err
+			}
+			return re.ReplaceAllString(s, replacement), nil
+		},
+	},
+	{
+		Name: "regex_find", Usage: "regex_find S PATTERN", Since: 2,
+		Description: "Returns the first match of the regular expression PATTERN in S.",
+		fn: func(s, pattern string) (string, error) {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return "", err
+			}
+			return re.FindString(s), nil
+		},
+	},
+	{
+		Name: "regex_find_all", Usage: "regex_find_all S PATTERN", Since: 2,
+		Description: "Returns all matches of the regular expression PATTERN in S.",
+		fn: func(s, pattern string) ([]string, error) {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			return re.FindAllString(s, -1), nil
+		},
+	},
+	{
+		Name: "regex_find_submatch", Usage: "regex_find_submatch S PATTERN", Since: 2,
+		Description: "Returns the first match of the regular expression PATTERN in S, followed by its submatches.",
+		fn: func(s, pattern string) ([]string, error) {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			return re.FindStringSubmatch(s), nil
+		},
+	},
+
+	{
+		Name: "base", Usage: "base PATH", Since: 2,
+		Description: "Returns the last element of PATH.",
+		fn:          path.Base,
+	},
+	{
+		Name: "dir", Usage: "dir PATH", Since: 2,
+		Description: "Returns all but the last element of PATH.",
+		fn:          path.Dir,
+	},
+	{
+		Name: "ext", Usage: "ext PATH", Since: 2,
+		Description: "Returns the file name extension of PATH, including the dot.",
+		fn:          path.Ext,
+	},
+	{
+		Name: "rel", Usage: "rel BASE PATH", Since: 2,
+		Description: "Returns PATH relative to BASE.",
+		fn: func(base, target string) (string, error) {
+			rel, err := filepath.Rel(filepath.FromSlash(base), filepath.FromSlash(target))
+			return filepath.ToSlash(rel), err
+		},
+	},
+
+	{
+		Name: "upper", Usage: "upper S", Since: 2,
+		Description: "Converts S to upper case.",
+		fn:          strings.ToUpper,
+	},
+	{
+		Name: "lower", Usage: "lower S", Since: 2,
+		Description: "Converts S to lower case.",
+		fn:          strings.ToLower,
+	},
+	{
+		Name: "title", Usage: "title S", Since: 2,
+		Description: "Converts the first letter of every word in S to upper case.",
+		fn: func(s string) string {
+			prev := ' '
+			return strings.Map(func(r rune) rune {
+				defer func() { prev = r }()
+				if unicode.IsSpace(prev) {
+					return unicode.ToUpper(r)
+				}
+				return r
+			}, s)
+		},
+	},
+	{
+		Name: "snake_case", Usage: "snake_case S", Since: 2,
+		Description: `Converts S to snake case, e.g. "fooBar" to "foo_bar".`,
+		fn: func(s string) string {
+			return strings.Join(words(s, strings.ToLower), "_")
+		},
+	},
+	{
+		Name: "kebab_case", Usage: "kebab_case S", Since: 2,
+		Description: `Converts S to kebab case, e.g. "fooBar" to "foo-bar".`,
+		fn: func(s string) string {
+			return strings.Join(words(s, strings.ToLower), "-")
+		},
+	},
+	{
+		Name: "camel_case", Usage: "camel_case S", Since: 2,
+		Description: `Converts S to camel case, e.g. "foo_bar" to "fooBar".`,
+		fn: func(s string) string {
+			ws := words(s, strings.ToLower)
+			for i := 1; i < len(ws); i++ {
+				r := []rune(ws[i])
+				r[0] = unicode.ToUpper(r[0])
+				ws[i] = string(r)
+			}
+			return strings.Join(ws, "")
+		},
+	},
+
+	{
+		Name: "sha256", Usage: "sha256 S", Since: 2,
+		Description: "Returns the hex-encoded SHA-256 hash of S.",
+		fn: func(s string) string {
+			sum := sha256.Sum256([]byte(s))
+			return hex.EncodeToString(sum[:])
+		},
+	},
+
+	{
+		Name: "default", Usage: "default DEFAULT VALUE", Since: 2,
+		Description: `Returns VALUE, or DEFAULT if VALUE is empty. VALUE comes last so it can be piped in: ${{ outputs.name | default "none" }}.`,
+		fn: func(def, value any) any {
+			if isEmpty(value) {
+				return def
+			}
+			return value
+		},
+	},
+	{
+		Name: "coalesce", Usage: "coalesce VALUES...", Since: 2,
+		Description: "Returns the first of VALUES that isn't empty.",
+		fn: func(values ...any) any {
+			for _, v := range values {
+				if !isEmpty(v) {
+					return v
+				}
+			}
+			return nil
+		},
+	},
+
+	{
+		Name: "uniq", Usage: "uniq LIST", Since: 2,
+		Description: "Returns the elements of LIST without duplicates, in the order they first appear.",
+		fn: func(list any) ([]string, error) {
+			l, err := toStrings(list)
+			if err != nil {
+				return nil, err
+			}
+			var uniq []string
+			seen := make(map[string]bool, len(l))
+			for _, s := range l {
+				if !seen[s] {
+					seen[s] = true
+					uniq = append(uniq, s)
+				}
+			}
+			return uniq, nil
+		},
+	},
+	{
+		Name: "sort_alpha", Usage: "sort_alpha LIST", Since: 2,
+		Description: "Returns the elements of LIST sorted alphabetically.",
+		fn: func(list any) ([]string, error) {
+			l, err := toStrings(list)
+			if err != nil {
+				return nil, err
+			}
+			l = slices.Clone(l)
+			slices.Sort(l)
+			return l, nil
+		},
+	},
+	{
+		Name: "filter_glob", Usage: "filter_glob LIST PATTERN", Since: 2,
+		Description: "Returns the elements of LIST that match the glob PATTERN.",
+		fn: func(list any, pattern string) ([]string, error) {
+			l, err := toStrings(list)
+			if err != nil {
+				return nil, err
+			}
+			g, err := glob.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			var matching []string
+			for _, s := range l {
+				if g.Match(s) {
+					matching = append(matching, s)
+				}
+			}
+			return matching, nil
+		},
+	},
+
+	{
+		Name: "now", Usage: "now", Since: 2, Impure: true,
+		Description: "Returns the current time.",
+		fn:          time.Now,
+	},
+	{
+		Name: "date", Usage: "date LAYOUT TIME", Since: 2,
+		Description: `Formats TIME with the Go time LAYOUT, e.g. "2006-01-02". TIME can be a time, an RFC 3339 string, or a Unix timestamp in seconds.`,
+		fn: func(layout string, t any) (string, error) {
+			switch t := t.(type) {
+			case time.Time:
+				return t.Format(layout), nil
+			case string:
+				parsed, err := time.Parse(time.RFC3339, t)
+				if err != nil {
+					return "", err
+				}
+				return parsed.Format(layout), nil
+			case int:
+				return time.Unix(int64(t), 0).UTC().Format(layout), nil
+			case int64:
+				return time.Unix(t, 0).UTC().Format(layout), nil
+			case float64:
+				return time.Unix(int64(t), 0).UTC().Format(layout), nil
+			default:
+				return "", errors.Newf("can't format %T as a date", t)
+			}
+		},
+	},
+}
+
+// builtins are the Functions by name.
+var builtins = func() template.FuncMap {
+	m := make(template.FuncMap, len(Functions))
+	for _, f := range Functions {
+		m[f.Name] = f.fn
+	}
+	return m
+}()
+
+// isImpure returns true if the function with the given name is an impure
+// Function.
+func isImpure(name string) bool {
+	for _, f := range Functions {
+		if f.Name == name {
+			return f.Impure
+		}
+	}
+	return false
+}
+
+// isEmpty returns true for nil, false, zero numbers, and empty strings,
+// lists and maps.
+func isEmpty(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	default:
+		return rv.IsZero()
+	}
+}
+
+// toStrings converts a list, such as a []string or the []any decoded from
+// JSON, to a []string.
+func toStrings(list any) ([]string, error) {
+	if list == nil {
+		return nil, nil
+	}
+	if l, ok := list.([]string); ok {
+		return l, nil
+	}
+	rv := reflect.ValueOf(list)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, errors.Newf("expected a list, got %T", list)
+	}
+	l := make([]string, rv.Len())
+	for i := range l {
+		l[i] = fmt.Sprint(rv.Index(i).Interface())
+	}
+	return l, nil
+}
+
+// words splits s into words at whitespace, punctuation, and changes from
+// lower to upper case, and applies fn to every word.
+func words(s string, fn func(string) string) []string {
+	var (
+		ws   []string
+		word []rune
+	)
+	flush := func() {
+		if len(word) > 0 {
+			ws = append(ws, fn(string(word)))
+			word = word[:0]
+		}
+	}
+	runes := []rune(s)
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+			continue
+		case unicode.IsUpper(r) && i > 0 && len(word) > 0:
+			prev := runes[i-1]
+			// Split "fooBar" before "B", and "HTTPServer" before "S".
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(prev)) {
+				flush()
+			}
+		}
+		word = append(word, r)
+	}
+	flush()
+	return ws
+}
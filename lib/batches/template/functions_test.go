@@ -0,0 +1,120 @@
+package template
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourcegraph/sourcegraph/lib/batches/execution"
+)
+
+func TestFunctions(t *testing.T) {
+	stepCtx := &StepContext{
+		Repository: Repository{Name: "github.com/sourcegraph/src-cli"},
+		Outputs: map[string]any{
+			"files": []any{"b.go", "a.go", "b.go", "README.md"},
+			"empty": "",
+		},
+		PreviousStep: execution.AfterStepResult{Stdout: `{"version": "1.2.3", "tags": ["x", "z"]}`},
+	}
+
+	for _, tc := range []struct {
+		tmpl string
+		want string
+	}{
+		{tmpl: `${{ to_json outputs.files }}`, want: `["b.go","a.go","b.go","README.md"]`},
+		{tmpl: `${{ (from_json previous_step.stdout).version }}`, want: `1.2.3`},
+		{tmpl: `${{ index (from_yaml "tags: [a, b]").tags 1 }}`, want: `b`},
+		{tmpl: `${{ to_yaml (from_json previous_step.stdout).tags }}`, want: "- x\n- z"},
+		{tmpl: `${{ regex_replace "v1.2.3" "^v(\\d+)\\..*$" "$1" }}`, want: `1`},
+		{tmpl: `${{ regex_find repository.name "[^/]+$" }}`, want: `src-cli`},
+		{tmpl: `${{ join (regex_find_all "a1b22c333" "\\d+") "," }}`, want: `1,22,333`},
+		{tmpl: `${{ index (regex_find_submatch repository.name "^([^/]+)/([^/]+)") 2 }}`, want: `sourcegraph`},
+		{tmpl: `${{ base repository.name }} ${{ dir repository.name }} ${{ ext "a/b.tar.gz" }}`, want: `src-cli github.com/sourcegraph .gz`},
+		{tmpl: `${{ rel "a/b" "a/b/c/d.go" }}`, want: `c/d.go`},
+		{tmpl: `${{ repository.name | base | upper }} ${{ lower "ABC" }} ${{ title "hello big world" }}`, want: `SRC-CLI abc Hello Big World`},
+		{tmpl: `${{ snake_case "fooBar" }} ${{ snake_case "HTTPServer" }} ${{ kebab_case "foo_bar baz" }} ${{ camel_case "foo-bar_baz" }}`, want: `foo_bar http_server foo-bar-baz fooBarBaz`},
+		{tmpl: `${{ sha256 "abc" }}`, want: `ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad`},
+		{tmpl: `${{ outputs.empty | default "none" }} ${{ default "none" repository.name }}`, want: `none github.com/sourcegraph/src-cli`},
+		{tmpl: `${{ coalesce outputs.empty "" "first" "second" }}`, want: `first`},
+		{tmpl: `${{ join (uniq outputs.files) "," }}`, want: `b.go,a.go,README.md`},
+		{tmpl: `${{ join (sort_alpha outputs.files) "," }}`, want: `README.md,a.go,b.go,b.go`},
+		{tmpl: `${{ join (filter_glob outputs.files "*.go" | uniq) "," }}`, want: `b.go,a.go`},
+		{tmpl: `${{ date "2006-01-02" "2022-03-04T05:06:07Z" }} ${{ date "2006" 0 }}`, want: `2022-03-04 1970`},
+	} {
+		t.Run(tc.tmpl, func(t *testing.T) {
+			var out bytes.Buffer
+			require.NoError(t, RenderStepTemplate("testing", tc.tmpl, &out, stepCtx))
+			assert.Equal(t, tc.want, out.String())
+		})
+	}
+}
+
+func TestFunctions_Registry(t *testing.T) {
+	seen := map[string]bool{}
+	for _, f := range Functions {
+		assert.False(t, seen[f.Name], "duplicate function %q", f.Name)
+		seen[f.Name] = true
+
+		assert.NotEmpty(t, f.Usage, f.Name)
+		assert.NotEmpty(t, f.Description, f.Name)
+		assert.True(t, f.Since >= 1 && f.Since <= FunctionsVersion, f.Name)
+		assert.True(t, IsBuiltin(f.Name), f.Name)
+	}
+}
+
+func TestIsStaticBool_Functions(t *testing.T) {
+	stepCtx := &StepContext{
+		Repository: Repository{Name: "github.com/sourcegraph/src-cli"},
+		Outputs:    map[string]any{"name": "foo"},
+	}
+
+	for _, tc := range []struct {
+		tmpl       string
+		wantStatic bool
+		wantBool   bool
+	}{
+		{tmpl: `${{ eq (base repository.name) "src-cli" }}`, wantStatic: true, wantBool: true},
+		{tmpl: `${{ eq (repository.name | base | upper) "SRC-CLI" }}`, wantStatic: true, wantBool: true},
+		{tmpl: `${{ "" | coalesce "x" | eq "x" }}`, wantStatic: false},
+		{tmpl: `${{ eq ("fooBar" | snake_case) "foo_bar" }}`, wantStatic: true, wantBool: true},
+		{tmpl: `${{ eq (date "2006" now) "2022" }}`, wantStatic: false},
+		{tmpl: `${{ eq (default "none" outputs.name) "foo" }}`, wantStatic: false},
+	} {
+		t.Run(tc.tmpl, func(t *testing.T) {
+			isStatic, boolVal, err := IsStaticBool(tc.tmpl, stepCtx)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantStatic, isStatic)
+			if tc.wantStatic {
+				assert.Equal(t, tc.wantBool, boolVal)
+			}
+		})
+	}
+}
+
+func TestPartialEval(t *testing.T) {
+	stepCtx := &StepContext{
+		Repository:  Repository{Name: "github.com/sourcegraph/src-cli"},
+		BatchChange: BatchChangeAttributes{Name: "test"},
+	}
+
+	for _, tc := range []struct {
+		tmpl string
+		want string
+	}{
+		{tmpl: `echo hello`, want: `echo hello`},
+		{tmpl: `echo ${{ repository.name }}`, want: `echo github.com/sourcegraph/src-cli`},
+		{tmpl: `cd ${{ base repository.name }} && echo ${{ outputs.name }}`, want: `cd src-cli && echo ${{ outputs.name }}`},
+		{tmpl: `${{ batch_change.name }}-${{ previous_step.stdout }}`, want: `test-${{ previous_step.stdout }}`},
+		{tmpl: "a\n${{- repository.name -}}\nb", want: "agithub.com/sourcegraph/src-clib"},
+		{tmpl: `${{ if eq repository.name "x" }}y${{ end }}!`, want: `${{ if eq repository.name "x" }}y${{ end }}!`},
+	} {
+		t.Run(tc.tmpl, func(t *testing.T) {
+			have, err := PartialEval(tc.tmpl, stepCtx)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, have)
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package template
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+const (
+	// paramsFunc is the name of the function that gives access to the
+	// parameters of a step library in RenderParams.
+	paramsFunc = "params"
+	// varsFunc is the name of the function that gives access to the
+	// variables of a batch spec in RenderVars.
+	varsFunc = "vars"
+)
+
+// RenderParams substitutes the parameters of an included step library in the
+// given template, e.g. "${{ params.version }}".
+//
+// Only the actions that reference params are evaluated. All other actions,
+// such as "${{ repository.name }}", are left as they are, since they can only
+// be rendered when the steps are executed. An action can't reference both.
+func RenderParams(name, tmpl string, params map[string]any) (string, error) {
+	return renderFunc(name, tmpl, paramsFunc, params)
+}
+
+// RenderVars substitutes the variables of a batch spec in the given template,
+// e.g. "${{ vars.go_version }}", in the same way as RenderParams.
+func RenderVars(name, tmpl string, vars map[string]any) (string, error) {
+	return renderFunc(name, tmpl, varsFunc, vars)
+}
+
+// renderFunc evaluates the actions of the template that reference the
+// function fn, which returns values, and leaves all other actions as they
+// are.
+func renderFunc(name, tmpl, fn string, values map[string]any) (string, error) {
+	if !ContainsTemplateAction(tmpl) {
+		return tmpl, nil
+	}
+
+	// Functions are only known once the steps are executed, so the template
+	// is parsed without checking them.
+	tree := parse.New(name)
+	tree.Mode = parse.SkipFuncCheck
+	if _, err := tree.Parse(tmpl, startDelim, endDelim, map[string]*parse.Tree{}); err != nil {
+		return "", err
+	}
+
+	// Actions that don't reference the function are turned into actions that
+	// print their own source, so that executing the template leaves them
+	// untouched.
+	nodes := tree.Root.Nodes
+	var rewritten strings.Builder
+	for i, n := range nodes {
+		start := nodeStart(tmpl, n)
+		if i == 0 {
+			start = 0
+		}
+		end := len(tmpl)
+		if i+1 < len(nodes) {
+			end = nodeStart(tmpl, nodes[i+1])
+		}
+		source := tmpl[start:end]
+
+		if n.Type() == parse.NodeText || referencesIdent(n, fn) {
+			rewritten.WriteString(source)
+		} else {
+			rewritten.WriteString(startDelim + " " + strconv.Quote(source) + " " + endDelim)
+		}
+	}
+
+	t, err := New(name, rewritten.String(), "missingkey=error", template.FuncMap{
+		fn: func() map[string]any { return values },
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	if err := t.Execute(&out, nil); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// nodeStart returns the offset of the given top-level node in the template
+// source. The position of a node that isn't text points into the action, so
+// the start is the delimiter preceding it.
+func nodeStart(tmpl string, n parse.Node) int {
+	pos := int(n.Position())
+	if n.Type() == parse.NodeText {
+		return pos
+	}
+	if i := strings.LastIndex(tmpl[:pos], startDelim); i >= 0 {
+		return i
+	}
+	return pos
+}
+
+// referencesIdent returns true if the given node or one of its children
+// references the identifier.
+func referencesIdent(n parse.Node, ident string) bool {
+	switch n := n.(type) {
+	case *parse.IdentifierNode:
+		return n.Ident == ident
+	case *parse.ChainNode:
+		return referencesIdent(n.Node, ident)
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if referencesIdent(arg, ident) {
+				return true
+			}
+		}
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, cmd := range n.Cmds {
+			if referencesIdent(cmd, ident) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return referencesIdent(n.Pipe, ident)
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, node := range n.Nodes {
+			if referencesIdent(node, ident) {
+				return true
+			}
+		}
+	case *parse.IfNode:
+		return referencesIdent(&n.BranchNode, ident)
+	case *parse.RangeNode:
+		return referencesIdent(&n.BranchNode, ident)
+	case *parse.WithNode:
+		return referencesIdent(&n.BranchNode, ident)
+	case *parse.BranchNode:
+		return referencesIdent(n.Pipe, ident) || referencesIdent(n.List, ident) || referencesIdent(n.ElseList, ident)
+	case *parse.TemplateNode:
+		return referencesIdent(n.Pipe, ident)
+	}
+	return false
+}
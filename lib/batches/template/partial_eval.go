@@ -62,6 +62,43 @@ func IsStaticString(input string, ctx *StepContext) (isStatic bool, value string
 	return true, out.String(), nil
 }
 
+// PartialEval parses the input as a text/template and evaluates the actions
+// that only need the ahead-of-execution information available in
+// StepContext, in the same way as IsStaticString. Unlike IsStaticString, the
+// actions that can't be evaluated yet are kept as they are in the returned
+// string, so that it shows what is known about the template before the steps
+// are executed.
+func PartialEval(input string, ctx *StepContext) (string, error) {
+	if !ContainsTemplateAction(input) {
+		return input, nil
+	}
+
+	t, err := parsePartialEval(input, ctx)
+	if err != nil {
+		return "", err
+	}
+
+	nodes := t.Tree.Root.Nodes
+	var out strings.Builder
+	for i, n := range nodes {
+		if text, ok := rewriteNode(n, ctx).(*parse.TextNode); ok {
+			out.Write(text.Text)
+			continue
+		}
+
+		start := nodeStart(input, n)
+		if i == 0 {
+			start = 0
+		}
+		end := len(input)
+		if i+1 < len(nodes) {
+			end = nodeStart(input, nodes[i+1])
+		}
+		out.WriteString(input[start:end])
+	}
+	return out.String(), nil
+}
+
 // parseAndPartialEval parses input as a text/template and then attempts to
 // partially evaluate the parts of the template it can evaluate ahead of time
 // (meaning: before we've executed any batch spec steps and have a full
@@ -83,12 +120,7 @@ func IsStaticString(input string, ctx *StepContext) (isStatic bool, value string
 // outside the `parse` package. In other words: we evaluate
 // all-parse.ActionNode-or-nothing.
 func parseAndPartialEval(input string, ctx *StepContext) (*template.Template, error) {
-	t, err := template.
-		New("partial-eval").
-		Delims(startDelim, endDelim).
-		Funcs(builtins).
-		Funcs(ctx.ToFuncMap()).
-		Parse(input)
+	t, err := parsePartialEval(input, ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -100,6 +132,17 @@ func parseAndPartialEval(input string, ctx *StepContext) (*template.Template, er
 	return t, nil
 }
 
+// parsePartialEval parses input as a text/template with the functions
+// available in StepContext, without evaluating it.
+func parsePartialEval(input string, ctx *StepContext) (*template.Template, error) {
+	return template.
+		New("partial-eval").
+		Delims(startDelim, endDelim).
+		Funcs(builtins).
+		Funcs(ctx.ToFuncMap()).
+		Parse(input)
+}
+
 // rewriteNode takes the given parse.Parse and tries to partially evaluate it.
 // If that's possible, the output of the evaluation is turned into text and
 // instead of the node that was passed in a new parse.TextNode is returned that
@@ -134,12 +177,10 @@ func evalPipe(ctx *StepContext, p *parse.PipeNode) (finalVal reflect.Value, ok b
 		return noValue, false
 	}
 
-	// TODO: Support finalVal and pass it in to evalCmd
 	// finalVal is the value of the previous Cmd in a pipe (i.e. `${{ 3 + 3 | eq 6 }}`)
-	// It needs to be the final (fixed) argument of a call if it's set.
-
+	// and is passed as the final argument of the next Cmd.
 	for _, c := range p.Cmds {
-		finalVal, ok = evalCmd(ctx, c)
+		finalVal, ok = evalCmd(ctx, c, finalVal)
 		if !ok {
 			return noValue, false
 		}
@@ -148,17 +189,17 @@ func evalPipe(ctx *StepContext, p *parse.PipeNode) (finalVal reflect.Value, ok b
 	return finalVal, ok
 }
 
-func evalCmd(ctx *StepContext, c *parse.CommandNode) (reflect.Value, bool) {
+func evalCmd(ctx *StepContext, c *parse.CommandNode, final reflect.Value) (reflect.Value, bool) {
 	switch first := c.Args[0].(type) {
 	case *parse.BoolNode, *parse.NumberNode, *parse.StringNode, *parse.ChainNode:
-		if len(c.Args) == 1 {
+		if len(c.Args) == 1 && !final.IsValid() {
 			return evalNode(ctx, first)
 		}
 		return noValue, false
 
 	case *parse.IdentifierNode:
 		// A function call always starts with an identifier
-		return evalFunction(ctx, first.Ident, c.Args)
+		return evalFunction(ctx, first.Ident, c.Args, final)
 
 	default:
 		// Node type that we don't care about, so we don't even try to evaluate it
@@ -245,7 +286,7 @@ func isHexInt(s string) bool {
 	return len(s) > 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') && !strings.ContainsAny(s, "pP")
 }
 
-func evalFunction(ctx *StepContext, name string, args []parse.Node) (val reflect.Value, success bool) {
+func evalFunction(ctx *StepContext, name string, args []parse.Node, final reflect.Value) (val reflect.Value, success bool) {
 	defer func() {
 		if r := recover(); r != nil {
 			val = noValue
@@ -253,6 +294,14 @@ func evalFunction(ctx *StepContext, name string, args []parse.Node) (val reflect
 		}
 	}()
 
+	switch name {
+	case "eq", "ne", "not":
+		if final.IsValid() {
+			// We don't support piping into these.
+			return noValue, false
+		}
+	}
+
 	switch name {
 	case "eq":
 		return evalEqCall(ctx, args[1:])
@@ -269,7 +318,7 @@ func evalFunction(ctx *StepContext, name string, args []parse.Node) (val reflect
 
 	default:
 		concreteFn, ok := builtins[name]
-		if !ok {
+		if !ok || isImpure(name) {
 			return noValue, false
 		}
 
@@ -286,6 +335,9 @@ func evalFunction(ctx *StepContext, name string, args []parse.Node) (val reflect
 			evaluatedArgs = append(evaluatedArgs, v)
 
 		}
+		if final.IsValid() {
+			evaluatedArgs = append(evaluatedArgs, final)
+		}
 
 		ret := fn.Call(evaluatedArgs)
 		if len(ret) == 2 && !ret[1].IsNil() {
@@ -0,0 +1,137 @@
+package template
+
+import (
+	"maps"
+	"slices"
+	"text/template/parse"
+)
+
+// Reference is a reference to a function of the template context in a
+// template, such as "${{ repository.name }}".
+type Reference struct {
+	// Name is the name of the function, e.g. "repository".
+	Name string
+	// Field is the field accessed on the result of the function, e.g. "name".
+	// It's empty if the result is used as a whole.
+	Field string
+	// Offset is the byte offset of the reference in the template.
+	Offset int
+}
+
+// textTemplateBuiltins are the functions that text/template predefines.
+var textTemplateBuiltins = []string{
+	"and", "call", "html", "index", "slice", "js", "len", "not", "or",
+	"print", "printf", "println", "urlquery",
+	"eq", "ge", "gt", "le", "lt", "ne",
+}
+
+// IsBuiltin returns true if name is a function that's available in all
+// templates, as opposed to the functions of a template context.
+func IsBuiltin(name string) bool {
+	_, ok := builtins[name]
+	return ok || slices.Contains(textTemplateBuiltins, name)
+}
+
+// References parses the template and returns its references to functions
+// that aren't builtins, whether the template context defines them or not.
+//
+// Accessing a field with index, as in `${{ index outputs "name" }}`, is
+// returned as a reference to that field.
+func References(tmpl string) ([]Reference, error) {
+	tree := parse.New("references")
+	tree.Mode = parse.SkipFuncCheck
+	if _, err := tree.Parse(tmpl, startDelim, endDelim, map[string]*parse.Tree{}); err != nil {
+		return nil, err
+	}
+
+	var refs []Reference
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.IdentifierNode:
+			if !IsBuiltin(n.Ident) {
+				refs = append(refs, Reference{Name: n.Ident, Offset: int(n.Pos)})
+			}
+		case *parse.ChainNode:
+			if ident, ok := n.Node.(*parse.IdentifierNode); ok && len(n.Field) > 0 {
+				if !IsBuiltin(ident.Ident) {
+					refs = append(refs, Reference{Name: ident.Ident, Field: n.Field[0], Offset: int(ident.Pos)})
+				}
+				return
+			}
+			walk(n.Node)
+		case *parse.CommandNode:
+			if len(n.Args) >= 3 {
+				fn, isIndex := n.Args[0].(*parse.IdentifierNode)
+				ident, isIdent := n.Args[1].(*parse.IdentifierNode)
+				key, isString := n.Args[2].(*parse.StringNode)
+				if isIndex && fn.Ident == "index" && isIdent && isString && !IsBuiltin(ident.Ident) {
+					refs = append(refs, Reference{Name: ident.Ident, Field: key.Text, Offset: int(ident.Pos)})
+					for _, arg := range n.Args[3:] {
+						walk(arg)
+					}
+					return
+				}
+			}
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, node := range n.Nodes {
+				walk(node)
+			}
+		case *parse.IfNode:
+			walk(&n.BranchNode)
+		case *parse.RangeNode:
+			walk(&n.BranchNode)
+		case *parse.WithNode:
+			walk(&n.BranchNode)
+		case *parse.BranchNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		}
+	}
+	walk(tree.Root)
+	return refs, nil
+}
+
+// StepContextFields returns the functions available in the templates of
+// steps, mapped to the fields of their results. Outputs have no fixed
+// fields, so they map to nil.
+func StepContextFields() map[string][]string {
+	return contextFields((&StepContext{}).ToFuncMap())
+}
+
+// ChangesetTemplateContextFields returns the functions available in the
+// templates of the changeset template, mapped to the fields of their
+// results. Outputs have no fixed fields, so they map to nil.
+func ChangesetTemplateContextFields() map[string][]string {
+	return contextFields((&ChangesetTemplateContext{}).ToFuncMap())
+}
+
+func contextFields(funcs map[string]any) map[string][]string {
+	fields := make(map[string][]string, len(funcs))
+	for name, fn := range funcs {
+		var keys []string
+		if f, ok := fn.(func() map[string]any); ok {
+			keys = slices.Sorted(maps.Keys(f()))
+		}
+		fields[name] = keys
+	}
+	return fields
+}
@@ -8,7 +8,6 @@ import (
 	"strings"
 	"text/template"
 
-	"github.com/gobwas/glob"
 	"github.com/grafana/regexp"
 
 	"github.com/sourcegraph/sourcegraph/lib/batches/execution"
@@ -21,28 +20,6 @@ const (
 	endDelim   = "}}"
 )
 
-var builtins = template.FuncMap{
-	"join":    strings.Join,
-	"split":   strings.Split,
-	"replace": strings.ReplaceAll,
-	"join_if": func(sep string, elems ...string) string {
-		var nonBlank []string
-		for _, e := range elems {
-			if e != "" {
-				nonBlank = append(nonBlank, e)
-			}
-		}
-		return strings.Join(nonBlank, sep)
-	},
-	"matches": func(in, pattern string) (bool, error) {
-		g, err := glob.Compile(pattern)
-		if err != nil {
-			return false, err
-		}
-		return g.Match(in), nil
-	},
-}
-
 // ValidateBatchSpecTemplate attempts to perform a dry run replacement of the whole batch
 // spec template for any templating variables which are not dependent on execution
 // context. It returns a tuple whose first element is whether or not the batch spec is
@@ -191,6 +168,19 @@ type StepContext struct {
 	PreviousStep execution.AfterStepResult
 	// Repository is the Sourcegraph repository in which the steps are executed.
 	Repository Repository
+	// Event is the changeset hook event that triggered the steps. Empty when
+	// the steps are not executed as a hook.
+	Event HookEvent
+}
+
+// HookEvent describes the changeset hook event the steps of a hook are
+// executed for.
+type HookEvent struct {
+	// Name is the name of the event, e.g. "onCIFailure".
+	Name string
+	// Payload is the data attached to the event, such as the CI log or the
+	// conflicting files.
+	Payload string
 }
 
 // ToFuncMap returns a template.FuncMap to access fields on the StepContext in a
@@ -247,6 +237,12 @@ func (stepCtx *StepContext) ToFuncMap() template.FuncMap {
 				"description": stepCtx.BatchChange.Description,
 			}
 		},
+		"event": func() map[string]any {
+			return map[string]any{
+				"name":    stepCtx.Event.Name,
+				"payload": stepCtx.Event.Payload,
+			}
+		},
 	}
 }
 
@@ -0,0 +1,191 @@
+package batches
+
+import (
+	"sort"
+	"strconv"
+
+	yamlv3 "gopkg.in/yaml.v3"
+
+	"github.com/sourcegraph/sourcegraph/lib/batches/template"
+	"github.com/sourcegraph/sourcegraph/lib/errors"
+)
+
+// Batch specs can declare variables at the top level, so that batch specs
+// that only differ in a few values don't have to be copied:
+//
+//	variables:
+//	  go_version:
+//	    type: string
+//	    default: "1.22"
+//	    description: The Go version to upgrade to.
+//	  org:
+//	    description: The organization whose repositories are changed.
+//
+// Variables are set with the -var and -var-file flags of src batch, and are
+// available as ${{ vars.go_version }} everywhere in the batch spec, including
+// the on queries. Variables without a default are required.
+const variablesKey = "variables"
+
+// Variable is the declaration of a batch spec variable.
+type Variable struct {
+	Type        VariableType `json:"type,omitempty" yaml:"type"`
+	Default     any          `json:"default,omitempty" yaml:"default"`
+	Description string       `json:"description,omitempty" yaml:"description"`
+}
+
+// VariableType is the type of a batch spec variable.
+type VariableType string
+
+const (
+	VariableTypeString  VariableType = "string"
+	VariableTypeNumber  VariableType = "number"
+	VariableTypeBoolean VariableType = "boolean"
+)
+
+// parse converts the given value to the type.
+func (t VariableType) parse(value string) (any, error) {
+	switch t {
+	case "", VariableTypeString:
+		return value, nil
+	case VariableTypeNumber:
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i, nil
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, errors.Newf("%q isn't a number", value)
+		}
+		return f, nil
+	case VariableTypeBoolean:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.Newf("%q isn't a boolean", value)
+		}
+		return b, nil
+	}
+	return nil, errors.Newf("unknown type %q", t)
+}
+
+// ExpandVariables substitutes the variables declared by the batch spec in data
+// in all strings of the batch spec. values are the values of the variables,
+// as given on the command line; variables without a value use their default.
+// name is the name of the batch spec used in errors.
+//
+// The variables declarations are removed from the expanded batch spec, since
+// they're only used by src. If the batch spec doesn't declare any variables,
+// data is returned as is.
+func ExpandVariables(name string, data []byte, values map[string]string) ([]byte, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		// Leave reporting syntax errors to the schema validation.
+		return data, nil
+	}
+	expanded, err := expandVariables(name, &doc, values)
+	if err != nil || !expanded {
+		return data, err
+	}
+	return encodeBatchSpec(&doc)
+}
+
+// expandVariables expands the variables in the given document in place, and
+// returns whether the batch spec declares any.
+func expandVariables(name string, doc *yamlv3.Node, values map[string]string) (bool, error) {
+	var root *yamlv3.Node
+	if len(doc.Content) > 0 && doc.Content[0].Kind == yamlv3.MappingNode {
+		root = doc.Content[0]
+	}
+
+	decls := mappingValue(root, variablesKey)
+	if decls == nil {
+		if len(values) > 0 {
+			return false, errors.Newf("%s: unknown variable %q, the batch spec doesn't declare any variables", name, sortedKeys(values)[0])
+		}
+		return false, nil
+	}
+	if decls.Kind != yamlv3.MappingNode {
+		return false, errors.Newf("%s:%d: variables must be a mapping", name, decls.Line)
+	}
+
+	vars := map[string]any{}
+	var errs error
+	for i := 0; i < len(decls.Content); i += 2 {
+		key, decl := decls.Content[i], decls.Content[i+1]
+
+		v, err := resolveVariable(decl, key.Value, values)
+		if err != nil {
+			errs = errors.Append(errs, errors.Newf("%s:%d: variable %q: %s", name, key.Line, key.Value, err))
+			continue
+		}
+		vars[key.Value] = v
+	}
+	for _, v := range sortedKeys(values) {
+		if mappingValue(decls, v) == nil {
+			errs = errors.Append(errs, errors.Newf("%s: unknown variable %q", name, v))
+		}
+	}
+	if errs != nil {
+		return false, errs
+	}
+
+	render := func(tmpl string) (string, error) { return template.RenderVars(name, tmpl, vars) }
+	content := make([]*yamlv3.Node, 0, len(root.Content)-2)
+	for i := 0; i < len(root.Content); i += 2 {
+		if root.Content[i].Value == variablesKey {
+			continue
+		}
+		if err := renderStrings(name, root.Content[i+1], render); err != nil {
+			return false, err
+		}
+		content = append(content, root.Content[i], root.Content[i+1])
+	}
+	root.Content = content
+	return true, nil
+}
+
+// resolveVariable returns the value of the variable with the given
+// declaration: its value in values, or else its default.
+func resolveVariable(decl *yamlv3.Node, name string, values map[string]string) (any, error) {
+	if decl.Kind != yamlv3.MappingNode {
+		return nil, errors.New("declaration must be a mapping")
+	}
+	var typ VariableType
+	if t := mappingValue(decl, "type"); t != nil {
+		typ = VariableType(t.Value)
+	}
+
+	value, ok := values[name]
+	if !ok {
+		def := mappingValue(decl, "default")
+		if def == nil || def.Tag == "!!null" {
+			return nil, errors.Newf("no value given, set it with -var %s=VALUE", name)
+		}
+		if def.Kind != yamlv3.ScalarNode {
+			return nil, errors.New("default must be a string, number or boolean")
+		}
+		// The text of the default is used, so that a default of 1.20 for a
+		// string isn't turned into 1.2.
+		value = def.Value
+	}
+	return typ.parse(value)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ParseBatchSpecWithVariables expands the includes of the batch spec with
+// ExpandIncludes and its variables with ExpandVariables, and parses the
+// expanded batch spec, which is returned, too.
+func ParseBatchSpecWithVariables(name, dir string, data []byte, values map[string]string) (*BatchSpec, []byte, error) {
+	expanded, _, err := ExpandBatchSpec(name, dir, data, values)
+	if err != nil {
+		return nil, nil, err
+	}
+	spec, err := ParseBatchSpec(expanded)
+	return spec, expanded, err
+}